@@ -4,6 +4,7 @@ import (
 	"apubot/internal/app"
 	"apubot/internal/config"
 	"log"
+	_ "time/tzdata" // chat timezones must work on hosts without zoneinfo
 )
 
 func main() {
@@ -0,0 +1,415 @@
+package adminapi
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/service/image"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodySize limits request bodies, image metadata is small
+const maxBodySize = 64 << 10
+
+type Server struct {
+	log   logger.Logger
+	srv   *http.Server
+	token string
+	// imagesDir is folder images without TG ID are sent from
+	imagesDir string
+	image     image.ImageService
+}
+
+type (
+	imageResponse struct {
+		ID         int64    `json:"id"`
+		Name       string   `json:"name"`
+		TgID       string   `json:"tg_id,omitempty"`
+		Type       string   `json:"type"`
+		Rating     string   `json:"rating"`
+		Tags       []string `json:"tags,omitempty"`
+		ServeCount int64    `json:"serve_count"`
+		UploaderID int64    `json:"uploader_id,omitempty"`
+		UploadedAt int64    `json:"uploaded_at,omitempty"`
+		SourceURL  string   `json:"source_url,omitempty"`
+	}
+	addImageRequest struct {
+		Name   string   `json:"name"`
+		TgID   string   `json:"tg_id"`
+		Type   string   `json:"type"`
+		Rating string   `json:"rating"`
+		Tags   []string `json:"tags"`
+	}
+	tagsRequest struct {
+		Tags []string `json:"tags"`
+	}
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewServer creates library management API guarded by bearer token, returns nil if addr is empty
+func NewServer(addr string, token string, imagesDir string, log logger.Logger, imageService image.ImageService) *Server {
+	if addr == "" {
+		return nil
+	}
+
+	s := &Server{
+		log:       log,
+		token:     token,
+		imagesDir: imagesDir,
+		image:     imageService,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/images", s.listImages)
+	mux.HandleFunc("POST /api/images", s.addImage)
+	mux.HandleFunc("GET /api/images/{id}", s.getImage)
+	mux.HandleFunc("DELETE /api/images/{id}", s.deleteImage)
+	mux.HandleFunc("POST /api/images/{id}/tags", s.addTags)
+	mux.HandleFunc("DELETE /api/images/{id}/tags/{tag}", s.removeTag)
+	mux.HandleFunc("GET /api/tags", s.listTags)
+
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           s.authorize(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+func (s *Server) Start() {
+	go func() {
+		err := s.srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("Error serving admin API", "err", err)
+		}
+	}()
+
+	s.log.Info("Serving admin API", "addr", s.srv.Addr)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, http.StatusUnauthorized, "missing or invalid token")
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	files := s.image.List(r.Context())
+
+	images := make([]imageResponse, 0, len(files))
+	for _, file := range files {
+		images = append(images, newImageResponse(file, nil))
+	}
+
+	s.writeJSON(w, http.StatusOK, images)
+}
+
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.imageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeImage(w, r, http.StatusOK, file)
+}
+
+func (s *Server) addImage(w http.ResponseWriter, r *http.Request) {
+	var req addImageRequest
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Name == "" {
+		s.writeError(w, http.StatusBadRequest, "name is required")
+
+		return
+	}
+
+	// name is joined with images folder, so it must not point outside of it
+	if filepath.Base(req.Name) != req.Name || req.Name == "." || req.Name == ".." {
+		s.writeError(w, http.StatusBadRequest, "name must be a file name without folders")
+
+		return
+	}
+
+	if req.Rating != "" && req.Rating != domain.RatingSFW && req.Rating != domain.RatingNSFW {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("rating must be %q or %q", domain.RatingSFW, domain.RatingNSFW))
+
+		return
+	}
+
+	if req.Type != "" && req.Type != domain.TypePhoto && req.Type != domain.TypeAnimation {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("type must be %q or %q", domain.TypePhoto, domain.TypeAnimation))
+
+		return
+	}
+
+	tags, ok := s.parseTags(w, req.Tags)
+	if !ok {
+		return
+	}
+
+	for _, file := range s.image.List(r.Context()) {
+		if file.Name == req.Name {
+			s.writeError(w, http.StatusConflict, fmt.Sprintf("image %s already exists with ID %d", file.Name, file.ID))
+
+			return
+		}
+	}
+
+	// image without TG ID can be sent only from file in images folder
+	if req.TgID == "" && !s.hasImageFile(w, req.Name) {
+		return
+	}
+
+	if req.Rating == "" {
+		req.Rating = domain.RatingSFW
+	}
+
+	if req.Type == "" {
+		req.Type = domain.TypeByName(req.Name)
+	}
+
+	file, err := s.image.AddImage(r.Context(), domain.File{
+		Name:   req.Name,
+		TgID:   req.TgID,
+		Type:   req.Type,
+		Rating: req.Rating,
+	}, tags)
+	if err != nil {
+		s.log.Error("Error adding image via API", "name", req.Name, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not add image")
+
+		return
+	}
+
+	s.log.Info("Image added via API", "image_id", file.ID, "name", file.Name)
+	s.writeImage(w, r, http.StatusCreated, file)
+}
+
+// hasImageFile reports whether file exists in images folder, error response is written otherwise
+func (s *Server) hasImageFile(w http.ResponseWriter, name string) bool {
+	info, err := os.Stat(filepath.Join(s.imagesDir, name))
+	if errors.Is(err, os.ErrNotExist) || err == nil && !info.Mode().IsRegular() {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("tg_id is required unless %s exists in images folder", name))
+
+		return false
+	}
+
+	if err != nil {
+		s.log.Error("Error checking image file", "name", name, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not check image file")
+
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.imageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.image.DeleteImage(r.Context(), file)
+	if err != nil {
+		s.log.Error("Error deleting image via API", "image_id", file.ID, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not delete image")
+
+		return
+	}
+
+	s.log.Info("Image deleted via API", "image_id", file.ID, "name", file.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addTags(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.imageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req tagsRequest
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	tags, ok := s.parseTags(w, req.Tags)
+	if !ok {
+		return
+	}
+
+	err := s.image.AddTags(r.Context(), file, tags)
+	if err != nil {
+		s.log.Error("Error adding tags via API", "image_id", file.ID, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not add tags")
+
+		return
+	}
+
+	s.writeImage(w, r, http.StatusOK, file)
+}
+
+func (s *Server) removeTag(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.imageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tag, valid := domain.NormalizeTag(r.PathValue("tag"))
+	if !valid {
+		s.writeError(w, http.StatusBadRequest, "invalid tag")
+
+		return
+	}
+
+	err := s.image.RemoveTag(r.Context(), file, tag)
+	if err != nil {
+		s.log.Error("Error removing tag via API", "image_id", file.ID, "tag", tag, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not remove tag")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.image.GetAllTags(r.Context())
+	if err != nil {
+		s.log.Error("Error listing tags via API", "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not get tags")
+
+		return
+	}
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	s.writeJSON(w, http.StatusOK, tagsRequest{Tags: tags})
+}
+
+// imageFromPath finds image by {id} path value, error response is written if it fails
+func (s *Server) imageFromPath(w http.ResponseWriter, r *http.Request) (domain.File, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "image ID must be a number")
+
+		return domain.File{}, false
+	}
+
+	file, err := s.image.GetByID(r.Context(), id)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("image %d not found", id))
+
+			return domain.File{}, false
+		}
+
+		s.log.Error("Error getting image via API", "image_id", id, "err", err)
+		s.writeError(w, http.StatusInternalServerError, "can not get image")
+
+		return domain.File{}, false
+	}
+
+	return file, true
+}
+
+// parseTags validates tags from request, at least one is required
+func (s *Server) parseTags(w http.ResponseWriter, raw []string) ([]string, bool) {
+	tags, invalid := domain.NormalizeTags(strings.Join(raw, " "))
+	if len(invalid) > 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid tags: "+strings.Join(invalid, ", "))
+
+		return nil, false
+	}
+
+	if len(tags) == 0 {
+		s.writeError(w, http.StatusBadRequest, "at least one tag is required")
+
+		return nil, false
+	}
+
+	return tags, true
+}
+
+func (s *Server) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+
+		return false
+	}
+
+	return true
+}
+
+// writeImage responds with image and its current tags
+func (s *Server) writeImage(w http.ResponseWriter, r *http.Request, status int, file domain.File) {
+	tags, err := s.image.GetTags(r.Context(), file)
+	if err != nil {
+		s.log.Warn("Error getting image tags via API", "image_id", file.ID, "err", err)
+	}
+
+	s.writeJSON(w, status, newImageResponse(file, tags))
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	s.writeJSON(w, status, errorResponse{Error: message})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.log.Warn("Error writing API response", "err", err)
+	}
+}
+
+func newImageResponse(file domain.File, tags []string) imageResponse {
+	return imageResponse{
+		ID:         file.ID,
+		Name:       file.Name,
+		TgID:       file.TgID,
+		Type:       file.Type,
+		Rating:     file.Rating,
+		Tags:       tags,
+		ServeCount: file.ServeCount,
+		UploaderID: file.UploaderID,
+		UploadedAt: file.UploadedAt,
+		SourceURL:  file.SourceURL,
+	}
+}
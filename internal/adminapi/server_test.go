@@ -0,0 +1,441 @@
+package adminapi
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository"
+	"apubot/internal/service"
+	"apubot/internal/testutil"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret-token"
+
+// newTestServer starts API using real image service with empty db
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	cfg, err := config.NewConfig("../../config")
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	cfg.IsDebug = false
+	cfg.ImagesDirPath = t.TempDir()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := database.New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+
+	services := service.New(&service.InitParams{
+		Config:       cfg,
+		Logger:       log,
+		Repositories: repository.New(&repository.InitParams{Config: cfg, DB: db}),
+	})
+
+	s := NewServer("127.0.0.1:0", testToken, cfg.ImagesDirPath, log, services.Image)
+	api := httptest.NewServer(s.srv.Handler)
+
+	t.Cleanup(func() {
+		api.Close()
+		_ = services.Subscription.Stop(context.Background())
+		_ = db.Close()
+	})
+
+	return s, api
+}
+
+// call sends request with token and decodes JSON response into out unless it is nil
+func call(t *testing.T, api *httptest.Server, token string, method string, path string, body string, out any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("can not create request: %v", err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := api.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s returned content type %q, want JSON", method, path, ct)
+		}
+
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// endpoints lists every API route with valid request to it
+var endpoints = []struct {
+	method string
+	path   string
+	body   string
+}{
+	{http.MethodGet, "/api/images", ""},
+	{http.MethodPost, "/api/images", `{"name": "dog.jpg", "tg_id": "tg-dog", "tags": ["dog"]}`},
+	{http.MethodGet, "/api/images/1", ""},
+	{http.MethodDelete, "/api/images/1", ""},
+	{http.MethodPost, "/api/images/1/tags", `{"tags": ["happy"]}`},
+	{http.MethodDelete, "/api/images/1/tags/cat", ""},
+	{http.MethodGet, "/api/tags", ""},
+}
+
+func TestEndpointsRequireToken(t *testing.T) {
+	tokens := []struct {
+		name   string
+		header string
+	}{
+		{"no token", ""},
+		{"wrong token", "Bearer wrong-token"},
+		{"token prefix", "Bearer secret"},
+		{"not bearer", "Basic " + testToken},
+	}
+
+	for _, e := range endpoints {
+		for _, tt := range tokens {
+			t.Run(e.method+" "+e.path+" "+tt.name, func(t *testing.T) {
+				s, api := newTestServer(t)
+				testutil.AddImage(t, s.image, "cat.jpg", "cat")
+				testutil.AddImage(t, s.image, "other.jpg")
+
+				req, err := http.NewRequest(e.method, api.URL+e.path, strings.NewReader(e.body))
+				if err != nil {
+					t.Fatalf("can not create request: %v", err)
+				}
+
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+
+				resp, err := api.Client().Do(req)
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusUnauthorized {
+					t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+				}
+
+				if resp.Header.Get("WWW-Authenticate") != "Bearer" {
+					t.Error("response does not ask for bearer token")
+				}
+
+				var body errorResponse
+				if err = json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error != "missing or invalid token" {
+					t.Errorf("got error %+v, %v, want JSON error", body, err)
+				}
+
+				// nothing is changed by unauthorized requests
+				if files := s.image.List(context.Background()); len(files) != 2 {
+					t.Errorf("library has %d images, want 2", len(files))
+				}
+
+				tags, err := s.image.GetTags(context.Background(), domain.File{ID: 1, Name: "cat.jpg"})
+				if err != nil || !slices.Equal(tags, []string{"cat"}) {
+					t.Errorf("image has tags %q, %v, want only cat", tags, err)
+				}
+			})
+		}
+	}
+}
+
+func TestEndpointsWithToken(t *testing.T) {
+	want := []int{
+		http.StatusOK,
+		http.StatusCreated,
+		http.StatusOK,
+		http.StatusNoContent,
+		http.StatusOK,
+		http.StatusNoContent,
+		http.StatusOK,
+	}
+
+	for i, e := range endpoints {
+		t.Run(e.method+" "+e.path, func(t *testing.T) {
+			s, api := newTestServer(t)
+			testutil.AddImage(t, s.image, "cat.jpg", "cat")
+			testutil.AddImage(t, s.image, "other.jpg")
+
+			if got := call(t, api, testToken, e.method, e.path, e.body, nil); got != want[i] {
+				t.Errorf("got status %d, want %d", got, want[i])
+			}
+		})
+	}
+}
+
+func TestImageLifecycle(t *testing.T) {
+	s, api := newTestServer(t)
+	testutil.AddImage(t, s.image, "cat.jpg", "cat")
+
+	var added imageResponse
+	status := call(t, api, testToken, http.MethodPost, "/api/images",
+		`{"name": "dog.gif", "tg_id": "tg-dog", "rating": "nsfw", "tags": ["Dog", "happy"]}`, &added)
+	if status != http.StatusCreated {
+		t.Fatalf("add returned status %d, want %d", status, http.StatusCreated)
+	}
+
+	if added.ID != 2 || added.Type != domain.TypeAnimation || added.Rating != domain.RatingNSFW ||
+		!slices.Equal(added.Tags, []string{"dog", "happy"}) {
+		t.Errorf("added %+v, want nsfw animation with normalized tags", added)
+	}
+
+	var images []imageResponse
+	if status = call(t, api, testToken, http.MethodGet, "/api/images", "", &images); status != http.StatusOK {
+		t.Fatalf("list returned status %d", status)
+	}
+
+	if len(images) != 2 || images[0].Name != "cat.jpg" || images[1].Name != "dog.gif" {
+		t.Errorf("listed %+v, want cat and dog", images)
+	}
+
+	var got imageResponse
+	call(t, api, testToken, http.MethodPost, "/api/images/2/tags", `{"tags": ["sad", "happy"]}`, &got)
+
+	slices.Sort(got.Tags)
+	if !slices.Equal(got.Tags, []string{"dog", "happy", "sad"}) {
+		t.Errorf("tags after adding are %q, want dog, happy and sad", got.Tags)
+	}
+
+	if status = call(t, api, testToken, http.MethodDelete, "/api/images/2/tags/Happy", "", nil); status != http.StatusNoContent {
+		t.Errorf("tag removal returned status %d", status)
+	}
+
+	got = imageResponse{}
+	call(t, api, testToken, http.MethodGet, "/api/images/2", "", &got)
+
+	slices.Sort(got.Tags)
+	if !slices.Equal(got.Tags, []string{"dog", "sad"}) {
+		t.Errorf("tags after removal are %q, want dog and sad", got.Tags)
+	}
+
+	var tags tagsRequest
+	call(t, api, testToken, http.MethodGet, "/api/tags", "", &tags)
+
+	slices.Sort(tags.Tags)
+	if !slices.Equal(tags.Tags, []string{"cat", "dog", "sad"}) {
+		t.Errorf("all tags are %q, want cat, dog and sad", tags.Tags)
+	}
+
+	if status = call(t, api, testToken, http.MethodDelete, "/api/images/2", "", nil); status != http.StatusNoContent {
+		t.Errorf("delete returned status %d", status)
+	}
+
+	var apiErr errorResponse
+	if status = call(t, api, testToken, http.MethodGet, "/api/images/2", "", &apiErr); status != http.StatusNotFound {
+		t.Errorf("deleted image returned status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAddImageFromImagesFolder(t *testing.T) {
+	s, api := newTestServer(t)
+
+	if err := os.WriteFile(filepath.Join(s.imagesDir, "dog.jpg"), []byte("jpeg"), 0o644); err != nil {
+		t.Fatalf("can not write image: %v", err)
+	}
+
+	var added imageResponse
+	status := call(t, api, testToken, http.MethodPost, "/api/images", `{"name": "dog.jpg", "tags": ["dog"]}`, &added)
+	if status != http.StatusCreated {
+		t.Fatalf("add returned status %d, want %d", status, http.StatusCreated)
+	}
+
+	if added.Name != "dog.jpg" || added.TgID != "" || added.Type != domain.TypePhoto {
+		t.Errorf("added %+v, want photo sent from images folder", added)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		err    string
+	}{
+		{
+			name:   "id is not a number",
+			method: http.MethodGet,
+			path:   "/api/images/cat",
+			status: http.StatusBadRequest,
+			err:    "image ID must be a number",
+		},
+		{
+			name:   "unknown image",
+			method: http.MethodDelete,
+			path:   "/api/images/42",
+			status: http.StatusNotFound,
+			err:    "image 42 not found",
+		},
+		{
+			name:   "invalid JSON",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": `,
+			status: http.StatusBadRequest,
+			err:    "invalid JSON body: unexpected EOF",
+		},
+		{
+			name:   "unknown field",
+			method: http.MethodPost,
+			path:   "/api/images/1/tags",
+			body:   `{"tag": "happy"}`,
+			status: http.StatusBadRequest,
+			err:    `invalid JSON body: json: unknown field "tag"`,
+		},
+		{
+			name:   "no name",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "name is required",
+		},
+		{
+			name:   "name with folder",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "../dog.jpg", "tg_id": "tg-dog", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "name must be a file name without folders",
+		},
+		{
+			name:   "absolute path",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "/etc/passwd", "tg_id": "tg-dog", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "name must be a file name without folders",
+		},
+		{
+			name:   "parent folder",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "..", "tg_id": "tg-dog", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "name must be a file name without folders",
+		},
+		{
+			name:   "no tg id and no file",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "dog.jpg", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "tg_id is required unless dog.jpg exists in images folder",
+		},
+		{
+			name:   "no tg id and folder with the name",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "folder", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    "tg_id is required unless folder exists in images folder",
+		},
+		{
+			name:   "invalid rating",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "dog.jpg", "rating": "spicy", "tags": ["dog"]}`,
+			status: http.StatusBadRequest,
+			err:    `rating must be "sfw" or "nsfw"`,
+		},
+		{
+			name:   "no tags",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "dog.jpg"}`,
+			status: http.StatusBadRequest,
+			err:    "at least one tag is required",
+		},
+		{
+			name:   "invalid tags",
+			method: http.MethodPost,
+			path:   "/api/images/1/tags",
+			body:   `{"tags": ["happy", "c@t"]}`,
+			status: http.StatusBadRequest,
+			err:    "invalid tags: c@t",
+		},
+		{
+			name:   "duplicate name",
+			method: http.MethodPost,
+			path:   "/api/images",
+			body:   `{"name": "cat.jpg", "tags": ["cat"]}`,
+			status: http.StatusConflict,
+			err:    "image cat.jpg already exists with ID 1",
+		},
+		{
+			name:   "invalid tag in path",
+			method: http.MethodDelete,
+			path:   "/api/images/1/tags/c@t",
+			status: http.StatusBadRequest,
+			err:    "invalid tag",
+		},
+		{
+			name:   "last image",
+			method: http.MethodDelete,
+			path:   "/api/images/1",
+			status: http.StatusInternalServerError,
+			err:    "can not delete image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, api := newTestServer(t)
+			testutil.AddImage(t, s.image, "cat.jpg", "cat")
+
+			if err := os.Mkdir(filepath.Join(s.imagesDir, "folder"), 0o755); err != nil {
+				t.Fatalf("can not create folder: %v", err)
+			}
+
+			var got errorResponse
+			if status := call(t, api, testToken, tt.method, tt.path, tt.body, &got); status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+
+			if got.Error != tt.err {
+				t.Errorf("got error %q, want %q", got.Error, tt.err)
+			}
+
+			if files := s.image.List(context.Background()); len(files) != 1 {
+				t.Errorf("library has %d images, want only cat", len(files))
+			}
+		})
+	}
+}
+
+func TestNewServerIsDisabledWithoutAddr(t *testing.T) {
+	if s := NewServer("", testToken, "", slog.New(slog.NewTextHandler(io.Discard, nil)), nil); s != nil {
+		t.Error("server created without address")
+	}
+}
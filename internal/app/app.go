@@ -1,32 +1,69 @@
 package app
 
 import (
+	"apubot/internal/adminapi"
 	"apubot/internal/config"
 	"apubot/internal/handler"
+	"apubot/internal/health"
 	"apubot/internal/infrastructure/database"
 	"apubot/internal/infrastructure/repository"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/metrics"
 	"apubot/internal/server"
 	"apubot/internal/service"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/breaker"
+	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 type App struct {
-	cfg    *config.Config
-	server *server.Server
+	cfg      *config.Config
+	log      logger.Logger
+	db       *database.DB
+	server   *server.Server
+	metrics  *metrics.Server
+	health   *health.Server
+	adminAPI *adminapi.Server
 }
 
 func New(cfg *config.Config) *App {
-	bot, err := tgbotapi.NewBotAPI(cfg.ApiKey)
+	err := cfg.Validate()
 	if err != nil {
-		log.Fatalf("Error creating bot: %v", err)
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	bot.Debug = cfg.IsDebug
+	appLogger, err := logger.New(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Error creating logger: %v", err)
+	}
 
-	db, err := database.New(cfg)
+	// long polling requests are held open by Telegram, so they get poll timeout on top of request timeout
+	client := &http.Client{Timeout: cfg.PollTimeout + cfg.RequestTimeout}
+
+	api, err := withStartupRetry(cfg, appLogger, "bot", func() (*tgbotapi.BotAPI, error) {
+		return tgbotapi.NewBotAPIWithClient(cfg.ApiKey, tgbotapi.APIEndpoint, client)
+	})
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		appLogger.Error("Error creating bot", "err", err)
+		os.Exit(1)
+	}
+
+	api.Debug = cfg.IsDebug
+
+	bot := telegram.New(cfg, api)
+
+	db, err := withStartupRetry(cfg, appLogger, "database", func() (*database.DB, error) {
+		return database.New(cfg, appLogger)
+	})
+	if err != nil {
+		appLogger.Error("Error connecting to database", "err", err)
+		os.Exit(1)
 	}
 
 	repos := repository.New(
@@ -39,6 +76,7 @@ func New(cfg *config.Config) *App {
 	services := service.New(
 		&service.InitParams{
 			Config:       cfg,
+			Logger:       appLogger,
 			Repositories: repos,
 		},
 	)
@@ -46,6 +84,7 @@ func New(cfg *config.Config) *App {
 	handlers := handler.New(
 		&handler.InitParams{
 			Config:   cfg,
+			Logger:   appLogger,
 			Bot:      bot,
 			Services: services,
 		},
@@ -54,17 +93,133 @@ func New(cfg *config.Config) *App {
 	s := server.New(
 		&server.InitParams{
 			Config:   cfg,
+			Logger:   appLogger,
 			Bot:      bot,
 			Handlers: handlers,
+			Services: services,
+			DBUnavailable: func() bool {
+				return db.BreakerState() == breaker.Open
+			},
 		},
 	)
 
+	checks := map[string]health.Check{
+		"database": func(ctx context.Context) error {
+			// ping bypasses breaker, so db is not reported ready while queries are rejected
+			if db.BreakerState() == breaker.Open {
+				return database.ErrUnavailable
+			}
+
+			return db.Ping(ctx)
+		},
+		"telegram": func(ctx context.Context) error {
+			_, err := bot.GetMe()
+
+			return err
+		},
+	}
+
+	status := map[string]health.Status{
+		"database_breaker": func() string {
+			return db.BreakerState().String()
+		},
+	}
+
 	return &App{
-		cfg:    cfg,
-		server: s,
+		cfg:     cfg,
+		log:     appLogger,
+		db:      db,
+		server:  s,
+		metrics: metrics.NewServer(cfg.MetricsAddr, appLogger),
+		health:  health.NewServer(cfg.HealthAddr, appLogger, s.IsRunning, checks, status),
+
+		adminAPI: adminapi.NewServer(cfg.AdminAPIAddr, cfg.AdminAPIToken, cfg.ImagesDirPath, appLogger, services.Image),
 	}
 }
 
 func (a *App) Run() {
+	if a.metrics != nil {
+		a.metrics.Start()
+	}
+
+	if a.health != nil {
+		a.health.Start()
+	}
+
+	if a.adminAPI != nil {
+		a.adminAPI.Start()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go a.watchReload(hup)
+
 	a.server.Start()
+
+	if a.adminAPI != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+		defer cancel()
+
+		err := a.adminAPI.Stop(ctx)
+		if err != nil {
+			a.log.Error("Error stopping admin API server", "err", err)
+		}
+	}
+
+	if a.health != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+		defer cancel()
+
+		err := a.health.Stop(ctx)
+		if err != nil {
+			a.log.Error("Error stopping health server", "err", err)
+		}
+	}
+
+	if a.metrics != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+		defer cancel()
+
+		err := a.metrics.Stop(ctx)
+		if err != nil {
+			a.log.Error("Error stopping metrics server", "err", err)
+		}
+	}
+
+	if !a.server.Drained() {
+		// closing db would make queries of handlers and deliveries still running fail
+		a.log.Warn("Handlers are still running, database is left open")
+
+		return
+	}
+
+	err := a.db.Close()
+	if err != nil {
+		a.log.Error("Error closing database", "err", err)
+	}
+}
+
+// watchReload reloads config on SIGHUP
+func (a *App) watchReload(hup <-chan os.Signal) {
+	for range hup {
+		ignored, err := a.cfg.Reload()
+		if err != nil {
+			a.log.Error("Error reloading config, keeping current one", "err", err)
+
+			continue
+		}
+
+		err = logger.SetLevel(a.cfg.Level())
+		if err != nil {
+			a.log.Error("Error changing log level", "err", err)
+		}
+
+		if len(ignored) > 0 {
+			a.log.Warn("Changed fields require restart and were not applied", "fields", ignored)
+		}
+
+		a.log.Info("Config reloaded")
+	}
 }
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"apubot/internal/config"
+	"apubot/pkg/logger"
+	"time"
+)
+
+// withStartupRetry calls create until it succeeds or startup_retries are used up, delay doubles after each failure,
+// so brief outage of Telegram or db at container start does not crash the bot at once
+func withStartupRetry[T any](cfg *config.Config, log logger.Logger, name string, create func() (T, error)) (T, error) {
+	delay := cfg.StartupRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		result, err := create()
+		if err == nil || attempt > cfg.StartupRetries {
+			return result, err
+		}
+
+		log.Warn(
+			"Startup attempt failed, retrying",
+			"component", name, "attempt", attempt, "max_attempts", cfg.StartupRetries+1, "retry_in", delay, "err", err,
+		)
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
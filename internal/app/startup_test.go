@@ -0,0 +1,81 @@
+package app
+
+import (
+	"apubot/internal/config"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestWithStartupRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "first attempt succeeds", retries: 3, failures: 0, wantAttempts: 1},
+		{name: "succeeds after failures", retries: 3, failures: 2, wantAttempts: 3},
+		{name: "retries used up", retries: 2, failures: 10, wantAttempts: 3, wantErr: true},
+		{name: "retries disabled", retries: 0, failures: 1, wantAttempts: 1, wantErr: true},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{StartupRetries: tt.retries, StartupRetryDelay: time.Millisecond}
+
+			attempts := 0
+			got, err := withStartupRetry(cfg, log, "test", func() (int, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return 0, errors.New("connection refused")
+				}
+
+				return 42, nil
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("error of last attempt was not returned")
+				}
+
+				return
+			}
+
+			if err != nil || got != 42 {
+				t.Errorf("got %d, %v, want 42 without error", got, err)
+			}
+		})
+	}
+}
+
+func TestWithStartupRetryDoublesDelay(t *testing.T) {
+	cfg := &config.Config{StartupRetries: 3, StartupRetryDelay: 10 * time.Millisecond}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var calls []time.Time
+	_, _ = withStartupRetry(cfg, log, "test", func() (struct{}, error) {
+		calls = append(calls, time.Now())
+
+		return struct{}{}, errors.New("connection refused")
+	})
+
+	if len(calls) != 4 {
+		t.Fatalf("got %d attempts, want 4", len(calls))
+	}
+
+	for i, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		if got := calls[i+1].Sub(calls[i]); got < want {
+			t.Errorf("delay before attempt %d = %s, want at least %s", i+2, got, want)
+		}
+	}
+}
@@ -1,8 +1,15 @@
 package config
 
 import (
+	stdErrors "errors"
+	"io/fs"
+	"log/slog"
+	"net/url"
 	"os"
 	"path"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -13,34 +20,257 @@ import (
 const (
 	DefaultCommandCooldown         = time.Second * 5
 	DefaultRequestTimeout          = time.Second * 5
-	DefaultLastSentQueueSize       = 10
+	DefaultNoRepeatWindow          = 10
+	DefaultHistorySize             = 20
+	DefaultImageCacheSize          = 256
+	DefaultMaxPhotoBytes           = 10 << 20
+	DefaultMaxAnimationBytes       = 50 << 20
+	DefaultMaxPhotoDimensions      = 10000
+	DefaultImportConcurrency       = 4
+	DefaultImportTimeout           = time.Second * 30
+	DefaultImageRestoreWindow      = 24 * time.Hour
+	DefaultMaxBatchSize            = 5
+	DefaultMaxTopImages            = 10
+	DefaultListPageSize            = 10
 	DefaultMaxRetries              = 3
 	DefaultMinSubscriptionInterval = time.Minute * 15
+	DefaultSubJitter               = time.Second * 30
 	DefaultMaxSubscriptionInterval = time.Hour * 24
+	DefaultMaxSubsPerChat          = 5
+	DefaultMinRemindDelay          = time.Minute
+	DefaultMaxRemindDelay          = time.Hour * 24 * 7
+	DefaultCooldownScope           = CooldownScopeUser
+	DefaultLogLevel                = "info"
+	DefaultGroupFallbackMessage    = "I can only handle listed commands in this chat!"
+	DefaultDailyTimezone           = "UTC"
+	DefaultShutdownTimeout         = time.Second * 10
+	DefaultStartupRetries          = 5
+	DefaultStartupRetryDelay       = time.Second * 2
+	DefaultWebhookListenAddr       = ":8443"
+	DefaultSendMaxRetries          = 3
+	DefaultSendRetryBaseDelay      = time.Second
+	DefaultWorkerCount             = 10
+	DefaultWorkerQueueSize         = 100
+	DefaultSendRateLimit           = 30
+	DefaultChatSendRateLimit       = 1
+	DefaultChatSendBurst           = 3
+	DefaultImageSource             = ImageSourceDB
+	DefaultSelectionStrategy       = SelectionRandom
+	DefaultQuietHoursMode          = QuietHoursSkip
+	DefaultDBMaxOpenConns          = 10
+	DefaultDBMaxIdleConns          = 5
+	DefaultDBConnMaxLifetime       = time.Minute * 30
+	DefaultDBHealthCheckInterval   = time.Second * 30
+	DefaultDBBreakerThreshold      = 5
+	DefaultDBBreakerCooldown       = time.Second * 30
+	DefaultSlowQueryThreshold      = time.Millisecond * 200
+	DefaultLogDedupWindow          = time.Minute
+	DefaultFeedbackCooldown        = time.Minute
+	DefaultNextButtonCooldown      = time.Second * 3
+	DefaultMinChatCooldown         = time.Second
+	DefaultMaxChatCooldown         = time.Hour
+	DefaultPollTimeout             = time.Minute
+	DefaultUpdateBufferSize        = 100
 )
 
+// DefaultAllowedUpdates are update types bot handles, other ones are not delivered by Telegram
+var DefaultAllowedUpdates = []string{"message", "callback_query", "inline_query", "my_chat_member"}
+
+// knownUpdateTypes are update types supported by Telegram
+var knownUpdateTypes = []string{
+	"message", "edited_message", "channel_post", "edited_channel_post", "inline_query", "chosen_inline_result",
+	"callback_query", "shipping_query", "pre_checkout_query", "poll", "poll_answer", "my_chat_member",
+	"chat_member", "chat_join_request",
+}
+
+const (
+	CooldownScopeChat = "chat"
+	CooldownScopeUser = "user"
+)
+
+const (
+	ImageSourceDB  = "db"
+	ImageSourceDir = "dir"
+)
+
+// error kinds are keys of error_messages replacing default replies to errors of the kind
+const (
+	ErrorNoImages    = "no_images"
+	ErrorTimeout     = "timeout"
+	ErrorUnavailable = "unavailable"
+	ErrorRateLimited = "rate_limited"
+	ErrorNotFound    = "not_found"
+	ErrorUnknown     = "unknown"
+)
+
+var ErrorKinds = []string{ErrorNoImages, ErrorTimeout, ErrorUnavailable, ErrorRateLimited, ErrorNotFound, ErrorUnknown}
+
+const (
+	SelectionRandom      = "random"
+	SelectionLeastRecent = "least_recent"
+	SelectionWeightedTag = "weighted_tag"
+)
+
+const (
+	QuietHoursSkip  = "skip"
+	QuietHoursQueue = "queue"
+)
+
+const minAdminAPITokenLength = 16
+
+// WelcomeImageRandom as welcome_image_id makes /start send random picture
+const WelcomeImageRandom = "random"
+
 type Config struct {
-	IsDebug                 bool          `yaml:"is_debug"`
-	ApiKey                  string        `yaml:"api_key"`
-	DBPath                  string        `yaml:"db_path"`
-	CommandCooldown         time.Duration `yaml:"command_cooldown"`
-	ImagesDirPath           string        `yaml:"images_dir_path"`
-	RequestTimeout          time.Duration `yaml:"request_timeout"`
-	LastSentQueueSize       int           `yaml:"last_sent_queue_size"`
-	MaxRetries              int           `yaml:"max_retries"`
-	MinSubscriptionInterval time.Duration `yaml:"min_subscription_interval"`
-	MaxSubscriptionInterval time.Duration `yaml:"max_subscription_interval"`
+	IsDebug                 bool                     `yaml:"is_debug"`
+	LogLevel                string                   `yaml:"log_level"`
+	LogDedupWindow          time.Duration            `yaml:"log_dedup_window"`
+	ApiKey                  string                   `yaml:"api_key"`
+	DBPath                  string                   `yaml:"db_path"`
+	DBMaxOpenConns          int                      `yaml:"db_max_open_conns"`
+	DBMaxIdleConns          int                      `yaml:"db_max_idle_conns"`
+	DBConnMaxLifetime       time.Duration            `yaml:"db_conn_max_lifetime"`
+	DBHealthCheckInterval   time.Duration            `yaml:"db_health_check_interval"`
+	DBBreakerThreshold      int                      `yaml:"db_breaker_threshold"`
+	DBBreakerCooldown       time.Duration            `yaml:"db_breaker_cooldown"`
+	SlowQueryThreshold      time.Duration            `yaml:"slow_query_threshold"`
+	CommandCooldown         time.Duration            `yaml:"command_cooldown"`
+	MinChatCooldown         time.Duration            `yaml:"min_chat_cooldown"`
+	MaxChatCooldown         time.Duration            `yaml:"max_chat_cooldown"`
+	CooldownScope           string                   `yaml:"cooldown_scope"`
+	CommandCooldowns        map[string]time.Duration `yaml:"command_cooldowns"`
+	Aliases                 map[string]string        `yaml:"aliases"`
+	ImagesDirPath           string                   `yaml:"images_dir_path"`
+	ImageSource             string                   `yaml:"image_source"`
+	SourceChannelID         int64                    `yaml:"source_channel_id"`
+	SelectionStrategy       string                   `yaml:"selection_strategy"`
+	QuietHoursMode          string                   `yaml:"quiet_hours_mode"`
+	ImageRescanInterval     time.Duration            `yaml:"image_rescan_interval"`
+	RequestTimeout          time.Duration            `yaml:"request_timeout"`
+	NoRepeatWindow          int                      `yaml:"no_repeat_window"`
+	HistorySize             int                      `yaml:"history_size"`
+	ImageCacheSize          int                      `yaml:"image_cache_size"`
+	MaxPhotoBytes           int64                    `yaml:"max_photo_bytes"`
+	MaxAnimationBytes       int64                    `yaml:"max_animation_bytes"`
+	MaxPhotoDimensions      int                      `yaml:"max_photo_dimensions"`
+	ImportConcurrency       int                      `yaml:"import_concurrency"`
+	ImportTimeout           time.Duration            `yaml:"import_timeout"`
+	ImageRestoreWindow      time.Duration            `yaml:"image_restore_window"`
+	PurgeDeletedFiles       bool                     `yaml:"purge_deleted_files"`
+	MaxBatchSize            int                      `yaml:"max_batch_size"`
+	MaxTopImages            int                      `yaml:"max_top_images"`
+	ListPageSize            int                      `yaml:"list_page_size"`
+	ShowImageCaptions       bool                     `yaml:"show_image_captions"`
+	ShowUploadAction        bool                     `yaml:"show_upload_action"`
+	ReplyToTrigger          bool                     `yaml:"reply_to_trigger"`
+	MaxRetries              int                      `yaml:"max_retries"`
+	MinSubscriptionInterval time.Duration            `yaml:"min_subscription_interval"`
+	SubJitter               time.Duration            `yaml:"sub_jitter"`
+	MaxSubscriptionInterval time.Duration            `yaml:"max_subscription_interval"`
+	MaxSubsPerChat          int                      `yaml:"max_subs_per_chat"`
+	MinRemindDelay          time.Duration            `yaml:"min_remind_delay"`
+	MaxRemindDelay          time.Duration            `yaml:"max_remind_delay"`
+	ShutdownTimeout         time.Duration            `yaml:"shutdown_timeout"`
+	StartupRetries          int                      `yaml:"startup_retries"`
+	StartupRetryDelay       time.Duration            `yaml:"startup_retry_delay"`
+	WebhookURL              string                   `yaml:"webhook_url"`
+	WebhookListenAddr       string                   `yaml:"webhook_listen_addr"`
+	PollTimeout             time.Duration            `yaml:"poll_timeout"`
+	UpdateBufferSize        int                      `yaml:"update_buffer_size"`
+	AllowedUpdates          []string                 `yaml:"allowed_updates"`
+	MetricsAddr             string                   `yaml:"metrics_addr"`
+	HealthAddr              string                   `yaml:"health_addr"`
+	AdminAPIAddr            string                   `yaml:"admin_api_addr"`
+	AdminAPIToken           string                   `yaml:"admin_api_token"`
+	SendMaxRetries          int                      `yaml:"send_max_retries"`
+	SendRetryBaseDelay      time.Duration            `yaml:"send_retry_base_delay"`
+	SendRateLimit           float64                  `yaml:"send_rate_limit"`
+	ChatSendRateLimit       float64                  `yaml:"chat_send_rate_limit"`
+	ChatSendBurst           int                      `yaml:"chat_send_burst"`
+	AdminIDs                []int64                  `yaml:"admin_ids"`
+	CooldownExemptIDs       []int64                  `yaml:"cooldown_exempt_ids"`
+	FeedbackCooldown        time.Duration            `yaml:"feedback_cooldown"`
+	NextButtonCooldown      time.Duration            `yaml:"next_button_cooldown"`
+	NotifyAdminsOnPanic     bool                     `yaml:"notify_admins_on_panic"`
+	GroupFallbackMessage    string                   `yaml:"group_fallback_message"`
+	PrivateFallbackMessage  string                   `yaml:"private_fallback_message"`
+	ErrorMessages           map[string]string        `yaml:"error_messages"`
+	HelpHeader              string                   `yaml:"help_header"`
+	HelpFooter              string                   `yaml:"help_footer"`
+	WelcomeImageID          string                   `yaml:"welcome_image_id"`
+	GreetNewChats           bool                     `yaml:"greet_new_chats"`
+	RequireMentionInGroups  bool                     `yaml:"require_mention_in_groups"`
+	DailyTimezone           string                   `yaml:"daily_timezone"`
+	AllowHDMode             bool                     `yaml:"allow_hd_mode"`
+	WorkerCount             int                      `yaml:"worker_count"`
+	WorkerQueueSize         int                      `yaml:"worker_queue_size"`
+
+	// folderPath is kept to reload config from the same place
+	folderPath string
+	// mu guards fields which can be changed by Reload
+	mu sync.RWMutex
 }
 
 func NewConfig(cfgFolderPath string) (*Config, error) {
 	c := &Config{
 		IsDebug:                 false,
+		LogLevel:                DefaultLogLevel,
+		GroupFallbackMessage:    DefaultGroupFallbackMessage,
+		DailyTimezone:           DefaultDailyTimezone,
 		CommandCooldown:         DefaultCommandCooldown,
+		MinChatCooldown:         DefaultMinChatCooldown,
+		MaxChatCooldown:         DefaultMaxChatCooldown,
+		CooldownScope:           DefaultCooldownScope,
+		ImageSource:             DefaultImageSource,
+		SelectionStrategy:       DefaultSelectionStrategy,
+		QuietHoursMode:          DefaultQuietHoursMode,
+		DBMaxOpenConns:          DefaultDBMaxOpenConns,
+		DBMaxIdleConns:          DefaultDBMaxIdleConns,
+		DBConnMaxLifetime:       DefaultDBConnMaxLifetime,
+		DBHealthCheckInterval:   DefaultDBHealthCheckInterval,
+		DBBreakerThreshold:      DefaultDBBreakerThreshold,
+		DBBreakerCooldown:       DefaultDBBreakerCooldown,
+		SlowQueryThreshold:      DefaultSlowQueryThreshold,
+		LogDedupWindow:          DefaultLogDedupWindow,
+		FeedbackCooldown:        DefaultFeedbackCooldown,
+		NextButtonCooldown:      DefaultNextButtonCooldown,
 		RequestTimeout:          DefaultRequestTimeout,
-		LastSentQueueSize:       DefaultLastSentQueueSize,
+		NoRepeatWindow:          DefaultNoRepeatWindow,
+		HistorySize:             DefaultHistorySize,
+		ImageCacheSize:          DefaultImageCacheSize,
+		MaxPhotoBytes:           DefaultMaxPhotoBytes,
+		MaxAnimationBytes:       DefaultMaxAnimationBytes,
+		MaxPhotoDimensions:      DefaultMaxPhotoDimensions,
+		ImportConcurrency:       DefaultImportConcurrency,
+		ImportTimeout:           DefaultImportTimeout,
+		ImageRestoreWindow:      DefaultImageRestoreWindow,
+		MaxBatchSize:            DefaultMaxBatchSize,
+		MaxTopImages:            DefaultMaxTopImages,
+		ListPageSize:            DefaultListPageSize,
+		ShowImageCaptions:       true,
+		ShowUploadAction:        true,
 		MaxRetries:              DefaultMaxRetries,
 		MinSubscriptionInterval: DefaultMinSubscriptionInterval,
+		SubJitter:               DefaultSubJitter,
 		MaxSubscriptionInterval: DefaultMaxSubscriptionInterval,
+		MaxSubsPerChat:          DefaultMaxSubsPerChat,
+		MinRemindDelay:          DefaultMinRemindDelay,
+		MaxRemindDelay:          DefaultMaxRemindDelay,
+		ShutdownTimeout:         DefaultShutdownTimeout,
+		StartupRetries:          DefaultStartupRetries,
+		StartupRetryDelay:       DefaultStartupRetryDelay,
+		WebhookListenAddr:       DefaultWebhookListenAddr,
+		PollTimeout:             DefaultPollTimeout,
+		UpdateBufferSize:        DefaultUpdateBufferSize,
+		AllowedUpdates:          slices.Clone(DefaultAllowedUpdates),
+		SendMaxRetries:          DefaultSendMaxRetries,
+		SendRetryBaseDelay:      DefaultSendRetryBaseDelay,
+		SendRateLimit:           DefaultSendRateLimit,
+		ChatSendRateLimit:       DefaultChatSendRateLimit,
+		ChatSendBurst:           DefaultChatSendBurst,
+		WorkerCount:             DefaultWorkerCount,
+		WorkerQueueSize:         DefaultWorkerQueueSize,
+		folderPath:              cfgFolderPath,
 	}
 
 	cfgPath := path.Join(cfgFolderPath, "config.yaml")
@@ -52,9 +282,6 @@ func NewConfig(cfgFolderPath string) (*Config, error) {
 		return nil, err
 	}
 
-	c.MaxSubscriptionInterval = c.MaxSubscriptionInterval.Round(time.Second)
-	c.MinSubscriptionInterval = c.MinSubscriptionInterval.Round(time.Second)
-
 	envFileName := "prod.env"
 	if c.IsDebug {
 		envFileName = "dev.env"
@@ -68,16 +295,38 @@ func NewConfig(cfgFolderPath string) (*Config, error) {
 		return nil, err
 	}
 
-	err = c.validate()
+	err = c.loadEnvOverrides()
 	if err != nil {
-		err = errors.Wrap(err, "NewConfig")
+		err = errors.Wrap(err, "NewConfig: invalid env overrides")
 
 		return nil, err
 	}
 
+	c.MaxSubscriptionInterval = c.MaxSubscriptionInterval.Round(time.Second)
+	c.MinSubscriptionInterval = c.MinSubscriptionInterval.Round(time.Second)
+	c.MinRemindDelay = c.MinRemindDelay.Round(time.Second)
+	c.MaxRemindDelay = c.MaxRemindDelay.Round(time.Second)
+
 	return c, nil
 }
 
+// DailyLocation returns timezone whose midnight changes picture of the day
+func (c *Config) DailyLocation() *time.Location {
+	loc, err := time.LoadLocation(c.DailyTimezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+func (c *Config) IsAdmin(userID int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Contains(c.AdminIDs, userID)
+}
+
 func (c *Config) loadConfig(filePath string) error {
 	configFile, err := os.ReadFile(filePath)
 	if err != nil {
@@ -96,9 +345,10 @@ func (c *Config) loadConfig(filePath string) error {
 	return nil
 }
 
+// loadEnv reads api key and db path from env file, file may be missing when env is set by container
 func (c *Config) loadEnv(filePath string) error {
 	err := godotenv.Load(filePath)
-	if err != nil {
+	if err != nil && !stdErrors.Is(err, fs.ErrNotExist) {
 		err = errors.Wrap(err, "loadEnv")
 
 		return err
@@ -110,24 +360,254 @@ func (c *Config) loadEnv(filePath string) error {
 	return nil
 }
 
-func (c *Config) validate() error {
-	if c.ApiKey == "" {
-		err := errors.New("api_key is required")
+// Validate checks config values and returns error listing every found problem
+func (c *Config) Validate() error {
+	var errs []error
 
-		return err
+	if c.ApiKey == "" {
+		errs = append(errs, errors.New("api_key is required"))
 	}
 
 	if c.DBPath == "" {
-		err := errors.New("db_path is required")
+		errs = append(errs, errors.New("db_path is required"))
+	}
 
-		return err
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, errors.New("db_max_open_conns must be positive"))
+	}
+
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("db_max_idle_conns must be between 0 and db_max_open_conns"))
+	}
+
+	if c.DBConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("db_conn_max_lifetime must not be negative"))
+	}
+
+	if c.DBHealthCheckInterval < 0 {
+		errs = append(errs, errors.New("db_health_check_interval must not be negative"))
+	}
+
+	if c.DBBreakerThreshold < 0 {
+		errs = append(errs, errors.New("db_breaker_threshold must not be negative"))
+	}
+
+	if c.DBBreakerThreshold > 0 && c.DBBreakerCooldown <= 0 {
+		errs = append(errs, errors.New("db_breaker_cooldown must be positive"))
+	}
+
+	if c.LogDedupWindow < 0 {
+		errs = append(errs, errors.New("log_dedup_window must not be negative"))
+	}
+
+	if c.SlowQueryThreshold < 0 {
+		errs = append(errs, errors.New("slow_query_threshold must not be negative"))
+	}
+
+	for kind := range c.ErrorMessages {
+		if !slices.Contains(ErrorKinds, kind) {
+			errs = append(errs, errors.Errorf("error_messages: unknown error kind %q, known are %s", kind, strings.Join(ErrorKinds, ", ")))
+		}
 	}
 
 	if c.ImagesDirPath == "" {
-		err := errors.New("images_dir_path is required")
+		errs = append(errs, errors.New("images_dir_path is required"))
+	}
 
-		return err
+	if c.ImageSource != ImageSourceDB && c.ImageSource != ImageSourceDir {
+		errs = append(errs, errors.New("image_source must be one of db, dir"))
 	}
 
-	return nil
+	if !slices.Contains([]string{SelectionRandom, SelectionLeastRecent, SelectionWeightedTag}, c.SelectionStrategy) {
+		errs = append(errs, errors.Errorf(
+			"selection_strategy must be one of %s, %s, %s", SelectionRandom, SelectionLeastRecent, SelectionWeightedTag,
+		))
+	}
+
+	if c.QuietHoursMode != QuietHoursSkip && c.QuietHoursMode != QuietHoursQueue {
+		errs = append(errs, errors.Errorf("quiet_hours_mode must be %q or %q", QuietHoursSkip, QuietHoursQueue))
+	}
+
+	if c.ImageRescanInterval < 0 {
+		errs = append(errs, errors.New("image_rescan_interval must not be negative"))
+	}
+
+	if c.ImageRestoreWindow <= 0 {
+		errs = append(errs, errors.New("image_restore_window must be positive"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, errors.New("log_level must be one of debug, info, warn, error"))
+	}
+
+	if c.GroupFallbackMessage == "" {
+		errs = append(errs, errors.New("group_fallback_message is required"))
+	}
+
+	if _, err := time.LoadLocation(c.DailyTimezone); err != nil || c.DailyTimezone == "" {
+		errs = append(errs, errors.Errorf("daily_timezone %q is not a known IANA timezone", c.DailyTimezone))
+	}
+
+	if c.CommandCooldown < 0 {
+		errs = append(errs, errors.New("command_cooldown must not be negative"))
+	}
+
+	for name, cd := range c.CommandCooldowns {
+		if cd < 0 {
+			errs = append(errs, errors.Errorf("command_cooldowns.%s must not be negative", name))
+		}
+	}
+
+	if c.FeedbackCooldown < 0 {
+		errs = append(errs, errors.New("feedback_cooldown must not be negative"))
+	}
+
+	if c.NextButtonCooldown < 0 {
+		errs = append(errs, errors.New("next_button_cooldown must not be negative"))
+	}
+
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, errors.New("request_timeout must be positive"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+
+	if c.StartupRetries < 0 {
+		errs = append(errs, errors.New("startup_retries must not be negative"))
+	}
+
+	if c.StartupRetryDelay <= 0 {
+		errs = append(errs, errors.New("startup_retry_delay must be positive"))
+	}
+
+	if c.PollTimeout < 0 || c.PollTimeout%time.Second != 0 {
+		errs = append(errs, errors.New("poll_timeout must be whole number of seconds, 0 disables long polling"))
+	}
+
+	if c.UpdateBufferSize < 0 {
+		errs = append(errs, errors.New("update_buffer_size must not be negative"))
+	}
+
+	for _, updateType := range c.AllowedUpdates {
+		if !slices.Contains(knownUpdateTypes, updateType) {
+			errs = append(errs, errors.Errorf("allowed_updates has unknown update type %q", updateType))
+		}
+	}
+
+	if c.SourceChannelID != 0 && len(c.AllowedUpdates) > 0 && !slices.Contains(c.AllowedUpdates, "channel_post") {
+		errs = append(errs, errors.New("allowed_updates must include channel_post when source_channel_id is set"))
+	}
+
+	if c.MaxRetries < 1 {
+		errs = append(errs, errors.New("max_retries must be positive"))
+	}
+
+	if c.WorkerCount < 1 {
+		errs = append(errs, errors.New("worker_count must be positive"))
+	}
+
+	if c.WorkerQueueSize < 0 {
+		errs = append(errs, errors.New("worker_queue_size must not be negative"))
+	}
+
+	if c.SendMaxRetries < 0 {
+		errs = append(errs, errors.New("send_max_retries must not be negative"))
+	}
+
+	if c.SendRetryBaseDelay <= 0 {
+		errs = append(errs, errors.New("send_retry_base_delay must be positive"))
+	}
+
+	if c.SendRateLimit <= 0 || c.ChatSendRateLimit <= 0 {
+		errs = append(errs, errors.New("send_rate_limit and chat_send_rate_limit must be positive"))
+	}
+
+	if c.ChatSendBurst < 1 {
+		errs = append(errs, errors.New("chat_send_burst must be at least 1"))
+	}
+
+	if c.MinChatCooldown <= 0 || c.MinChatCooldown > c.MaxChatCooldown {
+		errs = append(errs, errors.New("min_chat_cooldown must be positive and not greater than max_chat_cooldown"))
+	}
+
+	if c.MinSubscriptionInterval <= 0 || c.MinSubscriptionInterval > c.MaxSubscriptionInterval {
+		errs = append(errs, errors.New(
+			"min_subscription_interval must be positive and not greater than max_subscription_interval",
+		))
+	}
+
+	if c.MaxSubsPerChat < 0 {
+		errs = append(errs, errors.New("max_subs_per_chat must not be negative"))
+	}
+
+	if c.MinRemindDelay <= 0 || c.MinRemindDelay > c.MaxRemindDelay {
+		errs = append(errs, errors.New("min_remind_delay must be positive and not greater than max_remind_delay"))
+	}
+
+	if c.SubJitter < 0 || c.SubJitter >= c.MinSubscriptionInterval {
+		errs = append(errs, errors.New("sub_jitter must not be negative and must be less than min_subscription_interval"))
+	}
+
+	if c.NoRepeatWindow < 0 {
+		errs = append(errs, errors.New("no_repeat_window must not be negative"))
+	}
+
+	// history is listed in single message with a button per picture
+	if c.HistorySize < 0 || c.HistorySize > 100 {
+		errs = append(errs, errors.New("history_size must be between 0 and 100"))
+	}
+
+	if c.ImageCacheSize < 0 {
+		errs = append(errs, errors.New("image_cache_size must not be negative"))
+	}
+
+	if c.MaxPhotoBytes < 0 || c.MaxAnimationBytes < 0 || c.MaxPhotoDimensions < 0 {
+		errs = append(errs, errors.New("max_photo_bytes, max_animation_bytes and max_photo_dimensions must not be negative"))
+	}
+
+	if c.ImportConcurrency < 1 {
+		errs = append(errs, errors.New("import_concurrency must be positive"))
+	}
+
+	if c.ImportTimeout <= 0 {
+		errs = append(errs, errors.New("import_timeout must be positive"))
+	}
+
+	// telegram media group can hold up to 10 items
+	if c.MaxBatchSize < 1 || c.MaxBatchSize > 10 {
+		errs = append(errs, errors.New("max_batch_size must be between 1 and 10"))
+	}
+
+	if c.MaxTopImages < 1 {
+		errs = append(errs, errors.New("max_top_images must be positive"))
+	}
+
+	if c.ListPageSize < 1 {
+		errs = append(errs, errors.New("list_page_size must be positive"))
+	}
+
+	if c.CooldownScope != CooldownScopeChat && c.CooldownScope != CooldownScopeUser {
+		errs = append(errs, errors.Errorf("cooldown_scope must be %q or %q", CooldownScopeChat, CooldownScopeUser))
+	}
+
+	// short tokens are easy to guess and API can delete the whole library
+	if c.AdminAPIAddr != "" && len(c.AdminAPIToken) < minAdminAPITokenLength {
+		errs = append(errs, errors.Errorf("admin_api_token must be at least %d characters long", minAdminAPITokenLength))
+	}
+
+	if c.WebhookURL != "" {
+		_, err := url.ParseRequestURI(c.WebhookURL)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "webhook_url is invalid"))
+		}
+
+		if c.WebhookListenAddr == "" {
+			errs = append(errs, errors.New("webhook_listen_addr is required when webhook_url is set"))
+		}
+	}
+
+	return stdErrors.Join(errs...)
 }
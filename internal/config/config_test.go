@@ -0,0 +1,183 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repoConfigFolder holds config.yaml shipped with the bot
+const repoConfigFolder = "../../config"
+
+func loadRepoConfig(t *testing.T) *Config {
+	t.Helper()
+
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", t.TempDir()+"/test.db")
+
+	c, err := NewConfig(repoConfigFolder)
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	return c
+}
+
+func TestValidateShippedConfig(t *testing.T) {
+	c := loadRepoConfig(t)
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("shipped config is invalid: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "missing api key",
+			modify: func(c *Config) { c.ApiKey = "" },
+			want:   []string{"api_key is required"},
+		},
+		{
+			name:   "unknown image source",
+			modify: func(c *Config) { c.ImageSource = "s3" },
+			want:   []string{"image_source must be one of db, dir"},
+		},
+		{
+			name:   "unknown selection strategy",
+			modify: func(c *Config) { c.SelectionStrategy = "newest" },
+			want:   []string{"selection_strategy must be one of"},
+		},
+		{
+			name:   "fractional poll timeout",
+			modify: func(c *Config) { c.PollTimeout = 1500 * time.Millisecond },
+			want:   []string{"poll_timeout must be whole number of seconds"},
+		},
+		{
+			name: "subscription interval bounds swapped",
+			modify: func(c *Config) {
+				c.MinSubscriptionInterval = 2 * time.Hour
+				c.MaxSubscriptionInterval = time.Hour
+			},
+			want: []string{"min_subscription_interval must be positive and not greater than max_subscription_interval"},
+		},
+		{
+			name:   "unknown error kind",
+			modify: func(c *Config) { c.ErrorMessages = map[string]string{"oops": "Oops"} },
+			want:   []string{`unknown error kind "oops"`},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(c *Config) {
+				c.DBPath = ""
+				c.WorkerCount = 0
+				c.LogLevel = "verbose"
+			},
+			want: []string{
+				"db_path is required",
+				"worker_count must be positive",
+				"log_level must be one of debug, info, warn, error",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := loadRepoConfig(t)
+			tt.modify(c)
+
+			err := c.Validate()
+			if err == nil {
+				t.Fatal("invalid config passed validation")
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandCooldownsParsing(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]time.Duration
+		// err is part of load or validation error, empty if config is valid
+		err string
+	}{
+		{
+			name:  "empty",
+			value: "{}",
+			want:  map[string]time.Duration{},
+		},
+		{
+			name:  "flow style",
+			value: "{peepo_many: 30s, help: 500ms, top: 1m30s}",
+			want:  map[string]time.Duration{"peepo_many": 30 * time.Second, "help": 500 * time.Millisecond, "top": 90 * time.Second},
+		},
+		{
+			name:  "block style",
+			value: "\n  peepo_many: 1h\n  help: 0s",
+			want:  map[string]time.Duration{"peepo_many": time.Hour, "help": 0},
+		},
+		{
+			name:  "invalid duration",
+			value: "{help: soon}",
+			err:   "loadConfig",
+		},
+		{
+			name:  "negative",
+			value: "{help: -1s}",
+			err:   "command_cooldowns.help must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("api_key", "test-key")
+			t.Setenv("db_path", t.TempDir()+"/test.db")
+
+			folder := t.TempDir()
+			writeConfig(t, folder, map[string]string{"command_cooldowns": tt.value})
+
+			c, err := NewConfig(folder)
+			if err == nil {
+				err = c.Validate()
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("can not load config: %v", err)
+			}
+
+			if !maps.Equal(c.CommandCooldowns, tt.want) {
+				t.Errorf("command_cooldowns = %v, want %v", c.CommandCooldowns, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandCooldownsEnvOverride(t *testing.T) {
+	t.Setenv(EnvPrefix+"COMMAND_COOLDOWNS", "{top: 1m}")
+
+	c := loadRepoConfig(t)
+
+	if cd, ok := c.CooldownFor("top"); !ok || cd != time.Minute || len(c.CommandCooldowns) != 1 {
+		t.Errorf("command_cooldowns = %v, want only top with 1m", c.CommandCooldowns)
+	}
+}
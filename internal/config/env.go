@@ -0,0 +1,104 @@
+package config
+
+import (
+	stdErrors "errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to upper-cased yaml name of field to get env var overriding it,
+// e.g. APUBOT_COMMAND_COOLDOWN overrides command_cooldown
+const EnvPrefix = "APUBOT_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// loadEnvOverrides sets fields from APUBOT_* env vars, they take precedence over config files.
+// Lists and maps are written in yaml flow style, e.g. APUBOT_ADMIN_IDS=[1, 2].
+func (c *Config) loadEnvOverrides() error {
+	var errs []error
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := EnvPrefix + strings.ToUpper(name)
+
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		err := setFromEnv(v.Field(i), raw)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s=%q", key, raw))
+		}
+	}
+
+	return stdErrors.Join(errs...)
+}
+
+func setFromEnv(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("invalid duration, use e.g. 30s, 5m or 1h30m")
+		}
+
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("invalid bool, use true or false")
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("invalid integer")
+		}
+
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("invalid number")
+		}
+
+		field.SetFloat(f)
+	case reflect.Slice, reflect.Map:
+		// value replaces the one from file instead of being merged into it
+		fresh := reflect.New(field.Type())
+
+		err := yaml.Unmarshal([]byte(raw), fresh.Interface())
+		if err != nil {
+			return errors.New("invalid value, use yaml flow style, e.g. [a, b] or {key: value}")
+		}
+
+		field.Set(fresh.Elem())
+	default:
+		return errors.Errorf("env override is not supported for %s", field.Type())
+	}
+
+	return nil
+}
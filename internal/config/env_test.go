@@ -0,0 +1,61 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("APUBOT_COMMAND_COOLDOWN", "7s")
+	t.Setenv("APUBOT_IS_DEBUG", "false")
+	t.Setenv("APUBOT_WORKER_COUNT", " 3 ")
+	t.Setenv("APUBOT_ADMIN_IDS", "[1, 2]")
+	t.Setenv("APUBOT_ALIASES", "{p: peepo}")
+	t.Setenv("APUBOT_GROUP_FALLBACK_MESSAGE", "Commands only")
+
+	c := loadRepoConfig(t)
+
+	if c.CommandCooldown != 7*time.Second {
+		t.Errorf("command_cooldown = %s, want 7s", c.CommandCooldown)
+	}
+
+	if c.IsDebug {
+		t.Error("is_debug from file was not overridden")
+	}
+
+	if c.WorkerCount != 3 {
+		t.Errorf("worker_count = %d, want 3", c.WorkerCount)
+	}
+
+	if !slices.Equal(c.AdminIDs, []int64{1, 2}) {
+		t.Errorf("admin_ids = %v, want [1 2]", c.AdminIDs)
+	}
+
+	if len(c.Aliases) != 1 || c.Aliases["p"] != "peepo" {
+		t.Errorf("aliases = %v, want map[p:peepo]", c.Aliases)
+	}
+
+	if c.GroupFallbackMessage != "Commands only" {
+		t.Errorf("group_fallback_message = %q, want %q", c.GroupFallbackMessage, "Commands only")
+	}
+}
+
+func TestEnvOverridesReportInvalidValues(t *testing.T) {
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", t.TempDir()+"/test.db")
+	t.Setenv("APUBOT_COMMAND_COOLDOWN", "five seconds")
+	t.Setenv("APUBOT_WORKER_COUNT", "many")
+
+	_, err := NewConfig(repoConfigFolder)
+	if err == nil {
+		t.Fatal("invalid env overrides were accepted")
+	}
+
+	for _, want := range []string{"APUBOT_COMMAND_COOLDOWN", "invalid duration", "APUBOT_WORKER_COUNT", "invalid integer"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
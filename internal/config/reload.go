@@ -0,0 +1,117 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reloadableFields are yaml names of fields applied by Reload, changes of other ones require restart
+var reloadableFields = []string{
+	"command_cooldown",
+	"command_cooldowns",
+	"help_header",
+	"help_footer",
+	"admin_ids",
+	"cooldown_exempt_ids",
+	"log_level",
+}
+
+// Cooldown returns global command cooldown
+func (c *Config) Cooldown() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.CommandCooldown
+}
+
+// CooldownFor returns cooldown configured for command, false if it is not set
+func (c *Config) CooldownFor(name string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cd, ok := c.CommandCooldowns[name]
+
+	return cd, ok
+}
+
+// Help returns custom help header and footer, both may be empty
+func (c *Config) Help() (header string, footer string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.HelpHeader, c.HelpFooter
+}
+
+func (c *Config) Admins() []int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.AdminIDs
+}
+
+// IsCooldownExempt reports whether user is not limited by cooldowns
+func (c *Config) IsCooldownExempt(userID int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Contains(c.CooldownExemptIDs, userID)
+}
+
+func (c *Config) Level() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.LogLevel
+}
+
+// Reload reads config files again and applies cooldowns, help text, admin IDs, cooldown exemptions and log level.
+// Names of other changed fields are returned as they require restart.
+func (c *Config) Reload() (ignored []string, err error) {
+	fresh, err := NewConfig(c.folderPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read config")
+	}
+
+	err = fresh.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.CommandCooldown = fresh.CommandCooldown
+	c.CommandCooldowns = fresh.CommandCooldowns
+	c.HelpHeader = fresh.HelpHeader
+	c.HelpFooter = fresh.HelpFooter
+	c.AdminIDs = fresh.AdminIDs
+	c.CooldownExemptIDs = fresh.CooldownExemptIDs
+	c.LogLevel = fresh.LogLevel
+
+	return c.changedFields(fresh, reloadableFields), nil
+}
+
+// changedFields returns yaml names of fields whose values differ in other config, except skipped ones
+func (c *Config) changedFields(other *Config, skip []string) []string {
+	var changed []string
+
+	v, o := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || slices.Contains(skip, name) {
+			continue
+		}
+
+		if !reflect.DeepEqual(v.Field(i).Interface(), o.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
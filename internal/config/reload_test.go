@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeConfig writes shipped config.yaml to folder with values of given fields replaced
+func writeConfig(t *testing.T, folder string, values map[string]string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(repoConfigFolder, "config.yaml"))
+	if err != nil {
+		t.Fatalf("can not read shipped config: %v", err)
+	}
+
+	for name, value := range values {
+		line := regexp.MustCompile(`(?m)^` + name + `:.*$`)
+		if !line.Match(data) {
+			t.Fatalf("shipped config has no %s", name)
+		}
+
+		data = line.ReplaceAll(data, []byte(name+": "+value))
+	}
+
+	if err = os.WriteFile(filepath.Join(folder, "config.yaml"), data, 0o644); err != nil {
+		t.Fatalf("can not write config: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", t.TempDir()+"/test.db")
+
+	folder := t.TempDir()
+	writeConfig(t, folder, map[string]string{"command_cooldown": "2s"})
+
+	c, err := NewConfig(folder)
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	writeConfig(t, folder, map[string]string{
+		"command_cooldown":  "7s",
+		"command_cooldowns": "{peepo_many: 1m}",
+		"help_footer":       `"Have fun"`,
+		"max_chat_cooldown": "2h",
+		"allow_hd_mode":     "true",
+		"aliases":           "{p: peepo}",
+	})
+
+	ignored, err := c.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if got := c.Cooldown(); got != 7*time.Second {
+		t.Errorf("cooldown after reload = %s, want 7s", got)
+	}
+
+	if got, ok := c.CooldownFor("peepo_many"); !ok || got != time.Minute {
+		t.Errorf("peepo_many cooldown after reload = %s, %t, want 1m", got, ok)
+	}
+
+	if _, footer := c.Help(); footer != "Have fun" {
+		t.Errorf("help footer after reload = %q, want new one", footer)
+	}
+
+	// fields not applied at runtime are reported and keep their values
+	slices.Sort(ignored)
+	if want := []string{"aliases", "allow_hd_mode", "max_chat_cooldown"}; !slices.Equal(ignored, want) {
+		t.Errorf("Reload() ignored %q, want %q", ignored, want)
+	}
+
+	if c.MaxChatCooldown != time.Hour || c.AllowHDMode || len(c.Aliases) != 0 {
+		t.Errorf("restart-required fields changed: max_chat_cooldown %s, allow_hd_mode %t, aliases %v",
+			c.MaxChatCooldown, c.AllowHDMode, c.Aliases)
+	}
+}
+
+func TestReloadKeepsConfigOnError(t *testing.T) {
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", t.TempDir()+"/test.db")
+
+	folder := t.TempDir()
+	writeConfig(t, folder, map[string]string{"command_cooldown": "2s"})
+
+	c, err := NewConfig(folder)
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	writeConfig(t, folder, map[string]string{"command_cooldown": "7s", "image_source": "s3"})
+
+	if _, err = c.Reload(); err == nil {
+		t.Fatal("Reload() of invalid config succeeded")
+	}
+
+	if got := c.Cooldown(); got != 2*time.Second {
+		t.Errorf("cooldown after failed reload = %s, want 2s", got)
+	}
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ChatRatingSFW = "sfw"
+	ChatRatingAll = "all"
+)
+
+const (
+	DefaultChatLanguage = "en"
+	DefaultChatTimezone = "UTC"
+)
+
+type ChatSettings struct {
+	ChatID   int64
+	Rating   string
+	Language string
+	// Cooldown is command cooldown in seconds, 0 means global one is used
+	Cooldown int64
+	// QuietStart and QuietEnd are minutes since midnight in chat timezone, equal values disable quiet hours
+	QuietStart int
+	QuietEnd   int
+	// Timezone is IANA name of chat timezone
+	Timezone string
+	// HDMode makes pictures with local files be sent as uncompressed documents
+	HDMode bool
+	// Stopped is set by /stop, neither scheduled pictures nor broadcasts are sent to chat until /start
+	Stopped bool
+}
+
+func (s ChatSettings) CooldownAsDuration() time.Duration {
+	return time.Duration(s.Cooldown) * time.Second
+}
+
+func (s ChatSettings) HasQuietHours() bool {
+	return s.QuietStart != s.QuietEnd
+}
+
+// Location returns chat timezone, UTC is used if saved one is unknown
+func (s ChatSettings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// InQuietHours reports whether t falls into quiet hours, window may wrap past midnight
+func (s ChatSettings) InQuietHours(t time.Time) bool {
+	if !s.HasQuietHours() {
+		return false
+	}
+
+	local := t.In(s.Location())
+	minute := local.Hour()*60 + local.Minute()
+
+	if s.QuietStart < s.QuietEnd {
+		return minute >= s.QuietStart && minute < s.QuietEnd
+	}
+
+	return minute >= s.QuietStart || minute < s.QuietEnd
+}
+
+// QuietEndsAt returns the closest end of quiet hours after t
+func (s ChatSettings) QuietEndsAt(t time.Time) time.Time {
+	local := t.In(s.Location())
+
+	end := time.Date(local.Year(), local.Month(), local.Day(), s.QuietEnd/60, s.QuietEnd%60, 0, 0, local.Location())
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return end
+}
+
+// QuietHoursString formats quiet hours as HH:MM-HH:MM
+func (s ChatSettings) QuietHoursString() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", s.QuietStart/60, s.QuietStart%60, s.QuietEnd/60, s.QuietEnd%60)
+}
+
+func DefaultChatSettings(chatId int64) ChatSettings {
+	return ChatSettings{
+		ChatID:   chatId,
+		Rating:   ChatRatingSFW,
+		Language: DefaultChatLanguage,
+		Timezone: DefaultChatTimezone,
+	}
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// minutes converts HH:MM to minutes since midnight
+func minutes(hour int, minute int) int {
+	return hour*60 + minute
+}
+
+func TestInQuietHours(t *testing.T) {
+	day := func(hour int, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int
+		timezone   string
+		at         time.Time
+		want       bool
+	}{
+		{"off", 0, 0, "UTC", day(3, 0), false},
+		{"inside daytime window", minutes(13, 0), minutes(15, 0), "UTC", day(14, 0), true},
+		{"before daytime window", minutes(13, 0), minutes(15, 0), "UTC", day(12, 59), false},
+		{"window start is quiet", minutes(13, 0), minutes(15, 0), "UTC", day(13, 0), true},
+		{"window end is not quiet", minutes(13, 0), minutes(15, 0), "UTC", day(15, 0), false},
+		{"wrapping window before midnight", minutes(23, 0), minutes(8, 0), "UTC", day(23, 30), true},
+		{"wrapping window after midnight", minutes(23, 0), minutes(8, 0), "UTC", day(3, 0), true},
+		{"wrapping window start", minutes(23, 0), minutes(8, 0), "UTC", day(23, 0), true},
+		{"wrapping window last minute", minutes(23, 0), minutes(8, 0), "UTC", day(7, 59), true},
+		{"wrapping window end", minutes(23, 0), minutes(8, 0), "UTC", day(8, 0), false},
+		{"outside wrapping window", minutes(23, 0), minutes(8, 0), "UTC", day(12, 0), false},
+		// 20:30 UTC is 23:30 in Moscow
+		{"chat timezone", minutes(23, 0), minutes(8, 0), "Europe/Moscow", day(20, 30), true},
+		{"chat timezone outside window", minutes(23, 0), minutes(8, 0), "Europe/Moscow", day(5, 30), false},
+		{"unknown timezone falls back to UTC", minutes(23, 0), minutes(8, 0), "Mars/Olympus", day(23, 30), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ChatSettings{QuietStart: tt.start, QuietEnd: tt.end, Timezone: tt.timezone}
+
+			if got := s.InQuietHours(tt.at); got != tt.want {
+				t.Errorf("InQuietHours(%s) = %t, want %t", tt.at.Format(time.TimeOnly), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietEndsAt(t *testing.T) {
+	s := ChatSettings{QuietStart: minutes(23, 0), QuietEnd: minutes(8, 0), Timezone: "UTC"}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want time.Time
+	}{
+		{"before midnight", time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC), time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{"after midnight", time.Date(2024, 3, 11, 3, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{"at window end", time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC), time.Date(2024, 3, 12, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.QuietEndsAt(tt.at); !got.Equal(tt.want) {
+				t.Errorf("QuietEndsAt(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+type Cooldown struct {
+	Key       string
+	UsedAt    int64
+	ExpiresAt int64
+}
+
+func (c Cooldown) UsedAtAsUnixTime() time.Time {
+	return time.Unix(c.UsedAt, 0)
+}
+
+func (c Cooldown) ExpiresAtAsUnixTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
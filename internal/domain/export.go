@@ -0,0 +1,26 @@
+package domain
+
+// ExportVersion is version of exported data format, data of other versions is rejected on import
+const ExportVersion = 1
+
+type (
+	// Export holds user favorites with settings and subscriptions of chat to carry them over to another chat
+	Export struct {
+		Version       int                  `json:"version"`
+		Favorites     []int64              `json:"favorites"`
+		ChatSettings  *ExportChatSettings  `json:"chat_settings,omitempty"`
+		Subscriptions []ExportSubscription `json:"subscriptions,omitempty"`
+	}
+
+	ExportChatSettings struct {
+		Rating   string `json:"rating"`
+		Language string `json:"language"`
+		// Cooldown is command cooldown in seconds, 0 means global one
+		Cooldown int64 `json:"cooldown"`
+	}
+
+	ExportSubscription struct {
+		// Period is delivery period in seconds
+		Period int `json:"period"`
+	}
+)
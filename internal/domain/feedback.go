@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+type Feedback struct {
+	ID        int64
+	ChatID    int64
+	UserID    int64
+	Username  string
+	Text      string
+	CreatedAt int64
+}
+
+func (f Feedback) CreatedAtAsUnixTime() time.Time {
+	return time.Unix(f.CreatedAt, 0)
+}
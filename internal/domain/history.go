@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// ServedImage is image delivered to chat, listed by /history
+type ServedImage struct {
+	ChatID   int64
+	ImageID  int64
+	ServedAt int64
+}
+
+func (s ServedImage) ServedAtAsUnixTime() time.Time {
+	return time.Unix(s.ServedAt, 0)
+}
@@ -1,6 +1,83 @@
 package domain
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	RatingSFW  = "sfw"
+	RatingNSFW = "nsfw"
+)
+
+const (
+	TypePhoto     = "photo"
+	TypeAnimation = "animation"
+)
+
 type File struct {
-	Name string
-	TgID string
+	ID     int64
+	Name   string
+	TgID   string
+	Rating string
+	Type   string
+	// LastServedAt is unix time file was last sent, 0 if never
+	LastServedAt int64
+	ServeCount   int64
+	// UploaderID is ID of admin who added file, 0 for files from images directory
+	UploaderID int64
+	// UploadedAt is unix time file was added, 0 for files from images directory
+	UploadedAt int64
+	// DeletedAt is unix time file was soft deleted, 0 if file is not deleted
+	DeletedAt int64
+	// Hash is hex sha256 of file content, empty if it is unknown
+	Hash string
+	// SourceURL is address file was imported from with /import_urls, empty for other files
+	SourceURL string
+	// Purged is set for deleted file whose row is kept after restore window, so file left in images dir stays deleted
+	Purged bool
+}
+
+func (f File) IsAnimation() bool {
+	return f.Type == TypeAnimation
+}
+
+func (f File) IsDeleted() bool {
+	return f.DeletedAt != 0
+}
+
+// AllowedFor reports whether file can be sent to chat with given allowed rating
+func (f File) AllowedFor(chatRating string) bool {
+	return chatRating == ChatRatingAll || f.Rating != RatingNSFW
+}
+
+// ContentHash returns hex sha256 of file content, it is stored as File Hash
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// TypeByName detects file type by extension, empty string is returned for unsupported files
+func TypeByName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return TypePhoto
+	case ".gif", ".mp4":
+		return TypeAnimation
+	}
+
+	return ""
+}
+
+// TagFilter selects images having all Include tags and none of Exclude tags
+type TagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (f TagFilter) IsEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
 }
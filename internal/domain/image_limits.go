@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// ImageLimits are max sizes of images accepted by Telegram from bots, zero value disables a limit
+type ImageLimits struct {
+	PhotoBytes     int64
+	AnimationBytes int64
+	// PhotoDimensions limits sum of photo width and height
+	PhotoDimensions int
+}
+
+// Check returns error describing why image can not be sent, unknown width and height are passed as 0
+func (l ImageLimits) Check(fileType string, width, height int, size int64) error {
+	maxBytes := l.PhotoBytes
+	if fileType == TypeAnimation {
+		maxBytes = l.AnimationBytes
+	}
+
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("file is %s, max allowed size is %s", formatBytes(size), formatBytes(maxBytes))
+	}
+
+	if fileType == TypePhoto && l.PhotoDimensions > 0 && width+height > l.PhotoDimensions {
+		return fmt.Errorf("photo is %dx%d, width and height must not exceed %d in total", width, height, l.PhotoDimensions)
+	}
+
+	return nil
+}
+
+// CheckFile checks local image file, photo dimensions are read from its header
+func (l ImageLimits) CheckFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	fileType := TypeByName(path)
+
+	var width, height int
+	if fileType == TypePhoto && l.PhotoDimensions > 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return fmt.Errorf("can not read photo dimensions: %w", err)
+		}
+
+		width, height = cfg.Width, cfg.Height
+	}
+
+	return l.Check(fileType, width, height, info.Size())
+}
+
+func formatBytes(n int64) string {
+	const mb = 1 << 20
+	if n >= mb {
+		return fmt.Sprintf("%.1f MB", float64(n)/mb)
+	}
+
+	return fmt.Sprintf("%d KB", n>>10)
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// ScheduledSend is one-off delivery of random picture requested by /remind
+type ScheduledSend struct {
+	ID     int64
+	ChatID int64
+	SendAt int64
+}
+
+func (s ScheduledSend) SendAtAsUnixTime() time.Time {
+	return time.Unix(s.SendAt, 0)
+}
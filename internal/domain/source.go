@@ -0,0 +1,8 @@
+package domain
+
+// SourceMessage is post in source channel image can be forwarded from
+type SourceMessage struct {
+	ImageID   int64
+	ChannelID int64
+	MessageID int
+}
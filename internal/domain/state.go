@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// StateValue is bot runtime value persisted between restarts
+type StateValue struct {
+	Key       string
+	Value     string
+	UpdatedAt int64
+}
+
+func (v StateValue) UpdatedAtAsUnixTime() time.Time {
+	return time.Unix(v.UpdatedAt, 0)
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+type UsageStats struct {
+	UserID          int64
+	ImagesRequested int
+	FirstUsedAt     int64
+}
+
+func (s UsageStats) FirstUsedAtAsUnixTime() time.Time {
+	return time.Unix(s.FirstUsedAt, 0)
+}
@@ -3,9 +3,21 @@ package domain
 import "time"
 
 type Subscription struct {
+	ID        int64
 	ChatId    int64
 	CreatedAt int64
 	Period    int
+	Paused    bool
+}
+
+// SubscriptionCount is number of active subscriptions with the same period
+type SubscriptionCount struct {
+	Period int
+	Count  int
+}
+
+func (c SubscriptionCount) PeriodAsDurationInSeconds() time.Duration {
+	return time.Duration(c.Period) * time.Second
 }
 
 func (s Subscription) SubscribedAtAsUnixTime() time.Time {
@@ -15,3 +27,10 @@ func (s Subscription) SubscribedAtAsUnixTime() time.Time {
 func (s Subscription) PeriodAsDurationInSeconds() time.Duration {
 	return time.Duration(s.Period) * time.Second
 }
+
+// NextRun returns the closest scheduled event after current moment
+func (s Subscription) NextRun() time.Time {
+	passedIntervals := time.Since(s.SubscribedAtAsUnixTime()) / s.PeriodAsDurationInSeconds()
+
+	return s.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * s.PeriodAsDurationInSeconds())
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Suggestion is image sent by user with /suggest, it waits for admin approval before joining the library
+type Suggestion struct {
+	ID        int64
+	Name      string
+	TgID      string
+	Type      string
+	Tags      []string
+	UserID    int64
+	ChatID    int64
+	CreatedAt int64
+}
+
+func (s Suggestion) CreatedAtAsUnixTime() time.Time {
+	return time.Unix(s.CreatedAt, 0)
+}
+
+// File returns image to add to the library once suggestion is approved, suggesting user is its uploader
+func (s Suggestion) File() File {
+	return File{
+		Name:       s.Name,
+		TgID:       s.TgID,
+		Type:       s.Type,
+		UploaderID: s.UserID,
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTagLength is max number of characters in tag
+	MaxTagLength = 32
+	// DefaultTagWeight is weight of tags not configured with /tag_weight
+	DefaultTagWeight = 1
+	// MaxTagWeight limits weight so single tag can not take over selection by mistake
+	MaxTagWeight = 1000
+)
+
+// SplitTags splits raw user input to tags separated by commas or spaces
+func SplitTags(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// NormalizeTag lowercases and trims tag, false is returned if tag is empty, too long
+// or has characters other than letters, digits, underscore and hyphen not in the beginning
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength || strings.HasPrefix(tag, "-") {
+		return tag, false
+	}
+
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return tag, false
+		}
+	}
+
+	return tag, true
+}
+
+// NormalizeTags splits raw tags and normalizes them dropping duplicates, invalid tags are returned separately
+func NormalizeTags(raw string) (valid []string, invalid []string) {
+	for _, part := range SplitTags(raw) {
+		tag, ok := NormalizeTag(part)
+		if !ok {
+			invalid = append(invalid, part)
+
+			continue
+		}
+
+		if !slices.Contains(valid, tag) {
+			valid = append(valid, tag)
+		}
+	}
+
+	return valid, invalid
+}
+
+// ParseTagFilter splits command arguments to required tags and excluded ones prefixed with minus,
+// arguments which are not valid tags are returned separately
+func ParseTagFilter(args string) (filter TagFilter, invalid []string) {
+	for _, arg := range SplitTags(args) {
+		raw, exclude := strings.CutPrefix(arg, "-")
+
+		tag, ok := NormalizeTag(raw)
+		if !ok {
+			invalid = append(invalid, arg)
+
+			continue
+		}
+
+		switch {
+		case exclude && !slices.Contains(filter.Exclude, tag):
+			filter.Exclude = append(filter.Exclude, tag)
+		case !exclude && !slices.Contains(filter.Include, tag):
+			filter.Include = append(filter.Include, tag)
+		}
+	}
+
+	return filter, invalid
+}
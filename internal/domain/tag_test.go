@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		wantValid   []string
+		wantInvalid []string
+	}{
+		{
+			name:      "case and spaces",
+			raw:       " Happy, HAPPY  ,,sad ",
+			wantValid: []string{"happy", "sad"},
+		},
+		{
+			name:      "underscore and hyphen",
+			raw:       "big_peepo peepo-sad",
+			wantValid: []string{"big_peepo", "peepo-sad"},
+		},
+		{
+			name:      "unicode letters",
+			raw:       "Грусть",
+			wantValid: []string{"грусть"},
+		},
+		{
+			name:        "invalid characters",
+			raw:         "ok #hash -dash a.b",
+			wantValid:   []string{"ok"},
+			wantInvalid: []string{"#hash", "-dash", "a.b"},
+		},
+		{
+			name:        "too long",
+			raw:         strings.Repeat("a", MaxTagLength) + " " + strings.Repeat("b", MaxTagLength+1),
+			wantValid:   []string{strings.Repeat("a", MaxTagLength)},
+			wantInvalid: []string{strings.Repeat("b", MaxTagLength+1)},
+		},
+		{
+			name: "empty",
+			raw:  " , ,",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, invalid := NormalizeTags(tt.raw)
+
+			if !slices.Equal(valid, tt.wantValid) {
+				t.Errorf("valid = %q, want %q", valid, tt.wantValid)
+			}
+
+			if !slices.Equal(invalid, tt.wantInvalid) {
+				t.Errorf("invalid = %q, want %q", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        string
+		want        TagFilter
+		wantInvalid []string
+	}{
+		{
+			name: "included and excluded",
+			args: "Cat -dog, happy -SAD",
+			want: TagFilter{Include: []string{"cat", "happy"}, Exclude: []string{"dog", "sad"}},
+		},
+		{
+			name: "only excluded",
+			args: "-dog",
+			want: TagFilter{Exclude: []string{"dog"}},
+		},
+		{
+			name: "duplicates are dropped",
+			args: "cat CAT -dog -Dog",
+			want: TagFilter{Include: []string{"cat"}, Exclude: []string{"dog"}},
+		},
+		{
+			name: "tag both included and excluded",
+			args: "cat -cat",
+			want: TagFilter{Include: []string{"cat"}, Exclude: []string{"cat"}},
+		},
+		{
+			name:        "invalid tags",
+			args:        "cat - --dog -c@t d.og",
+			want:        TagFilter{Include: []string{"cat"}},
+			wantInvalid: []string{"-", "--dog", "-c@t", "d.og"},
+		},
+		{
+			name: "empty",
+			args: "  ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, invalid := ParseTagFilter(tt.args)
+
+			if !slices.Equal(filter.Include, tt.want.Include) || !slices.Equal(filter.Exclude, tt.want.Exclude) {
+				t.Errorf("ParseTagFilter() = %+v, want %+v", filter, tt.want)
+			}
+
+			if !slices.Equal(invalid, tt.wantInvalid) {
+				t.Errorf("ParseTagFilter() invalid = %q, want %q", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package access
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/pkg/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CanManageChat reports whether message author can change chat settings:
+// anyone in private chat, bot admins and chat administrators in groups
+func CanManageChat(cfg *config.Config, log logger.Logger, bot telegram.Sender, message *tgbotapi.Message) bool {
+	if message.Chat.IsPrivate() {
+		return true
+	}
+
+	if message.From == nil {
+		return false
+	}
+
+	if cfg.IsAdmin(message.From.ID) {
+		return true
+	}
+
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: message.Chat.ID,
+			UserID: message.From.ID,
+		},
+	})
+	if err != nil {
+		log.Error("Error getting chat member", "chat_id", message.Chat.ID, "err", err)
+
+		return false
+	}
+
+	return member.IsAdministrator() || member.IsCreator()
+}
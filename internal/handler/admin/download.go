@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+)
+
+// download reads response body of url, bodies larger than limit bytes are rejected
+func download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not create request")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not download file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read file")
+	}
+
+	if int64(len(data)) > limit {
+		return nil, errors.Errorf("file is larger than %d bytes", limit)
+	}
+
+	return data, nil
+}
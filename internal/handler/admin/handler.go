@@ -0,0 +1,653 @@
+package admin
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/handler/attachment"
+	"apubot/internal/handler/errmsg"
+	"apubot/internal/handler/pagination"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/feedback"
+	"apubot/internal/service/image"
+	"apubot/internal/service/source"
+	"apubot/internal/service/state"
+	"apubot/internal/service/subscription"
+	"apubot/internal/service/suggestion"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/text_split"
+	"apubot/pkg/utils/time_string"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// broadcastInterval keeps broadcast below Telegram limit of ~30 messages per second
+const broadcastInterval = time.Second / 25
+
+// maxMessageLength is Telegram limit for message text
+const maxMessageLength = 4096
+
+const (
+	// feedbackListLimit is number of latest messages paginated by FeedbackList
+	feedbackListLimit = 100
+	// maxFeedbackPreview is number of characters of each message shown in list, so page fits single message
+	maxFeedbackPreview = 300
+)
+
+// FeedbackCallbackPrefix is followed by page of FeedbackList
+const FeedbackCallbackPrefix = "feedback:"
+
+const (
+	DeleteImageCallbackPrefix = "delete_image:"
+	deleteConfirmAction       = "confirm"
+	deleteCancelAction        = "cancel"
+)
+
+type (
+	Handler struct {
+		cfg      *config.Config
+		log      logger.Logger
+		bot      telegram.Sender
+		services *Services
+	}
+	Services struct {
+		Chat         chat.ChatService
+		Image        image.ImageService
+		Feedback     feedback.FeedbackService
+		State        state.StateService
+		Subscription subscription.SubscriptionService
+		Suggestion   suggestion.SuggestionService
+		Source       source.SourceService
+	}
+)
+
+func New(cfg *config.Config, log logger.Logger, bot telegram.Sender, services *Services) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		log:      log,
+		bot:      bot,
+		services: services,
+	}
+}
+
+func (h *Handler) Broadcast(ctx context.Context, message *tgbotapi.Message) {
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		h.reply(message.Chat.ID, "Please enter a message, e.g. /broadcast Hello everyone!")
+
+		return
+	}
+
+	chatIDs, err := h.services.Chat.ListIDs(ctx)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error getting chats")
+
+		return
+	}
+
+	var sent, blocked, failed, stopped, notReached int
+
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+
+	// shutdown cancels ctx, chats not reached by then are left without message
+loop:
+	for i, chatID := range chatIDs {
+		if ctx.Err() != nil {
+			notReached = len(chatIDs) - i
+
+			break
+		}
+
+		settings, err := h.services.Chat.GetSettings(ctx, chatID)
+		if err != nil {
+			// chat may have opted out, so it is skipped until its settings can be read
+			failed++
+			h.log.Error("Error broadcasting message", "chat_id", chatID, "err", err)
+
+			continue
+		}
+
+		if settings.Stopped {
+			stopped++
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			notReached = len(chatIDs) - i
+
+			break loop
+		case <-ticker.C:
+		}
+
+		_, err = h.bot.Send(tgbotapi.NewMessage(chatID, text))
+		if err == nil {
+			sent++
+
+			continue
+		}
+
+		var tgErr *tgbotapi.Error
+		if errors.As(err, &tgErr) && tgErr.Code == http.StatusForbidden {
+			blocked++
+
+			continue
+		}
+
+		failed++
+		h.log.Error("Error broadcasting message", "chat_id", chatID, "err", err)
+	}
+
+	if notReached > 0 {
+		h.log.Warn(
+			"Broadcast interrupted", "sent", sent, "blocked", blocked, "failed", failed, "stopped", stopped,
+			"not_reached", notReached,
+		)
+
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Broadcast interrupted, %d chats not reached: %d sent, %d blocked, %d failed, %d skipped as stopped",
+			notReached, sent, blocked, failed, stopped,
+		))
+
+		return
+	}
+
+	h.log.Info("Broadcast finished", "sent", sent, "blocked", blocked, "failed", failed, "stopped", stopped)
+
+	summary := fmt.Sprintf(
+		"Broadcast finished: %d sent, %d blocked, %d failed, %d skipped as stopped", sent, blocked, failed, stopped,
+	)
+	h.reply(message.Chat.ID, summary)
+}
+
+// AddImage stores photo or animation from message or replied message with tags from command arguments
+func (h *Handler) AddImage(ctx context.Context, message *tgbotapi.Message) {
+	file, ok := uploadedFile(message)
+	source := message
+	if !ok && message.ReplyToMessage != nil {
+		file, ok = uploadedFile(message.ReplyToMessage)
+		source = message.ReplyToMessage
+	}
+
+	if !ok {
+		h.reply(message.Chat.ID, "Please send a photo or animation with /add_image <tags> caption or reply to one")
+
+		return
+	}
+
+	if err := h.checkUploadSize(source); err != nil {
+		h.reply(message.Chat.ID, "Image is too large: "+err.Error())
+
+		return
+	}
+
+	tags, invalid := domain.NormalizeTags(message.CommandArguments())
+	if len(tags) == 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Please add at least one valid tag, e.g. /add_image happy. "+
+				"Tags may contain letters, digits, _ and - only, up to %d characters.",
+			domain.MaxTagLength,
+		))
+
+		return
+	}
+
+	if message.From != nil {
+		file.UploaderID = message.From.ID
+	}
+
+	file, err := h.services.Image.AddImage(ctx, h.withHash(ctx, file), tags)
+	if err != nil {
+		var duplicateErr *image.DuplicateError
+		if errors.As(err, &duplicateErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf("This picture is already in library with ID %d", duplicateErr.ExistingID))
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error adding image")
+
+		return
+	}
+
+	text := fmt.Sprintf("Image added with ID %d, tags: %s", file.ID, strings.Join(tags, ", "))
+	if len(invalid) > 0 {
+		text += "\nSkipped invalid tags: " + strings.Join(invalid, ", ")
+	}
+
+	h.reply(message.Chat.ID, text)
+}
+
+// uploadedFile returns image attached to message, uploaded images have no local file, name only keeps them unique
+func uploadedFile(message *tgbotapi.Message) (domain.File, bool) {
+	if message.Animation != nil {
+		return domain.File{
+			Name: "tg_" + message.Animation.FileUniqueID + ".mp4",
+			TgID: message.Animation.FileID,
+			Type: domain.TypeAnimation,
+		}, true
+	}
+
+	if len(message.Photo) == 0 {
+		return domain.File{}, false
+	}
+
+	// pick the highest resolution
+	best := message.Photo[0]
+	for _, size := range message.Photo[1:] {
+		if size.Width*size.Height > best.Width*best.Height {
+			best = size
+		}
+	}
+
+	return domain.File{
+		Name: "tg_" + best.FileUniqueID + ".jpg",
+		TgID: best.FileID,
+		Type: domain.TypePhoto,
+	}, true
+}
+
+// checkUploadSize validates image attached to message against configured limits
+func (h *Handler) checkUploadSize(message *tgbotapi.Message) error {
+	limits := domain.ImageLimits{
+		PhotoBytes:      h.cfg.MaxPhotoBytes,
+		AnimationBytes:  h.cfg.MaxAnimationBytes,
+		PhotoDimensions: h.cfg.MaxPhotoDimensions,
+	}
+
+	if message.Animation != nil {
+		a := message.Animation
+
+		return limits.Check(domain.TypeAnimation, a.Width, a.Height, int64(a.FileSize))
+	}
+
+	// only the largest size is stored by uploadedFile
+	var largest tgbotapi.PhotoSize
+	for _, size := range message.Photo {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+
+	return limits.Check(domain.TypePhoto, largest.Width, largest.Height, int64(largest.FileSize))
+}
+
+// ByUploader lists images added by user
+func (h *Handler) ByUploader(ctx context.Context, message *tgbotapi.Message) {
+	uploaderID, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil || uploaderID <= 0 {
+		h.reply(message.Chat.ID, "Please enter user ID, e.g. /by_uploader 123456")
+
+		return
+	}
+
+	files, err := h.services.Image.GetByUploader(ctx, uploaderID)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf("User %d has not added any images", uploaderID))
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error getting images by uploader", "uploader_id", uploaderID)
+
+		return
+	}
+
+	lines := make([]string, 0, len(files)+1)
+	lines = append(lines, fmt.Sprintf("Images added by user %d:", uploaderID))
+	for _, file := range files {
+		lines = append(lines, fmt.Sprintf(
+			"ID %d, %s, added %s", file.ID, file.Rating, time.Unix(file.UploadedAt, 0).Format(time.DateTime),
+		))
+		if file.IsDeleted() {
+			lines[len(lines)-1] += ", deleted"
+		}
+	}
+
+	h.reply(message.Chat.ID, strings.Join(lines, "\n"))
+}
+
+// DeleteImage sends image preview and asks for deletion confirmation
+func (h *Handler) DeleteImage(ctx context.Context, message *tgbotapi.Message) {
+	id, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		h.reply(message.Chat.ID, "Please enter image ID, e.g. /delete_image 42")
+
+		return
+	}
+
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf("Image #%d not found", id))
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error getting image")
+
+		return
+	}
+
+	preview, err := attachment.New(h.cfg.ImagesDirPath, file, message.Chat.ID)
+	if err != nil {
+		h.log.Error("Error creating preview", "chat_id", message.Chat.ID, "err", err)
+	} else if _, err = h.bot.Send(preview); err != nil {
+		h.log.Error("Error sending preview", "chat_id", message.Chat.ID, "err", err)
+	}
+
+	data := func(action string) string {
+		return fmt.Sprintf("%s%s:%d", DeleteImageCallbackPrefix, action, id)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Delete image #%d (%s)?", id, file.Name))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Confirm", data(deleteConfirmAction)),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", data(deleteCancelAction)),
+		),
+	)
+
+	_, err = h.bot.Send(msg)
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+}
+
+// DeleteImageCallback handles Confirm and Cancel buttons of DeleteImage prompt
+func (h *Handler) DeleteImageCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.From == nil || !h.cfg.IsAdmin(query.From.ID) {
+		h.answer(query.ID, "Only admins can do this")
+
+		return
+	}
+
+	action, rawID, _ := strings.Cut(strings.TrimPrefix(query.Data, DeleteImageCallbackPrefix), ":")
+
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		h.log.Warn("Malformed callback data", "data", query.Data)
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	var result string
+
+	switch action {
+	case deleteCancelAction:
+		result = fmt.Sprintf("Deletion of image #%d cancelled", id)
+	case deleteConfirmAction:
+		result = h.deleteImage(ctx, id)
+	default:
+		h.log.Warn("Unknown callback action", "data", query.Data)
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	if query.Message != nil {
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, result)
+		if _, err = h.bot.Send(edit); err != nil {
+			h.log.Error("Error editing message", "chat_id", query.Message.Chat.ID, "err", err)
+		}
+	}
+
+	h.answer(query.ID, result)
+}
+
+func (h *Handler) deleteImage(ctx context.Context, id int64) string {
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Sprintf("Image #%d not found", id)
+	}
+
+	err = h.services.Image.DeleteImage(ctx, file)
+	if err != nil {
+		h.log.Error("Error deleting image", "image_id", id, "err", err)
+
+		return fmt.Sprintf("Can not delete image #%d :d", id)
+	}
+
+	h.log.Info("Image deleted", "image_id", id, "file", file.Name)
+
+	if h.cfg.ImageSource == config.ImageSourceDir {
+		return fmt.Sprintf("Image #%d deleted", id)
+	}
+
+	return fmt.Sprintf(
+		"Image #%d deleted, it can be restored with /restore_image %d within %s",
+		id, id, time_string.ShortDur(h.cfg.ImageRestoreWindow),
+	)
+}
+
+// RestoreImage brings back image deleted within restore window
+func (h *Handler) RestoreImage(ctx context.Context, message *tgbotapi.Message) {
+	id, err := strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+	if err != nil {
+		h.reply(message.Chat.ID, "Please enter image ID, e.g. /restore_image 42")
+
+		return
+	}
+
+	file, err := h.services.Image.RestoreImage(ctx, id)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"Image #%d was not deleted within last %s", id, time_string.ShortDur(h.cfg.ImageRestoreWindow),
+			))
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error restoring image", "image_id", id)
+
+		return
+	}
+
+	h.log.Info("Image restored", "image_id", id, "file", file.Name)
+	h.reply(message.Chat.ID, fmt.Sprintf("Image #%d restored", id))
+}
+
+// RateImage sets rating of image, nsfw images are sent only to chats allowing all ratings
+func (h *Handler) RateImage(ctx context.Context, message *tgbotapi.Message) {
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+	if len(args) != 2 || (args[1] != domain.RatingSFW && args[1] != domain.RatingNSFW) {
+		h.reply(message.Chat.ID, "Please enter image ID and rating, e.g. /rate_image 42 nsfw")
+
+		return
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		h.reply(message.Chat.ID, "Please enter valid image ID, e.g. /rate_image 42 nsfw")
+
+		return
+	}
+
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil {
+		h.reply(message.Chat.ID, fmt.Sprintf("Image #%d not found", id))
+
+		return
+	}
+
+	_, err = h.services.Image.SetRating(ctx, file, args[1])
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting image rating")
+
+		return
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Image #%d rated %s", id, args[1]))
+}
+
+// Maintenance toggles maintenance mode in which only admins can use the bot
+func (h *Handler) Maintenance(ctx context.Context, message *tgbotapi.Message) {
+	var on bool
+
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	default:
+		status := "off"
+		if h.services.State.Maintenance() {
+			status = "on"
+		}
+
+		h.reply(message.Chat.ID, fmt.Sprintf("Maintenance mode is %s. Please choose on or off, e.g. /maintenance on", status))
+
+		return
+	}
+
+	err := h.services.State.SetMaintenance(ctx, on)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting maintenance mode")
+
+		return
+	}
+
+	h.log.Info("Maintenance mode changed", "on", on, "chat_id", message.Chat.ID)
+
+	if on {
+		h.reply(message.Chat.ID, "Maintenance mode enabled, only admins can use the bot")
+	} else {
+		h.reply(message.Chat.ID, "Maintenance mode disabled")
+	}
+}
+
+func (h *Handler) FeedbackList(ctx context.Context, message *tgbotapi.Message) {
+	text, markup := h.feedbackPage(ctx, message.Chat.ID, 0)
+
+	_, err := h.bot.Send(pagination.Message(message.Chat.ID, text, markup))
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+}
+
+// FeedbackPage shows another page of FeedbackList
+func (h *Handler) FeedbackPage(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.From == nil || !h.cfg.IsAdmin(query.From.ID) {
+		h.answer(query.ID, "Only admins can do this")
+
+		return
+	}
+
+	page, ok := pagination.ParsePage(query.Data, FeedbackCallbackPrefix)
+	if !ok || query.Message == nil {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	text, markup := h.feedbackPage(ctx, query.Message.Chat.ID, page)
+
+	_, err := h.bot.Send(pagination.Edit(query.Message, text, markup))
+	if err != nil {
+		h.log.Error("Error editing message", "chat_id", query.Message.Chat.ID, "err", err)
+	}
+
+	h.answer(query.ID, "")
+}
+
+// feedbackPage returns text of feedback page with navigation buttons, errors are reported in text
+func (h *Handler) feedbackPage(ctx context.Context, chatID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	list, err := h.services.Feedback.ListRecent(ctx, feedbackListLimit)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return "No feedback yet", nil
+		}
+
+		return h.errorText(ctx, chatID, err, "Error listing feedback"), nil
+	}
+
+	list, page, pages := pagination.Page(list, page, h.cfg.ListPageSize)
+
+	lines := make([]string, 0, len(list))
+	for _, fb := range list {
+		text := fb.Text
+		if runes := []rune(text); len(runes) > maxFeedbackPreview {
+			text = string(runes[:maxFeedbackPreview]) + "…"
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"#%d %s from user %d in chat %d:\n%s",
+			fb.ID, fb.CreatedAtAsUnixTime().Format(time.DateTime), fb.UserID, fb.ChatID, text,
+		))
+	}
+
+	text := pagination.WithPageNumber(strings.Join(lines, "\n\n"), page, pages)
+
+	return text, pagination.Keyboard(FeedbackCallbackPrefix, page, pages)
+}
+
+// SubsCount shows number of active subscriptions with breakdown by period
+func (h *Handler) SubsCount(ctx context.Context, message *tgbotapi.Message) {
+	counts, err := h.services.Subscription.CountByPeriod(ctx)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error counting subscriptions")
+
+		return
+	}
+
+	total := 0
+	lines := make([]string, 0, len(counts))
+	for _, c := range counts {
+		total += c.Count
+		lines = append(lines, fmt.Sprintf("every %s: %d", time_string.ShortDur(c.PeriodAsDurationInSeconds()), c.Count))
+	}
+
+	if total == 0 {
+		h.reply(message.Chat.ID, "No active subscriptions")
+
+		return
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Active subscriptions: %d\n%s", total, strings.Join(lines, "\n")))
+}
+
+func (h *Handler) answer(queryID, text string) {
+	_, err := h.bot.Request(tgbotapi.NewCallback(queryID, text))
+	if err != nil {
+		h.log.Error("Error answering callback", "err", err)
+	}
+}
+
+// errorText returns reply to err in chat language, unexpected errors are logged with msg and args
+func (h *Handler) errorText(ctx context.Context, chatID int64, err error, msg string, args ...any) string {
+	settings, _ := h.services.Chat.GetSettings(ctx, chatID)
+
+	return errmsg.Reply(h.log, h.cfg, settings.Language, chatID, err, msg, args...)
+}
+
+// replyError sends errorText to chat
+func (h *Handler) replyError(ctx context.Context, chatID int64, err error, msg string, args ...any) {
+	h.reply(chatID, h.errorText(ctx, chatID, err, msg, args...))
+}
+
+func (h *Handler) reply(chatID int64, text string) {
+	for _, chunk := range text_split.Split(text, maxMessageLength) {
+		_, err := h.bot.Send(tgbotapi.NewMessage(chatID, chunk))
+		if err != nil {
+			h.log.Error("Error sending message", "chat_id", chatID, "err", err)
+
+			return
+		}
+	}
+}
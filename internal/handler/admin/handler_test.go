@@ -0,0 +1,351 @@
+package admin
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository"
+	"apubot/internal/service"
+	"apubot/internal/service/chat"
+	"apubot/internal/testutil"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestHandler creates handler using real services with empty db and fake Telegram
+func newTestHandler(t *testing.T) (*Handler, *testutil.Sender) {
+	t.Helper()
+
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	cfg, err := config.NewConfig("../../../config")
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	cfg.IsDebug = false
+	cfg.ImagesDirPath = t.TempDir()
+	cfg.AdminIDs = []int64{100}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := database.New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+
+	services := service.New(&service.InitParams{
+		Config:       cfg,
+		Logger:       log,
+		Repositories: repository.New(&repository.InitParams{Config: cfg, DB: db}),
+	})
+
+	bot := &testutil.Sender{}
+	h := New(cfg, log, bot, &Services{
+		Chat:         services.Chat,
+		Image:        services.Image,
+		Feedback:     services.Feedback,
+		State:        services.State,
+		Subscription: services.Subscription,
+		Suggestion:   services.Suggestion,
+		Source:       services.Source,
+	})
+
+	t.Cleanup(func() {
+		_ = services.Subscription.Stop(context.Background())
+		_ = db.Close()
+	})
+
+	return h, bot
+}
+
+// command returns command message from admin in private chat
+func command(text string) *tgbotapi.Message {
+	name, _, _ := strings.Cut(text, " ")
+
+	return &tgbotapi.Message{
+		MessageID: 1,
+		Chat:      &tgbotapi.Chat{ID: 100, Type: "private"},
+		From:      &tgbotapi.User{ID: 100},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+// photo returns sizes of photo as Telegram sends them, from the smallest to the largest
+func photo(id string) []tgbotapi.PhotoSize {
+	return []tgbotapi.PhotoSize{
+		{FileID: id + "-small", FileUniqueID: id + "-s", Width: 90, Height: 60},
+		{FileID: id, FileUniqueID: id + "-l", Width: 1280, Height: 853},
+		{FileID: id + "-medium", FileUniqueID: id + "-m", Width: 320, Height: 213},
+	}
+}
+
+func TestAddImageSavesLargestPhoto(t *testing.T) {
+	h, bot := newTestHandler(t)
+	bot.ServeFiles(t, map[string][]byte{"cat": []byte("cat picture")})
+
+	message := command("/add_image Happy cat")
+	message.Photo = photo("cat")
+
+	h.AddImage(context.Background(), message)
+
+	if got := bot.Texts(100); len(got) != 1 || got[0] != "Image added with ID 1, tags: happy, cat" {
+		t.Fatalf("got replies %q, want image added with ID 1", got)
+	}
+
+	file, err := h.services.Image.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("added image not found: %v", err)
+	}
+
+	if file.TgID != "cat" || file.Name != "tg_cat-l.jpg" || file.Type != domain.TypePhoto {
+		t.Errorf("saved %+v, want the largest photo size", file)
+	}
+
+	if file.UploaderID != 100 {
+		t.Errorf("saved uploader %d, want 100", file.UploaderID)
+	}
+
+	if file.Hash != domain.ContentHash([]byte("cat picture")) {
+		t.Errorf("saved hash %q, want hash of downloaded file", file.Hash)
+	}
+
+	tags, err := h.services.Image.GetTags(context.Background(), file)
+	if err != nil || strings.Join(tags, ",") != "cat,happy" && strings.Join(tags, ",") != "happy,cat" {
+		t.Errorf("saved tags %q, %v, want happy and cat", tags, err)
+	}
+}
+
+func TestAddImageFromRepliedMessage(t *testing.T) {
+	h, bot := newTestHandler(t)
+	bot.ServeFiles(t, map[string][]byte{"dog": []byte("dog picture")})
+
+	message := command("/add_image dog")
+	message.ReplyToMessage = &tgbotapi.Message{MessageID: 2, Chat: message.Chat, Photo: photo("dog")}
+
+	h.AddImage(context.Background(), message)
+
+	if got := bot.Texts(100); len(got) != 1 || got[0] != "Image added with ID 1, tags: dog" {
+		t.Fatalf("got replies %q, want image added with ID 1", got)
+	}
+}
+
+func TestAddImageWithoutHashIsStillAdded(t *testing.T) {
+	// file server is not started, so download fails
+	h, bot := newTestHandler(t)
+
+	message := command("/add_image happy")
+	message.Photo = photo("cat")
+
+	h.AddImage(context.Background(), message)
+
+	if got := bot.Texts(100); len(got) != 1 || got[0] != "Image added with ID 1, tags: happy" {
+		t.Fatalf("got replies %q, want image added with ID 1", got)
+	}
+
+	file, err := h.services.Image.GetByID(context.Background(), 1)
+	if err != nil || file.Hash != "" {
+		t.Errorf("saved %+v, %v, want image without hash", file, err)
+	}
+}
+
+func TestAddImageDuplicate(t *testing.T) {
+	h, bot := newTestHandler(t)
+	bot.ServeFiles(t, map[string][]byte{
+		"cat":       []byte("cat picture"),
+		"cat-again": []byte("cat picture"),
+	})
+
+	message := command("/add_image cat")
+	message.Photo = photo("cat")
+	h.AddImage(context.Background(), message)
+
+	// the same picture forwarded again gets other file ID
+	message = command("/add_image cat")
+	message.Photo = photo("cat-again")
+	h.AddImage(context.Background(), message)
+
+	got := bot.Texts(100)
+	if len(got) != 2 || got[1] != "This picture is already in library with ID 1" {
+		t.Errorf("got replies %q, want duplicate of image 1 reported", got)
+	}
+}
+
+func TestBroadcastSkipsStoppedChats(t *testing.T) {
+	h, bot := newTestHandler(t)
+	ctx := context.Background()
+
+	for _, chatID := range []int64{1, 2, 3} {
+		h.services.Chat.Register(ctx, chatID)
+	}
+
+	if err := h.services.Chat.SetStopped(ctx, 2, true); err != nil {
+		t.Fatalf("can not stop chat: %v", err)
+	}
+
+	h.Broadcast(ctx, command("/broadcast Hello everyone!"))
+
+	for chatID, want := range map[int64]int{1: 1, 2: 0, 3: 1} {
+		if got := bot.Texts(chatID); len(got) != want {
+			t.Errorf("chat %d got %q, want %d messages", chatID, got, want)
+		}
+	}
+
+	want := "Broadcast finished: 2 sent, 0 blocked, 0 failed, 1 skipped as stopped"
+	if got := bot.Texts(100); len(got) != 1 || got[0] != want {
+		t.Errorf("admin got %q, want %q", got, want)
+	}
+}
+
+func TestBroadcastStopsWhenCancelled(t *testing.T) {
+	h, bot := newTestHandler(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, chatID := range []int64{1, 2, 3, 4, 5} {
+		h.services.Chat.Register(ctx, chatID)
+	}
+
+	// shutdown arrives while the second chat is being sent to
+	bot.OnSend = func(c tgbotapi.Chattable) {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok && msg.ChatID == 2 {
+			cancel()
+		}
+	}
+
+	h.Broadcast(ctx, command("/broadcast Hello everyone!"))
+
+	for chatID, want := range map[int64]int{1: 1, 2: 1, 3: 0, 4: 0, 5: 0} {
+		if got := bot.Texts(chatID); len(got) != want {
+			t.Errorf("chat %d got %q, want %d messages", chatID, got, want)
+		}
+	}
+
+	want := "Broadcast interrupted, 3 chats not reached: 2 sent, 0 blocked, 0 failed, 0 skipped as stopped"
+	if got := bot.Texts(100); len(got) != 1 || got[0] != want {
+		t.Errorf("admin got %q, want %q", got, want)
+	}
+}
+
+func TestBroadcastSkipsChatsWithUnreadableSettings(t *testing.T) {
+	h, bot := newTestHandler(t)
+
+	repo := &testutil.ChatRepository{
+		Settings: map[int64]domain.ChatSettings{
+			1: domain.DefaultChatSettings(1),
+			2: {ChatID: 2, Stopped: true},
+			3: domain.DefaultChatSettings(3),
+		},
+		Unreadable: map[int64]bool{2: true},
+	}
+	h.services.Chat = chat.New(h.cfg, h.log, repo)
+
+	h.Broadcast(context.Background(), command("/broadcast Hello everyone!"))
+
+	for chatID, want := range map[int64]int{1: 1, 2: 0, 3: 1} {
+		if got := bot.Texts(chatID); len(got) != want {
+			t.Errorf("chat %d got %q, want %d messages", chatID, got, want)
+		}
+	}
+
+	want := "Broadcast finished: 2 sent, 0 blocked, 1 failed, 0 skipped as stopped"
+	if got := bot.Texts(100); len(got) != 1 || got[0] != want {
+		t.Errorf("admin got %q, want %q", got, want)
+	}
+}
+
+func TestAddImageRejected(t *testing.T) {
+	noTags := "Please add at least one valid tag, e.g. /add_image happy. " +
+		"Tags may contain letters, digits, _ and - only, up to 32 characters."
+
+	tests := []struct {
+		name      string
+		text      string
+		photo     []tgbotapi.PhotoSize
+		animation *tgbotapi.Animation
+		reply     bool
+		want      string
+		config    func(cfg *config.Config)
+	}{
+		{
+			name: "no picture",
+			text: "/add_image happy",
+			want: "Please send a photo or animation with /add_image <tags> caption or reply to one",
+		},
+		{
+			name:  "no tags",
+			text:  "/add_image",
+			photo: photo("cat"),
+			want:  noTags,
+		},
+		{
+			name:  "only invalid tags",
+			text:  "/add_image #happy? c@t",
+			photo: photo("cat"),
+			want:  noTags,
+		},
+		{
+			name:  "too large",
+			text:  "/add_image happy",
+			photo: []tgbotapi.PhotoSize{{FileID: "cat", FileUniqueID: "cat", Width: 100, Height: 100, FileSize: 2048}},
+			want:  "Image is too large: file is 2 KB, max allowed size is 1 KB",
+			config: func(cfg *config.Config) {
+				cfg.MaxPhotoBytes = 1024
+			},
+		},
+		{
+			name:  "too large in replied message",
+			text:  "/add_image happy",
+			photo: []tgbotapi.PhotoSize{{FileID: "cat", FileUniqueID: "cat", Width: 100, Height: 100, FileSize: 11 << 20}},
+			reply: true,
+			want:  "Image is too large: file is 11.0 MB, max allowed size is 10.0 MB",
+		},
+		{
+			name:  "photo dimensions",
+			text:  "/add_image happy",
+			photo: []tgbotapi.PhotoSize{{FileID: "cat", FileUniqueID: "cat", Width: 8000, Height: 4000, FileSize: 1024}},
+			want:  "Image is too large: photo is 8000x4000, width and height must not exceed 10000 in total",
+		},
+		{
+			name:      "animation",
+			text:      "/add_image happy",
+			animation: &tgbotapi.Animation{FileID: "dance", FileUniqueID: "dance", Width: 8000, Height: 4000, FileSize: 51 << 20},
+			want:      "Image is too large: file is 51.0 MB, max allowed size is 50.0 MB",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t)
+			if tt.config != nil {
+				tt.config(h.cfg)
+			}
+
+			message := command(tt.text)
+			attached := message
+			if tt.reply {
+				attached = &tgbotapi.Message{MessageID: 2, Chat: message.Chat}
+				message.ReplyToMessage = attached
+			}
+			attached.Photo = tt.photo
+			attached.Animation = tt.animation
+
+			h.AddImage(context.Background(), message)
+
+			if got := bot.Texts(100); len(got) != 1 || !strings.HasPrefix(got[0], tt.want) {
+				t.Errorf("got replies %q, want %q", got, tt.want)
+			}
+
+			if count, err := h.services.Image.CountImages(context.Background(), ""); err != nil || count != 0 {
+				t.Errorf("library has %d images, %v, want none added", count, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"github.com/pkg/errors"
+)
+
+// maxHashedSize is max size of file bots can download from Telegram
+const maxHashedSize = 20 << 20
+
+// fileHash downloads uploaded file and returns hex sha256 of its content
+func (h *Handler) fileHash(ctx context.Context, tgID string) (string, error) {
+	url, err := h.bot.GetFileDirectURL(tgID)
+	if err != nil {
+		return "", errors.Wrap(err, "can not get file url")
+	}
+
+	data, err := download(ctx, url, maxHashedSize)
+	if err != nil {
+		return "", err
+	}
+
+	return domain.ContentHash(data), nil
+}
+
+// withHash sets hash of uploaded file, file is added without it if download fails so duplicates are only not detected
+func (h *Handler) withHash(ctx context.Context, file domain.File) domain.File {
+	hash, err := h.fileHash(ctx, file.TgID)
+	if err != nil {
+		h.log.Warn("Can not hash uploaded file, skipping duplicate check", "name", file.Name, "err", err)
+
+		return file
+	}
+
+	file.Hash = hash
+
+	return file
+}
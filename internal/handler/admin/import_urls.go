@@ -0,0 +1,281 @@
+package admin
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/service/image"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxImportURLs limits pictures imported by single /import_urls
+	maxImportURLs = 200
+	// maxURLListSize limits size of document with URLs
+	maxURLListSize = 64 << 10
+	// maxImportedSize is max size of file bots can upload to Telegram, smaller limits are checked by ImageLimits
+	maxImportedSize = 50 << 20
+)
+
+// importedExtensions maps detected content type of supported picture to extension it is saved with
+var importedExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+type importResult struct {
+	url  string
+	file domain.File
+	err  error
+}
+
+// ImportURLs adds pictures downloaded from URLs listed one per line in document or command arguments,
+// tags from the first argument line are added to all of them. Downloads take longer than request timeout,
+// so command is registered as long running, summary is sent to admin when all downloads finish.
+func (h *Handler) ImportURLs(ctx context.Context, message *tgbotapi.Message) {
+	rawTags, rawURLs, _ := strings.Cut(message.CommandArguments(), "\n")
+	if strings.Contains(rawTags, "://") {
+		// no tags given, URLs start right after command
+		rawTags, rawURLs = "", message.CommandArguments()
+	}
+
+	doc := message.Document
+	if doc == nil && message.ReplyToMessage != nil {
+		doc = message.ReplyToMessage.Document
+	}
+
+	if doc != nil {
+		fileURL, err := h.bot.GetFileDirectURL(doc.FileID)
+		if err != nil {
+			h.replyError(ctx, message.Chat.ID, err, "Error getting document url")
+
+			return
+		}
+
+		data, err := download(ctx, fileURL, maxURLListSize)
+		if err != nil {
+			h.reply(message.Chat.ID, "Can not read document: "+err.Error())
+
+			return
+		}
+
+		rawURLs = string(data)
+	}
+
+	tags, invalid := domain.NormalizeTags(rawTags)
+	if len(invalid) > 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Invalid tags: %s. Tags may contain letters, digits, _ and - only, up to %d characters.",
+			strings.Join(invalid, ", "), domain.MaxTagLength,
+		))
+
+		return
+	}
+
+	urls, malformed := parseURLs(rawURLs)
+	if len(urls) == 0 {
+		h.reply(message.Chat.ID, "Please send a document with picture URLs, one per line, "+
+			"with /import_urls <tags> caption or reply to one")
+
+		return
+	}
+
+	if len(urls) > maxImportURLs {
+		h.reply(message.Chat.ID, fmt.Sprintf("Too many URLs, at most %d can be imported at once", maxImportURLs))
+
+		return
+	}
+
+	var uploaderID int64
+	if message.From != nil {
+		uploaderID = message.From.ID
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Importing %d pictures, I will report when it is done", len(urls)))
+
+	h.importURLs(ctx, message.Chat.ID, uploaderID, urls, malformed, tags)
+}
+
+// importURLs downloads pictures with at most import_concurrency downloads at once and reports results
+func (h *Handler) importURLs(
+	ctx context.Context,
+	chatID int64,
+	uploaderID int64,
+	urls []string,
+	malformed []string,
+	tags []string,
+) {
+	results := make([]importResult, len(urls))
+	sem := make(chan struct{}, h.cfg.ImportConcurrency)
+
+	var wg sync.WaitGroup
+
+	for i, rawURL := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			file, err := h.importURL(ctx, rawURL, uploaderID, tags)
+			results[i] = importResult{url: rawURL, file: file, err: err}
+		}()
+	}
+
+	wg.Wait()
+
+	var added, failed []string
+	for _, res := range results {
+		if res.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", res.url, res.err))
+
+			continue
+		}
+
+		added = append(added, fmt.Sprintf("#%d", res.file.ID))
+	}
+
+	for _, line := range malformed {
+		failed = append(failed, line+": not a valid http or https URL")
+	}
+
+	h.log.Info("Import from URLs finished", "added", len(added), "failed", len(failed), "uploader_id", uploaderID)
+
+	text := fmt.Sprintf("Import finished: %d added, %d failed", len(added), len(failed))
+	if len(added) > 0 {
+		text += "\nAdded: " + strings.Join(added, ", ")
+	}
+
+	if len(failed) > 0 {
+		text += "\nFailed:\n" + strings.Join(failed, "\n")
+	}
+
+	h.reply(chatID, text)
+}
+
+// importURL downloads picture to images directory and adds it to library, errors are meant for admin
+func (h *Handler) importURL(ctx context.Context, rawURL string, uploaderID int64, tags []string) (domain.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.ImportTimeout)
+	defer cancel()
+
+	data, err := download(ctx, rawURL, maxImportedSize)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	ext, ok := importedExtensions[http.DetectContentType(data)]
+	if !ok {
+		return domain.File{}, errors.New("not a JPEG, PNG or GIF picture")
+	}
+
+	hash := domain.ContentHash(data)
+	// name is derived from content, so the same picture is not saved twice
+	name := "url_" + hash[:16] + ext
+	path := filepath.Join(h.cfg.ImagesDirPath, name)
+
+	// file is created exclusively, so of concurrent imports of the same picture only one saves it
+	// and the others can not remove file it added to library
+	err = writeNewFile(path, data)
+	if errors.Is(err, os.ErrExist) {
+		return domain.File{}, errors.Errorf("already imported as %s", name)
+	}
+
+	if err != nil {
+		h.log.Error("Error saving imported picture", "url", rawURL, "err", err)
+
+		return domain.File{}, errors.New("can not save picture")
+	}
+
+	remove := func() {
+		if err := os.Remove(path); err != nil {
+			h.log.Error("Error removing imported picture", "name", name, "err", err)
+		}
+	}
+
+	limits := domain.ImageLimits{
+		PhotoBytes:      h.cfg.MaxPhotoBytes,
+		AnimationBytes:  h.cfg.MaxAnimationBytes,
+		PhotoDimensions: h.cfg.MaxPhotoDimensions,
+	}
+
+	if err = limits.CheckFile(path); err != nil {
+		remove()
+
+		return domain.File{}, err
+	}
+
+	file, err := h.services.Image.AddImage(ctx, domain.File{
+		Name:       name,
+		Type:       domain.TypeByName(name),
+		UploaderID: uploaderID,
+		Hash:       hash,
+		SourceURL:  rawURL,
+	}, tags)
+	if err != nil {
+		remove()
+
+		var duplicateErr *image.DuplicateError
+		if errors.As(err, &duplicateErr) {
+			return domain.File{}, errors.Errorf("already in library with ID %d", duplicateErr.ExistingID)
+		}
+
+		h.log.Error("Error adding imported picture", "url", rawURL, "err", err)
+
+		return domain.File{}, errors.New("can not add picture")
+	}
+
+	return file, nil
+}
+
+// writeNewFile creates file with data, os.ErrExist is returned if it already exists
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+	}
+
+	return err
+}
+
+// parseURLs returns distinct http and https URLs from lines of text, other non-empty lines are returned as malformed
+func parseURLs(text string) (urls []string, malformed []string) {
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+
+		seen[line] = true
+
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			malformed = append(malformed, line)
+
+			continue
+		}
+
+		urls = append(urls, line)
+	}
+
+	return urls, malformed
+}
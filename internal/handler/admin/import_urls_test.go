@@ -0,0 +1,274 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pngImage returns encoded square picture, colors make pictures of the same size differ
+func pngImage(t *testing.T, size int, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("can not encode png: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImportURLs(t *testing.T) {
+	h, bot := newTestHandler(t)
+	h.cfg.MaxPhotoDimensions = 200
+
+	red := pngImage(t, 10, color.RGBA{R: 255, A: 255})
+	bot.ServeFiles(t, map[string][]byte{
+		"red.png":   red,
+		"green.png": pngImage(t, 10, color.RGBA{G: 255, A: 255}),
+		"copy.png":  red,
+		"page.html": []byte("<html><body>not a picture</body></html>"),
+		"huge.png":  pngImage(t, 150, color.Black),
+	})
+
+	base := bot.FileServer.URL
+	urls := []string{
+		base + "/red.png",
+		base + "/green.png",
+		base + "/page.html",
+		base + "/missing.png",
+		base + "/huge.png",
+		base + "/copy.png",
+	}
+	bot.Files["list.txt"] = []byte(strings.Join(urls, "\n") + "\nftp://example.com/cat.png\n\nnot a url\n" + urls[0])
+
+	message := command("/import_urls Happy cat")
+	message.Document = &tgbotapi.Document{FileID: "list.txt"}
+
+	h.ImportURLs(context.Background(), message)
+
+	got := bot.Texts(100)
+	if len(got) != 2 {
+		t.Fatalf("got replies %q, want start and summary", got)
+	}
+
+	if got[0] != "Importing 6 pictures, I will report when it is done" {
+		t.Errorf("first reply is %q, want import started", got[0])
+	}
+
+	if !strings.HasPrefix(got[1], "Import finished: 2 added, 6 failed\nAdded: #") {
+		t.Fatalf("summary is %q, want 2 added and 6 failed", got[1])
+	}
+
+	// red picture and its copy are downloaded concurrently, either of them is added
+	failed := []string{
+		base + "/page.html: not a JPEG, PNG or GIF picture",
+		base + "/missing.png: unexpected status 404",
+		base + "/huge.png: ",
+		"ftp://example.com/cat.png: not a valid http or https URL",
+		"not a url: not a valid http or https URL",
+	}
+	for _, want := range failed {
+		if !strings.Contains(got[1], "\n"+want) {
+			t.Errorf("summary %q does not report %q", got[1], want)
+		}
+	}
+
+	for _, want := range []string{"#1", "#2"} {
+		if !strings.Contains(got[1], want) {
+			t.Errorf("summary %q does not report %s added", got[1], want)
+		}
+	}
+
+	var sources []string
+	for id := int64(1); id <= 2; id++ {
+		file, err := h.services.Image.GetByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("imported image %d not found: %v", id, err)
+		}
+
+		if file.UploaderID != 100 || !strings.HasPrefix(file.Name, "url_") || file.Hash == "" {
+			t.Errorf("saved %+v, want imported picture of admin", file)
+		}
+
+		if tags := imageTags(t, h, file); !slices.Equal(tags, []string{"cat", "happy"}) {
+			t.Errorf("image %d has tags %q, want shared tags", id, tags)
+		}
+
+		sources = append(sources, strings.TrimPrefix(file.SourceURL, base))
+	}
+
+	slices.Sort(sources)
+	if sources[0] != "/green.png" || sources[1] != "/copy.png" && sources[1] != "/red.png" {
+		t.Errorf("saved source URLs %q, want green and red pictures", sources)
+	}
+
+	// rejected pictures are not left in images folder
+	entries, err := os.ReadDir(h.cfg.ImagesDirPath)
+	if err != nil {
+		t.Fatalf("can not read images folder: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("images folder has %d files, want 2 imported ones", len(entries))
+	}
+
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".png" {
+			t.Errorf("picture saved as %s, want .png extension", entry.Name())
+		}
+	}
+}
+
+func TestImportURLsFromArguments(t *testing.T) {
+	h, bot := newTestHandler(t)
+	bot.ServeFiles(t, map[string][]byte{"red.png": pngImage(t, 10, color.RGBA{R: 255, A: 255})})
+
+	// without tags URLs start right after command
+	h.ImportURLs(context.Background(), command("/import_urls "+bot.FileServer.URL+"/red.png"))
+
+	got := bot.Texts(100)
+	if len(got) != 2 || got[1] != "Import finished: 1 added, 0 failed\nAdded: #1" {
+		t.Errorf("summary is %q, want 1 added", got[1])
+	}
+
+	file, err := h.services.Image.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("imported image not found: %v", err)
+	}
+
+	if tags := imageTags(t, h, file); len(tags) != 0 {
+		t.Errorf("image has tags %q, want none", tags)
+	}
+}
+
+func TestImportURLsStopsOnCancel(t *testing.T) {
+	h, bot := newTestHandler(t)
+
+	// server never answers, like one hanging while bot shuts down
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(hanging.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	h.ImportURLs(ctx, command("/import_urls "+hanging.URL+"/red.png\n"+hanging.URL+"/green.png"))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("import took %s after cancel, want it to stop", elapsed)
+	}
+
+	got := bot.Texts(100)
+	if len(got) != 2 || !strings.HasPrefix(got[1], "Import finished: 0 added, 2 failed") {
+		t.Errorf("got replies %q, want both downloads failed", got)
+	}
+}
+
+func TestImportURLsRejected(t *testing.T) {
+	var many []string
+	for i := 0; i <= maxImportURLs; i++ {
+		many = append(many, "https://example.com/"+strconv.Itoa(i)+".png")
+	}
+
+	noURLs := "Please send a document with picture URLs, one per line, with /import_urls <tags> caption or reply to one"
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "no urls",
+			text: "/import_urls happy",
+			want: noURLs,
+		},
+		{
+			name: "only malformed urls",
+			text: "/import_urls happy\nexample.com/cat.png",
+			want: noURLs,
+		},
+		{
+			name: "invalid tags",
+			text: "/import_urls c@t\nhttps://example.com/cat.png",
+			want: "Invalid tags: c@t. Tags may contain letters, digits, _ and - only, up to 32 characters.",
+		},
+		{
+			name: "too many urls",
+			text: "/import_urls happy\n" + strings.Join(many, "\n"),
+			want: "Too many URLs, at most 200 can be imported at once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t)
+
+			h.ImportURLs(context.Background(), command(tt.text))
+
+			if got := bot.Texts(100); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got replies %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseURLs(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		urls          []string
+		malformedURLs []string
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name: "blank lines and spaces are skipped",
+			text: "\n  https://example.com/a.png  \n\n\thttp://example.com/b.jpg\n",
+			urls: []string{"https://example.com/a.png", "http://example.com/b.jpg"},
+		},
+		{
+			name:          "duplicates are skipped",
+			text:          "https://example.com/a.png\nhttps://example.com/a.png\nnope\nnope",
+			urls:          []string{"https://example.com/a.png"},
+			malformedURLs: []string{"nope"},
+		},
+		{
+			name:          "other schemes and missing host",
+			text:          "ftp://example.com/a.png\nfile:///etc/passwd\nhttps:///a.png\nexample.com/a.png\nhttp://[::1",
+			malformedURLs: []string{"ftp://example.com/a.png", "file:///etc/passwd", "https:///a.png", "example.com/a.png", "http://[::1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, malformed := parseURLs(tt.text)
+			if !slices.Equal(urls, tt.urls) || !slices.Equal(malformed, tt.malformedURLs) {
+				t.Errorf("parseURLs() = %q, %q, want %q, %q", urls, malformed, tt.urls, tt.malformedURLs)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"apubot/internal/domain"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SourcePost adds photo or animation posted to source channel to library with caption as tags,
+// the post is saved so image is forwarded from it
+func (h *Handler) SourcePost(ctx context.Context, post *tgbotapi.Message) {
+	file, ok := uploadedFile(post)
+	if !ok {
+		return
+	}
+
+	// reposted picture keeps its image, only the post it is forwarded from changes
+	isNew := true
+	for _, existing := range h.services.Image.List(ctx) {
+		if existing.Name == file.Name {
+			file, isNew = existing, false
+
+			break
+		}
+	}
+
+	if isNew {
+		tags, invalid := domain.NormalizeTags(post.Caption)
+
+		var err error
+
+		file, err = h.services.Image.AddImage(ctx, file, tags)
+		if err != nil {
+			h.log.Error("Error adding image from source channel", "message_id", post.MessageID, "err", err)
+
+			return
+		}
+
+		h.log.Info(
+			"Image added from source channel",
+			"image_id", file.ID, "message_id", post.MessageID, "tags", tags, "invalid_tags", invalid,
+		)
+	}
+
+	err := h.services.Source.Save(ctx, domain.SourceMessage{
+		ImageID:   file.ID,
+		ChannelID: post.Chat.ID,
+		MessageID: post.MessageID,
+	})
+	if err != nil {
+		h.log.Error("Error saving source message", "image_id", file.ID, "message_id", post.MessageID, "err", err)
+	}
+}
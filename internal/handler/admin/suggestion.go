@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/handler/attachment"
+	"apubot/internal/service/image"
+	"apubot/internal/service/suggestion"
+	"apubot/pkg/custom_errors"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ReviewCallbackPrefix = "review:"
+	reviewApproveAction  = "approve"
+	reviewRejectAction   = "reject"
+)
+
+// Suggest queues photo or animation from message or replied message for admin review
+func (h *Handler) Suggest(ctx context.Context, message *tgbotapi.Message) {
+	file, ok := uploadedFile(message)
+	source := message
+	if !ok && message.ReplyToMessage != nil {
+		file, ok = uploadedFile(message.ReplyToMessage)
+		source = message.ReplyToMessage
+	}
+
+	if !ok || message.From == nil {
+		h.reply(message.Chat.ID, "Please reply to a photo or animation with /suggest <tags>")
+
+		return
+	}
+
+	if err := h.checkUploadSize(source); err != nil {
+		h.reply(message.Chat.ID, "Picture is too large: "+err.Error())
+
+		return
+	}
+
+	tags, _ := domain.NormalizeTags(message.CommandArguments())
+	if len(tags) == 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Please add at least one valid tag, e.g. /suggest happy. "+
+				"Tags may contain letters, digits, _ and - only, up to %d characters.",
+			domain.MaxTagLength,
+		))
+
+		return
+	}
+
+	sug, err := h.services.Suggestion.Submit(ctx, domain.Suggestion{
+		Name:   file.Name,
+		TgID:   file.TgID,
+		Type:   file.Type,
+		Tags:   tags,
+		UserID: message.From.ID,
+		ChatID: message.Chat.ID,
+	})
+	if err != nil {
+		var alreadyExistsErr *custom_errors.AlreadyExistsError
+		switch {
+		case errors.As(err, &alreadyExistsErr):
+			h.reply(message.Chat.ID, "This picture is already waiting for review")
+		case errors.Is(err, suggestion.ErrTooManyPending):
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"You already have %d pictures waiting for review, please wait until admins check them",
+				suggestion.MaxPendingPerUser,
+			))
+		default:
+			h.replyError(ctx, message.Chat.ID, err, "Error saving suggestion")
+		}
+
+		return
+	}
+
+	notification := fmt.Sprintf("New picture suggestion #%d from user %d, review it with /review", sug.ID, sug.UserID)
+	for _, adminID := range h.cfg.Admins() {
+		h.reply(adminID, notification)
+	}
+
+	h.reply(message.Chat.ID, "Thanks! The picture will be added once admins review it")
+}
+
+// Review sends the oldest pending suggestion with Approve and Reject buttons
+func (h *Handler) Review(ctx context.Context, message *tgbotapi.Message) {
+	h.sendNextSuggestion(ctx, message.Chat.ID)
+}
+
+func (h *Handler) sendNextSuggestion(ctx context.Context, chatID int64) {
+	sug, err := h.services.Suggestion.Next(ctx)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(chatID, "No pending suggestions")
+
+			return
+		}
+
+		h.replyError(ctx, chatID, err, "Error getting suggestion")
+
+		return
+	}
+
+	preview, err := attachment.New(h.cfg.ImagesDirPath, sug.File(), chatID)
+	if err != nil {
+		h.replyError(ctx, chatID, err, "Error creating preview", "suggestion_id", sug.ID)
+
+		return
+	}
+
+	caption := fmt.Sprintf(
+		"Suggestion #%d from user %d, %s\nTags: %s",
+		sug.ID, sug.UserID, sug.CreatedAtAsUnixTime().Format(time.DateTime), strings.Join(sug.Tags, ", "),
+	)
+	if count, err := h.services.Suggestion.Count(ctx); err == nil && count > 1 {
+		caption += fmt.Sprintf("\n%d more waiting", count-1)
+	}
+
+	data := func(action string) string {
+		return fmt.Sprintf("%s%s:%d", ReviewCallbackPrefix, action, sug.ID)
+	}
+
+	preview = attachment.WithCaption(preview, caption)
+	preview = attachment.WithReplyMarkup(preview, tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Approve", data(reviewApproveAction)),
+			tgbotapi.NewInlineKeyboardButtonData("Reject", data(reviewRejectAction)),
+		),
+	))
+
+	_, err = h.bot.Send(preview)
+	if err != nil {
+		h.log.Error("Error sending suggestion", "chat_id", chatID, "suggestion_id", sug.ID, "err", err)
+	}
+}
+
+// ReviewCallback handles Approve and Reject buttons of Review and shows the next suggestion
+func (h *Handler) ReviewCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.From == nil || !h.cfg.IsAdmin(query.From.ID) {
+		h.answer(query.ID, "Only admins can do this")
+
+		return
+	}
+
+	action, rawID, _ := strings.Cut(strings.TrimPrefix(query.Data, ReviewCallbackPrefix), ":")
+
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || (action != reviewApproveAction && action != reviewRejectAction) {
+		h.log.Warn("Malformed callback data", "data", query.Data)
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	result := h.review(ctx, id, action == reviewApproveAction)
+
+	if query.Message != nil {
+		// caption is replaced without buttons so suggestion can not be reviewed twice from this message
+		edit := tgbotapi.NewEditMessageCaption(query.Message.Chat.ID, query.Message.MessageID, result)
+		if _, err = h.bot.Send(edit); err != nil {
+			h.log.Error("Error editing message", "chat_id", query.Message.Chat.ID, "err", err)
+		}
+	}
+
+	h.answer(query.ID, result)
+
+	if query.Message != nil {
+		h.sendNextSuggestion(ctx, query.Message.Chat.ID)
+	}
+}
+
+// review approves or rejects suggestion, returns text describing result
+func (h *Handler) review(ctx context.Context, id int64, approve bool) string {
+	sug, err := h.services.Suggestion.Take(ctx, id)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return fmt.Sprintf("Suggestion #%d was already reviewed", id)
+		}
+
+		h.log.Error("Error taking suggestion", "suggestion_id", id, "err", err)
+
+		return fmt.Sprintf("Can not review suggestion #%d :d", id)
+	}
+
+	if !approve {
+		h.log.Info("Suggestion rejected", "suggestion_id", id, "user_id", sug.UserID)
+
+		return fmt.Sprintf("Suggestion #%d rejected", id)
+	}
+
+	file, err := h.services.Image.AddImage(ctx, h.withHash(ctx, sug.File()), sug.Tags)
+
+	var duplicateErr *image.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		h.log.Info("Suggestion is a duplicate", "suggestion_id", id, "image_id", duplicateErr.ExistingID)
+
+		return fmt.Sprintf("Suggestion #%d dropped, the picture is already in library with ID %d", id, duplicateErr.ExistingID)
+	}
+
+	if err != nil {
+		h.log.Error("Error adding suggested image", "suggestion_id", id, "err", err)
+
+		if err = h.services.Suggestion.Requeue(ctx, sug); err != nil {
+			h.log.Error("Error requeueing suggestion", "suggestion_id", id, "err", err)
+		}
+
+		return fmt.Sprintf("Can not add image from suggestion #%d :d", id)
+	}
+
+	h.log.Info("Suggestion approved", "suggestion_id", id, "image_id", file.ID, "user_id", sug.UserID)
+	h.reply(sug.ChatID, fmt.Sprintf("Your suggested picture was added with tags: %s. Thanks!", strings.Join(sug.Tags, ", ")))
+
+	return fmt.Sprintf("Suggestion #%d approved as image #%d", id, file.ID)
+}
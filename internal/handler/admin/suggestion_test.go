@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"apubot/internal/testutil"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"testing"
+)
+
+// suggest sends /suggest with photo from user in private chat with the same ID
+func suggest(h *Handler, userID int64, photoID string, tags string) {
+	message := command("/suggest " + tags)
+	message.Chat = &tgbotapi.Chat{ID: userID, Type: "private"}
+	message.From = &tgbotapi.User{ID: userID}
+	message.Photo = photo(photoID)
+
+	h.Suggest(context.Background(), message)
+}
+
+// reviewQuery returns press of Approve or Reject button by user on suggestion preview in admin chat
+func reviewQuery(userID int64, action string, id int64) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: userID},
+		Message: &tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: 100}},
+		Data:    fmt.Sprintf("%s%s:%d", ReviewCallbackPrefix, action, id),
+	}
+}
+
+// reviewResults returns captions set on reviewed previews and answers to button presses
+func reviewResults(bot *testutil.Sender) (captions []string, answers []string) {
+	for _, c := range bot.Sent() {
+		switch c := c.(type) {
+		case tgbotapi.EditMessageCaptionConfig:
+			captions = append(captions, c.Caption)
+		case tgbotapi.CallbackConfig:
+			answers = append(answers, c.Text)
+		}
+	}
+
+	return captions, answers
+}
+
+func pending(t *testing.T, h *Handler) int {
+	t.Helper()
+
+	count, err := h.services.Suggestion.Count(context.Background())
+	if err != nil {
+		t.Fatalf("can not count suggestions: %v", err)
+	}
+
+	return count
+}
+
+func TestSuggestionIsQueued(t *testing.T) {
+	h, bot := newTestHandler(t)
+
+	suggest(h, 5, "cat", "Happy cat")
+
+	if got := bot.Texts(5); len(got) != 1 || got[0] != "Thanks! The picture will be added once admins review it" {
+		t.Errorf("user got %q, want thanks", got)
+	}
+
+	if got := bot.Texts(100); len(got) != 1 || got[0] != "New picture suggestion #1 from user 5, review it with /review" {
+		t.Errorf("admin got %q, want notification", got)
+	}
+
+	bot.Reset()
+
+	// the same picture is not queued twice
+	suggest(h, 6, "cat", "cat")
+
+	if got := bot.Texts(6); len(got) != 1 || got[0] != "This picture is already waiting for review" {
+		t.Errorf("second user got %q, want already waiting", got)
+	}
+
+	if n := pending(t, h); n != 1 {
+		t.Errorf("%d suggestions pending, want 1", n)
+	}
+
+	// picture joins library only after approval
+	if _, err := h.services.Image.GetByID(context.Background(), 1); err == nil {
+		t.Error("suggested image was added before review")
+	}
+}
+
+func TestReviewSendsPreviewWithButtons(t *testing.T) {
+	h, bot := newTestHandler(t)
+
+	suggest(h, 5, "cat", "cat")
+	suggest(h, 6, "dog", "dog")
+	bot.Reset()
+
+	h.Review(context.Background(), command("/review"))
+
+	photos := bot.Photos()
+	if len(photos) != 1 {
+		t.Fatalf("sent %d previews, want 1", len(photos))
+	}
+
+	if photos[0].ChatID != 100 || photos[0].File != tgbotapi.FileID("cat") {
+		t.Errorf("preview of %v sent to %d, want the oldest suggestion to admin", photos[0].File, photos[0].ChatID)
+	}
+
+	markup, ok := photos[0].ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if !ok || len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("preview markup is %+v, want Approve and Reject buttons", photos[0].ReplyMarkup)
+	}
+
+	var data []string
+	for _, button := range markup.InlineKeyboard[0] {
+		data = append(data, *button.CallbackData)
+	}
+
+	if want := []string{"review:approve:1", "review:reject:1"}; !slices.Equal(data, want) {
+		t.Errorf("button data %q, want %q", data, want)
+	}
+}
+
+func TestReviewCallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      int64
+		action      string
+		wantResult  string
+		wantPending int
+		wantImage   bool
+	}{
+		{
+			name:       "approve",
+			userID:     100,
+			action:     reviewApproveAction,
+			wantResult: "Suggestion #1 approved as image #1",
+			wantImage:  true,
+		},
+		{
+			name:       "reject",
+			userID:     100,
+			action:     reviewRejectAction,
+			wantResult: "Suggestion #1 rejected",
+		},
+		{
+			name:        "not admin",
+			userID:      5,
+			action:      reviewApproveAction,
+			wantPending: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t)
+			ctx := context.Background()
+
+			suggest(h, 5, "cat", "Happy cat")
+			bot.Reset()
+
+			h.ReviewCallback(ctx, reviewQuery(tt.userID, tt.action, 1))
+
+			if n := pending(t, h); n != tt.wantPending {
+				t.Errorf("%d suggestions pending, want %d", n, tt.wantPending)
+			}
+
+			file, err := h.services.Image.GetByID(ctx, 1)
+			if tt.wantImage != (err == nil) {
+				t.Fatalf("image added is %t, want %t", err == nil, tt.wantImage)
+			}
+
+			captions, answers := reviewResults(bot)
+			if tt.wantResult == "" {
+				if len(captions) != 0 || !slices.Equal(answers, []string{"Only admins can do this"}) {
+					t.Errorf("got captions %q and answers %q, want request refused", captions, answers)
+				}
+
+				return
+			}
+
+			// preview loses its buttons and queue moves on
+			if !slices.Equal(captions, []string{tt.wantResult}) || !slices.Equal(answers, []string{tt.wantResult}) {
+				t.Errorf("got captions %q and answers %q, want %q", captions, answers, tt.wantResult)
+			}
+
+			if got := bot.Texts(100); len(got) != 1 || got[0] != "No pending suggestions" {
+				t.Errorf("admin got %q, want empty queue", got)
+			}
+
+			if !tt.wantImage {
+				if got := bot.Texts(5); len(got) != 0 {
+					t.Errorf("user of rejected suggestion got %q, want nothing", got)
+				}
+
+				return
+			}
+
+			if file.TgID != "cat" || file.UploaderID != 5 {
+				t.Errorf("saved %+v, want suggested photo uploaded by user", file)
+			}
+
+			if tags := imageTags(t, h, file); !slices.Equal(tags, []string{"cat", "happy"}) {
+				t.Errorf("image has tags %q, want suggested ones", tags)
+			}
+
+			want := "Your suggested picture was added with tags: happy, cat. Thanks!"
+			if got := bot.Texts(5); len(got) != 1 || got[0] != want {
+				t.Errorf("user got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSuggestionIsReviewedOnce(t *testing.T) {
+	h, bot := newTestHandler(t)
+	ctx := context.Background()
+
+	suggest(h, 5, "cat", "cat")
+
+	// two admins press buttons of the same preview
+	h.ReviewCallback(ctx, reviewQuery(100, reviewApproveAction, 1))
+	bot.Reset()
+	h.ReviewCallback(ctx, reviewQuery(100, reviewRejectAction, 1))
+
+	if _, answers := reviewResults(bot); !slices.Equal(answers, []string{"Suggestion #1 was already reviewed"}) {
+		t.Errorf("second review answered %q, want already reviewed", answers)
+	}
+
+	if _, err := h.services.Image.GetByID(ctx, 1); err != nil {
+		t.Errorf("approved image was removed by second review: %v", err)
+	}
+
+	if got := bot.Texts(5); len(got) != 0 {
+		t.Errorf("user got %q after second review, want nothing", got)
+	}
+}
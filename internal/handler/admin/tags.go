@@ -0,0 +1,243 @@
+package admin
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tags lists tags of image by ID
+func (h *Handler) Tags(ctx context.Context, message *tgbotapi.Message) {
+	file, _, ok := h.imageAndTags(ctx, message, false)
+	if !ok {
+		return
+	}
+
+	tags, err := h.services.Image.GetTags(ctx, file)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error getting image tags", "image_id", file.ID)
+
+		return
+	}
+
+	if len(tags) == 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf("Image #%d has no tags", file.ID))
+
+		return
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Image #%d tags: %s", file.ID, strings.Join(tags, ", ")))
+}
+
+// TagAdd adds tags to existing image, already present ones are skipped
+func (h *Handler) TagAdd(ctx context.Context, message *tgbotapi.Message) {
+	file, tags, ok := h.imageAndTags(ctx, message, true)
+	if !ok {
+		return
+	}
+
+	current, err := h.services.Image.GetTags(ctx, file)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error getting image tags", "image_id", file.ID)
+
+		return
+	}
+
+	var added []string
+	for _, tag := range tags {
+		if !slices.Contains(current, tag) {
+			added = append(added, tag)
+		}
+	}
+
+	if len(added) == 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf("Image #%d already has all these tags", file.ID))
+
+		return
+	}
+
+	err = h.services.Image.AddTags(ctx, file, added)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error adding image tags", "image_id", file.ID)
+
+		return
+	}
+
+	h.log.Info("Image tags added", "image_id", file.ID, "tags", added)
+	h.reply(message.Chat.ID, fmt.Sprintf("Added tags to image #%d: %s", file.ID, strings.Join(added, ", ")))
+}
+
+// TagRemove removes tags from existing image, missing ones are skipped
+func (h *Handler) TagRemove(ctx context.Context, message *tgbotapi.Message) {
+	file, tags, ok := h.imageAndTags(ctx, message, true)
+	if !ok {
+		return
+	}
+
+	current, err := h.services.Image.GetTags(ctx, file)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error getting image tags", "image_id", file.ID)
+
+		return
+	}
+
+	var removed []string
+	for _, tag := range tags {
+		if !slices.Contains(current, tag) {
+			continue
+		}
+
+		err = h.services.Image.RemoveTag(ctx, file, tag)
+		if err != nil {
+			h.log.Error("Error removing image tag", "image_id", file.ID, "tag", tag, "err", err)
+
+			break
+		}
+
+		removed = append(removed, tag)
+	}
+
+	switch {
+	case len(removed) > 0:
+		h.log.Info("Image tags removed", "image_id", file.ID, "tags", removed)
+
+		text := fmt.Sprintf("Removed tags from image #%d: %s", file.ID, strings.Join(removed, ", "))
+		if err != nil {
+			text += "\nCan not remove the rest :d"
+		}
+
+		h.reply(message.Chat.ID, text)
+	case err != nil:
+		h.reply(message.Chat.ID, "Can not remove tags :d")
+	default:
+		h.reply(message.Chat.ID, fmt.Sprintf("Image #%d has none of these tags", file.ID))
+	}
+}
+
+// TagWeight sets how often tag is picked by weighted tag selection, weights set before are listed without arguments
+func (h *Handler) TagWeight(ctx context.Context, message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		h.listTagWeights(ctx, message.Chat.ID)
+
+		return
+	}
+
+	usage := fmt.Sprintf("Please enter tag and weight from 0 to %d, e.g. /%s happy 3", domain.MaxTagWeight, message.Command())
+
+	tag, valid := domain.NormalizeTag(args[0])
+	if !valid || len(args) != 2 {
+		h.reply(message.Chat.ID, usage)
+
+		return
+	}
+
+	weight, err := strconv.Atoi(args[1])
+	if err != nil || weight < 0 || weight > domain.MaxTagWeight {
+		h.reply(message.Chat.ID, usage)
+
+		return
+	}
+
+	err = h.services.Image.SetTagWeight(ctx, tag, weight)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting tag weight", "tag", tag, "weight", weight)
+
+		return
+	}
+
+	h.log.Info("Tag weight set", "tag", tag, "weight", weight)
+
+	text := fmt.Sprintf("Tag %s weight is %d now", tag, weight)
+	if h.cfg.SelectionStrategy != config.SelectionWeightedTag {
+		text += fmt.Sprintf("\nWeights are used only with selection_strategy: %s", config.SelectionWeightedTag)
+	}
+
+	h.reply(message.Chat.ID, text)
+}
+
+func (h *Handler) listTagWeights(ctx context.Context, chatID int64) {
+	weights, err := h.services.Image.GetTagWeights(ctx)
+	if err != nil {
+		h.replyError(ctx, chatID, err, "Error getting tag weights")
+
+		return
+	}
+
+	if len(weights) == 0 {
+		h.reply(chatID, fmt.Sprintf("All tags have default weight %d", domain.DefaultTagWeight))
+
+		return
+	}
+
+	tags := make([]string, 0, len(weights))
+	for tag := range weights {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+
+	lines := make([]string, 0, len(tags)+1)
+	lines = append(lines, fmt.Sprintf("Tag weights, others have %d:", domain.DefaultTagWeight))
+	for _, tag := range tags {
+		lines = append(lines, fmt.Sprintf("%s: %d", tag, weights[tag]))
+	}
+
+	h.reply(chatID, strings.Join(lines, "\n"))
+}
+
+// imageAndTags parses "<id> <tags>" arguments, tags are required only if withTags is set.
+// Reply is sent to user if they are invalid or image does not exist.
+func (h *Handler) imageAndTags(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	withTags bool,
+) (domain.File, []string, bool) {
+	usage := "/" + message.Command() + " 42"
+	if withTags {
+		usage += " happy sad"
+	}
+
+	rawID, rawTags, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(rawID, "#"), 10, 64)
+	if err != nil || id < 1 {
+		h.reply(message.Chat.ID, "Please enter image ID, e.g. "+usage)
+
+		return domain.File{}, nil, false
+	}
+
+	var tags []string
+	if withTags {
+		var invalid []string
+
+		tags, invalid = domain.NormalizeTags(rawTags)
+		if len(invalid) > 0 {
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"Invalid tags: %s. Tags may contain letters, digits, _ and - only, up to %d characters.",
+				strings.Join(invalid, ", "), domain.MaxTagLength,
+			))
+
+			return domain.File{}, nil, false
+		}
+
+		if len(tags) == 0 {
+			h.reply(message.Chat.ID, "Please enter at least one tag, e.g. "+usage)
+
+			return domain.File{}, nil, false
+		}
+	}
+
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil {
+		h.reply(message.Chat.ID, fmt.Sprintf("Image #%d not found", id))
+
+		return domain.File{}, nil, false
+	}
+
+	return file, tags, true
+}
@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/testutil"
+	"context"
+	"slices"
+	"testing"
+)
+
+// imageTags returns sorted tags of image as they are stored now
+func imageTags(t *testing.T, h *Handler, file domain.File) []string {
+	t.Helper()
+
+	tags, err := h.services.Image.GetTags(context.Background(), file)
+	if err != nil {
+		t.Fatalf("can not get tags: %v", err)
+	}
+
+	slices.Sort(tags)
+
+	return tags
+}
+
+func TestTagAddIsIdempotent(t *testing.T) {
+	h, bot := newTestHandler(t)
+	file := testutil.AddImage(t, h.services.Image, "cat.jpg", "cat")
+
+	h.TagAdd(context.Background(), command("/tag_add 1 Happy cat"))
+	h.TagAdd(context.Background(), command("/tag_add #1 happy cat"))
+
+	want := []string{
+		"Added tags to image #1: happy",
+		"Image #1 already has all these tags",
+	}
+	if got := bot.Texts(100); !slices.Equal(got, want) {
+		t.Errorf("got replies %q, want %q", got, want)
+	}
+
+	if got := imageTags(t, h, file); !slices.Equal(got, []string{"cat", "happy"}) {
+		t.Errorf("image has tags %q, want cat and happy once", got)
+	}
+}
+
+func TestTagRemoveIsIdempotent(t *testing.T) {
+	h, bot := newTestHandler(t)
+	file := testutil.AddImage(t, h.services.Image, "cat.jpg", "cat", "happy", "sad")
+
+	h.TagRemove(context.Background(), command("/tag_remove 1 sad angry Happy"))
+	h.TagRemove(context.Background(), command("/tag_remove 1 sad happy"))
+
+	want := []string{
+		"Removed tags from image #1: sad, happy",
+		"Image #1 has none of these tags",
+	}
+	if got := bot.Texts(100); !slices.Equal(got, want) {
+		t.Errorf("got replies %q, want %q", got, want)
+	}
+
+	if got := imageTags(t, h, file); !slices.Equal(got, []string{"cat"}) {
+		t.Errorf("image has tags %q, want only cat", got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	h, bot := newTestHandler(t)
+	testutil.AddImage(t, h.services.Image, "cat.jpg", "cat")
+	testutil.AddImage(t, h.services.Image, "empty.jpg")
+
+	h.Tags(context.Background(), command("/tags 1"))
+	h.Tags(context.Background(), command("/tags 2"))
+
+	want := []string{"Image #1 tags: cat", "Image #2 has no tags"}
+	if got := bot.Texts(100); !slices.Equal(got, want) {
+		t.Errorf("got replies %q, want %q", got, want)
+	}
+}
+
+func TestTagCommandsRejectInvalidArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "no id",
+			text: "/tag_add",
+			want: "Please enter image ID, e.g. /tag_add 42 happy sad",
+		},
+		{
+			name: "id is not a number",
+			text: "/tag_remove cat happy",
+			want: "Please enter image ID, e.g. /tag_remove 42 happy sad",
+		},
+		{
+			name: "no tags",
+			text: "/tag_add 1",
+			want: "Please enter at least one tag, e.g. /tag_add 42 happy sad",
+		},
+		{
+			name: "invalid tag",
+			text: "/tag_add 1 happy c@t",
+			want: "Invalid tags: c@t. Tags may contain letters, digits, _ and - only, up to 32 characters.",
+		},
+		{
+			name: "unknown image",
+			text: "/tag_add 42 happy",
+			want: "Image #42 not found",
+		},
+		{
+			name: "unknown image without tags",
+			text: "/tags 42",
+			want: "Image #42 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t)
+			file := testutil.AddImage(t, h.services.Image, "cat.jpg", "cat")
+
+			message := command(tt.text)
+			switch message.Command() {
+			case "tag_add":
+				h.TagAdd(context.Background(), message)
+			case "tag_remove":
+				h.TagRemove(context.Background(), message)
+			default:
+				h.Tags(context.Background(), message)
+			}
+
+			if got := bot.Texts(100); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got replies %q, want %q", got, tt.want)
+			}
+
+			if got := imageTags(t, h, file); !slices.Equal(got, []string{"cat"}) {
+				t.Errorf("image has tags %q, want them unchanged", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package attachment
+
+import (
+	"apubot/internal/domain"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"path"
+)
+
+// RequestFile references file by TG ID if it was uploaded before or by local path otherwise
+func RequestFile(imagesDirPath string, file domain.File) tgbotapi.RequestFileData {
+	if file.TgID == "" {
+		fullFilePath := path.Join(imagesDirPath, file.Name)
+
+		return tgbotapi.FilePath(fullFilePath)
+	}
+
+	return tgbotapi.FileID(file.TgID)
+}
+
+func New(imagesDirPath string, file domain.File, chatId int64) (a tgbotapi.Chattable, err error) {
+	reqFile := RequestFile(imagesDirPath, file)
+
+	switch file.Type {
+	case domain.TypePhoto:
+		a = tgbotapi.NewPhoto(chatId, reqFile)
+	case domain.TypeAnimation:
+		a = tgbotapi.NewAnimation(chatId, reqFile)
+	default:
+		err = fmt.Errorf("unsupported image type: %v", file.Type)
+	}
+
+	return a, err
+}
+
+// NewDocument creates attachment sending local file without Telegram compression
+func NewDocument(imagesDirPath string, file domain.File, chatId int64) tgbotapi.DocumentConfig {
+	return tgbotapi.NewDocument(chatId, tgbotapi.FilePath(path.Join(imagesDirPath, file.Name)))
+}
+
+// NewInputMedia creates media for editing already sent message
+func NewInputMedia(imagesDirPath string, file domain.File, caption string) (m interface{}, err error) {
+	reqFile := RequestFile(imagesDirPath, file)
+
+	switch file.Type {
+	case domain.TypePhoto:
+		photo := tgbotapi.NewInputMediaPhoto(reqFile)
+		photo.Caption = caption
+		m = photo
+	case domain.TypeAnimation:
+		animation := tgbotapi.NewInputMediaAnimation(reqFile)
+		animation.Caption = caption
+		m = animation
+	default:
+		err = fmt.Errorf("unsupported image type: %v", file.Type)
+	}
+
+	return m, err
+}
+
+// WithCaption sets caption to attachment created by New
+func WithCaption(a tgbotapi.Chattable, caption string) tgbotapi.Chattable {
+	switch c := a.(type) {
+	case tgbotapi.PhotoConfig:
+		c.Caption = caption
+
+		return c
+	case tgbotapi.AnimationConfig:
+		c.Caption = caption
+
+		return c
+	case tgbotapi.DocumentConfig:
+		c.Caption = caption
+
+		return c
+	}
+
+	return a
+}
+
+// WithReplyTo threads attachment created by New under message, it is sent anyway if message was deleted
+func WithReplyTo(a tgbotapi.Chattable, messageID int) tgbotapi.Chattable {
+	switch c := a.(type) {
+	case tgbotapi.PhotoConfig:
+		c.ReplyToMessageID = messageID
+		c.AllowSendingWithoutReply = true
+
+		return c
+	case tgbotapi.AnimationConfig:
+		c.ReplyToMessageID = messageID
+		c.AllowSendingWithoutReply = true
+
+		return c
+	case tgbotapi.DocumentConfig:
+		c.ReplyToMessageID = messageID
+		c.AllowSendingWithoutReply = true
+
+		return c
+	}
+
+	return a
+}
+
+// WithReplyMarkup sets reply markup to attachment created by New
+func WithReplyMarkup(a tgbotapi.Chattable, markup interface{}) tgbotapi.Chattable {
+	switch c := a.(type) {
+	case tgbotapi.PhotoConfig:
+		c.ReplyMarkup = markup
+
+		return c
+	case tgbotapi.AnimationConfig:
+		c.ReplyMarkup = markup
+
+		return c
+	case tgbotapi.DocumentConfig:
+		c.ReplyMarkup = markup
+
+		return c
+	}
+
+	return a
+}
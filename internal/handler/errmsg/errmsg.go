@@ -0,0 +1,72 @@
+package errmsg
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/i18n"
+	"apubot/internal/service/image"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net"
+	"net/http"
+)
+
+// keys are catalog messages of error kinds
+var keys = map[string]string{
+	config.ErrorNoImages:    i18n.KeyNoImages,
+	config.ErrorTimeout:     i18n.KeyTimeout,
+	config.ErrorUnavailable: i18n.KeyUnavailable,
+	config.ErrorRateLimited: i18n.KeyRateLimited,
+	config.ErrorNotFound:    i18n.KeyNotFound,
+	config.ErrorUnknown:     i18n.KeyUnknownError,
+}
+
+// Kind classifies error by what user can do about it, config.ErrorUnknown is returned for unexpected ones
+func Kind(err error) string {
+	var (
+		notFoundErr    *custom_errors.NotFoundError
+		unavailableErr *custom_errors.UnavailableError
+		tgErr          *tgbotapi.Error
+		netErr         net.Error
+	)
+
+	switch {
+	// checked before not found as empty pool is not found error too
+	case errors.Is(err, image.ErrNoImages):
+		return config.ErrorNoImages
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return config.ErrorTimeout
+	case errors.As(err, &unavailableErr):
+		return config.ErrorUnavailable
+	case errors.As(err, &tgErr) && tgErr.Code == http.StatusTooManyRequests:
+		return config.ErrorRateLimited
+	case errors.As(err, &notFoundErr):
+		return config.ErrorNotFound
+	default:
+		return config.ErrorUnknown
+	}
+}
+
+// Text returns reply to error in language, messages set in error_messages config are used instead of catalog ones
+func Text(cfg *config.Config, lang string, err error) string {
+	kind := Kind(err)
+	if text := cfg.ErrorMessages[kind]; text != "" {
+		return text
+	}
+
+	return i18n.T(lang, keys[kind])
+}
+
+// Reply returns Text of err sent to chat, unexpected errors are logged as errors with msg and args, others as debug
+func Reply(log logger.Logger, cfg *config.Config, lang string, chatID int64, err error, msg string, args ...any) string {
+	args = append([]any{"chat_id", chatID, "err", err}, args...)
+	if Kind(err) == config.ErrorUnknown {
+		log.Error(msg, args...)
+	} else {
+		log.Debug(msg, args...)
+	}
+
+	return Text(cfg, lang, err)
+}
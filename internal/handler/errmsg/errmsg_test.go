@@ -0,0 +1,95 @@
+package errmsg
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/i18n"
+	"apubot/internal/service/image"
+	"apubot/pkg/custom_errors"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net"
+	"testing"
+)
+
+// timeoutErr is network error reporting timeout
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+var _ net.Error = timeoutErr{}
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no images", errors.Wrap(image.ErrNoImages, "can not get random file"), config.ErrorNoImages},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "can not get file"), config.ErrorTimeout},
+		{"network timeout", &net.OpError{Op: "read", Err: timeoutErr{}}, config.ErrorTimeout},
+		{"unavailable", custom_errors.NewUnavailable("db breaker is open"), config.ErrorUnavailable},
+		{"rate limited", &tgbotapi.Error{Code: 429, Message: "Too Many Requests"}, config.ErrorRateLimited},
+		{"other telegram error", &tgbotapi.Error{Code: 400, Message: "Bad Request"}, config.ErrorUnknown},
+		{"not found", custom_errors.NewNotFound("image not found"), config.ErrorNotFound},
+		{"unexpected", errors.New("disk is full"), config.ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Kind(tt.err); got != tt.want {
+				t.Errorf("Kind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	cfg := &config.Config{ErrorMessages: map[string]string{config.ErrorTimeout: "Too slow, sorry"}}
+
+	if got := Text(cfg, "en", context.DeadlineExceeded); got != "Too slow, sorry" {
+		t.Errorf("configured reply = %q, want %q", got, "Too slow, sorry")
+	}
+
+	if got, want := Text(cfg, "ru", image.ErrNoImages), i18n.T("ru", i18n.KeyNoImages); got != want {
+		t.Errorf("catalog reply = %q, want %q", got, want)
+	}
+}
+
+// levelLogger records levels of written messages
+type levelLogger struct {
+	levels []string
+}
+
+func (l *levelLogger) Debug(string, ...any) { l.levels = append(l.levels, "DEBUG") }
+func (l *levelLogger) Info(string, ...any)  { l.levels = append(l.levels, "INFO") }
+func (l *levelLogger) Warn(string, ...any)  { l.levels = append(l.levels, "WARN") }
+func (l *levelLogger) Error(string, ...any) { l.levels = append(l.levels, "ERROR") }
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		want  string
+		level string
+	}{
+		{"expected error", image.ErrNoImages, i18n.T("ru", i18n.KeyNoImages), "DEBUG"},
+		{"unexpected error", errors.New("disk is full"), i18n.T("ru", i18n.KeyUnknownError), "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &levelLogger{}
+
+			if got := Reply(log, &config.Config{}, "ru", 1, tt.err, "Error getting file"); got != tt.want {
+				t.Errorf("Reply() = %q, want %q", got, tt.want)
+			}
+
+			if len(log.levels) != 1 || log.levels[0] != tt.level {
+				t.Errorf("logged %q, want one %s message", log.levels, tt.level)
+			}
+		})
+	}
+}
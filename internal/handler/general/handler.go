@@ -2,50 +2,610 @@ package general
 
 import (
 	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/handler/access"
+	"apubot/internal/handler/errmsg"
+	"apubot/internal/i18n"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/feedback"
+	"apubot/internal/service/image"
+	"apubot/internal/service/stats"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/text_split"
+	"apubot/pkg/utils/time_string"
+	"context"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"log"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type (
 	Handler struct {
-		cfg *config.Config
-		bot *tgbotapi.BotAPI
+		cfg      *config.Config
+		log      logger.Logger
+		bot      telegram.Sender
+		services *Services
+	}
+	Services struct {
+		Image    image.ImageService
+		Stats    stats.StatsService
+		Chat     chat.ChatService
+		Feedback feedback.FeedbackService
+	}
+	// CommandInfo describes command in help
+	CommandInfo struct {
+		Name        string
+		Usage       string
+		Description string
+		Aliases     []string
 	}
 )
 
-func New(cfg *config.Config, bot *tgbotapi.BotAPI) *Handler {
+// maxMessageLength is Telegram limit for message text
+const maxMessageLength = 4096
+
+func New(cfg *config.Config, log logger.Logger, bot telegram.Sender, services *Services) *Handler {
 	return &Handler{
-		cfg: cfg,
-		bot: bot,
+		cfg:      cfg,
+		log:      log,
+		bot:      bot,
+		services: services,
 	}
 }
 
+// MessageResponse sends text to chat, texts longer than Telegram limit are sent in several messages
 func (h *Handler) MessageResponse(chatID int64, message string) {
-	_, err := h.bot.Send(tgbotapi.NewMessage(chatID, message))
-	if err != nil {
-		log.Printf("Error sending message: %v", err)
+	for _, chunk := range text_split.Split(message, maxMessageLength) {
+		_, err := h.bot.Send(tgbotapi.NewMessage(chatID, chunk))
+		if err != nil {
+			h.log.Error("Error sending message", "chat_id", chatID, "err", err)
+
+			return
+		}
+	}
+}
+
+// Start greets user, chat stopped by /stop gets scheduled pictures and broadcasts again
+func (h *Handler) Start(ctx context.Context, message *tgbotapi.Message) {
+	if settings, err := h.services.Chat.GetSettings(ctx, message.Chat.ID); err == nil && settings.Stopped {
+		err := h.services.Chat.SetStopped(ctx, message.Chat.ID, false)
+		if err != nil {
+			h.replyError(ctx, message.Chat.ID, err, "Error resuming stopped chat")
+
+			return
+		}
+
+		h.log.Info("Chat resumed", "chat_id", message.Chat.ID)
 	}
+
+	h.StartResponse(ctx, message.Chat.ID)
 }
 
-func (h *Handler) StartResponse(chatID int64) {
-	msgText := "Welcome to peepobot. Now you can use any available command."
+func (h *Handler) StartResponse(ctx context.Context, chatID int64) {
+	msgText := i18n.T(h.language(ctx, chatID), i18n.KeyWelcome)
+
+	if fileID := h.welcomeImageID(ctx, chatID); fileID != "" {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
+		photo.Caption = msgText
+
+		_, err := h.bot.Send(photo)
+		if err == nil {
+			return
+		}
+
+		// greeting is still sent if configured file ID is wrong or was removed
+		h.log.Warn("Error sending welcome image, sending text only", "chat_id", chatID, "file_id", fileID, "err", err)
+	}
 
 	_, err := h.bot.Send(tgbotapi.NewMessage(chatID, msgText))
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		h.log.Error("Error sending message", "chat_id", chatID, "err", err)
 	}
 }
 
-func (h *Handler) HelpResponse(chatID int64) {
-	msgText := "Command list help:\n" +
-		"/peepo - Get random picture;\n" +
-		"/sub - Subscribe to receive pictures periodically;\n" +
-		"/sub_info - Get info about current subscription;\n" +
-		"/unsub - Drop current subscription;\n" +
-		"/help - Get this list."
+// welcomeImageID returns Telegram file ID of picture sent with greeting, empty if there is none
+func (h *Handler) welcomeImageID(ctx context.Context, chatID int64) string {
+	if h.cfg.WelcomeImageID != config.WelcomeImageRandom {
+		return h.cfg.WelcomeImageID
+	}
+
+	settings, _ := h.services.Chat.GetSettings(ctx, chatID)
+	rating := settings.Rating
 
-	_, err := h.bot.Send(tgbotapi.NewMessage(chatID, msgText))
+	files, err := h.services.Image.GetRandomCachedPhotos(ctx, rating, domain.TagFilter{}, 1)
+	if err != nil || len(files) == 0 {
+		if err != nil && !errors.Is(err, image.ErrNoImages) {
+			h.log.Warn("Error getting welcome image", "chat_id", chatID, "err", err)
+		}
+
+		return ""
+	}
+
+	return files[0].TgID
+}
+
+// HelpResponse sends help built from given commands with configured header and footer
+func (h *Handler) HelpResponse(ctx context.Context, chatID int64, commands []CommandInfo) {
+	lang := h.language(ctx, chatID)
+
+	lines := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		name := "/" + cmd.Name
+		if cmd.Usage != "" {
+			name += " " + cmd.Usage
+		}
+
+		description, ok := i18n.Lookup(lang, i18n.CommandKey(cmd.Name))
+		if !ok {
+			description = cmd.Description
+		}
+
+		if len(cmd.Aliases) > 0 {
+			name += " (/" + strings.Join(cmd.Aliases, ", /") + ")"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s - %s", name, description))
+	}
+
+	header, footer := h.cfg.Help()
+	if header == "" {
+		header = i18n.T(lang, i18n.KeyHelpHeader)
+	}
+
+	msgText := header + "\n" + strings.Join(lines, ";\n") + "."
+
+	tags, err := h.services.Image.GetAllTags(ctx)
+	if err != nil {
+		h.log.Error("Error getting tags", "chat_id", chatID, "err", err)
+	}
+
+	if len(tags) > 0 {
+		msgText += "\n\n" + i18n.T(lang, i18n.KeyHelpTags, strings.Join(tags, ", "))
+	}
+
+	if footer != "" {
+		msgText += "\n\n" + footer
+	}
+
+	// tag list grows with library, so help may not fit single message
+	h.MessageResponse(chatID, msgText)
+}
+
+func (h *Handler) StatsResponse(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	userID := message.From.ID
+
+	// admins can look up stats of any user
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" && h.cfg.IsAdmin(userID) {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			h.MessageResponse(message.Chat.ID, "Please enter a valid user ID, e.g. /stats 123456")
+
+			return
+		}
+
+		userID = id
+	}
+
+	userStats, err := h.services.Stats.Get(ctx, userID)
+	if err != nil {
+		msgText := "No stats found!"
+
+		var notFoundErr *custom_errors.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error getting stats")
+		}
+
+		h.MessageResponse(message.Chat.ID, msgText)
+
+		return
+	}
+
+	msgText := fmt.Sprintf("Stats for user %d:\n", userStats.UserID) +
+		fmt.Sprintf("Pictures requested: %d\n", userStats.ImagesRequested) +
+		fmt.Sprintf("First used at: %s", userStats.FirstUsedAtAsUnixTime())
+
+	h.MessageResponse(message.Chat.ID, msgText)
+}
+
+// SetRating changes pictures allowed in chat, in groups only chat administrators can do it
+func (h *Handler) SetRating(ctx context.Context, message *tgbotapi.Message) {
+	rating := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if rating != domain.ChatRatingSFW && rating != domain.ChatRatingAll {
+		current, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf("Current rating is %s. Please choose sfw or all, e.g. /set_rating sfw", current.Rating))
+
+		return
+	}
+
+	if !h.canManageChat(message) {
+		h.MessageResponse(message.Chat.ID, "Only chat administrators can change rating!")
+
+		return
+	}
+
+	err := h.services.Chat.SetRating(ctx, message.Chat.ID, rating)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting rating")
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, fmt.Sprintf("Chat rating set to %s", rating))
+}
+
+// canManageChat reports whether sender may change chat settings
+func (h *Handler) canManageChat(message *tgbotapi.Message) bool {
+	return access.CanManageChat(h.cfg, h.log, h.bot, message)
+}
+
+// SetLanguage changes language of bot responses in chat
+func (h *Handler) SetLanguage(ctx context.Context, message *tgbotapi.Message) {
+	lang := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	current := h.language(ctx, message.Chat.ID)
+
+	if !i18n.IsSupported(lang) {
+		h.MessageResponse(message.Chat.ID, i18n.T(current, i18n.KeyLangCurrent, current, strings.Join(i18n.Languages(), ", ")))
+
+		return
+	}
+
+	err := h.services.Chat.SetLanguage(ctx, message.Chat.ID, lang)
+	if err != nil {
+		h.log.Error("Error setting language", "chat_id", message.Chat.ID, "err", err)
+		h.MessageResponse(message.Chat.ID, i18n.T(current, i18n.KeyLangError))
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, i18n.T(lang, i18n.KeyLangSet, lang))
+}
+
+func (h *Handler) language(ctx context.Context, chatID int64) string {
+	settings, _ := h.services.Chat.GetSettings(ctx, chatID)
+
+	return settings.Language
+}
+
+// errorText returns reply to err in chat language, unexpected errors are logged with msg and args
+func (h *Handler) errorText(ctx context.Context, chatID int64, err error, msg string, args ...any) string {
+	return errmsg.Reply(h.log, h.cfg, h.language(ctx, chatID), chatID, err, msg, args...)
+}
+
+// replyError sends errorText to chat
+func (h *Handler) replyError(ctx context.Context, chatID int64, err error, msg string, args ...any) {
+	h.MessageResponse(chatID, h.errorText(ctx, chatID, err, msg, args...))
+}
+
+// Feedback saves user message and forwards it to bot admins
+func (h *Handler) Feedback(ctx context.Context, message *tgbotapi.Message) {
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		h.MessageResponse(message.Chat.ID, "Please include a message, e.g. /feedback Picture #42 is broken")
+
+		return
+	}
+
+	if message.From == nil {
+		return
+	}
+
+	fb, err := h.services.Feedback.Submit(ctx, domain.Feedback{
+		ChatID:   message.Chat.ID,
+		UserID:   message.From.ID,
+		Username: message.From.UserName,
+		Text:     text,
+	})
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error saving feedback")
+
+		return
+	}
+
+	sender := fmt.Sprint(fb.UserID)
+	if fb.Username != "" {
+		sender += " (@" + fb.Username + ")"
+	}
+
+	forward := fmt.Sprintf("Feedback #%d from user %s in chat %d:\n%s", fb.ID, sender, fb.ChatID, fb.Text)
+	for _, adminID := range h.cfg.Admins() {
+		h.MessageResponse(adminID, forward)
+	}
+
+	h.MessageResponse(message.Chat.ID, "Thanks for your feedback!")
+}
+
+// maxPublicTagBreakdown is max number of tags listed by /count for non admins
+const maxPublicTagBreakdown = 10
+
+// Count reports library size, total with per tag breakdown or for single tag
+func (h *Handler) Count(ctx context.Context, message *tgbotapi.Message) {
+	if tag := strings.TrimSpace(message.CommandArguments()); tag != "" {
+		count, err := h.services.Image.CountImages(ctx, tag)
+		if err != nil {
+			h.replyError(ctx, message.Chat.ID, err, "Error counting images", "tag", tag)
+
+			return
+		}
+
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf("I currently have %d images tagged %s", count, tag))
+
+		return
+	}
+
+	total, err := h.services.Image.CountImages(ctx, "")
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error counting images")
+
+		return
+	}
+
+	msgText := fmt.Sprintf("I currently have %d images", total)
+
+	tags, err := h.services.Image.GetAllTags(ctx)
+	if err != nil {
+		h.log.Error("Error getting tags", "chat_id", message.Chat.ID, "err", err)
+	}
+
+	isAdmin := message.From != nil && h.cfg.IsAdmin(message.From.ID)
+	if len(tags) > 0 && (len(tags) <= maxPublicTagBreakdown || isAdmin) {
+		parts := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			count, err := h.services.Image.CountImages(ctx, tag)
+			if err != nil {
+				h.log.Error("Error counting images", "chat_id", message.Chat.ID, "tag", tag, "err", err)
+
+				continue
+			}
+
+			parts = append(parts, fmt.Sprintf("%s: %d", tag, count))
+		}
+
+		if len(parts) > 0 {
+			msgText += " (" + strings.Join(parts, ", ") + ")"
+		}
+	}
+
+	h.MessageResponse(message.Chat.ID, msgText)
+}
+
+// SetCooldown overrides command cooldown in chat, in groups only chat administrators can do it
+func (h *Handler) SetCooldown(ctx context.Context, message *tgbotapi.Message) {
+	arg := strings.ToLower(strings.ReplaceAll(message.CommandArguments(), " ", ""))
+
+	var cooldown time.Duration
+	if arg != "default" {
+		var err error
+
+		cooldown, err = time.ParseDuration(arg)
+		if err != nil || cooldown < h.cfg.MinChatCooldown || cooldown > h.cfg.MaxChatCooldown {
+			h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+				"Please enter a cooldown between %s and %s, e.g. /set_cooldown 5s, or /set_cooldown default",
+				time_string.ShortDur(h.cfg.MinChatCooldown),
+				time_string.ShortDur(h.cfg.MaxChatCooldown),
+			))
+
+			return
+		}
+	}
+
+	if !h.canManageChat(message) {
+		h.MessageResponse(message.Chat.ID, "Only chat administrators can change cooldown!")
+
+		return
+	}
+
+	err := h.services.Chat.SetCooldown(ctx, message.Chat.ID, cooldown)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting cooldown")
+
+		return
+	}
+
+	if cooldown == 0 {
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+			"Chat cooldown reset to default %s", time_string.ShortDur(h.cfg.Cooldown()),
+		))
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, fmt.Sprintf("Chat cooldown set to %s", time_string.ShortDur(cooldown)))
+}
+
+func (h *Handler) GetCooldown(ctx context.Context, message *tgbotapi.Message) {
+	settings, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+	cooldown := settings.CooldownAsDuration()
+	if cooldown == 0 {
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+			"Chat uses default cooldown %s", time_string.ShortDur(h.cfg.Cooldown()),
+		))
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, fmt.Sprintf("Chat cooldown is %s", time_string.ShortDur(cooldown)))
+}
+
+// Quiet sets, disables or shows hours when scheduled pictures are not delivered, e.g. /quiet 23:00-08:00
+func (h *Handler) Quiet(ctx context.Context, message *tgbotapi.Message) {
+	arg := strings.ToLower(strings.ReplaceAll(message.CommandArguments(), " ", ""))
+	settings, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+
+	if arg == "" {
+		if !settings.HasQuietHours() {
+			h.MessageResponse(message.Chat.ID, "Quiet hours are off, set them with /quiet 23:00-08:00")
+
+			return
+		}
+
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+			"Quiet hours are %s (%s)", settings.QuietHoursString(), settings.Timezone,
+		))
+
+		return
+	}
+
+	var start, end int
+	if arg != "off" {
+		var ok bool
+
+		start, end, ok = parseQuietHours(arg)
+		if !ok {
+			h.MessageResponse(message.Chat.ID, "Please enter quiet hours as HH:MM-HH:MM, e.g. /quiet 23:00-08:00, or /quiet off")
+
+			return
+		}
+	}
+
+	if !h.canManageChat(message) {
+		h.MessageResponse(message.Chat.ID, "Only chat administrators can change quiet hours!")
+
+		return
+	}
+
+	err := h.services.Chat.SetQuietHours(ctx, message.Chat.ID, start, end)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting quiet hours")
+
+		return
+	}
+
+	if start == end {
+		h.MessageResponse(message.Chat.ID, "Quiet hours are off")
+
+		return
+	}
+
+	settings.QuietStart, settings.QuietEnd = start, end
+	h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+		"Quiet hours set to %s (%s), change timezone with /timezone", settings.QuietHoursString(), settings.Timezone,
+	))
+}
+
+// parseQuietHours parses HH:MM-HH:MM to minutes since midnight
+func parseQuietHours(arg string) (start int, end int, ok bool) {
+	rawStart, rawEnd, found := strings.Cut(arg, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	startTime, err := time.Parse("15:04", rawStart)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	endTime, err := time.Parse("15:04", rawEnd)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	start = startTime.Hour()*60 + startTime.Minute()
+	end = endTime.Hour()*60 + endTime.Minute()
+
+	return start, end, start != end
+}
+
+// HD toggles sending pictures to chat as uncompressed documents, e.g. /hd on
+func (h *Handler) HD(ctx context.Context, message *tgbotapi.Message) {
+	if !h.cfg.AllowHDMode {
+		h.MessageResponse(message.Chat.ID, "HD pictures are disabled")
+
+		return
+	}
+
+	var on bool
+
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	default:
+		state := "off"
+		if settings, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID); settings.HDMode {
+			state = "on"
+		}
+
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf("HD mode is %s. Please choose on or off, e.g. /hd on", state))
+
+		return
+	}
+
+	if !h.canManageChat(message) {
+		h.MessageResponse(message.Chat.ID, "Only chat administrators can change HD mode!")
+
+		return
+	}
+
+	err := h.services.Chat.SetHDMode(ctx, message.Chat.ID, on)
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		h.replyError(ctx, message.Chat.ID, err, "Error setting HD mode")
+
+		return
+	}
+
+	if !on {
+		h.MessageResponse(message.Chat.ID, "HD mode is off")
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, "HD mode is on, pictures are sent as files without compression")
+}
+
+// Timezone sets or shows chat timezone used for quiet hours, e.g. /timezone Europe/Moscow
+func (h *Handler) Timezone(ctx context.Context, message *tgbotapi.Message) {
+	arg := strings.TrimSpace(message.CommandArguments())
+
+	if arg == "" {
+		settings, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+		h.MessageResponse(message.Chat.ID, fmt.Sprintf("Chat timezone is %s", settings.Timezone))
+
+		return
+	}
+
+	loc, err := time.LoadLocation(arg)
+	if err != nil || arg == "Local" {
+		h.MessageResponse(message.Chat.ID, "Please enter timezone name, e.g. /timezone Europe/Moscow or /timezone UTC")
+
+		return
 	}
+
+	if !h.canManageChat(message) {
+		h.MessageResponse(message.Chat.ID, "Only chat administrators can change timezone!")
+
+		return
+	}
+
+	err = h.services.Chat.SetTimezone(ctx, message.Chat.ID, loc.String())
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error setting timezone")
+
+		return
+	}
+
+	h.MessageResponse(message.Chat.ID, fmt.Sprintf(
+		"Chat timezone set to %s, local time is %s", loc, time.Now().In(loc).Format("15:04"),
+	))
+}
+
+// WhoAmI shows sender and chat IDs which are needed to configure admins
+func (h *Handler) WhoAmI(ctx context.Context, message *tgbotapi.Message) {
+	msgText := fmt.Sprintf("Chat ID: %d\nChat type: %s", message.Chat.ID, message.Chat.Type)
+
+	if message.From != nil {
+		msgText = fmt.Sprintf("User ID: %d\n", message.From.ID) + msgText +
+			fmt.Sprintf("\nAdmin: %t", h.cfg.IsAdmin(message.From.ID))
+	}
+
+	h.MessageResponse(message.Chat.ID, msgText)
 }
@@ -0,0 +1,242 @@
+package general
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/i18n"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/feedback"
+	"apubot/internal/service/image"
+	"apubot/internal/testutil"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fakeChatService returns default settings, other methods are not used by tested handlers
+type fakeChatService struct {
+	chat.ChatService
+}
+
+func (fakeChatService) GetSettings(_ context.Context, chatId int64) (domain.ChatSettings, error) {
+	return domain.DefaultChatSettings(chatId), nil
+}
+
+// fakeImageService returns tags, other methods are not used by tested handlers
+type fakeImageService struct {
+	image.ImageService
+	tags []string
+}
+
+func (f fakeImageService) GetAllTags(context.Context) ([]string, error) {
+	return f.tags, nil
+}
+
+// fakeFeedbackService saves feedback in memory or fails with err
+type fakeFeedbackService struct {
+	feedback.FeedbackService
+	saved []domain.Feedback
+	err   error
+}
+
+func (f *fakeFeedbackService) Submit(_ context.Context, fb domain.Feedback) (domain.Feedback, error) {
+	if f.err != nil {
+		return domain.Feedback{}, f.err
+	}
+
+	fb.ID = int64(len(f.saved) + 1)
+	f.saved = append(f.saved, fb)
+
+	return fb, nil
+}
+
+func newTestHandler(services *Services) (*Handler, *testutil.Sender) {
+	cfg := &config.Config{AdminIDs: []int64{100}}
+	bot := &testutil.Sender{}
+
+	if services.Chat == nil {
+		services.Chat = fakeChatService{}
+	}
+
+	return New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), bot, services), bot
+}
+
+func command(chatID int64, userID int64, text string) *tgbotapi.Message {
+	name, _, _ := strings.Cut(text, " ")
+
+	return &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: chatID, Type: "private"},
+		From:     &tgbotapi.User{ID: userID, UserName: "user"},
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+func TestMessageResponse(t *testing.T) {
+	h, bot := newTestHandler(&Services{})
+
+	h.MessageResponse(1, "hello")
+
+	sent := bot.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+
+	msg, ok := sent[0].(tgbotapi.MessageConfig)
+	if !ok || msg.ChatID != 1 || msg.Text != "hello" {
+		t.Errorf("sent %+v, want hello to chat 1", sent[0])
+	}
+}
+
+func TestMessageResponseStopsAfterSendError(t *testing.T) {
+	h, bot := newTestHandler(&Services{})
+	bot.Errs = []error{nil}
+	bot.Err = errors.New("connection reset by peer")
+
+	h.MessageResponse(1, strings.Repeat("a\n", maxMessageLength))
+
+	// remaining chunks are dropped after failed second one, otherwise user would get message with missing part
+	if sent := bot.Sent(); len(sent) != 2 {
+		t.Errorf("sent %d chunks, want the first one and failed second one", len(sent))
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	fb := &fakeFeedbackService{}
+	h, bot := newTestHandler(&Services{Feedback: fb})
+
+	h.Feedback(context.Background(), command(1, 2, "/feedback Picture #42 is broken"))
+
+	if len(fb.saved) != 1 || fb.saved[0].Text != "Picture #42 is broken" || fb.saved[0].UserID != 2 {
+		t.Fatalf("saved feedback %+v, want text from user 2", fb.saved)
+	}
+
+	want := "Feedback #1 from user 2 (@user) in chat 1:\nPicture #42 is broken"
+	if got := bot.Texts(100); len(got) != 1 || got[0] != want {
+		t.Errorf("sent %q to admin, want %q", got, want)
+	}
+
+	if got := bot.Texts(1); len(got) != 1 || got[0] != "Thanks for your feedback!" {
+		t.Errorf("sent %q to user, want thanks", got)
+	}
+}
+
+func TestFeedbackErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err  error
+		want string
+	}{
+		{
+			name: "no text",
+			text: "/feedback",
+			want: "Please include a message, e.g. /feedback Picture #42 is broken",
+		},
+		{
+			name: "save failed",
+			text: "/feedback hi",
+			err:  errors.New("disk is full"),
+			want: i18n.T(domain.DefaultChatLanguage, i18n.KeyUnknownError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(&Services{Feedback: &fakeFeedbackService{err: tt.err}})
+
+			h.Feedback(context.Background(), command(1, 2, tt.text))
+
+			if got := bot.Texts(1); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageResponseSplitsLongText(t *testing.T) {
+	h, bot := newTestHandler(&Services{})
+
+	text := strings.Repeat("0123456789abcdefghi\n", 500)
+	h.MessageResponse(1, text)
+
+	got := bot.Texts(1)
+	if len(got) < 3 {
+		t.Fatalf("10k characters sent in %d messages, want at least 3", len(got))
+	}
+
+	for i, chunk := range got {
+		if n := utf8.RuneCountInString(chunk); n > maxMessageLength {
+			t.Errorf("message %d has %d characters, want at most %d", i, n, maxMessageLength)
+		}
+
+		// text is cut on line boundaries
+		if i < len(got)-1 && !strings.HasSuffix(chunk, "\n") {
+			t.Errorf("message %d does not end with line break", i)
+		}
+	}
+
+	if joined := strings.Join(got, ""); joined != text {
+		t.Error("sent messages differ from text")
+	}
+}
+
+func TestHelpResponseSplitsLongTagList(t *testing.T) {
+	tags := make([]string, 1000)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag_%d", i)
+	}
+
+	h, bot := newTestHandler(&Services{Image: fakeImageService{tags: tags}})
+
+	h.HelpResponse(context.Background(), 1, []CommandInfo{{Name: "peepo", Description: "Get a random picture"}})
+
+	got := bot.Texts(1)
+	if len(got) < 2 {
+		t.Fatalf("help with %d tags sent in %d messages, want several", len(tags), len(got))
+	}
+
+	for i, chunk := range got {
+		if n := utf8.RuneCountInString(chunk); n > maxMessageLength {
+			t.Errorf("message %d has %d characters, want at most %d", i, n, maxMessageLength)
+		}
+	}
+
+	joined := strings.Join(got, "")
+	for _, tag := range []string{"tag_0", "tag_500", "tag_999"} {
+		if !strings.Contains(joined, tag) {
+			t.Errorf("help does not list %s", tag)
+		}
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		arg        string
+		start, end int
+		ok         bool
+	}{
+		{"23:00-08:00", 23 * 60, 8 * 60, true},
+		{"09:30-17:45", 9*60 + 30, 17*60 + 45, true},
+		{"00:00-23:59", 0, 23*60 + 59, true},
+		{"10:00-10:00", 0, 0, false},
+		{"23:00", 0, 0, false},
+		{"25:00-08:00", 0, 0, false},
+		{"night", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			start, end, ok := parseQuietHours(tt.arg)
+			if ok != tt.ok || ok && (start != tt.start || end != tt.end) {
+				t.Errorf("parseQuietHours(%q) = %d, %d, %t, want %d, %d, %t", tt.arg, start, end, ok, tt.start, tt.end, tt.ok)
+			}
+		})
+	}
+}
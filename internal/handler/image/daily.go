@@ -0,0 +1,31 @@
+package image
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"time"
+)
+
+// GetDailyImage sends picture of the day, it is the same for everyone until midnight in daily_timezone
+func (h *Handler) GetDailyImage(ctx context.Context, message *tgbotapi.Message) {
+	now := time.Now().In(h.cfg.DailyLocation())
+
+	file, err := h.services.Image.GetDailyFile(ctx, h.chatRating(ctx, message.Chat.ID), now)
+	if err != nil {
+		h.replyGetError(ctx, message.Chat.ID, err)
+
+		return
+	}
+
+	err = h.sendReply(ctx, file, message, nil)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+
+		return
+	}
+
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, file)
+	}
+}
@@ -0,0 +1,203 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/handler/pagination"
+	"apubot/pkg/custom_errors"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// AddFavorite saves replied picture or the last one served to user
+func (h *Handler) AddFavorite(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	file, ok := h.repliedFile(ctx, message)
+	if !ok {
+		file, ok = h.services.Favorite.LastServed(message.From.ID)
+	}
+
+	if !ok {
+		h.reply(message.Chat.ID, "Nothing to save yet! Get a picture with /peepo first or reply to one with /fav.")
+
+		return
+	}
+
+	err := h.services.Favorite.Add(ctx, message.From.ID, file)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error adding favorite")
+
+		return
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Picture #%d saved! Get it back with /fav_get %d", file.ID, file.ID))
+}
+
+// FavoritesCallbackPrefix is followed by owner ID and page, e.g. favs:42:1
+const FavoritesCallbackPrefix = "favs:"
+
+func (h *Handler) ListFavorites(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	text, markup := h.favoritesPage(ctx, message.Chat.ID, message.From.ID, 0)
+
+	_, err := h.bot.Send(pagination.Message(message.Chat.ID, text, markup))
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+}
+
+// FavoritesPage shows another page of favorites, only their owner can navigate them
+func (h *Handler) FavoritesPage(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	rawOwner, _, _ := strings.Cut(strings.TrimPrefix(query.Data, FavoritesCallbackPrefix), ":")
+
+	ownerId, err := strconv.ParseInt(rawOwner, 10, 64)
+	if err != nil || query.Message == nil || query.From == nil {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	page, ok := pagination.ParsePage(query.Data, fmt.Sprintf("%s%d:", FavoritesCallbackPrefix, ownerId))
+	if !ok {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	if query.From.ID != ownerId {
+		h.answer(query.ID, "These are not your favorites, use /favs to see yours")
+
+		return
+	}
+
+	text, markup := h.favoritesPage(ctx, query.Message.Chat.ID, ownerId, page)
+
+	_, err = h.bot.Send(pagination.Edit(query.Message, text, markup))
+	if err != nil {
+		h.log.Error("Error editing message", "chat_id", query.Message.Chat.ID, "err", err)
+	}
+
+	h.answer(query.ID, "")
+}
+
+// favoritesPage returns text of favorites page with navigation buttons, errors are reported in text
+func (h *Handler) favoritesPage(
+	ctx context.Context,
+	chatId int64,
+	userId int64,
+	page int,
+) (string, *tgbotapi.InlineKeyboardMarkup) {
+	ids, err := h.services.Favorite.List(ctx, userId)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return "You have no favorites yet! Use /fav after getting a picture.", nil
+		}
+
+		return h.errorText(ctx, chatId, err, "Error listing favorites"), nil
+	}
+
+	ids, page, pages := pagination.Page(ids, page, h.cfg.ListPageSize)
+
+	strIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strIDs = append(strIDs, fmt.Sprintf("#%d", id))
+	}
+
+	text := "Your favorites: " + strings.Join(strIDs, ", ") + "\nUse /fav_get <id> to get one."
+	text = pagination.WithPageNumber(text, page, pages)
+
+	return text, pagination.Keyboard(fmt.Sprintf("%s%d:", FavoritesCallbackPrefix, userId), page, pages)
+}
+
+func (h *Handler) GetFavorite(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	imageId, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), "#"), 10, 64)
+	if err != nil {
+		h.reply(message.Chat.ID, "Please enter favorite ID, e.g. /fav_get 42")
+
+		return
+	}
+
+	_, err = h.services.Favorite.Get(ctx, message.From.ID, imageId)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf("Picture #%d is not in your favorites! Check /favs.", imageId))
+		} else {
+			h.replyError(ctx, message.Chat.ID, err, "Error getting favorite")
+		}
+
+		return
+	}
+
+	file, err := h.services.Image.GetByID(ctx, imageId)
+	if err != nil {
+		h.reply(message.Chat.ID, fmt.Sprintf("Picture #%d is no longer available", imageId))
+
+		return
+	}
+
+	if !file.AllowedFor(h.chatRating(ctx, message.Chat.ID)) {
+		h.reply(message.Chat.ID, fmt.Sprintf("Picture #%d is not allowed in this chat", imageId))
+
+		return
+	}
+
+	err = h.sendReply(ctx, file, message, nil)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+	}
+}
+
+// repliedFile finds image of message user replied to
+func (h *Handler) repliedFile(ctx context.Context, message *tgbotapi.Message) (domain.File, bool) {
+	replied := message.ReplyToMessage
+	if replied == nil {
+		return domain.File{}, false
+	}
+
+	var tgId string
+
+	switch {
+	case len(replied.Photo) > 0:
+		tgId = replied.Photo[len(replied.Photo)-1].FileID
+	case replied.Animation != nil:
+		tgId = replied.Animation.FileID
+	default:
+		return domain.File{}, false
+	}
+
+	file, err := h.services.Image.GetByTgID(ctx, tgId)
+	if err != nil {
+		return domain.File{}, false
+	}
+
+	return file, true
+}
+
+func (h *Handler) answer(queryId string, text string) {
+	_, err := h.bot.Request(tgbotapi.NewCallback(queryId, text))
+	if err != nil {
+		h.log.Error("Error answering callback", "err", err)
+	}
+}
+
+func (h *Handler) reply(chatId int64, text string) {
+	_, err := h.bot.Send(tgbotapi.NewMessage(chatId, text))
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", chatId, "err", err)
+	}
+}
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/testutil"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"testing"
+)
+
+// favoritesQuery returns press of favorites navigation button under message sent to chat
+func favoritesQuery(userID int64, chatID int64, data string) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: userID},
+		Message: &tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: chatID, Type: "group"}},
+		Data:    data,
+	}
+}
+
+// lastEdit returns the last edit of message text
+func lastEdit(t *testing.T, bot *testutil.Sender) tgbotapi.EditMessageTextConfig {
+	t.Helper()
+
+	sent := bot.Sent()
+	for i := len(sent) - 1; i >= 0; i-- {
+		if edit, ok := sent[i].(tgbotapi.EditMessageTextConfig); ok {
+			return edit
+		}
+	}
+
+	t.Fatal("message was not edited")
+
+	return tgbotapi.EditMessageTextConfig{}
+}
+
+// answers returns texts of callback answers
+func answers(bot *testutil.Sender) []string {
+	var texts []string
+	for _, c := range bot.Sent() {
+		if answer, ok := c.(tgbotapi.CallbackConfig); ok {
+			texts = append(texts, answer.Text)
+		}
+	}
+
+	return texts
+}
+
+func TestFavoritesPagination(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.ListPageSize = 2 })
+	ctx := context.Background()
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, testutil.AddImage(t, h.services.Image, fmt.Sprintf("%02d.jpg", i)).ID)
+	}
+
+	if err := h.services.Favorite.AddMany(ctx, 1, ids); err != nil {
+		t.Fatalf("can not add favorites: %v", err)
+	}
+
+	h.ListFavorites(ctx, command(1, "/favs"))
+
+	got := bot.Texts(1)
+	if len(got) != 1 || !strings.HasSuffix(got[0], "Page 1 of 3") {
+		t.Fatalf("/favs sent %q, want first of 3 pages", got)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		wantPage string
+		// wantButtons is data of Prev and Next buttons
+		wantButtons []string
+	}{
+		{name: "next page", data: "favs:1:1", wantPage: "Page 2 of 3", wantButtons: []string{"favs:1:0", "favs:1:2"}},
+		{name: "last page", data: "favs:1:2", wantPage: "Page 3 of 3", wantButtons: []string{"favs:1:1", "favs:1:-"}},
+		{name: "first page", data: "favs:1:0", wantPage: "Page 1 of 3", wantButtons: []string{"favs:1:-", "favs:1:1"}},
+		// favorites may be removed while message is shown
+		{name: "page past the end", data: "favs:1:9", wantPage: "Page 3 of 3", wantButtons: []string{"favs:1:1", "favs:1:-"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.FavoritesPage(ctx, favoritesQuery(1, 1, tt.data))
+
+			edit := lastEdit(t, bot)
+			if !strings.HasSuffix(edit.Text, tt.wantPage) {
+				t.Errorf("edited text %q, want %s", edit.Text, tt.wantPage)
+			}
+
+			buttons := edit.ReplyMarkup.InlineKeyboard[0]
+			if *buttons[0].CallbackData != tt.wantButtons[0] || *buttons[1].CallbackData != tt.wantButtons[1] {
+				t.Errorf("buttons %q, %q, want %q", *buttons[0].CallbackData, *buttons[1].CallbackData, tt.wantButtons)
+			}
+		})
+	}
+}
+
+func TestFavoritesPaginationEdgeButtons(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.ListPageSize = 2 })
+	ctx := context.Background()
+
+	ids := []int64{testutil.AddImage(t, h.services.Image, "01.jpg").ID, testutil.AddImage(t, h.services.Image, "02.jpg").ID, testutil.AddImage(t, h.services.Image, "03.jpg").ID}
+	if err := h.services.Favorite.AddMany(ctx, 1, ids); err != nil {
+		t.Fatalf("can not add favorites: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		userID     int64
+		data       string
+		wantAnswer string
+	}{
+		{name: "placeholder button", userID: 1, data: "favs:1:-"},
+		{name: "malformed data", userID: 1, data: "favs:x:1"},
+		{name: "other user", userID: 2, data: "favs:1:1", wantAnswer: "These are not your favorites, use /favs to see yours"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot.Reset()
+
+			h.FavoritesPage(ctx, favoritesQuery(tt.userID, -5, tt.data))
+
+			if got := answers(bot); len(got) != 1 || got[0] != tt.wantAnswer {
+				t.Errorf("answers %q, want %q", got, tt.wantAnswer)
+			}
+
+			// message stays as it is
+			if sent := bot.Sent(); len(sent) != 1 {
+				t.Errorf("sent %d requests, want only callback answer", len(sent))
+			}
+		})
+	}
+}
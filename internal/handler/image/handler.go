@@ -3,74 +3,428 @@ package image
 import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
+	"apubot/internal/handler/access"
+	"apubot/internal/handler/attachment"
+	"apubot/internal/handler/errmsg"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/metrics"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/favorite"
+	"apubot/internal/service/history"
 	"apubot/internal/service/image"
+	"apubot/internal/service/source"
+	"apubot/internal/service/stats"
 	"apubot/internal/service/subscription"
 	"apubot/pkg/custom_errors"
-	"apubot/pkg/utils/queue"
+	"apubot/pkg/logger"
 	"apubot/pkg/utils/time_string"
 	"context"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pkg/errors"
-	"log"
-	"path"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+const RefreshImageCallbackPrefix = "refresh_image"
+
+// AnimationArg is /peepo argument requesting animation instead of picture
+const AnimationArg = "gif"
+
+const (
+	// maxInlineResults is Telegram limit for inline query results
+	maxInlineResults = 50
+	// inlineCacheTime is seconds Telegram caches inline results, kept short so pictures vary
+	inlineCacheTime = 10
+)
+
+// maxCaptionLength is Telegram limit for media caption
+const maxCaptionLength = 1024
+
+// noSubscriptionText replaces not found errors of subscription service, their messages are not meant for users
+const noSubscriptionText = "No active subscription found!"
+
 type (
 	Handler struct {
 		cfg      *config.Config
-		bot      *tgbotapi.BotAPI
+		log      logger.Logger
+		bot      telegram.Sender
 		services *Services
+		// postponed holds end of quiet hours each chat already has a delivery saved for
+		postponed   map[int64]time.Time
+		postponedMu sync.Mutex
+		// hotLog collapses send and db errors repeated for many chats during incidents
+		hotLog logger.Logger
 	}
 	Services struct {
 		Image        image.ImageService
 		Subscription subscription.SubscriptionService
+		Stats        stats.StatsService
+		Favorite     favorite.FavoriteService
+		Chat         chat.ChatService
+		Source       source.SourceService
+		History      history.HistoryService
 	}
 )
 
-func New(cfg *config.Config, bot *tgbotapi.BotAPI, services *Services) *Handler {
+func New(cfg *config.Config, log logger.Logger, bot telegram.Sender, services *Services) *Handler {
 	h := &Handler{
-		cfg:      cfg,
-		bot:      bot,
-		services: services,
+		cfg:       cfg,
+		log:       log,
+		bot:       bot,
+		services:  services,
+		postponed: make(map[int64]time.Time),
+		hotLog:    logger.Deduplicate(log, cfg.LogDedupWindow),
 	}
 
 	err := h.services.Subscription.RescheduleExisting(context.Background(), h.sendImage)
 	if err != nil {
-		log.Fatal(err)
+		log.Error("Can not reschedule existing subscriptions", "err", err)
+		os.Exit(1)
 	}
 
 	return h
 }
 
 func (h *Handler) GetImage(ctx context.Context, message *tgbotapi.Message) {
-	file, err := h.services.Image.GetRandomFile(ctx)
+	file, err := h.services.Image.GetRandomFileForChat(ctx, message.Chat.ID, h.chatRating(ctx, message.Chat.ID))
 	if err != nil {
-		log.Printf("Error getting file: %v", err)
+		h.replyGetError(ctx, message.Chat.ID, err)
 
 		return
 	}
 
-	attachment, err := h.createAttachment(file, message.Chat.ID)
+	err = h.sendReply(ctx, file, message, refreshKeyboard())
 	if err != nil {
-		log.Printf("Error creating attachment: %v", err)
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
 
 		return
 	}
 
-	res, err := h.bot.Send(attachment)
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, file)
+	}
+}
+
+// RefreshImage replaces picture in message with Next button by a new random one, recently sent ones are not repeated
+func (h *Handler) RefreshImage(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	// answerText is shown to user if picture can not be replaced
+	var answerText string
+	defer func() {
+		_, err := h.bot.Request(tgbotapi.NewCallback(query.ID, answerText))
+		if err != nil {
+			h.log.Error("Error answering callback", "err", err)
+		}
+	}()
+
+	if query.Message == nil {
+		return
+	}
+
+	chatId := query.Message.Chat.ID
+
+	file, err := h.services.Image.GetRandomFileForChat(ctx, chatId, h.chatRating(ctx, chatId))
+	if err != nil {
+		answerText = h.errorText(ctx, chatId, err, "Error getting file")
+
+		return
+	}
+
+	media, err := attachment.NewInputMedia(h.cfg.ImagesDirPath, file, h.caption(ctx, file))
 	if err != nil {
-		log.Printf("Error sending attachment: %v", err)
+		answerText = h.errorText(ctx, chatId, err, "Error creating media")
 
 		return
 	}
 
+	markup := refreshKeyboard()
+	edit := tgbotapi.EditMessageMediaConfig{
+		BaseEdit: tgbotapi.BaseEdit{
+			ChatID:      chatId,
+			MessageID:   query.Message.MessageID,
+			ReplyMarkup: &markup,
+		},
+		Media: media,
+	}
+
+	res, err := h.sendWithRetry(edit)
+	if err != nil {
+		metrics.SendErrors.Inc()
+		answerText = h.errorText(ctx, chatId, err, "Error editing message")
+
+		return
+	}
+
+	metrics.ImagesSent.Inc()
+
 	if file.TgID == "" {
 		h.updateFile(ctx, file, res)
 	}
+
+	h.markServed(ctx, chatId, file)
+
+	if query.From != nil {
+		h.services.Stats.IncrementImages(ctx, query.From.ID)
+		h.services.Favorite.SetLastServed(query.From.ID, file)
+	}
+}
+
+// GetImageHD sends random photo as uncompressed document regardless of chat HD mode
+func (h *Handler) GetImageHD(ctx context.Context, message *tgbotapi.Message) {
+	if !h.cfg.AllowHDMode {
+		h.reply(message.Chat.ID, "HD pictures are disabled")
+
+		return
+	}
+
+	files, err := h.services.Image.GetRandomPhotosForChat(ctx, message.Chat.ID, h.chatRating(ctx, message.Chat.ID), 1)
+	if err != nil {
+		h.replyGetError(ctx, message.Chat.ID, err)
+
+		return
+	}
+
+	err = h.sendFileWithMarkup(ctx, files[0], message.Chat.ID, h.replyToID(message), nil, true)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+
+		return
+	}
+
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, files[0])
+	}
+}
+
+// GetAnimation sends random animation requested as /peepo gif
+func (h *Handler) GetAnimation(ctx context.Context, message *tgbotapi.Message) {
+	file, err := h.services.Image.GetRandomAnimationForChat(ctx, message.Chat.ID, h.chatRating(ctx, message.Chat.ID))
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) && !errors.Is(err, image.ErrNoImages) {
+			h.reply(message.Chat.ID, "No animated pictures found!")
+
+			return
+		}
+
+		h.replyGetError(ctx, message.Chat.ID, err)
+
+		return
+	}
+
+	err = h.sendReply(ctx, file, message, nil)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+
+		return
+	}
+
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, file)
+	}
+}
+
+// InlineQuery answers @bot queries with random uploaded photos, query text is used as tag filter
+func (h *Handler) InlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	var (
+		files []domain.File
+		err   error
+	)
+
+	// invalid tags can not match any picture, so empty result is sent
+	filter, invalid := domain.ParseTagFilter(query.Query)
+	if len(invalid) == 0 {
+		files, err = h.services.Image.GetRandomCachedPhotos(ctx, domain.ChatRatingSFW, filter, maxInlineResults)
+		if err != nil {
+			var notFoundErr *custom_errors.NotFoundError
+			if !errors.As(err, &notFoundErr) {
+				h.log.Error("Error getting inline files", "query", query.Query, "err", err)
+
+				return
+			}
+		}
+	}
+
+	inline := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       InlineResults(files),
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	}
+
+	_, err = h.bot.Request(inline)
+	if err != nil {
+		h.log.Error("Error answering inline query", "query", query.Query, "err", err)
+	}
+}
+
+// InlineResults builds inline query results from photos uploaded to Telegram
+func InlineResults(files []domain.File) []interface{} {
+	results := make([]interface{}, 0, len(files))
+	for _, file := range files {
+		results = append(results, tgbotapi.NewInlineQueryResultCachedPhoto(fmt.Sprint(file.ID), file.TgID))
+	}
+
+	return results
+}
+
+// GetImageByID sends image requested as /peepo #<id>
+func (h *Handler) GetImageByID(ctx context.Context, message *tgbotapi.Message) {
+	id, ok := ParseImageID(message.CommandArguments())
+	if !ok {
+		h.reply(message.Chat.ID, "Please enter image ID, e.g. /peepo #42")
+
+		return
+	}
+
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil || !file.AllowedFor(h.chatRating(ctx, message.Chat.ID)) {
+		h.reply(message.Chat.ID, fmt.Sprintf("No image with ID #%d", id))
+
+		return
+	}
+
+	err = h.sendReply(ctx, file, message, nil)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+
+		return
+	}
+
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, file)
+	}
+}
+
+// formatTags joins tags for user messages
+func formatTags(tags []string, prefix string) string {
+	quoted := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		quoted = append(quoted, fmt.Sprintf("%q", prefix+tag))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// ParseImageID parses "#<id>" argument, false is returned for anything else
+func ParseImageID(arg string) (int64, bool) {
+	arg = strings.TrimSpace(arg)
+	if !strings.HasPrefix(arg, "#") {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(arg[1:], 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// GetImageByTag sends random image matching tags, tags prefixed with minus are excluded, e.g. /peepo happy -sad
+func (h *Handler) GetImageByTag(ctx context.Context, message *tgbotapi.Message) {
+	filter, invalid := domain.ParseTagFilter(message.CommandArguments())
+	if len(invalid) > 0 {
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Invalid tags %s! Tags may contain letters, digits, _ and - only, up to %d characters.",
+			formatTags(invalid, ""), domain.MaxTagLength,
+		))
+
+		return
+	}
+
+	file, err := h.services.Image.GetRandomFileByTags(ctx, message.Chat.ID, h.chatRating(ctx, message.Chat.ID), filter)
+	if err != nil {
+		var msgText string
+
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) && !errors.Is(err, image.ErrNoImages) {
+			switch {
+			case len(filter.Include) == 0:
+				msgText = "No pictures left after excluding " + formatTags(filter.Exclude, "-") + "! Try excluding fewer tags."
+			case len(filter.Exclude) == 0:
+				msgText = "No pictures with tags " + formatTags(filter.Include, "") + " found! Check /help for available tags."
+			default:
+				msgText = fmt.Sprintf(
+					"No pictures with tags %s found without %s! Try fewer tags or check /help for available ones.",
+					formatTags(filter.Include, ""), formatTags(filter.Exclude, "-"),
+				)
+			}
+		} else {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error getting file by tag")
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
+		_, err = h.bot.Send(msg)
+		if err != nil {
+			h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+		}
+
+		return
+	}
+
+	err = h.sendReply(ctx, file, message, nil)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending file")
+
+		return
+	}
+
+	if message.From != nil {
+		h.services.Stats.IncrementImages(ctx, message.From.ID)
+		h.services.Favorite.SetLastServed(message.From.ID, file)
+	}
+}
+
+func (h *Handler) GetImages(ctx context.Context, message *tgbotapi.Message) {
+	count, err := strconv.Atoi(strings.TrimSpace(message.CommandArguments()))
+	if err != nil || count < 1 {
+		msgText := fmt.Sprintf("Please enter number of pictures from 1 to %d, e.g. /peepo_many 3", h.cfg.MaxBatchSize)
+		msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
+		_, err = h.bot.Send(msg)
+		if err != nil {
+			h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+		}
+
+		return
+	}
+
+	count = min(count, h.cfg.MaxBatchSize)
+
+	files, err := h.services.Image.GetRandomPhotosForChat(ctx, message.Chat.ID, h.chatRating(ctx, message.Chat.ID), count)
+	if err != nil {
+		h.replyGetError(ctx, message.Chat.ID, err)
+
+		return
+	}
+
+	// media group must contain at least 2 items
+	if len(files) == 1 {
+		err = h.sendReply(ctx, files[0], message, nil)
+	} else {
+		err = h.sendAlbum(ctx, files, message.Chat.ID, h.replyToID(message))
+	}
+
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending files")
+
+		return
+	}
+
+	if message.From != nil {
+		for range files {
+			h.services.Stats.IncrementImages(ctx, message.From.ID)
+		}
+	}
 }
 
 func (h *Handler) CreateSubscription(ctx context.Context, message *tgbotapi.Message) error {
@@ -79,24 +433,49 @@ func (h *Handler) CreateSubscription(ctx context.Context, message *tgbotapi.Mess
 		msg := tgbotapi.NewMessage(message.Chat.ID, err.Error())
 		_, err = h.bot.Send(msg)
 		if err != nil {
-			log.Printf("Error sending message: %v", err)
+			h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 		}
 
 		return err
 	}
 
-	err = h.services.Subscription.Create(ctx, inp, h.sendImage)
+	firstRun, err := h.services.Subscription.Create(ctx, inp, h.sendImage)
 	if err != nil {
-		log.Printf("Error creating subscription: %v", err)
+		var existsErr *custom_errors.AlreadyExistsError
+		if errors.As(err, &existsErr) {
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"You already have a subscription with period %s (use /sub_info)",
+				time_string.ShortDur(inp.PeriodAsDurationInSeconds()),
+			))
+
+			return err
+		}
+
+		if errors.Is(err, subscription.ErrLimitReached) {
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"Subscription limit reached: chat can have up to %d active subscriptions, remove one with /unsub",
+				h.cfg.MaxSubsPerChat,
+			))
+
+			return err
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error creating subscription")
 
 		return err
 	}
 
-	msgText := "Subscription created successfully!"
+	h.resumeStopped(ctx, message.Chat.ID)
+
+	period := time_string.ShortDur(inp.PeriodAsDurationInSeconds())
+	msgText := fmt.Sprintf(
+		"Subscription created! First peepo arrives at %s, then every %s",
+		firstRun.Format(time.DateTime), period,
+	)
 	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
 	_, err = h.bot.Send(msg)
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 
 		return err
 	}
@@ -105,202 +484,675 @@ func (h *Handler) CreateSubscription(ctx context.Context, message *tgbotapi.Mess
 }
 
 func (h *Handler) GetSubscription(ctx context.Context, message *tgbotapi.Message) {
-	sub, err := h.services.Subscription.Get(ctx, message.Chat.ID)
+	subs, err := h.services.Subscription.List(ctx, message.Chat.ID)
 	if err != nil {
-		msgText := "Error getting subscription :d"
+		msgText := noSubscriptionText
 
 		var notFoundErr *custom_errors.NotFoundError
-		if errors.As(err, &notFoundErr) {
-			msgText = "No active subscription found!"
+		if !errors.As(err, &notFoundErr) {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error getting subscription")
 		}
 
 		msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
 		_, err = h.bot.Send(msg)
 		if err != nil {
-			log.Printf("Error sending message: %v", err)
+			h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 		}
 
 		return
 	}
 
-	createdAt := sub.SubscribedAtAsUnixTime().String()
-	period := time_string.ShortDur(sub.PeriodAsDurationInSeconds())
-	passedIntervals := time.Since(sub.SubscribedAtAsUnixTime()) / sub.PeriodAsDurationInSeconds()
-	nextEvent := sub.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * sub.PeriodAsDurationInSeconds())
+	msgText := "Active subscriptions:"
+	for i, sub := range subs {
+		nextEvent := sub.NextRun().String()
+		if sub.Paused {
+			nextEvent = "paused, use /sub_resume to continue"
+		}
 
-	msgText := "Current subscription info:\n" +
-		fmt.Sprintf("Created at: %s\n", createdAt) +
-		fmt.Sprintf("Period: %s\n", period) +
-		fmt.Sprintf("Next peepo: %s", nextEvent)
+		msgText += fmt.Sprintf(
+			"\n\n#%d\nCreated at: %s\nPeriod: %s\nNext peepo: %s",
+			i+1,
+			sub.SubscribedAtAsUnixTime(),
+			time_string.ShortDur(sub.PeriodAsDurationInSeconds()),
+			nextEvent,
+		)
+	}
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
 	_, err = h.bot.Send(msg)
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 	}
 }
 
 func (h *Handler) DeleteSubscription(ctx context.Context, message *tgbotapi.Message) {
-	sub, err := h.services.Subscription.Get(ctx, message.Chat.ID)
-	if err != nil {
-		msgText := "Error getting subscription :d"
+	var err error
+	msgText := "Subscription deleted successfully!"
+
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		msgText = "All subscriptions deleted successfully!"
+		err = h.services.Subscription.DeleteAll(ctx, message.Chat.ID)
+		if isNotFound(err) {
+			err = custom_errors.NewNotFound(noSubscriptionText)
+		}
+	} else {
+		err = h.deleteSubscriptionByArg(ctx, message.Chat.ID, arg)
+	}
 
+	if err != nil {
 		var notFoundErr *custom_errors.NotFoundError
 		if errors.As(err, &notFoundErr) {
-			msgText = "No active subscription found!"
+			msgText = notFoundErr.Message
+		} else {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error deleting subscription")
 		}
+	}
 
-		msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
-		_, err = h.bot.Send(msg)
-		if err != nil {
-			log.Printf("Error sending message: %v", err)
+	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
+	_, err = h.bot.Send(msg)
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+}
+
+func (h *Handler) PauseSubscription(ctx context.Context, message *tgbotapi.Message) {
+	msgText := "Subscriptions paused! Use /sub_resume to continue receiving pictures."
+
+	err := h.services.Subscription.Pause(ctx, message.Chat.ID)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			msgText = noSubscriptionText
+		} else {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error pausing subscription")
 		}
+	}
 
-		return
+	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
+	_, err = h.bot.Send(msg)
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 	}
+}
 
-	err = h.services.Subscription.Delete(ctx, sub.ChatId)
+func (h *Handler) ResumeSubscription(ctx context.Context, message *tgbotapi.Message) {
+	msgText := "Subscriptions resumed! Check /sub_info for next delivery time."
+
+	err := h.services.Subscription.Resume(ctx, message.Chat.ID, h.sendImage)
 	if err != nil {
-		msgText := "Can not delete subscription :d"
-		msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
-		_, err = h.bot.Send(msg)
-		if err != nil {
-			log.Printf("Error sending message: %v", err)
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			msgText = noSubscriptionText
+		} else {
+			msgText = h.errorText(ctx, message.Chat.ID, err, "Error resuming subscription")
 		}
-
-		return
 	}
 
-	msgText := "Subscription deleted successfully!"
 	msg := tgbotapi.NewMessage(message.Chat.ID, msgText)
 	_, err = h.bot.Send(msg)
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
 	}
 }
 
-func (h *Handler) createAttachment(file domain.File, chatId int64) (a tgbotapi.Chattable, err error) {
-	var reqFile tgbotapi.RequestFileData
+// Stop deletes all subscriptions of chat and opts it out of broadcasts until /start
+func (h *Handler) Stop(ctx context.Context, message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() && !access.CanManageChat(h.cfg, h.log, h.bot, message) {
+		h.reply(message.Chat.ID, "Only chat administrators can stop the bot!")
 
-	if file.TgID == "" {
-		fullFilePath := path.Join(h.cfg.ImagesDirPath, file.Name)
-		reqFile = tgbotapi.FilePath(fullFilePath)
-	} else {
-		reqFile = tgbotapi.FileID(file.TgID)
+		return
 	}
 
-	switch filepath.Ext(file.Name) {
-	case ".jpg", ".jpeg", ".png":
-		a = tgbotapi.NewPhoto(chatId, reqFile)
-	case ".gif":
-		a = tgbotapi.NewDocument(chatId, reqFile)
-	default:
-		err = fmt.Errorf("unsupported image format: %v", filepath.Ext(file.Name))
+	err := h.services.Subscription.DeleteAll(ctx, message.Chat.ID)
+	var notFoundErr *custom_errors.NotFoundError
+	if err != nil && !errors.As(err, &notFoundErr) {
+		h.replyError(ctx, message.Chat.ID, err, "Error deleting subscriptions")
+
+		return
+	}
+
+	err = h.services.Chat.SetStopped(ctx, message.Chat.ID, true)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error stopping chat")
+
+		return
 	}
 
-	return a, err
+	h.log.Info("Chat stopped", "chat_id", message.Chat.ID)
+	h.reply(message.Chat.ID, "Stopped! Subscriptions are deleted and no more messages will be sent here. "+
+		"Send /start to enable them again, commands keep working meanwhile.")
+}
+
+// resumeStopped opts chat stopped before back in, subscribing is explicit opt in
+func (h *Handler) resumeStopped(ctx context.Context, chatId int64) {
+	settings, err := h.services.Chat.GetSettings(ctx, chatId)
+	if err != nil || !settings.Stopped {
+		return
+	}
+
+	if err = h.services.Chat.SetStopped(ctx, chatId, false); err != nil {
+		h.log.Error("Error resuming stopped chat", "chat_id", chatId, "err", err)
+	}
+}
+
+// deleteSubscriptionByArg deletes subscription by its index from /sub_info or by its period
+func (h *Handler) deleteSubscriptionByArg(ctx context.Context, chatId int64, arg string) error {
+	subs, err := h.services.Subscription.List(ctx, chatId)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return custom_errors.NewNotFound(noSubscriptionText)
+		}
+
+		return err
+	}
+
+	if idx, err := strconv.Atoi(arg); err == nil {
+		if idx < 1 || idx > len(subs) {
+			return custom_errors.NewNotFound(fmt.Sprintf("No subscription #%d found! Check /sub_info.", idx))
+		}
+
+		return h.services.Subscription.Delete(ctx, subs[idx-1].ID)
+	}
+
+	period, err := time_string.ParseDur(arg)
+	if err != nil {
+		return custom_errors.NewNotFound("Please specify subscription number or period, e.g. /unsub 1 or /unsub 1h30m")
+	}
+
+	for _, sub := range subs {
+		if sub.PeriodAsDurationInSeconds() == period.Round(time.Second) {
+			return h.services.Subscription.Delete(ctx, sub.ID)
+		}
+	}
+
+	return custom_errors.NewNotFound(
+		fmt.Sprintf("No subscription with period %s found! Check /sub_info.", time_string.ShortDur(period)),
+	)
 }
 
 func (h *Handler) updateFile(ctx context.Context, file domain.File, res tgbotapi.Message) {
 	var newTgId string
 
-	switch filepath.Ext(file.Name) {
-	case ".jpg", ".jpeg", ".png":
+	switch file.Type {
+	case domain.TypePhoto:
 		if res.Photo == nil || len(res.Photo) == 0 {
-			log.Println("Photo is nil in response!")
+			h.log.Warn("Photo is nil in response!")
 
 			return
 		}
 
 		maxSizedImage := res.Photo[len(res.Photo)-1]
 		newTgId = maxSizedImage.FileID
-	case ".gif":
+	case domain.TypeAnimation:
 		if res.Animation == nil {
-			log.Println("Animation is nil in response!")
+			h.log.Warn("Animation is nil in response!")
 
 			return
 		}
 
 		newTgId = res.Animation.FileID
 	default:
-		log.Printf("Unsupported image format: %v", filepath.Ext(file.Name))
+		h.log.Warn("Unsupported image type", "type", file.Type)
 	}
 
 	if newTgId == "" {
-		log.Println("No new TG ID in response!")
+		h.log.Warn("No new TG ID in response!")
 
 		return
 	}
 
-	updInp := domain.File{Name: file.Name, TgID: newTgId}
+	updInp := file
+	updInp.TgID = newTgId
 
 	err := h.services.Image.UpdateFile(ctx, updInp)
 	if err != nil {
-		log.Printf("Error updating file: %v", err)
+		h.hotLog.Error("Error updating file", "err", err)
+	}
+}
+
+// ResetHistory allows pictures recently sent to chat to be repeated, e.g. after many images were added
+func (h *Handler) ResetHistory(ctx context.Context, message *tgbotapi.Message) {
+	h.services.Image.ResetHistory(message.Chat.ID)
+
+	h.reply(message.Chat.ID, "History cleared, recently sent pictures can show up again")
+}
+
+// postpone saves one delivery to chat at given time, deliveries postponed meanwhile are merged into it.
+// It is stored as scheduled send, so subscription service stops it on shutdown and restores it after restart.
+func (h *Handler) postpone(ctx context.Context, chatId int64, at time.Time) {
+	h.postponedMu.Lock()
+	defer h.postponedMu.Unlock()
+
+	if pending, ok := h.postponed[chatId]; ok && pending.After(time.Now()) {
+		return
+	}
+
+	err := h.services.Subscription.Schedule(ctx, domain.ScheduledSend{
+		ChatID: chatId,
+		SendAt: at.Unix(),
+	}, h.sendImage)
+	if err != nil {
+		// chat full of reminders gets one of them after quiet hours anyway
+		h.hotLog.Warn("Can not postpone picture until quiet hours end", "chat_id", chatId, "err", err)
+
+		return
 	}
+
+	h.postponed[chatId] = at
 }
 
 // sendImage is used as an injected function to subscription service
-func (h *Handler) sendImage(chatId int64, q *queue.Queue) error {
-	ctx := context.Background()
+func (h *Handler) sendImage(chatId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.RequestTimeout)
+	defer cancel()
 
-	var file domain.File
-	var err error
+	// chat may have opted out, so it gets nothing until its settings can be read
+	settings, err := h.services.Chat.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
 
-	for {
-		file, err = h.services.Image.GetRandomFile(ctx)
-		if err != nil {
-			return err
-		}
+	if settings.Stopped {
+		// subscriptions are deleted by /stop, the ones made before it got through anyway are skipped
+		h.log.Warn("Skipping scheduled picture, chat is stopped", "chat_id", chatId)
 
-		// check if file is already in sent queue
-		if !q.Contains(file.Name) {
-			break
+		return nil
+	}
+
+	if now := time.Now(); settings.InQuietHours(now) {
+		if h.cfg.QuietHoursMode == config.QuietHoursQueue {
+			h.postpone(ctx, chatId, settings.QuietEndsAt(now))
 		}
+
+		return nil
+	}
+
+	// per chat history of image service prevents repeats among files allowed in chat
+	file, err := h.services.Image.GetRandomFileForChat(ctx, chatId, h.chatRating(ctx, chatId))
+	if errors.Is(err, image.ErrNoImages) {
+		// not a delivery failure, subscription must survive until images are added
+		h.hotLog.Warn("Skipping scheduled picture, no images available", "chat_id", chatId)
+
+		return nil
 	}
 
-	attachment, err := h.createAttachment(file, chatId)
 	if err != nil {
 		return err
 	}
 
-	res, err := h.bot.Send(attachment)
+	err = h.sendFile(ctx, file, chatId)
 	if err != nil {
+		if isChatUnavailableError(err) {
+			return custom_errors.NewChatUnavailable(err.Error())
+		}
+
 		return err
 	}
 
+	return nil
+}
+
+// sendFile sends file to chat and saves its TG ID on first upload
+func (h *Handler) sendFile(ctx context.Context, file domain.File, chatId int64) error {
+	return h.sendFileWithMarkup(ctx, file, chatId, 0, nil, h.hdMode(ctx, chatId))
+}
+
+// sendReply sends file requested by message, in groups it is threaded under the message if enabled
+func (h *Handler) sendReply(ctx context.Context, file domain.File, message *tgbotapi.Message, markup interface{}) error {
+	return h.sendFileWithMarkup(ctx, file, message.Chat.ID, h.replyToID(message), markup, h.hdMode(ctx, message.Chat.ID))
+}
+
+// hdMode reports whether pictures are sent to chat as documents
+func (h *Handler) hdMode(ctx context.Context, chatId int64) bool {
+	settings, _ := h.services.Chat.GetSettings(ctx, chatId)
+
+	return h.cfg.AllowHDMode && settings.HDMode
+}
+
+// replyToID returns ID of message outgoing pictures should reply to, 0 if they should not
+func (h *Handler) replyToID(message *tgbotapi.Message) int {
+	if !h.cfg.ReplyToTrigger || message.Chat.IsPrivate() {
+		return 0
+	}
+
+	return message.MessageID
+}
+
+// sendFileWithMarkup sends file, photos are sent as documents if hd is set and they have local file,
+// images uploaded via Telegram only have compressed copy which is sent as usual
+func (h *Handler) sendFileWithMarkup(
+	ctx context.Context,
+	file domain.File,
+	chatId int64,
+	replyTo int,
+	markup interface{},
+	hd bool,
+) error {
+	start := time.Now()
+
+	if hd && file.Type == domain.TypePhoto && h.hasLocalFile(file) {
+		h.sendChatAction(chatId, tgbotapi.ChatUploadDocument)
+
+		att := h.decorate(ctx, attachment.NewDocument(h.cfg.ImagesDirPath, file, chatId), file, replyTo, markup)
+
+		// TG ID of document can not be used to send photo, so it is not saved
+		_, err := h.sendWithRetry(att)
+		if err != nil {
+			metrics.SendErrors.Inc()
+
+			return errors.Wrap(err, "can not send document")
+		}
+
+		metrics.ImagesSent.Inc()
+		metrics.ImageFetchDuration.Observe(time.Since(start).Seconds())
+
+		h.markServed(ctx, chatId, file)
+
+		return nil
+	}
+
+	forwarded, err := h.forwardFromSource(ctx, file, chatId)
+	if forwarded || err != nil {
+		return err
+	}
+
+	action := tgbotapi.ChatUploadPhoto
+	if file.IsAnimation() {
+		action = tgbotapi.ChatUploadDocument
+	}
+
+	h.sendChatAction(chatId, action)
+
+	res, err := h.sendAttachment(ctx, file, chatId, replyTo, markup)
+	// images uploaded via Telegram have no local file, their TG ID is the only copy
+	if err != nil && file.TgID != "" && isWrongFileIDError(err) && h.hasLocalFile(file) {
+		h.log.Warn("Cached TG ID rejected, uploading file again", "file", file.Name, "err", err)
+
+		file.TgID = ""
+
+		updErr := h.services.Image.UpdateFile(ctx, file)
+		if updErr != nil {
+			h.log.Error("Error dropping cached TG ID", "file", file.Name, "err", updErr)
+		}
+
+		res, err = h.sendAttachment(ctx, file, chatId, replyTo, markup)
+	}
+
+	if err != nil {
+		metrics.SendErrors.Inc()
+
+		return errors.Wrap(err, "can not send attachment")
+	}
+
+	metrics.ImagesSent.Inc()
+	metrics.ImageFetchDuration.Observe(time.Since(start).Seconds())
+
 	if file.TgID == "" {
 		h.updateFile(ctx, file, res)
 	}
 
-	q.Add(file.Name)
+	h.markServed(ctx, chatId, file)
+
+	return nil
+}
+
+// forwardFromSource forwards post of source channel image was added from, false is returned if there is none.
+// Forwarded pictures have neither caption nor buttons of their own.
+func (h *Handler) forwardFromSource(ctx context.Context, file domain.File, chatId int64) (bool, error) {
+	messageId, ok := h.services.Source.MessageID(file.ID)
+	if !ok {
+		return false, nil
+	}
+
+	start := time.Now()
+
+	_, err := h.sendWithRetry(tgbotapi.NewForward(chatId, h.cfg.SourceChannelID, messageId))
+	if err == nil {
+		metrics.ImagesSent.Inc()
+		metrics.ImageFetchDuration.Observe(time.Since(start).Seconds())
+
+		h.markServed(ctx, chatId, file)
+
+		return true, nil
+	}
+
+	if !isForwardNotFoundError(err) {
+		metrics.SendErrors.Inc()
+
+		return false, errors.Wrap(err, "can not forward source message")
+	}
+
+	// post was deleted from channel, but picture can still be sent by its TG ID
+	h.log.Warn("Source message not found, sending picture instead", "file", file.Name, "message_id", messageId)
+
+	err = h.services.Source.Delete(ctx, file.ID)
+	if err != nil {
+		h.log.Error("Error dropping source message", "file", file.Name, "err", err)
+	}
+
+	return false, nil
+}
+
+func (h *Handler) markServed(ctx context.Context, chatId int64, file domain.File) {
+	err := h.services.Image.MarkServed(ctx, file)
+	if err != nil {
+		h.hotLog.Error("Error marking file served", "file", file.Name, "err", err)
+	}
+
+	err = h.services.History.Add(ctx, chatId, file.ID)
+	if err != nil {
+		h.hotLog.Error("Error saving served file to history", "chat_id", chatId, "file", file.Name, "err", err)
+	}
+}
+
+func (h *Handler) hasLocalFile(file domain.File) bool {
+	_, err := os.Stat(filepath.Join(h.cfg.ImagesDirPath, file.Name))
+
+	return err == nil
+}
+
+func (h *Handler) sendAttachment(
+	ctx context.Context,
+	file domain.File,
+	chatId int64,
+	replyTo int,
+	markup interface{},
+) (tgbotapi.Message, error) {
+	att, err := attachment.New(h.cfg.ImagesDirPath, file, chatId)
+	if err != nil {
+		return tgbotapi.Message{}, errors.Wrap(err, "can not create attachment")
+	}
+
+	return h.sendWithRetry(h.decorate(ctx, att, file, replyTo, markup))
+}
+
+// decorate sets caption, reply markup and reply to attachment
+func (h *Handler) decorate(
+	ctx context.Context,
+	att tgbotapi.Chattable,
+	file domain.File,
+	replyTo int,
+	markup interface{},
+) tgbotapi.Chattable {
+	if caption := h.caption(ctx, file); caption != "" {
+		att = attachment.WithCaption(att, caption)
+	}
+
+	if markup != nil {
+		att = attachment.WithReplyMarkup(att, markup)
+	}
+
+	if replyTo != 0 {
+		att = attachment.WithReplyTo(att, replyTo)
+	}
+
+	return att
+}
+
+// sendAlbum sends photos as single media group and saves TG IDs of uploaded ones
+func (h *Handler) sendAlbum(ctx context.Context, files []domain.File, chatId int64, replyTo int) error {
+	start := time.Now()
+
+	h.sendChatAction(chatId, tgbotapi.ChatUploadPhoto)
+
+	media := make([]interface{}, 0, len(files))
+	for _, file := range files {
+		photo := tgbotapi.NewInputMediaPhoto(attachment.RequestFile(h.cfg.ImagesDirPath, file))
+		photo.Caption = h.caption(ctx, file)
+		media = append(media, photo)
+	}
+
+	group := tgbotapi.NewMediaGroup(chatId, media)
+	group.ReplyToMessageID = replyTo
+
+	res, err := h.bot.SendMediaGroup(group)
+	// media group can not be sent without reply, so it is sent again if triggering message was deleted
+	if err != nil && replyTo != 0 && isReplyNotFoundError(err) {
+		group.ReplyToMessageID = 0
+		res, err = h.bot.SendMediaGroup(group)
+	}
+
+	if err != nil {
+		metrics.SendErrors.Inc()
+
+		return errors.Wrap(err, "can not send media group")
+	}
+
+	metrics.ImagesSent.Add(float64(len(files)))
+	metrics.ImageFetchDuration.Observe(time.Since(start).Seconds())
+
+	for i, file := range files {
+		if file.TgID == "" && i < len(res) {
+			h.updateFile(ctx, file, res[i])
+		}
+
+		h.markServed(ctx, chatId, file)
+	}
 
 	return nil
 }
 
+// sendChatAction shows upload status in chat while picture is being sent,
+// failure is only logged as picture is sent anyway
+func (h *Handler) sendChatAction(chatId int64, action string) {
+	if !h.cfg.ShowUploadAction {
+		return
+	}
+
+	_, err := h.bot.Request(tgbotapi.NewChatAction(chatId, action))
+	if err != nil {
+		h.log.Warn("Error sending chat action", "chat_id", chatId, "action", action, "err", err)
+	}
+}
+
+// caption returns image ID with tags truncated to fit Telegram caption limit, empty if captions are disabled
+func (h *Handler) caption(ctx context.Context, file domain.File) string {
+	if !h.cfg.ShowImageCaptions {
+		return ""
+	}
+
+	caption := fmt.Sprintf("#%d", file.ID)
+
+	tags, err := h.services.Image.GetTags(ctx, file)
+	if err != nil {
+		h.log.Warn("Error getting image tags", "file", file.Name, "err", err)
+	}
+
+	for i, tag := range tags {
+		sep := ", "
+		if i == 0 {
+			sep = " | tags: "
+		}
+
+		// keep room for ellipsis
+		if utf8.RuneCountInString(caption+sep+tag) > maxCaptionLength-1 {
+			caption += "…"
+
+			break
+		}
+
+		caption += sep + tag
+	}
+
+	return caption
+}
+
+func (h *Handler) chatRating(ctx context.Context, chatId int64) string {
+	settings, _ := h.services.Chat.GetSettings(ctx, chatId)
+
+	return settings.Rating
+}
+
+// replyGetError tells user there are no pictures allowed in chat or replies to other error
+func (h *Handler) replyGetError(ctx context.Context, chatId int64, err error) {
+	var notFoundErr *custom_errors.NotFoundError
+	if errors.As(err, &notFoundErr) && !errors.Is(err, image.ErrNoImages) {
+		h.reply(chatId, "No pictures available for this chat rating! Check /set_rating.")
+
+		return
+	}
+
+	h.replyError(ctx, chatId, err, "Error getting file")
+}
+
+// errorText returns reply to err in chat language, unexpected errors are logged with msg and args
+func (h *Handler) errorText(ctx context.Context, chatId int64, err error, msg string, args ...any) string {
+	return errmsg.Reply(h.hotLog, h.cfg, h.language(ctx, chatId), chatId, err, msg, args...)
+}
+
+// replyError sends errorText to chat unless messages can not be delivered there anymore
+func (h *Handler) replyError(ctx context.Context, chatId int64, err error, msg string, args ...any) {
+	text := h.errorText(ctx, chatId, err, msg, args...)
+	if isChatUnavailableError(err) {
+		return
+	}
+
+	h.reply(chatId, text)
+}
+
+func (h *Handler) language(ctx context.Context, chatId int64) string {
+	settings, _ := h.services.Chat.GetSettings(ctx, chatId)
+
+	return settings.Language
+}
+
+func refreshKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Next", RefreshImageCallbackPrefix),
+		),
+	)
+}
+
 func (h *Handler) parseAndValidateSubscriptionInput(message *tgbotapi.Message) (domain.Subscription, error) {
-	rawMsg := strings.ReplaceAll(message.Text, " ", "")
-	rawMsg = strings.ToLower(rawMsg)
+	rawMsg := message.Text
+	if message.IsCommand() {
+		rawMsg = message.CommandArguments()
+	}
+
+	allowed := fmt.Sprintf(
+		"from %s to %s",
+		time_string.ShortDur(h.cfg.MinSubscriptionInterval),
+		time_string.ShortDur(h.cfg.MaxSubscriptionInterval),
+	)
 
-	period, err := time.ParseDuration(rawMsg)
+	period, err := time_string.ParseDur(rawMsg)
 	if err != nil {
-		errText := "Please enter a period in format like 1h30m\n" +
-			fmt.Sprintf(
-				"Hint: minimum: %s, maximun: %s",
-				time_string.ShortDur(h.cfg.MinSubscriptionInterval),
-				time_string.ShortDur(h.cfg.MaxSubscriptionInterval),
-			)
+		errText := "Please enter a period like 90s, 30m, 1h30m or 1d\n" +
+			"Allowed periods are " + allowed
 		err = errors.New(errText)
 
 		return domain.Subscription{}, err
 	}
 
-	if period.Seconds() < h.cfg.MinSubscriptionInterval.Seconds() ||
-		period.Seconds() > h.cfg.MaxSubscriptionInterval.Seconds() {
+	// periods are stored in whole seconds
+	period = period.Round(time.Second)
+
+	if period < h.cfg.MinSubscriptionInterval || period > h.cfg.MaxSubscriptionInterval {
 		errText := fmt.Sprintf(
-			"Subscription period must be between %s and %s!",
-			time_string.ShortDur(h.cfg.MinSubscriptionInterval),
-			time_string.ShortDur(h.cfg.MaxSubscriptionInterval),
+			"Subscription period %s is out of range, allowed periods are %s!", time_string.ShortDur(period), allowed,
 		)
 		err = errors.New(errText)
 
@@ -0,0 +1,911 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/i18n"
+	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository"
+	"apubot/internal/service"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/image"
+	"apubot/internal/service/subscription"
+	"apubot/internal/testutil"
+	"apubot/pkg/custom_errors"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHandler creates handler using real services with empty db and fake Telegram
+func newTestHandler(t *testing.T, modify func(cfg *config.Config)) (*Handler, *testutil.Sender) {
+	t.Helper()
+
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	cfg, err := config.NewConfig("../../../config")
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	cfg.IsDebug = false
+	cfg.ImagesDirPath = t.TempDir()
+	cfg.ShowUploadAction = false
+	cfg.SendRetryBaseDelay = time.Millisecond
+	if modify != nil {
+		modify(cfg)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := database.New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+
+	services := service.New(&service.InitParams{
+		Config:       cfg,
+		Logger:       log,
+		Repositories: repository.New(&repository.InitParams{Config: cfg, DB: db}),
+	})
+
+	bot := &testutil.Sender{MemberStatus: "administrator"}
+	h := New(cfg, log, bot, &Services{
+		Image:        services.Image,
+		Subscription: services.Subscription,
+		Stats:        services.Stats,
+		Favorite:     services.Favorite,
+		Chat:         services.Chat,
+		Source:       services.Source,
+		History:      services.History,
+	})
+
+	t.Cleanup(func() {
+		_ = services.Subscription.Stop(context.Background())
+		_ = db.Close()
+	})
+
+	return h, bot
+}
+
+// addLocalImage saves picture which exists only in images folder and was not uploaded yet
+func addLocalImage(t *testing.T, h *Handler, name string) domain.File {
+	t.Helper()
+
+	err := os.WriteFile(filepath.Join(h.cfg.ImagesDirPath, name), []byte("jpeg"), 0o644)
+	if err != nil {
+		t.Fatalf("can not write image: %v", err)
+	}
+
+	file, err := h.services.Image.AddImage(context.Background(), domain.File{Name: name, Type: domain.TypePhoto}, nil)
+	if err != nil {
+		t.Fatalf("can not add image: %v", err)
+	}
+
+	return file
+}
+
+// command returns command message from user in private chat with the same ID
+func command(userID int64, text string) *tgbotapi.Message {
+	name, _, _ := strings.Cut(text, " ")
+
+	return &tgbotapi.Message{
+		MessageID: 1,
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		From:      &tgbotapi.User{ID: userID},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+// savedFile returns file as it is stored now
+func savedFile(t *testing.T, h *Handler, id int64) domain.File {
+	t.Helper()
+
+	file, err := h.services.Image.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("can not get file %d: %v", id, err)
+	}
+
+	return file
+}
+
+func TestGetImageSendsPhotoWithNextButton(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	file := testutil.AddImage(t, h.services.Image, "01.jpg", "cat")
+
+	h.GetImage(context.Background(), command(1, "/peepo"))
+
+	photos := bot.Photos()
+	if len(photos) != 1 {
+		t.Fatalf("sent %d photos, want 1", len(photos))
+	}
+
+	photo := photos[0]
+	if photo.ChatID != 1 || photo.File != tgbotapi.FileID("tg-01.jpg") {
+		t.Errorf("sent photo %v to chat %d, want tg-01.jpg to chat 1", photo.File, photo.ChatID)
+	}
+
+	if want := fmt.Sprintf("#%d | tags: cat", file.ID); photo.Caption != want {
+		t.Errorf("caption = %q, want %q", photo.Caption, want)
+	}
+
+	keyboard, ok := photo.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if !ok || *keyboard.InlineKeyboard[0][0].CallbackData != RefreshImageCallbackPrefix {
+		t.Errorf("photo markup = %+v, want Next button", photo.ReplyMarkup)
+	}
+
+	if got := bot.Texts(1); len(got) != 0 {
+		t.Errorf("sent messages %q besides photo", got)
+	}
+}
+
+func TestNextButtonReplacesPicture(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.NoRepeatWindow = 3 })
+	for _, name := range []string{"01.jpg", "02.jpg", "03.jpg", "04.jpg"} {
+		testutil.AddImage(t, h.services.Image, name)
+	}
+
+	ctx := context.Background()
+	h.GetImage(ctx, command(1, "/peepo"))
+
+	photos := bot.Photos()
+	if len(photos) != 1 {
+		t.Fatalf("sent %d photos, want 1", len(photos))
+	}
+
+	shown := []tgbotapi.RequestFileData{photos[0].File}
+	query := &tgbotapi.CallbackQuery{
+		ID:      "next",
+		From:    &tgbotapi.User{ID: 1},
+		Message: &tgbotapi.Message{MessageID: 5, Chat: &tgbotapi.Chat{ID: 1}},
+		Data:    RefreshImageCallbackPrefix,
+	}
+
+	for range 6 {
+		bot.Reset()
+		h.RefreshImage(ctx, query)
+
+		var edits []tgbotapi.EditMessageMediaConfig
+		for _, c := range bot.Sent() {
+			if edit, ok := c.(tgbotapi.EditMessageMediaConfig); ok {
+				edits = append(edits, edit)
+			}
+		}
+
+		if len(edits) != 1 {
+			t.Fatalf("Next button made %d edits, want 1", len(edits))
+		}
+
+		edit := edits[0]
+		if edit.ChatID != 1 || edit.MessageID != 5 {
+			t.Errorf("edited message %d in chat %d, want pressed one", edit.MessageID, edit.ChatID)
+		}
+
+		if edit.ReplyMarkup == nil || *edit.ReplyMarkup.InlineKeyboard[0][0].CallbackData != RefreshImageCallbackPrefix {
+			t.Errorf("edited message markup = %+v, want Next button", edit.ReplyMarkup)
+		}
+
+		media, ok := edit.Media.(tgbotapi.InputMediaPhoto)
+		if !ok {
+			t.Fatalf("edited media is %T, want photo", edit.Media)
+		}
+
+		// new picture differs from ones shown within no repeat window
+		for _, prev := range shown[max(0, len(shown)-3):] {
+			if media.Media == prev {
+				t.Fatalf("Next button showed %v again after %q", media.Media, shown)
+			}
+		}
+
+		shown = append(shown, media.Media)
+	}
+}
+
+func TestUploadedFileIDIsSaved(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	file := addLocalImage(t, h, "01.jpg")
+
+	h.GetImage(context.Background(), command(1, "/peepo"))
+
+	photos := bot.Photos()
+	if len(photos) != 1 {
+		t.Fatalf("sent %d photos, want 1", len(photos))
+	}
+
+	if want := tgbotapi.FilePath(filepath.Join(h.cfg.ImagesDirPath, "01.jpg")); photos[0].File != want {
+		t.Errorf("sent %v, want local file", photos[0].File)
+	}
+
+	if got := savedFile(t, h, file.ID).TgID; got != "uploaded-1" {
+		t.Errorf("saved TG ID %q, want ID from response", got)
+	}
+}
+
+func TestRejectedFileIDIsUploadedAgain(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	file := addLocalImage(t, h, "01.jpg")
+
+	err := h.services.Image.UpdateFile(context.Background(), domain.File{ID: file.ID, Name: file.Name, TgID: "stale", Type: file.Type})
+	if err != nil {
+		t.Fatalf("can not set TG ID: %v", err)
+	}
+
+	bot.Errs = []error{&tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file identifier/HTTP URL specified"}}
+
+	h.GetImage(context.Background(), command(1, "/peepo"))
+
+	photos := bot.Photos()
+	if len(photos) != 2 {
+		t.Fatalf("sent %d photos, want cached one and upload", len(photos))
+	}
+
+	if photos[0].File != tgbotapi.FileID("stale") {
+		t.Errorf("first attempt sent %v, want cached TG ID", photos[0].File)
+	}
+
+	if _, ok := photos[1].File.(tgbotapi.FilePath); !ok {
+		t.Errorf("second attempt sent %v, want local file", photos[1].File)
+	}
+
+	if got := savedFile(t, h, file.ID).TgID; got != "uploaded-2" {
+		t.Errorf("saved TG ID %q, want ID of new upload", got)
+	}
+}
+
+func TestInlineQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "no query", query: "", want: []string{"tg-cat.jpg", "tg-dog.jpg"}},
+		{name: "tag", query: "cat", want: []string{"tg-cat.jpg"}},
+		{name: "excluded tag", query: "-cat", want: []string{"tg-dog.jpg"}},
+		{name: "unknown tag", query: "bird"},
+		{name: "invalid tag", query: "c@t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, nil)
+			ctx := context.Background()
+
+			testutil.AddImage(t, h.services.Image, "cat.jpg", "cat")
+			testutil.AddImage(t, h.services.Image, "dog.jpg", "dog")
+
+			// only sfw photos uploaded to Telegram can be inline results
+			addLocalImage(t, h, "local.jpg")
+			for _, file := range []domain.File{
+				{Name: "cat.gif", TgID: "tg-cat.gif", Type: domain.TypeAnimation},
+				{Name: "nsfw.jpg", TgID: "tg-nsfw.jpg", Type: domain.TypePhoto, Rating: domain.RatingNSFW},
+			} {
+				if _, err := h.services.Image.AddImage(ctx, file, []string{"cat", "dog"}); err != nil {
+					t.Fatalf("can not add image: %v", err)
+				}
+			}
+
+			h.InlineQuery(ctx, &tgbotapi.InlineQuery{ID: "query", From: &tgbotapi.User{ID: 1}, Query: tt.query})
+
+			sent := bot.Sent()
+			if len(sent) != 1 {
+				t.Fatalf("sent %d requests, want inline answer", len(sent))
+			}
+
+			inline, ok := sent[0].(tgbotapi.InlineConfig)
+			if !ok || inline.InlineQueryID != "query" || !inline.IsPersonal {
+				t.Fatalf("sent %+v, want personal answer to query", sent[0])
+			}
+
+			var got []string
+			for _, r := range inline.Results {
+				got = append(got, r.(tgbotapi.InlineQueryResultCachedPhoto).PhotoID)
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("inline results %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageIsSentByType(t *testing.T) {
+	tests := []struct {
+		name string
+		file domain.File
+		// local files are written to images folder and uploaded
+		local     bool
+		animation bool
+	}{
+		{name: "photo", file: domain.File{Name: "cat.jpg", TgID: "tg-cat", Type: domain.TypePhoto}},
+		{name: "animation", file: domain.File{Name: "cat.gif", TgID: "tg-cat", Type: domain.TypeAnimation}, animation: true},
+		{name: "local animation", file: domain.File{Name: "cat.gif", Type: domain.TypeAnimation}, local: true, animation: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, nil)
+
+			if tt.local {
+				if err := os.WriteFile(filepath.Join(h.cfg.ImagesDirPath, tt.file.Name), []byte("gif"), 0o644); err != nil {
+					t.Fatalf("can not write image: %v", err)
+				}
+			}
+
+			file, err := h.services.Image.AddImage(context.Background(), tt.file, nil)
+			if err != nil {
+				t.Fatalf("can not add image: %v", err)
+			}
+
+			h.GetImageByID(context.Background(), command(1, fmt.Sprintf("/peepo #%d", file.ID)))
+
+			var photos, animations int
+			for _, c := range bot.Sent() {
+				switch c.(type) {
+				case tgbotapi.PhotoConfig:
+					photos++
+				case tgbotapi.AnimationConfig:
+					animations++
+				}
+			}
+
+			if tt.animation != (animations == 1) || photos+animations != 1 {
+				t.Errorf("sent %d photos and %d animations, want animation %t", photos, animations, tt.animation)
+			}
+
+			if tt.local && savedFile(t, h, file.ID).TgID == "" {
+				t.Error("TG ID of uploaded animation is not saved")
+			}
+		})
+	}
+}
+
+func TestHDModeSendsDocument(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowHD      bool
+		hdMode       bool
+		uploadedOnly bool
+		wantDocument bool
+	}{
+		{name: "hd mode on", allowHD: true, hdMode: true, wantDocument: true},
+		{name: "hd mode off", allowHD: true},
+		{name: "hd mode disabled by config", hdMode: true},
+		// only compressed copy exists in Telegram
+		{name: "image without local file", allowHD: true, hdMode: true, uploadedOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.AllowHDMode = tt.allowHD })
+			ctx := context.Background()
+
+			var file domain.File
+			if tt.uploadedOnly {
+				file = testutil.AddImage(t, h.services.Image, "01.jpg")
+			} else {
+				file = addLocalImage(t, h, "01.jpg")
+			}
+
+			if err := h.services.Chat.SetHDMode(ctx, 1, tt.hdMode); err != nil {
+				t.Fatalf("can not set hd mode: %v", err)
+			}
+
+			h.GetImage(ctx, command(1, "/peepo"))
+
+			var documents []tgbotapi.DocumentConfig
+			for _, c := range bot.Sent() {
+				if document, ok := c.(tgbotapi.DocumentConfig); ok {
+					documents = append(documents, document)
+				}
+			}
+
+			if !tt.wantDocument {
+				if len(documents) != 0 || len(bot.Photos()) != 1 {
+					t.Errorf("sent %d documents and %d photos, want one photo", len(documents), len(bot.Photos()))
+				}
+
+				return
+			}
+
+			if len(documents) != 1 || len(bot.Photos()) != 0 {
+				t.Fatalf("sent %d documents and %d photos, want one document", len(documents), len(bot.Photos()))
+			}
+
+			want := tgbotapi.FilePath(filepath.Join(h.cfg.ImagesDirPath, "01.jpg"))
+			if documents[0].File != want || documents[0].ChatID != 1 {
+				t.Errorf("sent document %v to chat %d, want local file to chat 1", documents[0].File, documents[0].ChatID)
+			}
+
+			// TG ID of document can not be used to send photo
+			if saved := savedFile(t, h, file.ID); saved.TgID != "" {
+				t.Errorf("saved TG ID %q of document", saved.TgID)
+			}
+		})
+	}
+}
+
+func TestImageIsForwardedFromSource(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []error
+		// forwarded is true when picture is delivered by forward, otherwise it is sent as photo
+		forwarded bool
+	}{
+		{
+			name:      "post exists",
+			forwarded: true,
+		},
+		{
+			name: "post deleted",
+			errs: []error{&tgbotapi.Error{Code: 400, Message: "Bad Request: message to forward not found"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, func(cfg *config.Config) {
+				cfg.SourceChannelID = -100
+			})
+			file := testutil.AddImage(t, h.services.Image, "01.jpg")
+
+			err := h.services.Source.Save(context.Background(), domain.SourceMessage{ImageID: file.ID, ChannelID: -100, MessageID: 42})
+			if err != nil {
+				t.Fatalf("can not save source message: %v", err)
+			}
+
+			bot.Errs = tt.errs
+
+			h.GetImage(context.Background(), command(1, "/peepo"))
+
+			sent := bot.Sent()
+
+			forward, ok := sent[0].(tgbotapi.ForwardConfig)
+			if !ok || forward.ChatID != 1 || forward.FromChatID != -100 || forward.MessageID != 42 {
+				t.Fatalf("first request is %+v, want forward of post 42 to chat 1", sent[0])
+			}
+
+			if photos := bot.Photos(); tt.forwarded != (len(photos) == 0) {
+				t.Errorf("sent %d photos besides forward, want forwarded %t", len(photos), tt.forwarded)
+			}
+
+			if _, ok := h.services.Source.MessageID(file.ID); ok != tt.forwarded {
+				t.Errorf("source message kept %t, want %t", ok, tt.forwarded)
+			}
+
+			if got := savedFile(t, h, file.ID).ServeCount; got != 1 {
+				t.Errorf("serve count %d, want picture served once", got)
+			}
+		})
+	}
+}
+
+func TestGetImageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		images bool
+		errs   []error
+		want   []string
+	}{
+		{
+			name: "no images",
+			want: []string{i18n.T(domain.DefaultChatLanguage, i18n.KeyNoImages)},
+		},
+		{
+			name:   "send failed",
+			images: true,
+			errs:   []error{&tgbotapi.Error{Code: 400, Message: "Bad Request: something is wrong"}},
+			want:   []string{i18n.T(domain.DefaultChatLanguage, i18n.KeyUnknownError)},
+		},
+		{
+			name:   "bot blocked",
+			images: true,
+			errs:   []error{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}},
+			// nobody would read the reply
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, nil)
+			if tt.images {
+				testutil.AddImage(t, h.services.Image, "01.jpg")
+			}
+
+			bot.Errs = tt.errs
+
+			h.GetImage(context.Background(), command(1, "/peepo"))
+
+			got := bot.Texts(1)
+			if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingImages fails picking of pictures like broken db does
+type failingImages struct {
+	image.ImageService
+}
+
+var errDB = errors.New("database is locked")
+
+func (failingImages) GetRandomFileForChat(context.Context, int64, string) (domain.File, error) {
+	return domain.File{}, errDB
+}
+
+func (failingImages) GetRandomAnimationForChat(context.Context, int64, string) (domain.File, error) {
+	return domain.File{}, errDB
+}
+
+func (failingImages) GetRandomFileByTags(context.Context, int64, string, domain.TagFilter) (domain.File, error) {
+	return domain.File{}, errDB
+}
+
+func TestPickErrors(t *testing.T) {
+	noImages := i18n.T(domain.DefaultChatLanguage, i18n.KeyNoImages)
+	unknown := i18n.T(domain.DefaultChatLanguage, i18n.KeyUnknownError)
+
+	tests := []struct {
+		name    string
+		failing bool
+		get     func(h *Handler) func(context.Context, *tgbotapi.Message)
+		text    string
+		want    string
+	}{
+		{
+			name: "empty pool animation",
+			get:  func(h *Handler) func(context.Context, *tgbotapi.Message) { return h.GetAnimation },
+			text: "/peepo_gif",
+			want: noImages,
+		},
+		{
+			name: "empty pool tags",
+			get:  func(h *Handler) func(context.Context, *tgbotapi.Message) { return h.GetImageByTag },
+			text: "/tag cat",
+			want: noImages,
+		},
+		{
+			name:    "db error picture",
+			failing: true,
+			get:     func(h *Handler) func(context.Context, *tgbotapi.Message) { return h.GetImage },
+			text:    "/peepo",
+			want:    unknown,
+		},
+		{
+			name:    "db error animation",
+			failing: true,
+			get:     func(h *Handler) func(context.Context, *tgbotapi.Message) { return h.GetAnimation },
+			text:    "/peepo_gif",
+			want:    unknown,
+		},
+		{
+			name:    "db error tags",
+			failing: true,
+			get:     func(h *Handler) func(context.Context, *tgbotapi.Message) { return h.GetImageByTag },
+			text:    "/tag cat",
+			want:    unknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, bot := newTestHandler(t, nil)
+			if tt.failing {
+				h.services.Image = failingImages{ImageService: h.services.Image}
+			}
+
+			tt.get(h)(context.Background(), command(1, tt.text))
+
+			if got := bot.Texts(1); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+
+			if len(bot.Photos()) != 0 {
+				t.Errorf("sent %d photos, want none", len(bot.Photos()))
+			}
+		})
+	}
+}
+
+func TestScheduledDeliveryErrors(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+
+	// subscription waits for images to be added
+	if err := h.sendImage(1); err != nil {
+		t.Fatalf("delivery without images failed: %v", err)
+	}
+
+	testutil.AddImage(t, h.services.Image, "01.jpg")
+
+	if err := h.sendImage(1); err != nil || len(bot.Photos()) != 1 {
+		t.Fatalf("delivery sent %d photos, err %v, want 1 photo", len(bot.Photos()), err)
+	}
+
+	bot.Errs = []error{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the group chat"}}
+
+	var unavailableErr *custom_errors.ChatUnavailableError
+	if err := h.sendImage(1); !errors.As(err, &unavailableErr) {
+		t.Errorf("delivery to kicked bot returned %v, want chat unavailable error", err)
+	}
+
+	// unlike empty pool broken db is reported to subscription
+	h.services.Image = failingImages{ImageService: h.services.Image}
+	if err := h.sendImage(1); !errors.Is(err, errDB) {
+		t.Errorf("delivery with broken db returned %v, want db error", err)
+	}
+}
+
+func TestStoppedChatGetsNoScheduledPictures(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	ctx := context.Background()
+	testutil.AddImage(t, h.services.Image, "01.jpg")
+
+	noop := func(int64) error { return nil }
+	for _, chatId := range []int64{1, 2} {
+		if _, err := h.services.Subscription.Create(ctx, domain.Subscription{ChatId: chatId, Period: 3600}, noop); err != nil {
+			t.Fatalf("can not subscribe chat %d: %v", chatId, err)
+		}
+	}
+
+	h.Stop(ctx, command(1, "/stop"))
+
+	var notFoundErr *custom_errors.NotFoundError
+	if subs, err := h.services.Subscription.List(ctx, 1); !errors.As(err, &notFoundErr) {
+		t.Errorf("stopped chat has subscriptions %+v, %v, want none", subs, err)
+	}
+
+	if subs, err := h.services.Subscription.List(ctx, 2); err != nil || len(subs) != 1 {
+		t.Errorf("other chat has subscriptions %+v, %v, want its own one", subs, err)
+	}
+
+	bot.Reset()
+
+	// delivery scheduled before /stop is skipped without failing subscription
+	for _, chatId := range []int64{1, 2} {
+		if err := h.sendImage(chatId); err != nil {
+			t.Fatalf("delivery to chat %d failed: %v", chatId, err)
+		}
+	}
+
+	photos := bot.Photos()
+	if len(photos) != 1 || photos[0].ChatID != 2 {
+		t.Fatalf("sent %d photos, want one to not stopped chat", len(photos))
+	}
+
+	if got := bot.Texts(1); len(got) != 0 {
+		t.Errorf("stopped chat got %q", got)
+	}
+
+	// subscribing again opts chat back in
+	if err := h.CreateSubscription(ctx, command(1, "/sub 1h")); err != nil {
+		t.Fatalf("can not subscribe after stop: %v", err)
+	}
+
+	if settings, err := h.services.Chat.GetSettings(ctx, 1); err != nil || settings.Stopped {
+		t.Errorf("chat settings %+v, %v after /sub, want not stopped", settings, err)
+	}
+}
+
+func TestScheduledDeliverySkipsChatWithUnreadableSettings(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	testutil.AddImage(t, h.services.Image, "01.jpg")
+
+	repo := &testutil.ChatRepository{
+		Settings:   map[int64]domain.ChatSettings{1: {ChatID: 1, Stopped: true}},
+		Unreadable: map[int64]bool{1: true},
+	}
+	h.services.Chat = chat.New(h.cfg, h.log, repo)
+
+	if err := h.sendImage(1); err == nil {
+		t.Error("delivery succeeded, want settings read error")
+	}
+
+	if photos := bot.Photos(); len(photos) != 0 {
+		t.Errorf("sent %d photos to chat with unreadable settings, want none", len(photos))
+	}
+}
+
+// recordingSubscriptions remembers scheduled sends instead of saving them
+type recordingSubscriptions struct {
+	subscription.SubscriptionService
+	scheduled []domain.ScheduledSend
+}
+
+func (r *recordingSubscriptions) Schedule(_ context.Context, send domain.ScheduledSend, _ func(chatId int64) error) error {
+	r.scheduled = append(r.scheduled, send)
+
+	return nil
+}
+
+// setQuietNow sets chat quiet hours covering current time
+func setQuietNow(t *testing.T, h *Handler, chatId int64) domain.ChatSettings {
+	t.Helper()
+
+	now := time.Now().UTC()
+	minute := now.Hour()*60 + now.Minute()
+	start, end := (minute+24*60-60)%(24*60), (minute+60)%(24*60)
+
+	err := h.services.Chat.SetQuietHours(context.Background(), chatId, start, end)
+	if err != nil {
+		t.Fatalf("can not set quiet hours: %v", err)
+	}
+
+	settings, err := h.services.Chat.GetSettings(context.Background(), chatId)
+	if err != nil {
+		t.Fatalf("can not get settings: %v", err)
+	}
+
+	return settings
+}
+
+func TestScheduledDeliveryInQuietHours(t *testing.T) {
+	for _, mode := range []string{config.QuietHoursSkip, config.QuietHoursQueue} {
+		t.Run(mode, func(t *testing.T) {
+			h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.QuietHoursMode = mode })
+			testutil.AddImage(t, h.services.Image, "01.jpg")
+
+			subs := &recordingSubscriptions{SubscriptionService: h.services.Subscription}
+			h.services.Subscription = subs
+
+			settings := setQuietNow(t, h, 1)
+
+			// deliveries during the same quiet hours are merged
+			for i := 0; i < 3; i++ {
+				if err := h.sendImage(1); err != nil {
+					t.Fatalf("delivery in quiet hours failed: %v", err)
+				}
+			}
+
+			if photos := bot.Photos(); len(photos) != 0 {
+				t.Errorf("sent %d photos during quiet hours", len(photos))
+			}
+
+			if mode == config.QuietHoursSkip {
+				if len(subs.scheduled) != 0 {
+					t.Errorf("skipped delivery scheduled %v", subs.scheduled)
+				}
+
+				return
+			}
+
+			want := settings.QuietEndsAt(time.Now()).Unix()
+			if len(subs.scheduled) != 1 || subs.scheduled[0].ChatID != 1 || subs.scheduled[0].SendAt != want {
+				t.Errorf("scheduled %+v, want one send to chat 1 at %d", subs.scheduled, want)
+			}
+		})
+	}
+}
+
+func TestManualRequestsWorkInQuietHours(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	testutil.AddImage(t, h.services.Image, "01.jpg")
+	setQuietNow(t, h, 1)
+
+	h.GetImage(context.Background(), command(1, "/peepo"))
+
+	if photos := bot.Photos(); len(photos) != 1 {
+		t.Errorf("/peepo sent %d photos during quiet hours, want 1", len(photos))
+	}
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.MaxSubsPerChat = 2 })
+	ctx := context.Background()
+
+	for _, period := range []string{"1h", "2h"} {
+		if err := h.CreateSubscription(ctx, command(1, "/sub "+period)); err != nil {
+			t.Fatalf("can not subscribe for %s: %v", period, err)
+		}
+	}
+
+	bot.Reset()
+
+	err := h.CreateSubscription(ctx, command(1, "/sub 3h"))
+	if !errors.Is(err, subscription.ErrLimitReached) {
+		t.Fatalf("third subscription returned %v, want limit error", err)
+	}
+
+	want := "Subscription limit reached: chat can have up to 2 active subscriptions, remove one with /unsub"
+	if got := bot.Texts(1); len(got) != 1 || got[0] != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	// other chats have their own limit
+	if err = h.CreateSubscription(ctx, command(2, "/sub 3h")); err != nil {
+		t.Errorf("other chat can not subscribe: %v", err)
+	}
+
+	// only active subscriptions count
+	h.PauseSubscription(ctx, command(1, "/sub_pause"))
+
+	if err = h.CreateSubscription(ctx, command(1, "/sub 3h")); err != nil {
+		t.Errorf("can not subscribe after pausing others: %v", err)
+	}
+}
+
+func TestSubscriptionConfirmation(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+
+	before := time.Now().Truncate(time.Second)
+	if err := h.CreateSubscription(context.Background(), command(1, "/sub 1h30m")); err != nil {
+		t.Fatalf("can not subscribe: %v", err)
+	}
+	after := time.Now()
+
+	got := bot.Texts(1)
+	if len(got) != 1 {
+		t.Fatalf("sent %q, want confirmation", got)
+	}
+
+	prefix, suffix := "Subscription created! First peepo arrives at ", ", then every 1h30m"
+	if !strings.HasPrefix(got[0], prefix) || !strings.HasSuffix(got[0], suffix) {
+		t.Fatalf("confirmation is %q, want first delivery time and period", got[0])
+	}
+
+	stamp := strings.TrimSuffix(strings.TrimPrefix(got[0], prefix), suffix)
+	firstRun, err := time.ParseInLocation(time.DateTime, stamp, time.Local)
+	if err != nil {
+		t.Fatalf("can not parse first delivery time %q: %v", stamp, err)
+	}
+
+	// first picture is sent within seconds, not after whole period
+	latest := after.Add(5 * time.Second)
+	if firstRun.Before(before) || firstRun.After(latest) {
+		t.Errorf("first delivery at %s, want between %s and %s", firstRun, before, latest)
+	}
+}
+
+func TestSubscriptionPeriodValidation(t *testing.T) {
+	h := &Handler{cfg: &config.Config{MinSubscriptionInterval: 10 * time.Minute, MaxSubscriptionInterval: 24 * time.Hour}}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    time.Duration
+		wantErr string
+	}{
+		{name: "minutes", text: "/sub 30m", want: 30 * time.Minute},
+		{name: "hours and minutes", text: "/sub 1h30m", want: 90 * time.Minute},
+		{name: "day", text: "/sub 1d", want: 24 * time.Hour},
+		{name: "lowest allowed", text: "/sub 600s", want: 10 * time.Minute},
+		{name: "below min", text: "/sub 1s", wantErr: "Subscription period 1s is out of range, allowed periods are from 10m to 24h!"},
+		{name: "above max", text: "/sub 2d", wantErr: "Subscription period 48h is out of range, allowed periods are from 10m to 24h!"},
+		{name: "malformed", text: "/sub often", wantErr: "Please enter a period like 90s, 30m, 1h30m or 1d\nAllowed periods are from 10m to 24h"},
+		{name: "missing", text: "/sub", wantErr: "Please enter a period like 90s, 30m, 1h30m or 1d\nAllowed periods are from 10m to 24h"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := h.parseAndValidateSubscriptionInput(command(1, tt.text))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if sub.ChatId != 1 || sub.PeriodAsDurationInSeconds() != tt.want {
+				t.Errorf("got subscription %+v, want period %s in chat 1", sub, tt.want)
+			}
+		})
+	}
+}
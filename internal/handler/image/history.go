@@ -0,0 +1,99 @@
+package image
+
+import (
+	"apubot/pkg/custom_errors"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryCallbackPrefix is followed by ID of image to send again, e.g. history:42
+const HistoryCallbackPrefix = "history:"
+
+// historyButtonsPerRow keeps buttons of long history readable on phones
+const historyButtonsPerRow = 5
+
+// History lists images last sent to chat with buttons sending them again
+func (h *Handler) History(ctx context.Context, message *tgbotapi.Message) {
+	if h.cfg.HistorySize == 0 {
+		h.reply(message.Chat.ID, "History is disabled")
+
+		return
+	}
+
+	served, err := h.services.History.Recent(ctx, message.Chat.ID)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.reply(message.Chat.ID, "No pictures were sent here yet!")
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error getting history")
+
+		return
+	}
+
+	lines := make([]string, 0, len(served)+1)
+	lines = append(lines, "Last pictures sent here, newest first:")
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, s := range served {
+		lines = append(lines, fmt.Sprintf("%d. #%d, %s", i+1, s.ImageID, s.ServedAtAsUnixTime().Format(time.DateTime)))
+
+		if i%historyButtonsPerRow == 0 {
+			rows = append(rows, nil)
+		}
+
+		button := tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("#%d", s.ImageID), HistoryCallbackPrefix+strconv.FormatInt(s.ImageID, 10),
+		)
+		rows[len(rows)-1] = append(rows[len(rows)-1], button)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	_, err = h.bot.Send(msg)
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+}
+
+// HistoryImage sends image from History button to chat again
+func (h *Handler) HistoryImage(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(query.Data, HistoryCallbackPrefix), 10, 64)
+	if err != nil || query.Message == nil {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	chatId := query.Message.Chat.ID
+
+	file, err := h.services.Image.GetByID(ctx, id)
+	if err != nil || !file.AllowedFor(h.chatRating(ctx, chatId)) {
+		h.answer(query.ID, fmt.Sprintf("Picture #%d is no longer available", id))
+
+		return
+	}
+
+	err = h.sendFileWithMarkup(ctx, file, chatId, 0, nil, h.hdMode(ctx, chatId))
+	if err != nil {
+		h.answer(query.ID, h.errorText(ctx, chatId, err, "Error sending file"))
+
+		return
+	}
+
+	h.answer(query.ID, "")
+
+	if query.From != nil {
+		h.services.Stats.IncrementImages(ctx, query.From.ID)
+		h.services.Favorite.SetLastServed(query.From.ID, file)
+	}
+}
@@ -0,0 +1,93 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/testutil"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"testing"
+)
+
+func TestHistoryListsServedImagesNewestFirst(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.HistorySize = 10 })
+	ctx := context.Background()
+
+	var files []domain.File
+	for i := 0; i < 3; i++ {
+		files = append(files, testutil.AddImage(t, h.services.Image, fmt.Sprintf("%02d.jpg", i)))
+	}
+
+	for _, file := range files {
+		if err := h.sendFile(ctx, file, 1); err != nil {
+			t.Fatalf("can not send file: %v", err)
+		}
+	}
+
+	bot.Reset()
+	h.History(ctx, command(1, "/history"))
+
+	sent := bot.Sent()
+
+	msg, ok := sent[0].(tgbotapi.MessageConfig)
+	if !ok {
+		t.Fatalf("/history sent %T, want message", sent[0])
+	}
+
+	lines := strings.Split(msg.Text, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("/history sent %q, want header and 3 pictures", msg.Text)
+	}
+
+	markup := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	for i, line := range lines[1:] {
+		want := files[len(files)-1-i]
+
+		if !strings.HasPrefix(line, fmt.Sprintf("%d. #%d, ", i+1, want.ID)) {
+			t.Errorf("line %d = %q, want picture #%d", i+1, line, want.ID)
+		}
+
+		if data := *markup.InlineKeyboard[0][i].CallbackData; data != fmt.Sprintf("%s%d", HistoryCallbackPrefix, want.ID) {
+			t.Errorf("button %d data = %q, want picture #%d", i+1, data, want.ID)
+		}
+	}
+}
+
+func TestHistoryImageSendsPictureAgain(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.HistorySize = 10 })
+	file := testutil.AddImage(t, h.services.Image, "01.jpg")
+
+	query := &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: 1},
+		Message: &tgbotapi.Message{MessageID: 3, Chat: &tgbotapi.Chat{ID: 1, Type: "private"}},
+		Data:    fmt.Sprintf("%s%d", HistoryCallbackPrefix, file.ID),
+	}
+
+	h.HistoryImage(context.Background(), query)
+
+	if photos := bot.Photos(); len(photos) != 1 || photos[0].File != tgbotapi.FileID("tg-01.jpg") {
+		t.Fatalf("history button sent %v, want tg-01.jpg", photos)
+	}
+
+	bot.Reset()
+	query.Data = HistoryCallbackPrefix + "999"
+
+	h.HistoryImage(context.Background(), query)
+
+	if got := answers(bot); len(got) != 1 || got[0] != "Picture #999 is no longer available" {
+		t.Errorf("button of removed picture answered %q", got)
+	}
+}
+
+func TestHistoryIsEmpty(t *testing.T) {
+	h, bot := newTestHandler(t, func(cfg *config.Config) { cfg.HistorySize = 10 })
+
+	h.History(context.Background(), command(1, "/history"))
+
+	if got := bot.Texts(1); len(got) != 1 || got[0] != "No pictures were sent here yet!" {
+		t.Errorf("/history sent %q, want empty history reply", got)
+	}
+}
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/service/subscription"
+	"apubot/pkg/utils/time_string"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+// Remind schedules single random picture to be sent after delay, e.g. /remind 2h
+func (h *Handler) Remind(ctx context.Context, message *tgbotapi.Message) {
+	allowed := fmt.Sprintf(
+		"from %s to %s", time_string.ShortDur(h.cfg.MinRemindDelay), time_string.ShortDur(h.cfg.MaxRemindDelay),
+	)
+
+	delay, err := time_string.ParseDur(strings.TrimSpace(message.CommandArguments()))
+	if err != nil {
+		h.reply(message.Chat.ID, "Please enter a delay like 30m, 2h or 1d, e.g. /remind 2h\nAllowed delays are "+allowed)
+
+		return
+	}
+
+	// send time is stored in whole seconds
+	delay = delay.Round(time.Second)
+
+	if delay < h.cfg.MinRemindDelay || delay > h.cfg.MaxRemindDelay {
+		h.reply(message.Chat.ID, fmt.Sprintf(
+			"Delay %s is out of range, allowed delays are %s!", time_string.ShortDur(delay), allowed,
+		))
+
+		return
+	}
+
+	sendAt := time.Now().Add(delay)
+
+	err = h.services.Subscription.Schedule(ctx, domain.ScheduledSend{
+		ChatID: message.Chat.ID,
+		SendAt: sendAt.Unix(),
+	}, h.sendImage)
+	if err != nil {
+		if errors.Is(err, subscription.ErrTooManyScheduled) {
+			h.reply(message.Chat.ID, fmt.Sprintf(
+				"Chat already has %d pictures scheduled, please wait until some of them arrive",
+				subscription.MaxScheduledPerChat,
+			))
+
+			return
+		}
+
+		h.replyError(ctx, message.Chat.ID, err, "Error scheduling picture")
+
+		return
+	}
+
+	// asking for a picture is explicit opt in, same as subscribing
+	if settings, err := h.services.Chat.GetSettings(ctx, message.Chat.ID); err == nil && settings.Stopped {
+		if err = h.services.Chat.SetStopped(ctx, message.Chat.ID, false); err != nil {
+			h.log.Error("Error resuming stopped chat", "chat_id", message.Chat.ID, "err", err)
+		}
+	}
+
+	h.reply(message.Chat.ID, fmt.Sprintf("Got it! Peepo arrives at %s", sendAt.Format(time.DateTime)))
+}
@@ -0,0 +1,108 @@
+package image
+
+import (
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sendWithRetry sends chattable retrying transient errors with exponential backoff
+func (h *Handler) sendWithRetry(c tgbotapi.Chattable) (res tgbotapi.Message, err error) {
+	delay := h.cfg.SendRetryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		res, err = h.bot.Send(c)
+		if err == nil {
+			return res, nil
+		}
+
+		if isPermanentSendError(err) {
+			h.hotLog.Error("Permanent error sending message, not retrying", "err", err)
+
+			return res, err
+		}
+
+		if attempt >= h.cfg.SendMaxRetries {
+			return res, err
+		}
+
+		wait := delay
+		if retryAfter := retryAfterDelay(err); retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		h.hotLog.Warn(
+			"Transient error sending message, retrying",
+			"attempt", attempt+1, "max_retries", h.cfg.SendMaxRetries, "wait", wait, "err", err,
+		)
+
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// isPermanentSendError reports whether retrying the request can not help,
+// e.g. bot was blocked by user or chat was not found
+func isPermanentSendError(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false // network errors are worth retrying
+	}
+
+	if tgErr.Code == http.StatusTooManyRequests || tgErr.Code >= http.StatusInternalServerError {
+		return false
+	}
+
+	return true
+}
+
+// isChatUnavailableError reports whether Telegram refused delivery because
+// bot was blocked, kicked or chat does not exist anymore
+func isChatUnavailableError(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
+	}
+
+	return tgErr.Code == http.StatusForbidden ||
+		tgErr.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(tgErr.Message), "chat not found")
+}
+
+// isReplyNotFoundError reports whether message to reply was deleted
+func isReplyNotFoundError(err error) bool {
+	var tgErr *tgbotapi.Error
+
+	return errors.As(err, &tgErr) &&
+		tgErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(tgErr.Message), "reply not found")
+}
+
+// isWrongFileIDError reports whether Telegram rejected cached file ID
+func isWrongFileIDError(err error) bool {
+	var tgErr *tgbotapi.Error
+
+	return errors.As(err, &tgErr) &&
+		tgErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(tgErr.Message), "file identifier")
+}
+
+// isForwardNotFoundError reports whether forwarded message was deleted
+func isForwardNotFoundError(err error) bool {
+	var tgErr *tgbotapi.Error
+
+	return errors.As(err, &tgErr) &&
+		tgErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(tgErr.Message), "message to forward not found")
+}
+
+// retryAfterDelay returns delay requested by Telegram flood control
+func retryAfterDelay(err error) time.Duration {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second
+	}
+
+	return 0
+}
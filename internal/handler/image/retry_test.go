@@ -0,0 +1,123 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/testutil"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func newRetryHandler(bot *testutil.Sender) *Handler {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return &Handler{
+		cfg:    &config.Config{SendMaxRetries: 3, SendRetryBaseDelay: time.Millisecond},
+		log:    log,
+		bot:    bot,
+		hotLog: log,
+	}
+}
+
+func TestSendWithRetry(t *testing.T) {
+	var (
+		serverErr  = &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}
+		networkErr = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		blockedErr = &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+	)
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantSends int
+		wantErr   error
+	}{
+		{name: "success", wantSends: 1},
+		{name: "transient errors then success", errs: []error{serverErr, networkErr}, wantSends: 3},
+		{name: "retries exhausted", errs: []error{serverErr, serverErr, serverErr, serverErr, nil}, wantSends: 4, wantErr: serverErr},
+		{name: "permanent error is not retried", errs: []error{blockedErr, nil}, wantSends: 1, wantErr: blockedErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &testutil.Sender{Errs: tt.errs}
+			h := newRetryHandler(bot)
+
+			_, err := h.sendWithRetry(tgbotapi.NewMessage(1, "hi"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("sendWithRetry() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := len(bot.Texts(1)); got != tt.wantSends {
+				t.Errorf("sent %d times, want %d", got, tt.wantSends)
+			}
+		})
+	}
+}
+
+func TestSendWithRetryBacksOff(t *testing.T) {
+	serverErr := &tgbotapi.Error{Code: 500, Message: "Internal Server Error"}
+
+	bot := &testutil.Sender{Errs: []error{serverErr, serverErr, serverErr}}
+	h := newRetryHandler(bot)
+	h.cfg.SendRetryBaseDelay = 10 * time.Millisecond
+
+	start := time.Now()
+
+	_, err := h.sendWithRetry(tgbotapi.NewMessage(1, "hi"))
+	if err != nil {
+		t.Fatalf("sendWithRetry() error = %v", err)
+	}
+
+	// 10ms, 20ms and 40ms delays
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("3 retries took %s, want at least 70ms", elapsed)
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"flood control", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5}}, 5 * time.Second},
+		{"wrapped flood control", errors.Wrap(&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 2}}, "can not send"), 2 * time.Second},
+		{"telegram error without delay", &tgbotapi.Error{Code: 500}, 0},
+		{"network error", errors.New("connection reset by peer"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfterDelay(tt.err); got != tt.want {
+				t.Errorf("retryAfterDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanentSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"blocked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, true},
+		{"chat not found", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, true},
+		{"flood control", &tgbotapi.Error{Code: 429, Message: "Too Many Requests"}, false},
+		{"server error", &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, false},
+		{"network error", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanentSendError(tt.err); got != tt.want {
+				t.Errorf("isPermanentSendError() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
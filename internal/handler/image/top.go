@@ -0,0 +1,129 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/handler/pagination"
+	"apubot/pkg/custom_errors"
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+// defaultTopImages is number of images listed by /top without argument
+const defaultTopImages = 5
+
+// TopCallbackPrefix is followed by number of listed images and page, e.g. top:10:1
+const TopCallbackPrefix = "top:"
+
+// TopImages lists most served images, admins also get previews
+func (h *Handler) TopImages(ctx context.Context, message *tgbotapi.Message) {
+	n := min(defaultTopImages, h.cfg.MaxTopImages)
+
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		var err error
+
+		n, err = strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			h.reply(message.Chat.ID, fmt.Sprintf("Please enter number of pictures from 1 to %d, e.g. /top 3", h.cfg.MaxTopImages))
+
+			return
+		}
+
+		n = min(n, h.cfg.MaxTopImages)
+	}
+
+	files, text, markup := h.topPage(ctx, message.Chat.ID, n, 0)
+
+	_, err := h.bot.Send(pagination.Message(message.Chat.ID, text, markup))
+	if err != nil {
+		h.log.Error("Error sending message", "chat_id", message.Chat.ID, "err", err)
+	}
+
+	// previews are limited to admins so busy chats are not flooded
+	if len(files) == 0 || message.From == nil || !h.cfg.IsAdmin(message.From.ID) {
+		return
+	}
+
+	rating := h.chatRating(ctx, message.Chat.ID)
+
+	for _, file := range files {
+		if !file.AllowedFor(rating) {
+			continue
+		}
+
+		_, err = h.sendAttachment(ctx, file, message.Chat.ID, 0, nil)
+		if err != nil {
+			h.log.Error("Error sending preview", "chat_id", message.Chat.ID, "file", file.Name, "err", err)
+		}
+	}
+}
+
+// TopPage shows another page of /top list
+func (h *Handler) TopPage(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	rawCount, _, _ := strings.Cut(strings.TrimPrefix(query.Data, TopCallbackPrefix), ":")
+
+	n, err := strconv.Atoi(rawCount)
+	if err != nil || n < 1 || query.Message == nil {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	page, ok := pagination.ParsePage(query.Data, fmt.Sprintf("%s%d:", TopCallbackPrefix, n))
+	if !ok {
+		h.answer(query.ID, "")
+
+		return
+	}
+
+	_, text, markup := h.topPage(ctx, query.Message.Chat.ID, min(n, h.cfg.MaxTopImages), page)
+
+	_, err = h.bot.Send(pagination.Edit(query.Message, text, markup))
+	if err != nil {
+		h.log.Error("Error editing message", "chat_id", query.Message.Chat.ID, "err", err)
+	}
+
+	h.answer(query.ID, "")
+}
+
+// topPage returns n most served images allowed in chat with text of their page and navigation buttons,
+// errors are reported in text
+func (h *Handler) topPage(
+	ctx context.Context,
+	chatId int64,
+	n int,
+	page int,
+) ([]domain.File, string, *tgbotapi.InlineKeyboardMarkup) {
+	files, err := h.services.Image.TopImages(ctx, n)
+	if err != nil {
+		var notFoundErr *custom_errors.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return nil, "No pictures served yet!", nil
+		}
+
+		return nil, h.errorText(ctx, chatId, err, "Error getting top images"), nil
+	}
+
+	rating := h.chatRating(ctx, chatId)
+
+	lines := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.AllowedFor(rating) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%d. #%d - served %d times", len(lines)+1, file.ID, file.ServeCount))
+	}
+
+	if len(lines) == 0 {
+		return nil, "No pictures served yet!", nil
+	}
+
+	lines, page, pages := pagination.Page(lines, page, h.cfg.ListPageSize)
+	text := pagination.WithPageNumber("Most popular pictures:\n"+strings.Join(lines, "\n"), page, pages)
+
+	return files, text, pagination.Keyboard(fmt.Sprintf("%s%d:", TopCallbackPrefix, n), page, pages)
+}
@@ -0,0 +1,302 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/handler/access"
+	"apubot/internal/i18n"
+	"apubot/internal/service/subscription"
+	"apubot/pkg/custom_errors"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxImportSize limits size of imported data
+	maxImportSize = 64 * 1024
+	// maxImportFavorites limits number of imported favorites
+	maxImportFavorites = 1000
+	// maxImportSubscriptions limits number of imported subscriptions
+	maxImportSubscriptions = 10
+	exportFileName         = "peepo_export.json"
+)
+
+// Export sends JSON document with caller favorites and, if caller can manage chat, chat settings and subscriptions
+func (h *Handler) Export(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	exp := domain.Export{Version: domain.ExportVersion, Favorites: []int64{}}
+
+	ids, err := h.services.Favorite.List(ctx, message.From.ID)
+	if err != nil && !isNotFound(err) {
+		h.replyError(ctx, message.Chat.ID, err, "Error listing favorites")
+
+		return
+	}
+
+	if len(ids) > 0 {
+		exp.Favorites = ids
+	}
+
+	if access.CanManageChat(h.cfg, h.log, h.bot, message) {
+		settings, _ := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+		exp.ChatSettings = &domain.ExportChatSettings{
+			Rating:   settings.Rating,
+			Language: settings.Language,
+			Cooldown: settings.Cooldown,
+		}
+
+		subs, err := h.services.Subscription.List(ctx, message.Chat.ID)
+		if err != nil && !isNotFound(err) {
+			h.replyError(ctx, message.Chat.ID, err, "Error listing subscriptions")
+
+			return
+		}
+
+		for _, sub := range subs {
+			exp.Subscriptions = append(exp.Subscriptions, domain.ExportSubscription{Period: sub.Period})
+		}
+	}
+
+	data, err := json.MarshalIndent(exp, "", "  ")
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error encoding export")
+
+		return
+	}
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: exportFileName, Bytes: data})
+	doc.Caption = "Send this file with /import caption in another chat to restore your settings"
+
+	_, err = h.bot.Send(doc)
+	if err != nil {
+		h.replyError(ctx, message.Chat.ID, err, "Error sending export")
+	}
+}
+
+// Import restores data produced by Export from attached or replied document or from command arguments
+func (h *Handler) Import(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+
+	data, err := h.importData(ctx, message)
+	if err != nil {
+		h.log.Warn("Can not read import data", "chat_id", message.Chat.ID, "err", err)
+		h.reply(message.Chat.ID, "Please send exported file with /import caption, reply to it with /import or paste its text after /import")
+
+		return
+	}
+
+	exp, err := h.parseExport(data)
+	if err != nil {
+		h.reply(message.Chat.ID, "Invalid import data: "+err.Error())
+
+		return
+	}
+
+	if (exp.ChatSettings != nil || len(exp.Subscriptions) > 0) && !access.CanManageChat(h.cfg, h.log, h.bot, message) {
+		h.reply(message.Chat.ID, "Only chat administrators can import chat settings and subscriptions!")
+
+		return
+	}
+
+	var report []string
+
+	// favorites of images removed since export are skipped
+	favorites := make([]int64, 0, len(exp.Favorites))
+	for _, id := range exp.Favorites {
+		if _, err = h.services.Image.GetByID(ctx, id); err == nil {
+			favorites = append(favorites, id)
+		}
+	}
+
+	if len(favorites) > 0 {
+		err = h.services.Favorite.AddMany(ctx, message.From.ID, favorites)
+		if err != nil {
+			h.replyError(ctx, message.Chat.ID, err, "Error importing favorites")
+
+			return
+		}
+	}
+
+	report = append(report, fmt.Sprintf("Favorites imported: %d of %d", len(favorites), len(exp.Favorites)))
+
+	if exp.ChatSettings != nil {
+		// settings not in export are kept, so they must be read first
+		settings, err := h.services.Chat.GetSettings(ctx, message.Chat.ID)
+		if err == nil {
+			settings.Rating = exp.ChatSettings.Rating
+			settings.Language = exp.ChatSettings.Language
+			settings.Cooldown = exp.ChatSettings.Cooldown
+
+			err = h.services.Chat.SaveSettings(ctx, settings)
+		}
+
+		if err != nil {
+			h.log.Error("Error importing chat settings", "chat_id", message.Chat.ID, "err", err)
+			report = append(report, "Chat settings were not imported :d")
+		} else {
+			report = append(report, "Chat settings imported")
+		}
+	}
+
+	created := 0
+	for _, sub := range exp.Subscriptions {
+		_, err = h.services.Subscription.Create(ctx, domain.Subscription{
+			ChatId:    message.Chat.ID,
+			CreatedAt: time.Now().Unix(),
+			Period:    sub.Period,
+		}, h.sendImage)
+		if errors.Is(err, subscription.ErrLimitReached) {
+			break
+		}
+
+		var existsErr *custom_errors.AlreadyExistsError
+		if err != nil && !errors.As(err, &existsErr) {
+			h.log.Error("Error importing subscription", "chat_id", message.Chat.ID, "period", sub.Period, "err", err)
+
+			continue
+		}
+
+		if err == nil {
+			created++
+		}
+	}
+
+	if created > 0 {
+		// imported subscriptions opt chat in like /sub does
+		h.resumeStopped(ctx, message.Chat.ID)
+	}
+
+	if len(exp.Subscriptions) > 0 {
+		report = append(report, fmt.Sprintf("Subscriptions created: %d of %d", created, len(exp.Subscriptions)))
+	}
+
+	h.reply(message.Chat.ID, strings.Join(report, "\n"))
+}
+
+// importData returns document attached to message or replied message, command arguments are used otherwise
+func (h *Handler) importData(ctx context.Context, message *tgbotapi.Message) ([]byte, error) {
+	doc := message.Document
+	if doc == nil && message.ReplyToMessage != nil {
+		doc = message.ReplyToMessage.Document
+	}
+
+	if doc == nil {
+		args := strings.TrimSpace(message.CommandArguments())
+		if args == "" {
+			return nil, errors.New("no data")
+		}
+
+		return []byte(args), nil
+	}
+
+	if doc.FileSize > maxImportSize {
+		return nil, errors.Errorf("document is larger than %d bytes", maxImportSize)
+	}
+
+	url, err := h.bot.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get document url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not create request")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not download document")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read document")
+	}
+
+	if len(data) > maxImportSize {
+		return nil, errors.Errorf("document is larger than %d bytes", maxImportSize)
+	}
+
+	return data, nil
+}
+
+// parseExport decodes and validates exported data, errors are meant for users
+func (h *Handler) parseExport(data []byte) (domain.Export, error) {
+	var exp domain.Export
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&exp); err != nil {
+		return exp, errors.New("malformed JSON")
+	}
+
+	if dec.More() {
+		return exp, errors.New("unexpected data after JSON object")
+	}
+
+	if exp.Version != domain.ExportVersion {
+		return exp, errors.Errorf("unsupported version %d", exp.Version)
+	}
+
+	if len(exp.Favorites) > maxImportFavorites {
+		return exp, errors.Errorf("too many favorites, at most %d allowed", maxImportFavorites)
+	}
+
+	for _, id := range exp.Favorites {
+		if id <= 0 {
+			return exp, errors.Errorf("invalid favorite ID %d", id)
+		}
+	}
+
+	if s := exp.ChatSettings; s != nil {
+		if s.Rating != domain.ChatRatingSFW && s.Rating != domain.ChatRatingAll {
+			return exp, errors.Errorf("invalid rating %q", s.Rating)
+		}
+
+		if !i18n.IsSupported(s.Language) {
+			return exp, errors.Errorf("unsupported language %q", s.Language)
+		}
+
+		cooldown := time.Duration(s.Cooldown) * time.Second
+		if s.Cooldown != 0 && (cooldown < h.cfg.MinChatCooldown || cooldown > h.cfg.MaxChatCooldown) {
+			return exp, errors.Errorf("cooldown %ds is out of allowed range", s.Cooldown)
+		}
+	}
+
+	if len(exp.Subscriptions) > maxImportSubscriptions {
+		return exp, errors.Errorf("too many subscriptions, at most %d allowed", maxImportSubscriptions)
+	}
+
+	for _, sub := range exp.Subscriptions {
+		period := time.Duration(sub.Period) * time.Second
+		if period < h.cfg.MinSubscriptionInterval || period > h.cfg.MaxSubscriptionInterval {
+			return exp, errors.Errorf("subscription period %ds is out of allowed range", sub.Period)
+		}
+	}
+
+	return exp, nil
+}
+
+func isNotFound(err error) bool {
+	var notFoundErr *custom_errors.NotFoundError
+
+	return errors.As(err, &notFoundErr)
+}
@@ -0,0 +1,196 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/testutil"
+	"context"
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"testing"
+	"time"
+)
+
+// exported returns data of the last sent export document
+func exported(t *testing.T, bot *testutil.Sender) []byte {
+	t.Helper()
+
+	sent := bot.Sent()
+	for i := len(sent) - 1; i >= 0; i-- {
+		doc, ok := sent[i].(tgbotapi.DocumentConfig)
+		if !ok {
+			continue
+		}
+
+		file, ok := doc.File.(tgbotapi.FileBytes)
+		if !ok || file.Name != exportFileName {
+			t.Fatalf("sent document %v, want export file", doc.File)
+		}
+
+		return file.Bytes
+	}
+
+	t.Fatal("no export document sent")
+
+	return nil
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	ctx := context.Background()
+
+	first, second := testutil.AddImage(t, h.services.Image, "01.jpg"), testutil.AddImage(t, h.services.Image, "02.jpg")
+
+	if err := h.services.Favorite.AddMany(ctx, 1, []int64{first.ID, second.ID}); err != nil {
+		t.Fatalf("can not add favorites: %v", err)
+	}
+
+	for _, err := range []error{
+		h.services.Chat.SetRating(ctx, 1, domain.ChatRatingAll),
+		h.services.Chat.SetLanguage(ctx, 1, "ru"),
+		h.services.Chat.SetCooldown(ctx, 1, 5*time.Second),
+	} {
+		if err != nil {
+			t.Fatalf("can not change chat settings: %v", err)
+		}
+	}
+
+	if err := h.CreateSubscription(ctx, command(1, "/sub 1h")); err != nil {
+		t.Fatalf("can not subscribe: %v", err)
+	}
+
+	h.Export(ctx, command(1, "/export"))
+	data := exported(t, bot)
+
+	// another user restores data in another chat
+	h.Import(ctx, command(2, "/import "+string(data)))
+
+	want := "Favorites imported: 2 of 2\nChat settings imported\nSubscriptions created: 1 of 1"
+	if got := bot.Texts(2); len(got) != 1 || got[0] != want {
+		t.Fatalf("import replied %q, want %q", got, want)
+	}
+
+	favorites, err := h.services.Favorite.List(ctx, 2)
+	slices.Sort(favorites)
+	if err != nil || !slices.Equal(favorites, []int64{first.ID, second.ID}) {
+		t.Errorf("imported favorites %v, %v, want %d and %d", favorites, err, first.ID, second.ID)
+	}
+
+	settings, err := h.services.Chat.GetSettings(ctx, 2)
+	if err != nil || settings.Rating != domain.ChatRatingAll || settings.Language != "ru" || settings.CooldownAsDuration() != 5*time.Second {
+		t.Errorf("imported settings %+v, %v, want rating all, language ru and cooldown 5s", settings, err)
+	}
+
+	subs, err := h.services.Subscription.List(ctx, 2)
+	if err != nil || len(subs) != 1 || subs[0].PeriodAsDurationInSeconds() != time.Hour {
+		t.Errorf("imported subscriptions %+v, %v, want one with period 1h", subs, err)
+	}
+
+	// importing the same data again does not duplicate anything
+	bot.Reset()
+	h.Import(ctx, command(2, "/import "+string(data)))
+
+	want = "Favorites imported: 2 of 2\nChat settings imported\nSubscriptions created: 0 of 1"
+	if got := bot.Texts(2); len(got) != 1 || got[0] != want {
+		t.Errorf("second import replied %q, want %q", got, want)
+	}
+}
+
+func TestImportSkipsRemovedImages(t *testing.T) {
+	h, bot := newTestHandler(t, nil)
+	file := testutil.AddImage(t, h.services.Image, "01.jpg")
+
+	data, _ := json.Marshal(domain.Export{Version: domain.ExportVersion, Favorites: []int64{file.ID, file.ID + 100}})
+	h.Import(context.Background(), command(1, "/import "+string(data)))
+
+	if got := bot.Texts(1); len(got) != 1 || got[0] != "Favorites imported: 1 of 2" {
+		t.Errorf("import replied %q, want one of two favorites imported", got)
+	}
+}
+
+func TestImportResumesStoppedChat(t *testing.T) {
+	h, _ := newTestHandler(t, nil)
+	ctx := context.Background()
+
+	h.Stop(ctx, command(1, "/stop"))
+
+	data, _ := json.Marshal(domain.Export{
+		Version:       domain.ExportVersion,
+		Favorites:     []int64{},
+		Subscriptions: []domain.ExportSubscription{{Period: 3600}},
+	})
+	h.Import(ctx, command(1, "/import "+string(data)))
+
+	if subs, err := h.services.Subscription.List(ctx, 1); err != nil || len(subs) != 1 {
+		t.Fatalf("imported subscriptions %+v, %v, want one", subs, err)
+	}
+
+	if settings, err := h.services.Chat.GetSettings(ctx, 1); err != nil || settings.Stopped {
+		t.Errorf("chat settings %+v, %v after import, want chat resumed", settings, err)
+	}
+}
+
+func TestParseExport(t *testing.T) {
+	h := &Handler{cfg: &config.Config{
+		MinChatCooldown:         time.Second,
+		MaxChatCooldown:         time.Hour,
+		MinSubscriptionInterval: 10 * time.Minute,
+		MaxSubscriptionInterval: 24 * time.Hour,
+	}}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "favorites only", data: `{"version": 1, "favorites": [1, 2]}`},
+		{
+			name: "everything",
+			data: `{"version": 1, "favorites": [], "chat_settings": {"rating": "all", "language": "en", "cooldown": 0}, "subscriptions": [{"period": 3600}]}`,
+		},
+		{name: "not json", data: `favorites: 1, 2`, wantErr: "malformed JSON"},
+		{name: "unknown field", data: `{"version": 1, "favorites": [], "password": "x"}`, wantErr: "malformed JSON"},
+		{name: "trailing data", data: `{"version": 1, "favorites": []} {}`, wantErr: "unexpected data after JSON object"},
+		{name: "other version", data: `{"version": 2, "favorites": []}`, wantErr: "unsupported version 2"},
+		{name: "invalid favorite", data: `{"version": 1, "favorites": [0]}`, wantErr: "invalid favorite ID 0"},
+		{
+			name:    "invalid rating",
+			data:    `{"version": 1, "favorites": [], "chat_settings": {"rating": "nsfw", "language": "en", "cooldown": 0}}`,
+			wantErr: `invalid rating "nsfw"`,
+		},
+		{
+			name:    "unsupported language",
+			data:    `{"version": 1, "favorites": [], "chat_settings": {"rating": "sfw", "language": "xx", "cooldown": 0}}`,
+			wantErr: `unsupported language "xx"`,
+		},
+		{
+			name:    "cooldown out of range",
+			data:    `{"version": 1, "favorites": [], "chat_settings": {"rating": "sfw", "language": "en", "cooldown": 7200}}`,
+			wantErr: "cooldown 7200s is out of allowed range",
+		},
+		{
+			name:    "period out of range",
+			data:    `{"version": 1, "favorites": [], "subscriptions": [{"period": 1}]}`,
+			wantErr: "subscription period 1s is out of allowed range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.parseExport([]byte(tt.data))
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,34 +2,68 @@ package handler
 
 import (
 	"apubot/internal/config"
+	getterA "apubot/internal/handler/admin"
 	getterG "apubot/internal/handler/general"
 	getterI "apubot/internal/handler/image"
+	"apubot/internal/infrastructure/telegram"
 	"apubot/internal/service"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"apubot/pkg/logger"
 )
 
 type (
 	InitParams struct {
 		Config   *config.Config
-		Bot      *tgbotapi.BotAPI
+		Logger   logger.Logger
+		Bot      telegram.Sender
 		Services *service.Services
 	}
 
 	Handlers struct {
 		General *getterG.Handler
 		Image   *getterI.Handler
+		Admin   *getterA.Handler
 	}
 )
 
 func New(p *InitParams) *Handlers {
 	return &Handlers{
-		General: getterG.New(p.Config, p.Bot),
+		General: getterG.New(
+			p.Config,
+			p.Logger,
+			p.Bot,
+			&getterG.Services{
+				Image:    p.Services.Image,
+				Stats:    p.Services.Stats,
+				Chat:     p.Services.Chat,
+				Feedback: p.Services.Feedback,
+			},
+		),
 		Image: getterI.New(
 			p.Config,
+			p.Logger,
 			p.Bot,
 			&getterI.Services{
 				Image:        p.Services.Image,
 				Subscription: p.Services.Subscription,
+				Stats:        p.Services.Stats,
+				Favorite:     p.Services.Favorite,
+				Chat:         p.Services.Chat,
+				Source:       p.Services.Source,
+				History:      p.Services.History,
+			},
+		),
+		Admin: getterA.New(
+			p.Config,
+			p.Logger,
+			p.Bot,
+			&getterA.Services{
+				Chat:         p.Services.Chat,
+				Image:        p.Services.Image,
+				Feedback:     p.Services.Feedback,
+				State:        p.Services.State,
+				Subscription: p.Services.Subscription,
+				Suggestion:   p.Services.Suggestion,
+				Source:       p.Services.Source,
 			},
 		),
 	}
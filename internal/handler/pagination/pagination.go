@@ -0,0 +1,87 @@
+package pagination
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+// boundary is callback data of placeholder shown instead of Prev on the first page and Next on the last one
+const boundary = "-"
+
+// Page returns items of 0-based page, page is clamped to existing ones and returned with number of pages
+func Page[T any](items []T, page int, size int) (pageItems []T, current int, pages int) {
+	size = max(size, 1)
+	pages = max((len(items)+size-1)/size, 1)
+	current = min(max(page, 0), pages-1)
+
+	start := current * size
+	end := min(start+size, len(items))
+
+	return items[start:end], current, pages
+}
+
+// WithPageNumber appends page number to text if there are several pages
+func WithPageNumber(text string, current int, pages int) string {
+	if pages <= 1 {
+		return text
+	}
+
+	return text + fmt.Sprintf("\n\nPage %d of %d", current+1, pages)
+}
+
+// Keyboard builds Prev and Next buttons with page encoded after prefix in callback data,
+// nil is returned if there is a single page
+func Keyboard(prefix string, current int, pages int) *tgbotapi.InlineKeyboardMarkup {
+	if pages <= 1 {
+		return nil
+	}
+
+	prev := tgbotapi.NewInlineKeyboardButtonData("·", prefix+boundary)
+	if current > 0 {
+		prev = tgbotapi.NewInlineKeyboardButtonData("« Prev", prefix+strconv.Itoa(current-1))
+	}
+
+	next := tgbotapi.NewInlineKeyboardButtonData("·", prefix+boundary)
+	if current < pages-1 {
+		next = tgbotapi.NewInlineKeyboardButtonData("Next »", prefix+strconv.Itoa(current+1))
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(prev, next))
+
+	return &markup
+}
+
+// ParsePage returns page from callback data built by Keyboard, false for placeholder buttons and malformed data
+func ParsePage(data string, prefix string) (int, bool) {
+	raw, ok := strings.CutPrefix(data, prefix)
+	if !ok || raw == boundary {
+		return 0, false
+	}
+
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 0 {
+		return 0, false
+	}
+
+	return page, true
+}
+
+// Edit replaces text and buttons of paginated message
+func Edit(message *tgbotapi.Message, text string, markup *tgbotapi.InlineKeyboardMarkup) tgbotapi.EditMessageTextConfig {
+	edit := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	edit.ReplyMarkup = markup
+
+	return edit
+}
+
+// Message creates paginated message, markup is omitted for a single page
+func Message(chatID int64, text string, markup *tgbotapi.InlineKeyboardMarkup) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+
+	return msg
+}
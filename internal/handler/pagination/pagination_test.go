@@ -0,0 +1,108 @@
+package pagination
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	tests := []struct {
+		name        string
+		items       []int
+		page, size  int
+		want        []int
+		wantCurrent int
+		wantPages   int
+	}{
+		{name: "first page", items: items, page: 0, size: 2, want: []int{1, 2}, wantCurrent: 0, wantPages: 3},
+		{name: "middle page", items: items, page: 1, size: 2, want: []int{3, 4}, wantCurrent: 1, wantPages: 3},
+		{name: "last partial page", items: items, page: 2, size: 2, want: []int{5}, wantCurrent: 2, wantPages: 3},
+		{name: "past last page", items: items, page: 7, size: 2, want: []int{5}, wantCurrent: 2, wantPages: 3},
+		{name: "negative page", items: items, page: -1, size: 2, want: []int{1, 2}, wantCurrent: 0, wantPages: 3},
+		{name: "exactly full pages", items: items[:4], page: 1, size: 2, want: []int{3, 4}, wantCurrent: 1, wantPages: 2},
+		{name: "single page", items: items, page: 0, size: 10, want: items, wantCurrent: 0, wantPages: 1},
+		{name: "no items", items: nil, page: 0, size: 2, want: []int{}, wantCurrent: 0, wantPages: 1},
+		{name: "invalid size", items: items, page: 1, size: 0, want: []int{2}, wantCurrent: 1, wantPages: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, current, pages := Page(tt.items, tt.page, tt.size)
+			if !slices.Equal(got, tt.want) || current != tt.wantCurrent || pages != tt.wantPages {
+				t.Errorf("Page() = %v, %d, %d, want %v, %d, %d", got, current, pages, tt.want, tt.wantCurrent, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestKeyboard(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  int
+		pages    int
+		wantData []string
+	}{
+		{name: "first page", current: 0, pages: 3, wantData: []string{"top:-", "top:1"}},
+		{name: "middle page", current: 1, pages: 3, wantData: []string{"top:0", "top:2"}},
+		{name: "last page", current: 2, pages: 3, wantData: []string{"top:1", "top:-"}},
+		{name: "single page", current: 0, pages: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markup := Keyboard("top:", tt.current, tt.pages)
+			if tt.wantData == nil {
+				if markup != nil {
+					t.Errorf("Keyboard() = %+v, want no buttons", markup)
+				}
+
+				return
+			}
+
+			var data []string
+			for _, button := range markup.InlineKeyboard[0] {
+				data = append(data, *button.CallbackData)
+			}
+
+			if !slices.Equal(data, tt.wantData) {
+				t.Errorf("buttons data = %v, want %v", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		data   string
+		want   int
+		wantOk bool
+	}{
+		{data: "top:2", want: 2, wantOk: true},
+		{data: "top:0", want: 0, wantOk: true},
+		{data: "top:-", wantOk: false},
+		{data: "top:-1", wantOk: false},
+		{data: "top:x", wantOk: false},
+		{data: "favs:1", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, ok := ParsePage(tt.data, "top:")
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ParsePage(%q) = %d, %t, want %d, %t", tt.data, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestWithPageNumber(t *testing.T) {
+	if got := WithPageNumber("Top", 0, 1); got != "Top" {
+		t.Errorf("single page text = %q, want no page number", got)
+	}
+
+	if got := WithPageNumber("Top", 1, 3); got != "Top\n\nPage 2 of 3" {
+		t.Errorf("text = %q, want page number", got)
+	}
+}
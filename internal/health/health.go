@@ -0,0 +1,109 @@
+package health
+
+import (
+	"apubot/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const checkTimeout = 3 * time.Second
+
+// Check returns error if dependency is not available
+type Check func(ctx context.Context) error
+
+// Status describes current state of component, e.g. circuit breaker
+type Status func() string
+
+type Server struct {
+	log    logger.Logger
+	srv    *http.Server
+	alive  func() bool
+	checks map[string]Check
+	status map[string]Status
+}
+
+// NewServer creates health HTTP server, returns nil if addr is empty.
+// /healthz reports whether alive returns true, /readyz runs all checks and lists statuses.
+func NewServer(addr string, log logger.Logger, alive func() bool, checks map[string]Check, status map[string]Status) *Server {
+	if addr == "" {
+		return nil
+	}
+
+	s := &Server{
+		log:    log,
+		alive:  alive,
+		checks: checks,
+		status: status,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+
+	s.srv = &http.Server{Addr: addr, Handler: mux}
+
+	return s
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	if !s.alive() {
+		http.Error(w, "update loop is not running", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	for name, check := range s.checks {
+		err := check(ctx)
+		if err != nil {
+			s.log.Warn("Readiness check failed", "check", name, "err", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, name+" is not available")
+			s.writeStatus(w)
+
+			return
+		}
+	}
+
+	_, _ = fmt.Fprintln(w, "ok")
+	s.writeStatus(w)
+}
+
+// writeStatus lists component statuses sorted by name
+func (s *Server) writeStatus(w http.ResponseWriter) {
+	names := make([]string, 0, len(s.status))
+	for name := range s.status {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%s: %s\n", name, s.status[name]())
+	}
+}
+
+func (s *Server) Start() {
+	go func() {
+		err := s.srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("Error serving health checks", "err", err)
+		}
+	}()
+
+	s.log.Info("Serving health checks", "addr", s.srv.Addr)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,23 @@
+package i18n
+
+var en = map[string]string{
+	KeyWelcome:        "Welcome to peepobot. Now you can use any available command.",
+	KeyCooldown:       "Command on cooldown for %.1f sec",
+	KeyUnknownCommand: "Unknown command",
+	KeyTimeout:        "Taking too long, please try again later!",
+	KeyHelpHeader:     "Command list help:",
+	KeyHelpTags:       "Available tags: %s",
+	KeyLangCurrent:    "Current language is %s. Available languages: %s, e.g. /lang en",
+	KeyLangSet:        "Language set to %s",
+	KeyLangError:      "Can not change language :d",
+	KeyMaintenance:    "Under maintenance, back soon!",
+	KeyUnavailable:    "Service is temporarily unavailable, please try again later!",
+	KeyNoImages:       "No pictures available yet, ask an admin to add some!",
+	KeyRateLimited:    "Too many requests right now, please try again in a bit!",
+	KeyNotFound:       "Nothing found :d",
+	KeyUnknownError:   "Sorry, something went wrong :d Please try again later.",
+	KeyCooldownNone:   "No cooldown, all commands are available",
+	KeyCooldownLeft:   "Commands are on cooldown for %.1f sec",
+	KeyCooldownOwn:    "/%s is on cooldown for %.1f sec",
+	KeyCooldownExempt: "You are exempt from cooldowns",
+}
@@ -0,0 +1,87 @@
+package i18n
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	LangEN      = "en"
+	LangRU      = "ru"
+	DefaultLang = LangEN
+)
+
+const (
+	KeyWelcome        = "welcome"
+	KeyCooldown       = "cooldown"
+	KeyUnknownCommand = "unknown_command"
+	KeyTimeout        = "timeout"
+	KeyHelpHeader     = "help.header"
+	KeyHelpTags       = "help.tags"
+	KeyLangCurrent    = "lang.current"
+	KeyLangSet        = "lang.set"
+	KeyLangError      = "lang.error"
+	KeyMaintenance    = "maintenance"
+	KeyUnavailable    = "unavailable"
+	KeyNoImages       = "error.no_images"
+	KeyRateLimited    = "error.rate_limited"
+	KeyNotFound       = "error.not_found"
+	KeyUnknownError   = "error.unknown"
+	KeyCooldownNone   = "cooldown.none"
+	KeyCooldownLeft   = "cooldown.left"
+	KeyCooldownOwn    = "cooldown.own"
+	KeyCooldownExempt = "cooldown.exempt"
+)
+
+// CommandKey returns key of command description in help
+func CommandKey(name string) string {
+	return "cmd." + name
+}
+
+var catalogs = map[string]map[string]string{
+	LangEN: en,
+	LangRU: ru,
+}
+
+// T returns message for language formatted with args, english is used for missing keys
+func T(lang string, key string, args ...any) string {
+	msg, ok := Lookup(lang, key)
+	if !ok {
+		return key
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// Lookup returns message for language falling back to english
+func Lookup(lang string, key string) (string, bool) {
+	if msg, ok := catalogs[lang][key]; ok {
+		return msg, true
+	}
+
+	msg, ok := catalogs[DefaultLang][key]
+
+	return msg, ok
+}
+
+func IsSupported(lang string) bool {
+	_, ok := catalogs[lang]
+
+	return ok
+}
+
+// Languages returns sorted codes of supported languages
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+
+	slices.Sort(langs)
+
+	return langs
+}
@@ -0,0 +1,72 @@
+package i18n
+
+var ru = map[string]string{
+	KeyWelcome:        "Добро пожаловать в peepobot. Теперь можно использовать любую доступную команду.",
+	KeyCooldown:       "Команда будет доступна через %.1f сек",
+	KeyUnknownCommand: "Неизвестная команда",
+	KeyTimeout:        "Это заняло слишком много времени, попробуйте ещё раз позже!",
+	KeyHelpHeader:     "Список команд:",
+	KeyHelpTags:       "Доступные теги: %s",
+	KeyLangCurrent:    "Текущий язык: %s. Доступные языки: %s, например /lang ru",
+	KeyLangSet:        "Язык изменён на %s",
+	KeyLangError:      "Не удалось изменить язык :d",
+	KeyMaintenance:    "Ведутся технические работы, скоро вернёмся!",
+	KeyUnavailable:    "Сервис временно недоступен, попробуйте позже!",
+	KeyNoImages:       "Картинок пока нет, попросите админа добавить!",
+	KeyRateLimited:    "Слишком много запросов, попробуйте чуть позже!",
+	KeyNotFound:       "Ничего не найдено :d",
+	KeyUnknownError:   "Извините, что-то пошло не так :d Попробуйте позже.",
+	KeyCooldownNone:   "Ограничений нет, все команды доступны",
+	KeyCooldownLeft:   "Команды будут доступны через %.1f сек",
+	KeyCooldownOwn:    "/%s будет доступна через %.1f сек",
+	KeyCooldownExempt: "На вас ограничения частоты команд не действуют",
+
+	"cmd.peepo":         "Получить случайную картинку, можно с выбранными тегами и без исключённых, картинку по ID или анимацию",
+	"cmd.peepo_many":    "Получить сразу несколько случайных картинок",
+	"cmd.peepo_hd":      "Получить случайную картинку файлом без сжатия",
+	"cmd.potd":          "Картинка дня, одна для всех до полуночи",
+	"cmd.sub":           "Подписаться на регулярную отправку картинок",
+	"cmd.unsub":         "Удалить выбранную или все подписки",
+	"cmd.stop":          "Удалить все подписки и не присылать сообщения до /start",
+	"cmd.remind":        "Прислать одну картинку через заданное время",
+	"cmd.sub_info":      "Информация об активных подписках",
+	"cmd.sub_pause":     "Приостановить подписки",
+	"cmd.sub_resume":    "Возобновить подписки",
+	"cmd.help":          "Показать этот список",
+	"cmd.cooldown":      "Показать, через сколько снова будут доступны команды",
+	"cmd.fav":           "Сохранить последнюю или отвеченную картинку в избранное",
+	"cmd.favs":          "Список избранных картинок",
+	"cmd.history":       "Список картинок, недавно отправленных в этот чат",
+	"cmd.fav_get":       "Получить избранную картинку по ID",
+	"cmd.export":        "Выгрузить избранное, настройки и подписки чата",
+	"cmd.import":        "Загрузить данные, выгруженные командой /export",
+	"cmd.set_rating":    "Выбрать, какие картинки разрешены в чате",
+	"cmd.lang":          "Выбрать язык бота",
+	"cmd.stats":         "Статистика использования",
+	"cmd.set_cooldown":  "Задать задержку между командами в чате",
+	"cmd.get_cooldown":  "Показать задержку между командами в чате",
+	"cmd.quiet":         "Задать часы, когда картинки по подписке не отправляются",
+	"cmd.timezone":      "Задать часовой пояс чата для тихих часов",
+	"cmd.hd":            "Отправлять картинки в этот чат файлами без сжатия",
+	"cmd.count":         "Сколько картинок доступно",
+	"cmd.top":           "Самые популярные картинки",
+	"cmd.reset_history": "Разрешить повтор недавно отправленных картинок",
+	"cmd.whoami":        "Показать ваш ID, ID чата и статус администратора",
+	"cmd.feedback":      "Отправить отзыв администраторам бота",
+	"cmd.feedback_list": "Последние отзывы",
+	"cmd.subs_count":    "Количество активных подписок по интервалам",
+	"cmd.suggest":       "Предложить картинку из ответа для библиотеки",
+	"cmd.review":        "Проверить предложенные картинки",
+	"cmd.maintenance":   "Включить или выключить режим обслуживания",
+	"cmd.broadcast":     "Отправить сообщение во все известные чаты",
+	"cmd.add_image":     "Добавить фото в библиотеку с тегами",
+	"cmd.import_urls":   "Добавить картинки по ссылкам из документа, по одной на строку",
+	"cmd.delete_image":  "Удалить картинку из библиотеки по ID",
+	"cmd.restore_image": "Восстановить недавно удалённую картинку по ID",
+	"cmd.rate_image":    "Задать рейтинг картинки",
+	"cmd.tags":          "Показать теги картинки",
+	"cmd.tag_add":       "Добавить теги картинке",
+	"cmd.tag_remove":    "Удалить теги картинки",
+	"cmd.tag_weight":    "Задать, как часто выбирается тег",
+	"cmd.by_uploader":   "Список картинок, добавленных пользователем",
+}
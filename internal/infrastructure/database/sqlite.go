@@ -2,47 +2,260 @@ package database
 
 import (
 	"apubot/internal/config"
+	"apubot/internal/metrics"
+	"apubot/migrations"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/breaker"
+	"context"
 	"database/sql"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
-	"log"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// ErrUnavailable is returned without querying db while circuit breaker is open
+var ErrUnavailable = custom_errors.NewUnavailable("database is temporarily unavailable")
+
 type DB struct {
-	conn *sql.DB
+	conn    *sql.DB
+	log     logger.Logger
+	breaker *breaker.Breaker
+	// slowQuery is duration after which query is logged, 0 disables logging
+	slowQuery time.Duration
+	stop      chan struct{}
 }
 
-func New(cfg *config.Config) (*DB, error) {
+func New(cfg *config.Config, log logger.Logger) (*DB, error) {
 	conn, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not connect to db")
 	}
 
-	err = conn.Ping()
+	conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout)
+	defer cancel()
+
+	err = conn.PingContext(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "can not ping db")
+		_ = conn.Close()
+
+		return nil, errors.Wrapf(err, "can not ping db at %s within %s", cfg.DBPath, cfg.RequestTimeout)
 	}
 
-	migrationsDir := "./migrations"
-	err = migrationUp(cfg.DBPath, migrationsDir)
+	err = migrationUp(cfg.DBPath, log)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not apply migrations")
 	}
 
-	return &DB{conn: conn}, nil
+	db := &DB{
+		conn:      conn,
+		log:       log,
+		breaker:   breaker.New(cfg.DBBreakerThreshold, cfg.DBBreakerCooldown),
+		slowQuery: cfg.SlowQueryThreshold,
+		stop:      make(chan struct{}),
+	}
+
+	if cfg.DBHealthCheckInterval > 0 {
+		go db.watch(cfg.DBHealthCheckInterval, cfg.RequestTimeout)
+	}
+
+	return db, nil
+}
+
+// watch pings db periodically and reports when connection is lost and restored,
+// sql.DB reconnects by itself once db is reachable again
+func (db *DB) watch(interval time.Duration, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := db.conn.PingContext(ctx)
+		cancel()
+
+		switch {
+		case err != nil && healthy:
+			db.log.Error("Database is not reachable", "err", err)
+		case err == nil && !healthy:
+			db.log.Info("Database connection restored")
+		}
+
+		healthy = err == nil
+	}
+}
+
+// Row is result of QueryRowContext, query error is returned by Scan like for sql.Row
+type Row struct {
+	row   *sql.Row
+	err   error
+	db    *DB
+	name  string
+	query string
+	start time.Time
+}
+
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	// sql.Row runs query lazily, so it is timed until scanned
+	err := r.row.Scan(dest...)
+	r.db.observe(r.name, r.query, r.start)
+	r.db.done(err)
+
+	return err
+}
+
+// ExecContext, QueryContext, QueryRowContext and BeginTx run through circuit breaker,
+// so requests fail fast with ErrUnavailable after several consecutive db failures.
+// Queries are timed by name of repository method running them, statements inside transactions are not.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if !db.breaker.Allow() {
+		return nil, ErrUnavailable
+	}
+
+	name, start := queryName(), time.Now()
+
+	res, err := db.conn.ExecContext(ctx, query, args...)
+	db.observe(name, query, start)
+	db.done(err)
+
+	return res, err
 }
 
-func (db *DB) Conn() *sql.DB {
-	return db.conn
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if !db.breaker.Allow() {
+		return nil, ErrUnavailable
+	}
+
+	name, start := queryName(), time.Now()
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	db.observe(name, query, start)
+	db.done(err)
+
+	return rows, err
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	if !db.breaker.Allow() {
+		return &Row{err: ErrUnavailable}
+	}
+
+	return &Row{
+		row:   db.conn.QueryRowContext(ctx, query, args...),
+		db:    db,
+		name:  queryName(),
+		query: query,
+		start: time.Now(),
+	}
 }
 
-func migrationUp(connString, migrationsDir string) error {
-	m, err := migrate.New(
-		"file://"+migrationsDir,
-		"sqlite3://"+connString,
-	)
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if !db.breaker.Allow() {
+		return nil, ErrUnavailable
+	}
+
+	tx, err := db.conn.BeginTx(ctx, opts)
+	db.done(err)
+
+	return tx, err
+}
+
+// observe records query duration and logs query if it was slow
+func (db *DB) observe(name string, query string, start time.Time) {
+	elapsed := time.Since(start)
+
+	metrics.DBQueryDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+
+	if db.slowQuery > 0 && elapsed >= db.slowQuery {
+		db.log.Warn("Slow query", "query", name, "duration", elapsed, "sql", compactQuery(query))
+	}
+}
+
+// queryName returns repository method which called DB method, e.g. image.GetNamesByTags
+func queryName() string {
+	// skip queryName and DB method
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strings.Replace(name, "(*Repository).", "", 1)
+}
+
+// compactQuery joins multiline query to single line for logs
+func compactQuery(query string) string {
+	const maxLength = 200
+
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLength {
+		query = query[:maxLength] + "…"
+	}
+
+	return query
+}
+
+// done records query result in circuit breaker, errors caused by request itself are not db failures
+func (db *DB) done(err error) {
+	var sqliteErr sqlite3.Error
+
+	failed := err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, context.Canceled) &&
+		!(errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint)
+
+	from, to := db.breaker.Done(failed)
+
+	switch {
+	case from == breaker.Closed && to == breaker.Open:
+		db.log.Error("Database circuit breaker opened", "err", err)
+	case from == breaker.HalfOpen && to == breaker.Open:
+		db.log.Warn("Database is still failing, circuit breaker reopened", "err", err)
+	case from != breaker.Closed && to == breaker.Closed:
+		db.log.Info("Database circuit breaker closed")
+	}
+}
+
+// BreakerState returns state of circuit breaker guarding db queries
+func (db *DB) BreakerState() breaker.State {
+	return db.breaker.State()
+}
+
+// migrationUp applies embedded migrations, applied version is tracked in schema_migrations table
+func migrationUp(connString string, log logger.Logger) error {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return errors.Wrap(err, "can not read migrations")
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, "sqlite3://"+connString)
 	if err != nil {
 		return errors.Wrap(err, "can not create migrate instance")
 	}
@@ -52,11 +265,17 @@ func migrationUp(connString, migrationsDir string) error {
 		return errors.Wrap(err, "error applying migrations")
 	}
 
-	log.Println("Successfully applied migrations")
+	log.Info("Successfully applied migrations")
 
 	return nil
 }
 
 func (db *DB) Close() error {
+	close(db.stop)
+
 	return db.conn.Close()
 }
+
+func (db *DB) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"apubot/internal/config"
+	"apubot/migrations"
+	"context"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	return &config.Config{
+		DBPath:         filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConns: 1,
+		RequestTimeout: time.Second,
+	}
+}
+
+// latestVersion returns version of the newest embedded migration
+func latestVersion(t *testing.T) uint {
+	t.Helper()
+
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no embedded migrations: %v", err)
+	}
+
+	version, _, _ := strings.Cut(names[len(names)-1], "_")
+
+	v, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		t.Fatalf("bad migration name %s: %v", names[len(names)-1], err)
+	}
+
+	return uint(v)
+}
+
+func TestNewAppliesEmbeddedMigrations(t *testing.T) {
+	cfg := testConfig(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// migrations do not depend on working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("can not get working directory: %v", err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("can not change working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	db, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+
+	var version uint
+	var dirty bool
+
+	err = db.QueryRowContext(context.Background(), "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+	if err != nil {
+		t.Fatalf("can not read applied version: %v", err)
+	}
+
+	if want := latestVersion(t); version != want || dirty {
+		t.Errorf("applied version %d (dirty %v), want %d", version, dirty, want)
+	}
+
+	_, err = db.ExecContext(context.Background(), "SELECT count(*) FROM images")
+	if err != nil {
+		t.Errorf("images table is missing: %v", err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatalf("can not close db: %v", err)
+	}
+
+	// reopening applies nothing and does not fail
+	db, err = New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not reopen db: %v", err)
+	}
+
+	_ = db.Close()
+}
+
+func TestMigrationsCanBeRolledBack(t *testing.T) {
+	cfg := testConfig(t)
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatalf("can not read migrations: %v", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, "sqlite3://"+cfg.DBPath)
+	if err != nil {
+		t.Fatalf("can not create migrate instance: %v", err)
+	}
+	defer m.Close()
+
+	if err = m.Up(); err != nil {
+		t.Fatalf("can not apply migrations: %v", err)
+	}
+
+	if err = m.Down(); err != nil {
+		t.Fatalf("can not roll migrations back: %v", err)
+	}
+
+	if err = m.Up(); err != nil {
+		t.Fatalf("can not apply migrations again: %v", err)
+	}
+
+	if _, err = os.Stat(cfg.DBPath); err != nil {
+		t.Errorf("db file is missing: %v", err)
+	}
+}
+
+// warnLogger records warnings with their args
+type warnLogger struct {
+	warnings []map[string]any
+}
+
+func (l *warnLogger) Debug(string, ...any) {}
+func (l *warnLogger) Info(string, ...any)  {}
+func (l *warnLogger) Error(string, ...any) {}
+
+func (l *warnLogger) Warn(msg string, args ...any) {
+	fields := map[string]any{"msg": msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1]
+	}
+
+	l.warnings = append(l.warnings, fields)
+}
+
+func TestSlowQueriesAreLogged(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SlowQueryThreshold = time.Second
+
+	log := &warnLogger{}
+
+	db, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	// queries are given start time in the past instead of sleeping
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		slow    bool
+	}{
+		{name: "fast", elapsed: 0},
+		{name: "below threshold", elapsed: 500 * time.Millisecond},
+		{name: "at threshold", elapsed: time.Second, slow: true},
+		{name: "slow", elapsed: time.Minute, slow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log.warnings = nil
+
+			row := db.QueryRowContext(context.Background(), "SELECT\n\tcount(*)\n\tFROM images")
+			row.start = row.start.Add(-tt.elapsed)
+
+			var count int
+			if err := row.Scan(&count); err != nil {
+				t.Fatalf("can not run query: %v", err)
+			}
+
+			if !tt.slow {
+				if len(log.warnings) != 0 {
+					t.Errorf("logged %v for fast query", log.warnings)
+				}
+
+				return
+			}
+
+			if len(log.warnings) != 1 {
+				t.Fatalf("logged %v, want one slow query warning", log.warnings)
+			}
+
+			w := log.warnings[0]
+			if w["msg"] != "Slow query" || w["sql"] != "SELECT count(*) FROM images" {
+				t.Errorf("logged %v, want compacted slow query", w)
+			}
+
+			// caller of DB method names the query
+			if name, _ := w["query"].(string); !strings.HasPrefix(name, "database.TestSlowQueriesAreLogged.") {
+				t.Errorf("query name is %v, want calling function", w["query"])
+			}
+
+			if d, ok := w["duration"].(time.Duration); !ok || d < tt.elapsed {
+				t.Errorf("logged duration %v, want at least %s", w["duration"], tt.elapsed)
+			}
+		})
+	}
+
+	// disabled threshold never logs
+	db.slowQuery = 0
+	log.warnings = nil
+
+	db.observe("image.GetAll", "SELECT 1", time.Now().Add(-time.Hour))
+
+	if len(log.warnings) != 0 {
+		t.Errorf("logged %v with slow query logging disabled", log.warnings)
+	}
+}
@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) SaveChat(ctx context.Context, chatId int64, seenAt int64) error {
+	query := "INSERT INTO chats (chat_id, first_seen_at) VALUES (?, ?) ON CONFLICT(chat_id) DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, chatId, seenAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) GetAllIDs(ctx context.Context) (ids []int64, err error) {
+	query := "SELECT chat_id FROM chats"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return ids, nil
+}
+
+func (r *Repository) GetSettings(ctx context.Context, chatId int64) (settings domain.ChatSettings, err error) {
+	query := `
+	SELECT chat_id, rating, language, cooldown, quiet_start, quiet_end, timezone, hd_mode, stopped
+	FROM chat_settings WHERE chat_id = ?
+	`
+	err = r.db.QueryRowContext(ctx, query, chatId).Scan(
+		&settings.ChatID, &settings.Rating, &settings.Language, &settings.Cooldown,
+		&settings.QuietStart, &settings.QuietEnd, &settings.Timezone, &settings.HDMode, &settings.Stopped,
+	)
+	if err != nil {
+		return settings, errors.Wrap(err, "can not get chat settings")
+	}
+
+	return settings, nil
+}
+
+func (r *Repository) SaveSettings(ctx context.Context, settings domain.ChatSettings) error {
+	query := `
+	INSERT INTO chat_settings (chat_id, rating, language, cooldown, quiet_start, quiet_end, timezone, hd_mode, stopped)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET rating=excluded.rating, language=excluded.language, cooldown=excluded.cooldown,
+		quiet_start=excluded.quiet_start, quiet_end=excluded.quiet_end, timezone=excluded.timezone,
+		hd_mode=excluded.hd_mode, stopped=excluded.stopped
+	`
+	_, err := r.db.ExecContext(
+		ctx, query, settings.ChatID, settings.Rating, settings.Language, settings.Cooldown,
+		settings.QuietStart, settings.QuietEnd, settings.Timezone, settings.HDMode, settings.Stopped,
+	)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
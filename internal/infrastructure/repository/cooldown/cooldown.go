@@ -0,0 +1,62 @@
+package cooldown
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) SaveCooldown(ctx context.Context, cd domain.Cooldown) error {
+	query := `
+	INSERT INTO cooldowns (key, used_at, expires_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(key) DO UPDATE SET used_at=excluded.used_at, expires_at=excluded.expires_at
+	`
+	_, err := r.db.ExecContext(ctx, query, cd.Key, cd.UsedAt, cd.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// LoadCooldowns prunes cooldowns expired before now and returns the rest
+func (r *Repository) LoadCooldowns(ctx context.Context, now int64) (cds []domain.Cooldown, err error) {
+	query := "DELETE FROM cooldowns WHERE expires_at <= ?"
+	_, err = r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not prune expired cooldowns")
+	}
+
+	query = "SELECT key, used_at, expires_at FROM cooldowns"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cd domain.Cooldown
+
+		if err = rows.Scan(&cd.Key, &cd.UsedAt, &cd.ExpiresAt); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+
+		cds = append(cds, cd)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return cds, nil
+}
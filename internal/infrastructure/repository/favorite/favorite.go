@@ -0,0 +1,83 @@
+package favorite
+
+import (
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) AddFavorite(ctx context.Context, userId int64, imageId int64, createdAt int64) error {
+	query := "INSERT INTO favorites (user_id, image_id, created_at) VALUES (?, ?, ?) ON CONFLICT(user_id, image_id) DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, userId, imageId, createdAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// AddFavorites saves several favorites at once, already saved ones are skipped
+func (r *Repository) AddFavorites(ctx context.Context, userId int64, imageIds []int64, createdAt int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO favorites (user_id, image_id, created_at) VALUES (?, ?, ?) ON CONFLICT(user_id, image_id) DO NOTHING"
+	for _, imageId := range imageIds {
+		_, err = tx.ExecContext(ctx, query, userId, imageId, createdAt)
+		if err != nil {
+			return errors.Wrap(err, "can not exec query")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
+
+// ListFavorites returns IDs of user favorite images in order they were added
+func (r *Repository) ListFavorites(ctx context.Context, userId int64) ([]int64, error) {
+	query := "SELECT image_id FROM favorites WHERE user_id = ? ORDER BY created_at, image_id"
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return ids, nil
+}
+
+func (r *Repository) GetFavorite(ctx context.Context, userId int64, imageId int64) (id int64, err error) {
+	query := "SELECT image_id FROM favorites WHERE user_id = ? AND image_id = ?"
+	err = r.db.QueryRowContext(ctx, query, userId, imageId).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not get favorite")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,51 @@
+package feedback
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(ctx context.Context, fb domain.Feedback) (id int64, err error) {
+	query := "INSERT INTO feedback (chat_id, user_id, username, text, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id"
+	err = r.db.QueryRowContext(ctx, query, fb.ChatID, fb.UserID, fb.Username, fb.Text, fb.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return id, nil
+}
+
+// ListRecent returns up to limit latest feedback messages, newest first
+func (r *Repository) ListRecent(ctx context.Context, limit int) ([]domain.Feedback, error) {
+	query := "SELECT id, chat_id, user_id, username, text, created_at FROM feedback ORDER BY id DESC LIMIT ?"
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var list []domain.Feedback
+	for rows.Next() {
+		var fb domain.Feedback
+		if err = rows.Scan(&fb.ID, &fb.ChatID, &fb.UserID, &fb.Username, &fb.Text, &fb.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		list = append(list, fb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return list, nil
+}
@@ -0,0 +1,78 @@
+package history
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Add saves served image and drops chat entries older than the last keep ones
+func (r *Repository) Add(ctx context.Context, served domain.ServedImage, keep int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO served_images (chat_id, image_id, served_at) VALUES (?, ?, ?)"
+	_, err = tx.ExecContext(ctx, query, served.ChatID, served.ImageID, served.ServedAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	query = `
+	DELETE FROM served_images
+	WHERE chat_id = ? AND id NOT IN (
+		SELECT id FROM served_images WHERE chat_id = ? ORDER BY served_at DESC, id DESC LIMIT ?
+	)
+	`
+	_, err = tx.ExecContext(ctx, query, served.ChatID, served.ChatID, keep)
+	if err != nil {
+		return errors.Wrap(err, "can not trim history")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
+
+// RecentlyServed returns up to n images last served to chat, newest first
+func (r *Repository) RecentlyServed(ctx context.Context, chatId int64, n int) ([]domain.ServedImage, error) {
+	query := `
+	SELECT chat_id, image_id, served_at FROM served_images
+	WHERE chat_id = ?
+	ORDER BY served_at DESC, id DESC
+	LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, chatId, n)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var served []domain.ServedImage
+	for rows.Next() {
+		var s domain.ServedImage
+		if err = rows.Scan(&s.ChatID, &s.ImageID, &s.ServedAt); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		served = append(served, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return served, nil
+}
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	cfg := &config.Config{
+		DBPath:         filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConns: 1,
+		RequestTimeout: time.Second,
+	}
+
+	db, err := database.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return New(db)
+}
+
+// imageIDs returns IDs of served images in returned order
+func imageIDs(served []domain.ServedImage) []int64 {
+	ids := make([]int64, len(served))
+	for i, s := range served {
+		ids[i] = s.ImageID
+	}
+
+	return ids
+}
+
+func TestRecentlyServedIsNewestFirst(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	for _, served := range []domain.ServedImage{
+		{ChatID: 1, ImageID: 10, ServedAt: 100},
+		{ChatID: 1, ImageID: 30, ServedAt: 300},
+		{ChatID: 2, ImageID: 99, ServedAt: 400},
+		{ChatID: 1, ImageID: 20, ServedAt: 200},
+		// served in the same second as previous one, but later
+		{ChatID: 1, ImageID: 21, ServedAt: 200},
+	} {
+		if err := r.Add(ctx, served, 10); err != nil {
+			t.Fatalf("can not add served image: %v", err)
+		}
+	}
+
+	served, err := r.RecentlyServed(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("can not get history: %v", err)
+	}
+
+	if got, want := imageIDs(served), []int64{30, 21, 20, 10}; !slices.Equal(got, want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+
+	served, err = r.RecentlyServed(ctx, 1, 2)
+	if err != nil {
+		t.Fatalf("can not get history: %v", err)
+	}
+
+	if got, want := imageIDs(served), []int64{30, 21}; !slices.Equal(got, want) {
+		t.Errorf("2 last served = %v, want %v", got, want)
+	}
+}
+
+func TestAddTrimsHistory(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	for i := int64(1); i <= 5; i++ {
+		if err := r.Add(ctx, domain.ServedImage{ChatID: 1, ImageID: i, ServedAt: i}, 3); err != nil {
+			t.Fatalf("can not add served image: %v", err)
+		}
+	}
+
+	// other chats keep their history
+	if err := r.Add(ctx, domain.ServedImage{ChatID: 2, ImageID: 1, ServedAt: 1}, 3); err != nil {
+		t.Fatalf("can not add served image: %v", err)
+	}
+
+	served, err := r.RecentlyServed(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("can not get history: %v", err)
+	}
+
+	if got, want := imageIDs(served), []int64{5, 4, 3}; !slices.Equal(got, want) {
+		t.Errorf("history = %v, want only %v", got, want)
+	}
+
+	served, err = r.RecentlyServed(ctx, 2, 10)
+	if err != nil || len(served) != 1 {
+		t.Errorf("history of other chat = %v, %v, want one image", served, err)
+	}
+}
@@ -3,10 +3,15 @@ package image
 import (
 	"apubot/internal/domain"
 	"apubot/internal/infrastructure/database"
+	"apubot/pkg/custom_errors"
 	"context"
+	"database/sql"
 	"github.com/pkg/errors"
+	"strings"
 )
 
+const fileColumns = "id, name, tg_id, rating, type, last_served_at, serve_count, uploader_id, uploaded_at, deleted_at, hash, source_url, purged"
+
 type Repository struct {
 	db *database.DB
 }
@@ -15,36 +20,490 @@ func New(db *database.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) GetAll(ctx context.Context) (map[string]string, error) {
-	query := "SELECT name, tg_id FROM images"
-	rows, err := r.db.Conn().QueryContext(ctx, query)
+// GetAll returns all images including soft deleted ones
+func (r *Repository) GetAll(ctx context.Context) (map[string]domain.File, error) {
+	query := "SELECT " + fileColumns + " FROM images"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+
+	files, err := scanFiles(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]domain.File, len(files))
+	for _, file := range files {
+		images[file.Name] = file
+	}
+
+	return images, nil
+}
+
+func (r *Repository) SaveImage(ctx context.Context, file domain.File) error {
+	query := "INSERT INTO images (name, tg_id) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET tg_id=excluded.tg_id;"
+	_, err := r.db.ExecContext(ctx, query, file.Name, file.TgID)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// AddImage creates image with tags and returns its ID
+func (r *Repository) AddImage(ctx context.Context, file domain.File, tags []string) (id int64, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	rating := file.Rating
+	if rating == "" {
+		rating = domain.RatingSFW
+	}
+
+	fileType := file.Type
+	if fileType == "" {
+		fileType = domain.TypeByName(file.Name)
+	}
+
+	query := `
+	INSERT INTO images (name, tg_id, rating, type, uploader_id, uploaded_at, hash, source_url)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`
+	err = tx.QueryRowContext(
+		ctx, query, file.Name, file.TgID, rating, fileType, file.UploaderID, file.UploadedAt, file.Hash, file.SourceURL,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	query = "INSERT OR IGNORE INTO image_tags (image_name, tag) VALUES (?, ?)"
+	for _, tag := range tags {
+		_, err = tx.ExecContext(ctx, query, file.Name, tag)
+		if err != nil {
+			return 0, errors.Wrap(err, "can not save tag")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "can not commit transaction")
+	}
+
+	return id, nil
+}
+
+// MarkServed saves last served time and increments serve counter
+func (r *Repository) MarkServed(ctx context.Context, id int64, servedAt int64) error {
+	query := "UPDATE images SET last_served_at = ?, serve_count = serve_count + 1 WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, servedAt, id)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// TopImages returns up to n most served images
+func (r *Repository) TopImages(ctx context.Context, n int) ([]domain.File, error) {
+	query := "SELECT " + fileColumns + ` FROM images
+	WHERE serve_count > 0 AND deleted_at = 0
+	ORDER BY serve_count DESC, id
+	LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, n)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+
+	return scanFiles(rows)
+}
+
+// GetByUploader returns images added by user, oldest first
+func (r *Repository) GetByUploader(ctx context.Context, uploaderID int64) ([]domain.File, error) {
+	query := "SELECT " + fileColumns + " FROM images WHERE uploader_id = ? ORDER BY uploaded_at, id"
+	rows, err := r.db.QueryContext(ctx, query, uploaderID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+
+	return scanFiles(rows)
+}
+
+// scanFiles reads files selected with fileColumns and closes rows
+func scanFiles(rows *sql.Rows) ([]domain.File, error) {
+	defer rows.Close()
+
+	var files []domain.File
+	for rows.Next() {
+		var file domain.File
+		if err := rows.Scan(
+			&file.ID, &file.Name, &file.TgID, &file.Rating, &file.Type,
+			&file.LastServedAt, &file.ServeCount, &file.UploaderID, &file.UploadedAt, &file.DeletedAt, &file.Hash, &file.SourceURL,
+			&file.Purged,
+		); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return files, nil
+}
+
+func (r *Repository) SetRating(ctx context.Context, id int64, rating string) error {
+	query := "UPDATE images SET rating = ? WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, rating, id)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// GetNamesByTags returns names of images having all included tags and none of excluded ones
+func (r *Repository) GetNamesByTags(ctx context.Context, filter domain.TagFilter) ([]string, error) {
+	query := "SELECT name FROM images WHERE deleted_at = 0"
+	args := make([]any, 0, len(filter.Include)+len(filter.Exclude)+1)
+
+	if len(filter.Include) > 0 {
+		query += " AND name IN (SELECT image_name FROM image_tags WHERE tag IN (" + placeholders(len(filter.Include)) + ")" +
+			" GROUP BY image_name HAVING COUNT(DISTINCT tag) = ?)"
+		for _, tag := range filter.Include {
+			args = append(args, tag)
+		}
+		args = append(args, len(filter.Include))
+	}
+
+	if len(filter.Exclude) > 0 {
+		query += " AND name NOT IN (SELECT image_name FROM image_tags WHERE tag IN (" + placeholders(len(filter.Exclude)) + "))"
+		for _, tag := range filter.Exclude {
+			args = append(args, tag)
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not exec query")
 	}
 	defer rows.Close()
 
-	images := make(map[string]string)
+	var names []string
 	for rows.Next() {
-		var name, tgID string
-		if err = rows.Scan(&name, &tgID); err != nil {
+		var name string
+		if err = rows.Scan(&name); err != nil {
 			return nil, errors.Wrap(err, "can not scan row")
 		}
-		images[name] = tgID
+		names = append(names, name)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, errors.Wrap(err, "can not read rows")
 	}
 
-	return images, nil
+	return names, nil
 }
 
-func (r *Repository) SaveImage(ctx context.Context, file domain.File) error {
-	query := "INSERT INTO images (name, tg_id) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET tg_id=excluded.tg_id;"
-	_, err := r.db.Conn().ExecContext(ctx, query, file.Name, file.TgID)
+// CountImages returns number of images, only ones with tag if it is not empty
+func (r *Repository) CountImages(ctx context.Context, tag string) (count int, err error) {
+	query := "SELECT COUNT(*) FROM images WHERE deleted_at = 0"
+	args := []any{}
+
+	if tag != "" {
+		query = `
+		SELECT COUNT(DISTINCT t.image_name) FROM image_tags t
+		JOIN images i ON i.name = t.image_name
+		WHERE t.tag = ? AND i.deleted_at = 0
+		`
+		args = append(args, tag)
+	}
+
+	err = r.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return count, nil
+}
+
+func (r *Repository) GetTags(ctx context.Context, name string) ([]string, error) {
+	query := "SELECT tag FROM image_tags WHERE image_name = ? ORDER BY tag"
+	rows, err := r.db.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return tags, nil
+}
+
+// AddTags adds tags to image, tags it already has are skipped
+func (r *Repository) AddTags(ctx context.Context, name string, tags []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT OR IGNORE INTO image_tags (image_name, tag) VALUES (?, ?)"
+	for _, tag := range tags {
+		_, err = tx.ExecContext(ctx, query, name, tag)
+		if err != nil {
+			return errors.Wrap(err, "can not exec query")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
+
+func (r *Repository) RemoveTag(ctx context.Context, name string, tag string) error {
+	query := "DELETE FROM image_tags WHERE image_name = ? AND tag = ?"
+	_, err := r.db.ExecContext(ctx, query, name, tag)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) GetAllTags(ctx context.Context) ([]string, error) {
+	query := "SELECT DISTINCT tag FROM image_tags ORDER BY tag"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return tags, nil
+}
+
+// GetImageTags returns tags of all images not deleted by image name
+func (r *Repository) GetImageTags(ctx context.Context) (map[string][]string, error) {
+	query := `
+	SELECT t.image_name, t.tag FROM image_tags t
+	JOIN images i ON i.name = t.image_name
+	WHERE i.deleted_at = 0
+	ORDER BY t.tag
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var name, tag string
+		if err = rows.Scan(&name, &tag); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		tags[name] = append(tags[name], tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return tags, nil
+}
+
+// GetTagWeights returns configured tag weights, tags missing in result have default weight
+func (r *Repository) GetTagWeights(ctx context.Context) (map[string]int, error) {
+	query := "SELECT name, weight FROM tags"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	weights := make(map[string]int)
+	for rows.Next() {
+		var (
+			tag    string
+			weight int
+		)
+		if err = rows.Scan(&tag, &weight); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		weights[tag] = weight
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return weights, nil
+}
+
+// SetTagWeight saves tag weight, row is removed for default weight
+func (r *Repository) SetTagWeight(ctx context.Context, tag string, weight int) error {
+	query := "INSERT INTO tags (name, weight) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET weight=excluded.weight"
+	args := []any{tag, weight}
+	if weight == domain.DefaultTagWeight {
+		query = "DELETE FROM tags WHERE name = ?"
+		args = args[:1]
+	}
+
+	_, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// GetByHash returns not deleted image with content hash
+func (r *Repository) GetByHash(ctx context.Context, hash string) (domain.File, error) {
+	query := "SELECT " + fileColumns + " FROM images WHERE hash = ? AND deleted_at = 0 LIMIT 1"
+	rows, err := r.db.QueryContext(ctx, query, hash)
+	if err != nil {
+		return domain.File{}, errors.Wrap(err, "can not exec query")
+	}
+
+	files, err := scanFiles(rows)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	if len(files) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no image with given hash")
+	}
+
+	return files[0], nil
+}
+
+// SetHash saves content hash of image added before hashes were stored
+func (r *Repository) SetHash(ctx context.Context, id int64, hash string) error {
+	query := "UPDATE images SET hash = ? WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, hash, id)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
 
 	return nil
 }
+
+// SoftDeleteImage marks image as deleted, it stays in db until purged
+func (r *Repository) SoftDeleteImage(ctx context.Context, file domain.File, deletedAt int64) error {
+	query := "UPDATE images SET deleted_at = ? WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, deletedAt, file.ID)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// RestoreImage clears deletion mark of image deleted not earlier than deletedSince
+func (r *Repository) RestoreImage(ctx context.Context, id int64, deletedSince int64) (domain.File, error) {
+	query := "UPDATE images SET deleted_at = 0 WHERE id = ? AND deleted_at >= ? AND purged = 0 RETURNING " + fileColumns
+	rows, err := r.db.QueryContext(ctx, query, id, max(deletedSince, 1))
+	if err != nil {
+		return domain.File{}, errors.Wrap(err, "can not exec query")
+	}
+
+	files, err := scanFiles(rows)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	if len(files) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no recently deleted image with given id")
+	}
+
+	return files[0], nil
+}
+
+// GetDeleted returns images deleted before deletedBefore which are not purged yet
+func (r *Repository) GetDeleted(ctx context.Context, deletedBefore int64) ([]domain.File, error) {
+	query := "SELECT " + fileColumns + " FROM images WHERE deleted_at > 0 AND deleted_at < ? AND purged = 0"
+	rows, err := r.db.QueryContext(ctx, query, deletedBefore)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+
+	return scanFiles(rows)
+}
+
+// DeleteImage removes image with its tags and favorites
+func (r *Repository) DeleteImage(ctx context.Context, file domain.File) error {
+	return r.removeImage(ctx, file, "DELETE FROM images WHERE id = ?")
+}
+
+// PurgeImage removes tags and favorites of deleted image and keeps its row marked as purged,
+// so file left in images dir is not registered again by scan
+func (r *Repository) PurgeImage(ctx context.Context, file domain.File) error {
+	return r.removeImage(ctx, file, "UPDATE images SET purged = 1 WHERE id = ?")
+}
+
+// removeImage deletes tags and favorites of image and runs query removing image row in one transaction
+func (r *Repository) removeImage(ctx context.Context, file domain.File, query string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM image_tags WHERE image_name = ?", file.Name)
+	if err != nil {
+		return errors.Wrap(err, "can not delete tags")
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM favorites WHERE image_id = ?", file.ID)
+	if err != nil {
+		return errors.Wrap(err, "can not delete favorites")
+	}
+
+	_, err = tx.ExecContext(ctx, query, file.ID)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can not commit transaction")
+	}
+
+	return nil
+}
+
+// placeholders returns n comma separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,121 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	cfg := &config.Config{
+		DBPath:         filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConns: 1,
+		RequestTimeout: time.Second,
+	}
+
+	db, err := database.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return New(db)
+}
+
+func TestGetByUploader(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	for _, file := range []domain.File{
+		{Name: "late.jpg", TgID: "tg-late", UploaderID: 1, UploadedAt: 300},
+		{Name: "other.jpg", TgID: "tg-other", UploaderID: 2, UploadedAt: 100},
+		{Name: "early.jpg", TgID: "tg-early", UploaderID: 1, UploadedAt: 100},
+		{Name: "same_time.jpg", TgID: "tg-same", UploaderID: 1, UploadedAt: 100},
+	} {
+		if _, err := r.AddImage(ctx, file, nil); err != nil {
+			t.Fatalf("can not add image: %v", err)
+		}
+	}
+
+	// files from images folder have no uploader
+	if err := r.SaveImage(ctx, domain.File{Name: "folder.jpg", TgID: "tg-folder"}); err != nil {
+		t.Fatalf("can not save image: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		uploaderID int64
+		want       []string
+	}{
+		{
+			name:       "oldest first, ties by id",
+			uploaderID: 1,
+			want:       []string{"early.jpg", "same_time.jpg", "late.jpg"},
+		},
+		{
+			name:       "other uploader",
+			uploaderID: 2,
+			want:       []string{"other.jpg"},
+		},
+		{
+			name:       "no uploads",
+			uploaderID: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := r.GetByUploader(ctx, tt.uploaderID)
+			if err != nil {
+				t.Fatalf("GetByUploader() error = %v", err)
+			}
+
+			var names []string
+			for _, file := range files {
+				if file.UploaderID != tt.uploaderID || file.UploadedAt == 0 {
+					t.Errorf("got %+v, want file uploaded by %d", file, tt.uploaderID)
+				}
+				names = append(names, file.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("GetByUploader() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllReadsUploader(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	if _, err := r.AddImage(ctx, domain.File{Name: "cat.jpg", TgID: "tg-cat", UploaderID: 7, UploadedAt: 123}, nil); err != nil {
+		t.Fatalf("can not add image: %v", err)
+	}
+
+	if err := r.SaveImage(ctx, domain.File{Name: "folder.jpg", TgID: "tg-folder"}); err != nil {
+		t.Fatalf("can not save image: %v", err)
+	}
+
+	images, err := r.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+
+	if cat := images["cat.jpg"]; cat.UploaderID != 7 || cat.UploadedAt != 123 || cat.TgID != "tg-cat" {
+		t.Errorf("GetAll() cat.jpg = %+v, want uploaded by 7 at 123", cat)
+	}
+
+	if folder := images["folder.jpg"]; folder.UploaderID != 0 || folder.UploadedAt != 0 {
+		t.Errorf("GetAll() folder.jpg = %+v, want no uploader", folder)
+	}
+}
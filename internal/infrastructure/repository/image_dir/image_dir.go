@@ -0,0 +1,298 @@
+package image_dir
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"apubot/pkg/custom_errors"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type (
+	// Repository serves images straight from images directory.
+	// Tags and ratings are not supported, TG IDs are cached in db by file content hash.
+	Repository struct {
+		cfg    *config.Config
+		db     *database.DB
+		hashes map[string]fileHash
+		mu     sync.Mutex
+	}
+
+	// fileHash lets skip hashing of files not changed since last scan
+	fileHash struct {
+		size    int64
+		modTime time.Time
+		hash    string
+	}
+)
+
+func New(cfg *config.Config, db *database.DB) *Repository {
+	return &Repository{
+		cfg:    cfg,
+		db:     db,
+		hashes: make(map[string]fileHash),
+		mu:     sync.Mutex{},
+	}
+}
+
+func (r *Repository) GetAll(ctx context.Context) (map[string]domain.File, error) {
+	entries, err := os.ReadDir(r.cfg.ImagesDirPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read directory")
+	}
+
+	images := make(map[string]domain.File)
+	for _, entry := range entries {
+		if entry.IsDir() || domain.TypeByName(entry.Name()) == "" {
+			continue
+		}
+
+		file := domain.File{
+			ID:     fileID(entry.Name()),
+			Name:   entry.Name(),
+			Rating: domain.RatingSFW,
+			Type:   domain.TypeByName(entry.Name()),
+		}
+
+		hash, err := r.hash(file.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		file.Hash = hash
+
+		file.TgID, err = r.GetCachedFileID(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		images[file.Name] = file
+	}
+
+	return images, nil
+}
+
+// SaveImage caches TG ID of file, empty TG ID drops cached one
+func (r *Repository) SaveImage(ctx context.Context, file domain.File) error {
+	hash, err := r.hash(file.Name)
+	if err != nil {
+		return err
+	}
+
+	return r.SetCachedFileID(ctx, hash, file.TgID)
+}
+
+// AddImage returns ID of file which already exists in directory, images without local file are not supported
+func (r *Repository) AddImage(ctx context.Context, file domain.File, tags []string) (id int64, err error) {
+	_, err = os.Stat(filepath.Join(r.cfg.ImagesDirPath, file.Name))
+	if err != nil {
+		return 0, errors.Wrap(err, "image must be placed in images directory")
+	}
+
+	return fileID(file.Name), nil
+}
+
+// GetByHash finds nothing, image being added must already be in directory and would be reported as its own duplicate
+func (r *Repository) GetByHash(ctx context.Context, hash string) (domain.File, error) {
+	return domain.File{}, custom_errors.NewNotFound("duplicates are not detected for directory image source")
+}
+
+// SetHash does nothing, hashes of files are computed from their content on each scan
+func (r *Repository) SetHash(ctx context.Context, id int64, hash string) error {
+	return nil
+}
+
+func (r *Repository) SetRating(ctx context.Context, id int64, rating string) error {
+	return errors.New("ratings are not supported for directory image source")
+}
+
+func (r *Repository) AddTags(ctx context.Context, name string, tags []string) error {
+	return errors.New("tags are not supported for directory image source")
+}
+
+func (r *Repository) RemoveTag(ctx context.Context, name string, tag string) error {
+	return errors.New("tags are not supported for directory image source")
+}
+
+// GetNamesByTags returns all names when no tags are required as files have no tags to exclude
+// MarkServed does nothing, served time and count are only kept in memory until next rescan
+func (r *Repository) MarkServed(ctx context.Context, id int64, servedAt int64) error {
+	return nil
+}
+
+// TopImages returns nothing as serve counts are not saved
+func (r *Repository) TopImages(ctx context.Context, n int) ([]domain.File, error) {
+	return nil, nil
+}
+
+// GetByUploader returns nothing as directory images have no uploader
+func (r *Repository) GetByUploader(ctx context.Context, uploaderID int64) ([]domain.File, error) {
+	return nil, nil
+}
+
+func (r *Repository) GetNamesByTags(ctx context.Context, filter domain.TagFilter) ([]string, error) {
+	if len(filter.Include) > 0 {
+		return nil, nil
+	}
+
+	files, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (r *Repository) GetTags(ctx context.Context, name string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *Repository) GetAllTags(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (r *Repository) GetImageTags(ctx context.Context) (map[string][]string, error) {
+	return nil, nil
+}
+
+func (r *Repository) GetTagWeights(ctx context.Context) (map[string]int, error) {
+	return nil, nil
+}
+
+func (r *Repository) SetTagWeight(ctx context.Context, tag string, weight int) error {
+	return errors.New("tags are not supported for directory image source")
+}
+
+func (r *Repository) CountImages(ctx context.Context, tag string) (int, error) {
+	if tag != "" {
+		return 0, nil
+	}
+
+	files, err := r.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(files), nil
+}
+
+func (r *Repository) DeleteImage(ctx context.Context, file domain.File) error {
+	err := os.Remove(filepath.Join(r.cfg.ImagesDirPath, file.Name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "can not remove file")
+	}
+
+	r.mu.Lock()
+	delete(r.hashes, file.Name)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// SoftDeleteImage removes file right away as there is nowhere to keep deletion mark
+func (r *Repository) SoftDeleteImage(ctx context.Context, file domain.File, deletedAt int64) error {
+	return r.DeleteImage(ctx, file)
+}
+
+// PurgeImage removes file as there is no row to keep, files are never left deleted in directory source
+func (r *Repository) PurgeImage(ctx context.Context, file domain.File) error {
+	return r.DeleteImage(ctx, file)
+}
+
+func (r *Repository) RestoreImage(ctx context.Context, id int64, deletedSince int64) (domain.File, error) {
+	return domain.File{}, errors.New("restoring is not supported for directory image source")
+}
+
+// GetDeleted returns nothing as files are removed on deletion
+func (r *Repository) GetDeleted(ctx context.Context, deletedBefore int64) ([]domain.File, error) {
+	return nil, nil
+}
+
+// GetCachedFileID returns TG ID of file uploaded before or empty string
+func (r *Repository) GetCachedFileID(ctx context.Context, hash string) (tgID string, err error) {
+	query := "SELECT tg_id FROM file_id_cache WHERE hash = ?"
+	err = r.db.QueryRowContext(ctx, query, hash).Scan(&tgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "can not get cached file id")
+	}
+
+	return tgID, nil
+}
+
+func (r *Repository) SetCachedFileID(ctx context.Context, hash string, tgID string) error {
+	var err error
+
+	if tgID == "" {
+		_, err = r.db.ExecContext(ctx, "DELETE FROM file_id_cache WHERE hash = ?", hash)
+	} else {
+		query := "INSERT INTO file_id_cache (hash, tg_id) VALUES (?, ?) ON CONFLICT(hash) DO UPDATE SET tg_id=excluded.tg_id"
+		_, err = r.db.ExecContext(ctx, query, hash, tgID)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// hash returns sha256 of file content, files not changed since last call are not read again
+func (r *Repository) hash(name string) (string, error) {
+	fullPath := filepath.Join(r.cfg.ImagesDirPath, name)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", errors.Wrap(err, "can not stat file")
+	}
+
+	r.mu.Lock()
+	cached, ok := r.hashes[name]
+	r.mu.Unlock()
+
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", errors.Wrap(err, "can not open file")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "can not read file")
+	}
+
+	cached = fileHash{size: info.Size(), modTime: info.ModTime(), hash: hex.EncodeToString(h.Sum(nil))}
+
+	r.mu.Lock()
+	r.hashes[name] = cached
+	r.mu.Unlock()
+
+	return cached.hash, nil
+}
+
+// fileID derives stable ID from file name so it survives restarts
+func fileID(name string) int64 {
+	return int64(crc32.ChecksumIEEE([]byte(name)))
+}
@@ -3,8 +3,18 @@ package repository
 import (
 	"apubot/internal/config"
 	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository/chat"
+	"apubot/internal/infrastructure/repository/cooldown"
+	"apubot/internal/infrastructure/repository/favorite"
+	"apubot/internal/infrastructure/repository/feedback"
+	"apubot/internal/infrastructure/repository/history"
 	"apubot/internal/infrastructure/repository/image"
+	"apubot/internal/infrastructure/repository/image_dir"
+	"apubot/internal/infrastructure/repository/source"
+	"apubot/internal/infrastructure/repository/state"
+	"apubot/internal/infrastructure/repository/stats"
 	"apubot/internal/infrastructure/repository/subscriprion"
+	"apubot/internal/infrastructure/repository/suggestion"
 )
 
 type (
@@ -15,13 +25,33 @@ type (
 
 	Repositories struct {
 		Image        *image.Repository
+		ImageDir     *image_dir.Repository
 		Subscription *subscriprion.Repository
+		Cooldown     *cooldown.Repository
+		Chat         *chat.Repository
+		Stats        *stats.Repository
+		Favorite     *favorite.Repository
+		Feedback     *feedback.Repository
+		State        *state.Repository
+		Suggestion   *suggestion.Repository
+		Source       *source.Repository
+		History      *history.Repository
 	}
 )
 
 func New(p *InitParams) *Repositories {
 	return &Repositories{
 		Image:        image.New(p.DB),
+		ImageDir:     image_dir.New(p.Config, p.DB),
 		Subscription: subscriprion.New(p.DB),
+		Cooldown:     cooldown.New(p.DB),
+		Chat:         chat.New(p.DB),
+		Stats:        stats.New(p.DB),
+		Favorite:     favorite.New(p.DB),
+		Feedback:     feedback.New(p.DB),
+		State:        state.New(p.DB),
+		Suggestion:   suggestion.New(p.DB),
+		Source:       source.New(p.DB),
+		History:      history.New(p.DB),
 	}
 }
@@ -0,0 +1,64 @@
+package source
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) GetAll(ctx context.Context) ([]domain.SourceMessage, error) {
+	query := "SELECT image_id, channel_id, message_id FROM source_messages"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	var messages []domain.SourceMessage
+	for rows.Next() {
+		var msg domain.SourceMessage
+		if err = rows.Scan(&msg.ImageID, &msg.ChannelID, &msg.MessageID); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return messages, nil
+}
+
+// Save stores source message of image, the previous one is replaced
+func (r *Repository) Save(ctx context.Context, msg domain.SourceMessage) error {
+	query := `
+	INSERT INTO source_messages (image_id, channel_id, message_id) VALUES (?, ?, ?)
+	ON CONFLICT(image_id) DO UPDATE SET channel_id=excluded.channel_id, message_id=excluded.message_id
+	`
+	_, err := r.db.ExecContext(ctx, query, msg.ImageID, msg.ChannelID, msg.MessageID)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, imageId int64) error {
+	query := "DELETE FROM source_messages WHERE image_id = ?"
+	_, err := r.db.ExecContext(ctx, query, imageId)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Get(ctx context.Context, key string) (v domain.StateValue, err error) {
+	query := "SELECT key, value, updated_at FROM bot_state WHERE key = ?"
+	err = r.db.QueryRowContext(ctx, query, key).Scan(&v.Key, &v.Value, &v.UpdatedAt)
+	if err != nil {
+		return v, errors.Wrap(err, "can not get state value")
+	}
+
+	return v, nil
+}
+
+func (r *Repository) Set(ctx context.Context, v domain.StateValue) error {
+	query := `
+	INSERT INTO bot_state (key, value, updated_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at
+	`
+	_, err := r.db.ExecContext(ctx, query, v.Key, v.Value, v.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateUser(ctx context.Context, userId int64, firstUsedAt int64) error {
+	query := "INSERT INTO usage_stats (user_id, first_used_at) VALUES (?, ?) ON CONFLICT(user_id) DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, userId, firstUsedAt)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) IncrementImages(ctx context.Context, userId int64, now int64) error {
+	query := `
+	INSERT INTO usage_stats (user_id, images_requested, first_used_at)
+	VALUES (?, 1, ?)
+	ON CONFLICT(user_id) DO UPDATE SET images_requested=images_requested + 1
+	`
+	_, err := r.db.ExecContext(ctx, query, userId, now)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, userId int64) (stats domain.UsageStats, err error) {
+	query := "SELECT user_id, images_requested, first_used_at FROM usage_stats WHERE user_id = ?"
+	err = r.db.QueryRowContext(ctx, query, userId).Scan(&stats.UserID, &stats.ImagesRequested, &stats.FirstUsedAt)
+	if err != nil {
+		return stats, errors.Wrap(err, "can not get stats")
+	}
+
+	return stats, nil
+}
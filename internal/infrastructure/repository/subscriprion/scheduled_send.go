@@ -0,0 +1,62 @@
+package subscriprion
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"github.com/pkg/errors"
+)
+
+func (r *Repository) GetAllScheduled(ctx context.Context) (sends []domain.ScheduledSend, err error) {
+	query := "SELECT id, chat_id, send_at FROM scheduled_sends ORDER BY send_at"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var send domain.ScheduledSend
+
+		if err = rows.Scan(&send.ID, &send.ChatID, &send.SendAt); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+
+		sends = append(sends, send)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return sends, nil
+}
+
+func (r *Repository) CountScheduledByChat(ctx context.Context, chatId int64) (count int, err error) {
+	query := "SELECT COUNT(*) FROM scheduled_sends WHERE chat_id = ?"
+	err = r.db.QueryRowContext(ctx, query, chatId).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return count, nil
+}
+
+func (r *Repository) CreateScheduled(ctx context.Context, send domain.ScheduledSend) (id int64, err error) {
+	query := "INSERT INTO scheduled_sends (chat_id, send_at) VALUES (?, ?) RETURNING id"
+	err = r.db.QueryRowContext(ctx, query, send.ChatID, send.SendAt).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return id, nil
+}
+
+func (r *Repository) DeleteScheduled(ctx context.Context, id int64) error {
+	query := "DELETE FROM scheduled_sends WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
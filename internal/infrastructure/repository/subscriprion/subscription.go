@@ -15,19 +15,34 @@ func New(db *database.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error) {
-	query := "SELECT chat_id, created_at, period FROM subscription WHERE chat_id = ?"
-	err = r.db.Conn().QueryRowContext(ctx, query, chatId).Scan(&sub.ChatId, &sub.CreatedAt, &sub.Period)
+func (r *Repository) GetByChat(ctx context.Context, chatId int64) (subs []domain.Subscription, err error) {
+	query := "SELECT id, chat_id, created_at, period, paused FROM subscription WHERE chat_id = ? ORDER BY period"
+	rows, err := r.db.QueryContext(ctx, query, chatId)
 	if err != nil {
-		return sub, errors.Wrap(err, "can not get subscription")
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sub domain.Subscription
+
+		if err = rows.Scan(&sub.ID, &sub.ChatId, &sub.CreatedAt, &sub.Period, &sub.Paused); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+
+		subs = append(subs, sub)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
 	}
 
-	return sub, nil
+	return subs, nil
 }
 
 func (r *Repository) GetAll(ctx context.Context) (subs []domain.Subscription, err error) {
-	query := "SELECT chat_id, created_at, period FROM subscription"
-	rows, err := r.db.Conn().QueryContext(ctx, query)
+	query := "SELECT id, chat_id, created_at, period, paused FROM subscription"
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, errors.Wrap(err, "can not exec query")
 	}
@@ -36,7 +51,7 @@ func (r *Repository) GetAll(ctx context.Context) (subs []domain.Subscription, er
 	for rows.Next() {
 		var sub domain.Subscription
 
-		if err = rows.Scan(&sub.ChatId, &sub.CreatedAt, &sub.Period); err != nil {
+		if err = rows.Scan(&sub.ID, &sub.ChatId, &sub.CreatedAt, &sub.Period, &sub.Paused); err != nil {
 			return nil, errors.Wrap(err, "can not scan row")
 		}
 
@@ -50,13 +65,72 @@ func (r *Repository) GetAll(ctx context.Context) (subs []domain.Subscription, er
 	return subs, nil
 }
 
-func (r *Repository) Create(ctx context.Context, sub domain.Subscription) error {
+// CountActiveByChat returns number of not paused chat subscriptions
+func (r *Repository) CountActiveByChat(ctx context.Context, chatId int64) (count int, err error) {
+	query := "SELECT COUNT(*) FROM subscription WHERE chat_id = ? AND paused = 0"
+	err = r.db.QueryRowContext(ctx, query, chatId).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return count, nil
+}
+
+// CountByPeriod returns number of active subscriptions grouped by period
+func (r *Repository) CountByPeriod(ctx context.Context) (counts []domain.SubscriptionCount, err error) {
+	query := "SELECT period, COUNT(*) FROM subscription WHERE paused = 0 GROUP BY period ORDER BY period"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not exec query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count domain.SubscriptionCount
+
+		if err = rows.Scan(&count.Period, &count.Count); err != nil {
+			return nil, errors.Wrap(err, "can not scan row")
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read rows")
+	}
+
+	return counts, nil
+}
+
+func (r *Repository) Create(ctx context.Context, sub domain.Subscription) (id int64, err error) {
 	query := `
 	INSERT INTO subscription (chat_id, created_at, period)
 	VALUES (?, ?, ?)
-	ON CONFLICT(chat_id) DO UPDATE SET created_at=excluded.created_at, period=excluded.period
+	ON CONFLICT(chat_id, period) DO UPDATE SET created_at=excluded.created_at, paused=0
+	RETURNING id
 	`
-	_, err := r.db.Conn().ExecContext(ctx, query, sub.ChatId, sub.CreatedAt, sub.Period)
+	err = r.db.QueryRowContext(ctx, query, sub.ChatId, sub.CreatedAt, sub.Period).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return id, nil
+}
+
+func (r *Repository) Update(ctx context.Context, sub domain.Subscription) error {
+	query := "UPDATE subscription SET created_at = ?, paused = ? WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, sub.CreatedAt, sub.Paused, sub.ID)
+	if err != nil {
+		return errors.Wrap(err, "can not exec query")
+	}
+
+	return nil
+}
+
+// Deactivate pauses all chat subscriptions
+func (r *Repository) Deactivate(ctx context.Context, chatId int64) error {
+	query := "UPDATE subscription SET paused = 1 WHERE chat_id = ?"
+	_, err := r.db.ExecContext(ctx, query, chatId)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
@@ -64,9 +138,9 @@ func (r *Repository) Create(ctx context.Context, sub domain.Subscription) error
 	return nil
 }
 
-func (r *Repository) Delete(ctx context.Context, chatId int64) error {
-	query := "DELETE FROM subscription WHERE chat_id = ?"
-	_, err := r.db.Conn().ExecContext(ctx, query, chatId)
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	query := "DELETE FROM subscription WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return errors.Wrap(err, "can not exec query")
 	}
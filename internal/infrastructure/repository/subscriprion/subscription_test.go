@@ -0,0 +1,151 @@
+package subscriprion
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	cfg := &config.Config{
+		DBPath:         filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConns: 1,
+		RequestTimeout: time.Second,
+	}
+
+	db, err := database.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return New(db)
+}
+
+func TestCountByPeriod(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	hour, day := int(time.Hour.Seconds()), int((24 * time.Hour).Seconds())
+
+	for _, sub := range []domain.Subscription{
+		{ChatId: 1, Period: day},
+		{ChatId: 1, Period: hour},
+		{ChatId: 2, Period: hour},
+		{ChatId: 3, Period: hour},
+		{ChatId: 4, Period: day},
+	} {
+		if _, err := r.Create(ctx, sub); err != nil {
+			t.Fatalf("can not create subscription: %v", err)
+		}
+	}
+
+	// paused subscriptions are not counted
+	if err := r.Deactivate(ctx, 4); err != nil {
+		t.Fatalf("can not deactivate chat: %v", err)
+	}
+
+	counts, err := r.CountByPeriod(ctx)
+	if err != nil {
+		t.Fatalf("can not count subscriptions: %v", err)
+	}
+
+	want := []domain.SubscriptionCount{{Period: hour, Count: 3}, {Period: day, Count: 1}}
+	if !slices.Equal(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+func TestCreateKeepsOneSubscriptionPerPeriod(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	hour := int(time.Hour.Seconds())
+
+	first, err := r.Create(ctx, domain.Subscription{ChatId: 1, Period: hour, CreatedAt: 1})
+	if err != nil {
+		t.Fatalf("can not create subscription: %v", err)
+	}
+
+	if err = r.Deactivate(ctx, 1); err != nil {
+		t.Fatalf("can not deactivate chat: %v", err)
+	}
+
+	// unique chat and period make repeated create restart existing subscription
+	second, err := r.Create(ctx, domain.Subscription{ChatId: 1, Period: hour, CreatedAt: 2})
+	if err != nil {
+		t.Fatalf("can not create subscription again: %v", err)
+	}
+
+	if second != first {
+		t.Errorf("repeated create returned ID %d, want existing %d", second, first)
+	}
+
+	subs, err := r.GetByChat(ctx, 1)
+	if err != nil {
+		t.Fatalf("can not get subscriptions: %v", err)
+	}
+
+	if len(subs) != 1 || subs[0].CreatedAt != 2 || subs[0].Paused {
+		t.Errorf("saved %+v, want one resumed subscription with new creation time", subs)
+	}
+}
+
+func TestCountByPeriodEmpty(t *testing.T) {
+	r := newTestRepository(t)
+
+	counts, err := r.CountByPeriod(context.Background())
+	if err != nil {
+		t.Fatalf("can not count subscriptions: %v", err)
+	}
+
+	if len(counts) != 0 {
+		t.Errorf("counts = %v, want none", counts)
+	}
+}
+
+func TestCountActiveByChat(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	hour := int(time.Hour.Seconds())
+
+	for _, sub := range []domain.Subscription{
+		{ChatId: 1, Period: hour},
+		{ChatId: 1, Period: 2 * hour},
+		{ChatId: 2, Period: hour},
+	} {
+		if _, err := r.Create(ctx, sub); err != nil {
+			t.Fatalf("can not create subscription: %v", err)
+		}
+	}
+
+	count, err := r.CountActiveByChat(ctx, 1)
+	if err != nil || count != 2 {
+		t.Fatalf("CountActiveByChat(1) = %d, %v, want 2", count, err)
+	}
+
+	// paused subscriptions are not counted
+	if err = r.Deactivate(ctx, 1); err != nil {
+		t.Fatalf("can not deactivate chat: %v", err)
+	}
+
+	count, err = r.CountActiveByChat(ctx, 1)
+	if err != nil || count != 0 {
+		t.Errorf("CountActiveByChat(1) after pause = %d, %v, want 0", count, err)
+	}
+
+	count, err = r.CountActiveByChat(ctx, 2)
+	if err != nil || count != 1 {
+		t.Errorf("CountActiveByChat(2) = %d, %v, want 1", count, err)
+	}
+}
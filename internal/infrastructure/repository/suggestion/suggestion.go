@@ -0,0 +1,97 @@
+package suggestion
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	"context"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// tags are stored comma separated, valid tags never contain commas
+const suggestionColumns = "id, name, tg_id, type, tags, user_id, chat_id, created_at"
+
+type Repository struct {
+	db *database.DB
+}
+
+func New(db *database.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create saves suggestion, sql.ErrNoRows is returned if the same image is already pending
+func (r *Repository) Create(ctx context.Context, s domain.Suggestion) (id int64, err error) {
+	query := `
+	INSERT INTO pending_images (name, tg_id, type, tags, user_id, chat_id, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO NOTHING
+	RETURNING id
+	`
+	err = r.db.QueryRowContext(
+		ctx, query, s.Name, s.TgID, s.Type, strings.Join(s.Tags, ","), s.UserID, s.ChatID, s.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return id, nil
+}
+
+// Next returns the oldest pending suggestion
+func (r *Repository) Next(ctx context.Context) (s domain.Suggestion, err error) {
+	query := "SELECT " + suggestionColumns + " FROM pending_images ORDER BY id LIMIT 1"
+
+	s, err = scanSuggestion(r.db.QueryRowContext(ctx, query))
+	if err != nil {
+		return s, errors.Wrap(err, "can not exec query")
+	}
+
+	return s, nil
+}
+
+// Take removes suggestion from queue and returns it, sql.ErrNoRows is returned if it was already reviewed
+func (r *Repository) Take(ctx context.Context, id int64) (s domain.Suggestion, err error) {
+	query := "DELETE FROM pending_images WHERE id = ? RETURNING " + suggestionColumns
+
+	s, err = scanSuggestion(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return s, errors.Wrap(err, "can not exec query")
+	}
+
+	return s, nil
+}
+
+func (r *Repository) Count(ctx context.Context) (count int, err error) {
+	query := "SELECT COUNT(*) FROM pending_images"
+	err = r.db.QueryRowContext(ctx, query).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return count, nil
+}
+
+func (r *Repository) CountByUser(ctx context.Context, userID int64) (count int, err error) {
+	query := "SELECT COUNT(*) FROM pending_images WHERE user_id = ?"
+	err = r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not exec query")
+	}
+
+	return count, nil
+}
+
+func scanSuggestion(row *database.Row) (s domain.Suggestion, err error) {
+	var tags string
+
+	err = row.Scan(&s.ID, &s.Name, &s.TgID, &s.Type, &tags, &s.UserID, &s.ChatID, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	if tags != "" {
+		s.Tags = strings.Split(tags, ",")
+	}
+
+	return s, nil
+}
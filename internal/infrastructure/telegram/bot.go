@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"apubot/internal/config"
+	"apubot/pkg/utils/ratelimit"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/patrickmn/go-cache"
+	"time"
+)
+
+// chatBucketTTL is how long limiter of idle chat is kept
+const chatBucketTTL = 10 * time.Minute
+
+// Bot funnels outgoing requests through global and per chat rate limits,
+// callers block until request fits into limits. Other API methods are used as is.
+type Bot struct {
+	*tgbotapi.BotAPI
+	cfg    *config.Config
+	global *ratelimit.Bucket
+	chats  *cache.Cache
+}
+
+func New(cfg *config.Config, api *tgbotapi.BotAPI) *Bot {
+	return &Bot{
+		BotAPI: api,
+		cfg:    cfg,
+		global: ratelimit.NewBucket(cfg.SendRateLimit, max(1, int(cfg.SendRateLimit))),
+		chats:  cache.New(chatBucketTTL, chatBucketTTL),
+	}
+}
+
+func (b *Bot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	chatID := chatIDOf(c)
+	b.wait(chatID)
+
+	res, err := b.BotAPI.Send(c)
+	b.handleFlood(chatID, err)
+
+	return res, err
+}
+
+func (b *Bot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	chatID := chatIDOf(c)
+	b.wait(chatID)
+
+	res, err := b.BotAPI.Request(c)
+	b.handleFlood(chatID, err)
+
+	return res, err
+}
+
+func (b *Bot) SendMediaGroup(c tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	b.wait(c.ChatID)
+
+	res, err := b.BotAPI.SendMediaGroup(c)
+	b.handleFlood(c.ChatID, err)
+
+	return res, err
+}
+
+// wait blocks until request to chat is allowed, 0 chat ID means request is not sent to chat
+func (b *Bot) wait(chatID int64) {
+	wait := b.global.Reserve()
+
+	if chatID != 0 {
+		wait = max(wait, b.chatBucket(chatID).Reserve())
+	}
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (b *Bot) chatBucket(chatID int64) *ratelimit.Bucket {
+	key := fmt.Sprint(chatID)
+
+	if bucket, ok := b.chats.Get(key); ok {
+		// prolong lifetime of active chat limiter
+		b.chats.SetDefault(key, bucket)
+
+		return bucket.(*ratelimit.Bucket)
+	}
+
+	bucket := ratelimit.NewBucket(b.cfg.ChatSendRateLimit, b.cfg.ChatSendBurst)
+
+	// another goroutine may have created limiter meanwhile
+	if err := b.chats.Add(key, bucket, cache.DefaultExpiration); err != nil {
+		if existing, ok := b.chats.Get(key); ok {
+			return existing.(*ratelimit.Bucket)
+		}
+	}
+
+	return bucket
+}
+
+// handleFlood pauses sends to chat for time requested by Telegram flood control
+func (b *Bot) handleFlood(chatID int64, err error) {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.RetryAfter == 0 {
+		return
+	}
+
+	retryAfter := time.Duration(tgErr.RetryAfter) * time.Second
+
+	if chatID == 0 {
+		b.global.Pause(retryAfter)
+
+		return
+	}
+
+	b.chatBucket(chatID).Pause(retryAfter)
+}
+
+// chatIDOf returns chat request is sent to, 0 if it is unknown
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID
+	case tgbotapi.PhotoConfig:
+		return c.ChatID
+	case tgbotapi.AnimationConfig:
+		return c.ChatID
+	case tgbotapi.DocumentConfig:
+		return c.ChatID
+	case tgbotapi.ForwardConfig:
+		return c.ChatID
+	case tgbotapi.ChatActionConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageMediaConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageCaptionConfig:
+		return c.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return c.ChatID
+	}
+
+	return 0
+}
@@ -0,0 +1,145 @@
+package telegram
+
+import (
+	"apubot/internal/config"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestBot creates bot talking to stub API, sendMessage fails with flood error while flood is set
+func newTestBot(t *testing.T, cfg *config.Config, flood *atomic.Bool) *Bot {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`)
+		case flood.Load():
+			fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":1}}`)
+		default:
+			fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1}}}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatalf("can not create bot api: %v", err)
+	}
+
+	return New(cfg, api)
+}
+
+func timeSend(t *testing.T, b *Bot, chatID int64) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+
+	_, err := b.Send(tgbotapi.NewMessage(chatID, "hi"))
+	if err != nil && !strings.Contains(err.Error(), "Too Many Requests") {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	return time.Since(start)
+}
+
+func TestBotLimitsSendsPerChat(t *testing.T) {
+	b := newTestBot(t, &config.Config{SendRateLimit: 1000, ChatSendRateLimit: 5, ChatSendBurst: 2}, &atomic.Bool{})
+
+	for i := 0; i < 2; i++ {
+		if d := timeSend(t, b, 1); d > 100*time.Millisecond {
+			t.Fatalf("send %d of chat burst took %s", i, d)
+		}
+	}
+
+	if d := timeSend(t, b, 1); d < 150*time.Millisecond {
+		t.Errorf("send over chat burst took %s, want it to wait about 200ms", d)
+	}
+
+	// limit of one chat does not slow down others
+	if d := timeSend(t, b, 2); d > 100*time.Millisecond {
+		t.Errorf("send to other chat took %s", d)
+	}
+}
+
+func TestBotLimitsSendsGlobally(t *testing.T) {
+	b := newTestBot(t, &config.Config{SendRateLimit: 5, ChatSendRateLimit: 1000, ChatSendBurst: 1000}, &atomic.Bool{})
+
+	start := time.Now()
+	for chatID := int64(1); chatID <= 7; chatID++ {
+		timeSend(t, b, chatID)
+	}
+
+	// burst of 5 and two more sends spread by 200ms
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("7 sends to different chats took %s, want global limit to spread them", d)
+	}
+}
+
+func TestBotPausesChatOnFloodError(t *testing.T) {
+	var flood atomic.Bool
+	b := newTestBot(t, &config.Config{SendRateLimit: 1000, ChatSendRateLimit: 1000, ChatSendBurst: 1000}, &flood)
+
+	flood.Store(true)
+	timeSend(t, b, 1)
+	flood.Store(false)
+
+	if d := timeSend(t, b, 1); d < 900*time.Millisecond {
+		t.Errorf("send after flood error took %s, want it to wait retry_after", d)
+	}
+
+	if d := timeSend(t, b, 2); d > 100*time.Millisecond {
+		t.Errorf("send to other chat took %s, flood pause must be per chat", d)
+	}
+}
+
+func TestChatIDOf(t *testing.T) {
+	tests := []struct {
+		name string
+		c    tgbotapi.Chattable
+		want int64
+	}{
+		{name: "message", c: tgbotapi.NewMessage(1, "hi"), want: 1},
+		{name: "photo", c: tgbotapi.NewPhoto(2, tgbotapi.FileID("cat")), want: 2},
+		{name: "animation", c: tgbotapi.NewAnimation(3, tgbotapi.FileID("cat")), want: 3},
+		{name: "document", c: tgbotapi.NewDocument(4, tgbotapi.FileID("cat")), want: 4},
+		{name: "forward", c: tgbotapi.NewForward(5, -100, 42), want: 5},
+		{name: "chat action", c: tgbotapi.NewChatAction(6, tgbotapi.ChatTyping), want: 6},
+		{name: "edit text", c: tgbotapi.NewEditMessageText(7, 1, "hi"), want: 7},
+		{name: "edit caption", c: tgbotapi.NewEditMessageCaption(8, 1, "hi"), want: 8},
+		{name: "delete", c: tgbotapi.NewDeleteMessage(9, 1), want: 9},
+		{name: "not sent to chat", c: tgbotapi.NewCallback("query", "ok"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chatIDOf(tt.c); got != tt.want {
+				t.Errorf("chatIDOf() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotLimitsForwardsPerChat(t *testing.T) {
+	b := newTestBot(t, &config.Config{SendRateLimit: 1000, ChatSendRateLimit: 5, ChatSendBurst: 1}, &atomic.Bool{})
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+
+		if _, err := b.Send(tgbotapi.NewForward(1, -100, 42)); err != nil {
+			t.Fatalf("forward failed: %v", err)
+		}
+
+		if d := time.Since(start); i == 1 && d < 150*time.Millisecond {
+			t.Errorf("forward over chat burst took %s, want it to wait about 200ms", d)
+		}
+	}
+}
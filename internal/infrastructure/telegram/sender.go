@@ -0,0 +1,16 @@
+package telegram
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Sender is part of Bot API used by handlers, so they do not depend on concrete bot
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	SendMediaGroup(c tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error)
+	GetChatMember(c tgbotapi.GetChatMemberConfig) (tgbotapi.ChatMember, error)
+	GetFileDirectURL(fileID string) (string, error)
+}
+
+var _ Sender = (*Bot)(nil)
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"apubot/pkg/logger"
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "peepobot"
+
+var (
+	CommandsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_received_total",
+		Help:      "Number of received commands.",
+	}, []string{"command"})
+
+	ImagesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "images_sent_total",
+		Help:      "Number of successfully sent images.",
+	})
+
+	SendErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_send_errors_total",
+		Help:      "Number of failed image sends.",
+	})
+
+	CooldownRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cooldown_rejections_total",
+		Help:      "Number of commands rejected due to cooldown.",
+	})
+
+	ImageCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_cache_hits_total",
+		Help:      "Number of image metadata lookups served from cache.",
+	})
+
+	ImageCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_cache_misses_total",
+		Help:      "Number of image metadata lookups which hit the database.",
+	})
+
+	ImageFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_fetch_duration_seconds",
+		Help:      "Time spent to fetch and deliver an image.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent running db queries by repository method.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+)
+
+type Server struct {
+	log logger.Logger
+	srv *http.Server
+}
+
+// NewServer creates metrics HTTP server, returns nil if addr is empty
+func NewServer(addr string, log logger.Logger) *Server {
+	if addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &Server{
+		log: log,
+		srv: &http.Server{Addr: addr, Handler: mux},
+	}
+}
+
+func (s *Server) Start() {
+	go func() {
+		err := s.srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("Error serving metrics", "err", err)
+		}
+	}()
+
+	s.log.Info("Serving metrics", "addr", s.srv.Addr)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
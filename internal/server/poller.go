@@ -0,0 +1,102 @@
+package server
+
+import (
+	"apubot/pkg/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+	"time"
+)
+
+// disconnectFailures is number of failed polls in a row after which connection is reported lost
+const disconnectFailures = 3
+
+// poller long polls Telegram for updates. Unlike channel of tgbotapi it does not give up on errors,
+// failed requests are retried with backoff until poller is stopped, so bot recovers from connection drops.
+type poller struct {
+	getUpdates func(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error)
+	config     tgbotapi.UpdateConfig
+	log        logger.Logger
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newPoller(
+	getUpdates func(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error),
+	config tgbotapi.UpdateConfig,
+	log logger.Logger,
+) *poller {
+	return &poller{
+		getUpdates: getUpdates,
+		config:     config,
+		log:        log,
+		baseDelay:  reconnectBaseDelay,
+		maxDelay:   reconnectMaxDelay,
+		stop:       make(chan struct{}),
+	}
+}
+
+// run sends received updates to channel until poller is stopped, channel is closed afterwards
+func (p *poller) run(updates chan<- tgbotapi.Update) {
+	defer close(updates)
+
+	config := p.config
+	delay := p.baseDelay
+	failures := 0
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		batch, err := p.getUpdates(config)
+		if err != nil {
+			failures++
+			if failures == disconnectFailures {
+				p.log.Error("Connection to Telegram lost, reconnecting", "err", err)
+			} else {
+				p.log.Warn("Error getting updates, retrying", "delay", delay, "err", err)
+			}
+
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, p.maxDelay)
+
+			continue
+		}
+
+		if failures >= disconnectFailures {
+			p.log.Info("Connection to Telegram restored", "failed_polls", failures)
+		}
+
+		failures = 0
+		delay = p.baseDelay
+
+		for _, update := range batch {
+			// next request confirms received updates, so Telegram does not send them again
+			if update.UpdateID >= config.Offset {
+				config.Offset = update.UpdateID + 1
+			}
+
+			select {
+			case updates <- update:
+			case <-p.stop:
+				return
+			}
+		}
+	}
+}
+
+// Stop makes run return, request in progress is abandoned and its updates are received again after restart
+func (p *poller) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeUpdates returns scripted results of getUpdates calls and remembers requested offsets
+type fakeUpdates struct {
+	mu      sync.Mutex
+	results []func() ([]tgbotapi.Update, error)
+	offsets []int
+}
+
+func (f *fakeUpdates) get(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.offsets = append(f.offsets, config.Offset)
+
+	if len(f.results) == 0 {
+		// long poll without new updates
+		time.Sleep(time.Millisecond)
+
+		return nil, nil
+	}
+
+	res := f.results[0]
+	f.results = f.results[1:]
+
+	return res()
+}
+
+func (f *fakeUpdates) calls() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]int(nil), f.offsets...)
+}
+
+func fail() ([]tgbotapi.Update, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+func updates(ids ...int) func() ([]tgbotapi.Update, error) {
+	return func() ([]tgbotapi.Update, error) {
+		res := make([]tgbotapi.Update, len(ids))
+		for i, id := range ids {
+			res[i] = tgbotapi.Update{UpdateID: id}
+		}
+
+		return res, nil
+	}
+}
+
+func receive(t *testing.T, ch <-chan tgbotapi.Update) tgbotapi.Update {
+	t.Helper()
+
+	select {
+	case update, ok := <-ch:
+		if !ok {
+			t.Fatal("updates channel closed")
+		}
+
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+	}
+
+	return tgbotapi.Update{}
+}
+
+func TestPollerRecoversAfterFailures(t *testing.T) {
+	fake := &fakeUpdates{results: []func() ([]tgbotapi.Update, error){
+		updates(10),
+		fail, fail, fail, fail,
+		updates(11, 12),
+	}}
+
+	p := newPoller(fake.get, tgbotapi.NewUpdate(10), discardLogger())
+	p.baseDelay = time.Millisecond
+	p.maxDelay = 4 * time.Millisecond
+
+	ch := make(chan tgbotapi.Update)
+	go p.run(ch)
+	defer p.Stop()
+
+	for _, want := range []int{10, 11, 12} {
+		if got := receive(t, ch).UpdateID; got != want {
+			t.Fatalf("got update %d, want %d", got, want)
+		}
+	}
+
+	offsets := fake.calls()
+	if len(offsets) < 6 {
+		t.Fatalf("got %d polls, want at least 6", len(offsets))
+	}
+
+	// failed polls are retried from the same offset, received updates are confirmed by the next one
+	want := []int{10, 11, 11, 11, 11, 11}
+	for i, offset := range want {
+		if offsets[i] != offset {
+			t.Errorf("poll %d used offset %d, want %d", i, offsets[i], offset)
+		}
+	}
+}
+
+func TestPollerBacksOffInsteadOfBusyLooping(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	getUpdates := func(tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+
+		return fail()
+	}
+
+	p := newPoller(getUpdates, tgbotapi.NewUpdate(0), discardLogger())
+	p.baseDelay = 10 * time.Millisecond
+	p.maxDelay = 20 * time.Millisecond
+
+	ch := make(chan tgbotapi.Update)
+	go p.run(ch)
+
+	time.Sleep(100 * time.Millisecond)
+	p.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 10ms, 20ms, 20ms... delays fit at most 6 calls into 100ms
+	if calls < 2 || calls > 7 {
+		t.Errorf("got %d polls in 100ms, want retries with backoff", calls)
+	}
+}
+
+func TestPollerStopClosesChannel(t *testing.T) {
+	fake := &fakeUpdates{}
+
+	p := newPoller(fake.get, tgbotapi.NewUpdate(0), discardLogger())
+
+	ch := make(chan tgbotapi.Update)
+	go p.run(ch)
+
+	p.Stop()
+	// stopping twice must not panic
+	p.Stop()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("got update after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after stop")
+	}
+}
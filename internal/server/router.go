@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+type (
+	CommandHandlerFunc  func(ctx context.Context, message *tgbotapi.Message)
+	CallbackHandlerFunc func(ctx context.Context, query *tgbotapi.CallbackQuery)
+
+	Command struct {
+		Name string
+		// Usage describes command arguments in help, e.g. "<count>"
+		Usage       string
+		Description string
+		AdminOnly   bool
+		// Cooldown overrides shared command cooldown, zero means shared one is used
+		Cooldown time.Duration
+		// CooldownScale makes own cooldown multiple of global one, so it follows config reloads
+		CooldownScale int
+		// Hidden commands are not listed in help
+		Hidden bool
+		// LongRunning commands are not limited by request timeout
+		LongRunning bool
+		// NoCooldown commands are neither rejected by cooldown nor start it
+		NoCooldown bool
+		Handler    CommandHandlerFunc
+	}
+
+	CommandRouter struct {
+		commands map[string]Command
+		order    []string
+		// aliases maps alias to name of registered command
+		aliases map[string]string
+	}
+
+	Callback struct {
+		Prefix string
+		// Cooldown limits how often button can be pressed, zero means no limit
+		Cooldown time.Duration
+		Handler  CallbackHandlerFunc
+	}
+
+	// CallbackRouter dispatches callback queries by data prefix
+	CallbackRouter struct {
+		callbacks map[string]Callback
+		prefixes  []string
+	}
+)
+
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{
+		commands: make(map[string]Command),
+		aliases:  make(map[string]string),
+	}
+}
+
+// Register adds command to router, command with the same name is replaced
+func (r *CommandRouter) Register(cmd Command) {
+	if _, ok := r.commands[cmd.Name]; !ok {
+		r.order = append(r.order, cmd.Name)
+	}
+
+	r.commands[cmd.Name] = cmd
+}
+
+// SetAliases replaces command aliases, aliases may point to other aliases.
+// Aliases shadowing commands, pointing to unknown commands or forming cycle are rejected.
+func (r *CommandRouter) SetAliases(aliases map[string]string) error {
+	resolved := make(map[string]string, len(aliases))
+
+	for alias := range aliases {
+		if _, ok := r.commands[alias]; ok {
+			return errors.Errorf("alias %q shadows command with the same name", alias)
+		}
+
+		seen := map[string]bool{alias: true}
+		target := aliases[alias]
+
+		for {
+			if _, ok := r.commands[target]; ok {
+				break
+			}
+
+			next, ok := aliases[target]
+			if !ok {
+				return errors.Errorf("alias %q points to unknown command %q", alias, target)
+			}
+
+			if seen[target] {
+				return errors.Errorf("alias %q is part of cycle", alias)
+			}
+
+			seen[target] = true
+			target = next
+		}
+
+		resolved[alias] = target
+	}
+
+	r.aliases = resolved
+
+	return nil
+}
+
+// Resolve returns name of command alias points to, other names are returned as is
+func (r *CommandRouter) Resolve(name string) string {
+	if target, ok := r.aliases[name]; ok {
+		return target
+	}
+
+	return name
+}
+
+// AliasesOf returns sorted aliases of command
+func (r *CommandRouter) AliasesOf(name string) []string {
+	var aliases []string
+	for alias, target := range r.aliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	slices.Sort(aliases)
+
+	return aliases
+}
+
+// Get returns command by name or alias
+func (r *CommandRouter) Get(name string) (Command, bool) {
+	cmd, ok := r.commands[r.Resolve(name)]
+
+	return cmd, ok
+}
+
+// List returns registered commands in registration order
+func (r *CommandRouter) List() []Command {
+	cmds := make([]Command, 0, len(r.order))
+	for _, name := range r.order {
+		cmds = append(cmds, r.commands[name])
+	}
+
+	return cmds
+}
+
+func NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		callbacks: make(map[string]Callback),
+	}
+}
+
+// Register adds handler for callback data starting with prefix, callback with the same prefix is replaced
+func (r *CallbackRouter) Register(cb Callback) {
+	if _, ok := r.callbacks[cb.Prefix]; !ok {
+		r.prefixes = append(r.prefixes, cb.Prefix)
+	}
+
+	r.callbacks[cb.Prefix] = cb
+}
+
+// Match returns callback with the longest prefix matching callback data
+func (r *CallbackRouter) Match(data string) (Callback, bool) {
+	var best string
+
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(data, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+
+	if best == "" {
+		return Callback{}, false
+	}
+
+	return r.callbacks[best], true
+}
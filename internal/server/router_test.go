@@ -0,0 +1,126 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func commandNames(cmds []Command) []string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name
+	}
+
+	return names
+}
+
+func TestCommandRouter(t *testing.T) {
+	r := NewCommandRouter()
+
+	r.Register(Command{Name: "peepo", Description: "old"})
+	r.Register(Command{Name: "help"})
+	// re-registered command keeps its place
+	r.Register(Command{Name: "peepo", Description: "new"})
+
+	if got := commandNames(r.List()); !slices.Equal(got, []string{"peepo", "help"}) {
+		t.Errorf("List() = %v, want commands in registration order", got)
+	}
+
+	cmd, ok := r.Get("peepo")
+	if !ok || cmd.Description != "new" {
+		t.Errorf("Get(peepo) = %+v, %v, want replaced command", cmd, ok)
+	}
+
+	if _, ok = r.Get("nope"); ok {
+		t.Error("unknown command was found")
+	}
+}
+
+func TestCallbackRouterMatchesLongestPrefix(t *testing.T) {
+	r := NewCallbackRouter()
+
+	r.Register(Callback{Prefix: "fav"})
+	r.Register(Callback{Prefix: "fav_page"})
+
+	tests := []struct {
+		data   string
+		want   string
+		wantOk bool
+	}{
+		{data: "fav:12", want: "fav", wantOk: true},
+		{data: "fav_page:2", want: "fav_page", wantOk: true},
+		{data: "top:1", wantOk: false},
+		{data: "", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		cb, ok := r.Match(tt.data)
+		if ok != tt.wantOk || cb.Prefix != tt.want {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.data, cb.Prefix, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestSetAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "alias of command",
+			aliases: map[string]string{"p": "peepo"},
+			want:    map[string]string{"p": "peepo", "peepo": "peepo", "sub": "sub"},
+		},
+		{
+			name:    "chained aliases",
+			aliases: map[string]string{"pp": "p", "p": "peepo"},
+			want:    map[string]string{"pp": "peepo", "p": "peepo"},
+		},
+		{name: "alias shadows command", aliases: map[string]string{"sub": "peepo"}, wantErr: true},
+		{name: "unknown target", aliases: map[string]string{"x": "nope"}, wantErr: true},
+		{name: "cycle", aliases: map[string]string{"a": "b", "b": "a"}, wantErr: true},
+		{name: "alias points to itself", aliases: map[string]string{"a": "a"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewCommandRouter()
+			r.Register(Command{Name: "peepo"})
+			r.Register(Command{Name: "sub"})
+
+			err := r.SetAliases(tt.aliases)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetAliases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for name, want := range tt.want {
+				if got := r.Resolve(name); got != want {
+					t.Errorf("Resolve(%q) = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRejectedAliasesKeepPreviousOnes(t *testing.T) {
+	r := NewCommandRouter()
+	r.Register(Command{Name: "peepo"})
+
+	if err := r.SetAliases(map[string]string{"p": "peepo", "pp": "p"}); err != nil {
+		t.Fatalf("can not set aliases: %v", err)
+	}
+
+	if err := r.SetAliases(map[string]string{"a": "b", "b": "a"}); err == nil {
+		t.Fatal("cycle was accepted")
+	}
+
+	if got := r.AliasesOf("peepo"); !slices.Equal(got, []string{"p", "pp"}) {
+		t.Errorf("AliasesOf(peepo) = %v, want [p pp]", got)
+	}
+
+	if _, ok := r.Get("pp"); !ok {
+		t.Error("command is not found by alias")
+	}
+}
@@ -3,13 +3,29 @@ package server
 import (
 	"apubot/internal/config"
 	"apubot/internal/handler"
+	"apubot/internal/handler/admin"
+	"apubot/internal/handler/errmsg"
+	"apubot/internal/handler/general"
+	"apubot/internal/handler/image"
+	"apubot/internal/i18n"
+	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/metrics"
+	"apubot/internal/service"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/workerpool"
 	"context"
+	"errors"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/patrickmn/go-cache"
-	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -17,89 +33,941 @@ import (
 const (
 	StartCommand            = "start"
 	PeepoCommand            = "peepo"
+	PeepoManyCommand        = "peepo_many"
 	SubscribeCommand        = "sub"
 	UnsubscribeCommand      = "unsub"
 	SubscriptionInfoCommand = "sub_info"
+	PauseCommand            = "sub_pause"
+	ResumeCommand           = "sub_resume"
 	HelpCommand             = "help"
+	BroadcastCommand        = "broadcast"
+	StatsCommand            = "stats"
+	AddImageCommand         = "add_image"
+	DeleteImageCommand      = "delete_image"
+	RateImageCommand        = "rate_image"
+	SetRatingCommand        = "set_rating"
+	LanguageCommand         = "lang"
+	FeedbackCommand         = "feedback"
+	CountCommand            = "count"
+	TopCommand              = "top"
+	ResetHistoryCommand     = "reset_history"
+	WhoAmICommand           = "whoami"
+	MaintenanceCommand      = "maintenance"
+	SetCooldownCommand      = "set_cooldown"
+	GetCooldownCommand      = "get_cooldown"
+	QuietCommand            = "quiet"
+	TimezoneCommand         = "timezone"
+	FeedbackListCommand     = "feedback_list"
+	SubsCountCommand        = "subs_count"
+	SuggestCommand          = "suggest"
+	ReviewCommand           = "review"
+	ByUploaderCommand       = "by_uploader"
+	RestoreImageCommand     = "restore_image"
+	FavoriteCommand         = "fav"
+	FavoritesCommand        = "favs"
+	GetFavoriteCommand      = "fav_get"
+	ExportCommand           = "export"
+	ImportCommand           = "import"
+	TagsCommand             = "tags"
+	PeepoHDCommand          = "peepo_hd"
+	HDCommand               = "hd"
+	TagAddCommand           = "tag_add"
+	TagRemoveCommand        = "tag_remove"
+	TagWeightCommand        = "tag_weight"
+	StopCommand             = "stop"
+	RemindCommand           = "remind"
+	HistoryCommand          = "history"
+	DailyCommand            = "potd"
+	ImportURLsCommand       = "import_urls"
+	CooldownCommand         = "cooldown"
+)
+
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+	// updateIDResetPeriod is idle time after which Telegram may start update IDs from random value
+	updateIDResetPeriod = 7 * 24 * time.Hour
+	// cancelGracePeriod is how long handlers still running after shutdown timeout get to give up on cancelled context
+	cancelGracePeriod = time.Second
+	// offsetSaveInterval is how often last received update ID is saved, it is also saved on shutdown
+	offsetSaveInterval = 5 * time.Second
 )
 
 type Server struct {
 	cfg       *config.Config
-	bot       *tgbotapi.BotAPI
+	log       logger.Logger
+	bot       *telegram.Bot
 	handlers  *handler.Handlers
-	lastUsage *cache.Cache
+	services  *service.Services
 	lastCmd   *cache.Cache
+	router    *CommandRouter
+	callbacks *CallbackRouter
+	// webhookServer is set only when running in webhook mode
+	webhookServer *http.Server
+	// poller is set only when running in long polling mode
+	poller *poller
+	// lastUpdateID lets polling continue from the last received update after restart
+	lastUpdateID int
+	lastUpdateAt time.Time
+	// savedUpdateID is lastUpdateID as it was last saved to db
+	savedUpdateID int
+	pool          *workerpool.Pool
+	running       atomic.Bool
+	wg            sync.WaitGroup
+	inFlight      atomic.Int64
+	// handlersCtx is parent of handler contexts, it is cancelled if handlers do not finish within shutdown timeout
+	handlersCtx    context.Context
+	cancelHandlers context.CancelFunc
+	// drained is set by shutdown if no handlers or deliveries were left running
+	drained atomic.Bool
+	// dbUnavailable reports whether db queries are rejected by circuit breaker
+	dbUnavailable func() bool
 }
 
 type InitParams struct {
-	Config   *config.Config
-	Bot      *tgbotapi.BotAPI
-	Handlers *handler.Handlers
+	Config        *config.Config
+	Logger        logger.Logger
+	Bot           *telegram.Bot
+	Handlers      *handler.Handlers
+	Services      *service.Services
+	DBUnavailable func() bool
 }
 
 func New(p *InitParams) *Server {
-	return &Server{
+	handlersCtx, cancelHandlers := context.WithCancel(context.Background())
+
+	s := &Server{
 		cfg:       p.Config,
+		log:       p.Logger,
 		bot:       p.Bot,
 		handlers:  p.Handlers,
-		lastUsage: cache.New(p.Config.CommandCooldown, 5*time.Minute),
+		services:  p.Services,
 		lastCmd:   cache.New(time.Minute, 5*time.Minute),
+		router:    NewCommandRouter(),
+		callbacks: NewCallbackRouter(),
+		pool:      workerpool.New(p.Config.WorkerCount, p.Config.WorkerQueueSize),
+
+		dbUnavailable:  p.DBUnavailable,
+		handlersCtx:    handlersCtx,
+		cancelHandlers: cancelHandlers,
+	}
+
+	s.registerCommands()
+	s.registerCallbacks()
+	s.checkCommandCooldowns()
+
+	err := s.router.SetAliases(s.cfg.Aliases)
+	if err != nil {
+		s.log.Error("Invalid command aliases", "err", err)
+		os.Exit(1)
 	}
+
+	return s
+}
+
+// checkCommandCooldowns warns about configured cooldowns of commands which do not exist, e.g. misspelled ones
+func (s *Server) checkCommandCooldowns() {
+	for name := range s.cfg.CommandCooldowns {
+		if _, ok := s.router.commands[name]; !ok {
+			s.log.Warn("Cooldown configured for unknown command", "command", name)
+		}
+	}
+}
+
+func (s *Server) registerCommands() {
+	s.router.Register(Command{
+		Name:        StartCommand,
+		Hidden:      true,
+		Description: "Start using bot",
+		Handler:     s.handlers.General.Start,
+	})
+	s.router.Register(Command{
+		Name:        PeepoCommand,
+		Usage:       "[tags -excluded|#id|gif]",
+		Description: "Get random picture, optionally with selected tags and without excluded ones, picture by ID or animation",
+		Handler: func(ctx context.Context, message *tgbotapi.Message) {
+			args := message.CommandArguments()
+
+			if _, isID := image.ParseImageID(args); isID {
+				s.handlers.Image.GetImageByID(ctx, message)
+			} else if strings.EqualFold(strings.TrimSpace(args), image.AnimationArg) {
+				s.handlers.Image.GetAnimation(ctx, message)
+			} else if args != "" {
+				s.handlers.Image.GetImageByTag(ctx, message)
+			} else {
+				s.handlers.Image.GetImage(ctx, message)
+			}
+		},
+	})
+	s.router.Register(Command{
+		Name:        PeepoManyCommand,
+		Usage:       "<count>",
+		Description: "Get several random pictures at once",
+		// album is as heavy as separate request for each picture
+		CooldownScale: s.cfg.MaxBatchSize,
+		Handler:       s.handlers.Image.GetImages,
+	})
+	s.router.Register(Command{
+		Name:        DailyCommand,
+		Description: "Get picture of the day, the same for everyone until midnight",
+		Handler:     s.handlers.Image.GetDailyImage,
+	})
+	s.router.Register(Command{
+		Name:        PeepoHDCommand,
+		Description: "Get random picture as file without compression",
+		Hidden:      !s.cfg.AllowHDMode,
+		Handler:     s.handlers.Image.GetImageHD,
+	})
+	s.router.Register(Command{
+		Name:        SubscribeCommand,
+		Usage:       "<period>",
+		Description: "Subscribe to receive pictures periodically",
+		Handler: func(ctx context.Context, message *tgbotapi.Message) {
+			_ = s.handlers.Image.CreateSubscription(ctx, message)
+		},
+	})
+	s.router.Register(Command{
+		Name:        UnsubscribeCommand,
+		Usage:       "[number|period]",
+		Description: "Drop selected or all subscriptions",
+		Handler:     s.handlers.Image.DeleteSubscription,
+	})
+	s.router.Register(Command{
+		Name:        StopCommand,
+		Description: "Drop all subscriptions and stop messages until /start",
+		Handler:     s.handlers.Image.Stop,
+	})
+	s.router.Register(Command{
+		Name:        RemindCommand,
+		Usage:       "<delay>",
+		Description: "Send one picture after delay",
+		Handler:     s.handlers.Image.Remind,
+	})
+	s.router.Register(Command{
+		Name:        SubscriptionInfoCommand,
+		Description: "Get info about active subscriptions",
+		Handler:     s.handlers.Image.GetSubscription,
+	})
+	s.router.Register(Command{
+		Name:        PauseCommand,
+		Description: "Pause subscriptions delivery",
+		Handler:     s.handlers.Image.PauseSubscription,
+	})
+	s.router.Register(Command{
+		Name:        ResumeCommand,
+		Description: "Resume paused subscriptions",
+		Handler:     s.handlers.Image.ResumeSubscription,
+	})
+	s.router.Register(Command{
+		Name:        HelpCommand,
+		Description: "Get this list",
+		Handler: func(ctx context.Context, message *tgbotapi.Message) {
+			s.handlers.General.HelpResponse(ctx, message.Chat.ID, s.helpCommands(message))
+		},
+	})
+	s.router.Register(Command{
+		Name:        CooldownCommand,
+		Description: "Show how long commands stay on cooldown for you",
+		NoCooldown:  true,
+		Handler:     s.cooldownStatus,
+	})
+	s.router.Register(Command{
+		Name:        FavoriteCommand,
+		Description: "Save the last or replied picture to favorites",
+		Handler:     s.handlers.Image.AddFavorite,
+	})
+	s.router.Register(Command{
+		Name:        FavoritesCommand,
+		Description: "List your favorite pictures",
+		Handler:     s.handlers.Image.ListFavorites,
+	})
+	s.router.Register(Command{
+		Name:        HistoryCommand,
+		Description: "List pictures last sent to this chat",
+		Handler:     s.handlers.Image.History,
+	})
+	s.router.Register(Command{
+		Name:        GetFavoriteCommand,
+		Usage:       "<id>",
+		Description: "Get favorite picture by ID",
+		Handler:     s.handlers.Image.GetFavorite,
+	})
+	s.router.Register(Command{
+		Name:        ExportCommand,
+		Description: "Export your favorites with chat settings and subscriptions",
+		Handler:     s.handlers.Image.Export,
+	})
+	s.router.Register(Command{
+		Name:        ImportCommand,
+		Usage:       "[data]",
+		Description: "Import data produced by /export",
+		Handler:     s.handlers.Image.Import,
+	})
+	s.router.Register(Command{
+		Name:        SetRatingCommand,
+		Usage:       "<sfw|all>",
+		Description: "Choose which pictures are allowed in chat",
+		Handler:     s.handlers.General.SetRating,
+	})
+	s.router.Register(Command{
+		Name:        LanguageCommand,
+		Usage:       "<en|ru>",
+		Description: "Choose bot language",
+		Handler:     s.handlers.General.SetLanguage,
+	})
+	s.router.Register(Command{
+		Name:        SetCooldownCommand,
+		Usage:       "<duration|default>",
+		Description: "Set command cooldown in this chat",
+		Handler:     s.handlers.General.SetCooldown,
+	})
+	s.router.Register(Command{
+		Name:        GetCooldownCommand,
+		Description: "Show command cooldown in this chat",
+		Handler:     s.handlers.General.GetCooldown,
+	})
+	s.router.Register(Command{
+		Name:        QuietCommand,
+		Usage:       "[HH:MM-HH:MM|off]",
+		Description: "Set hours when subscription pictures are not sent",
+		Handler:     s.handlers.General.Quiet,
+	})
+	s.router.Register(Command{
+		Name:        TimezoneCommand,
+		Usage:       "[name]",
+		Description: "Set chat timezone used for quiet hours",
+		Handler:     s.handlers.General.Timezone,
+	})
+	s.router.Register(Command{
+		Name:        HDCommand,
+		Usage:       "[on|off]",
+		Description: "Send pictures to this chat as files without compression",
+		Hidden:      !s.cfg.AllowHDMode,
+		Handler:     s.handlers.General.HD,
+	})
+	s.router.Register(Command{
+		Name:        CountCommand,
+		Usage:       "[tag]",
+		Description: "Show number of available pictures",
+		Handler:     s.handlers.General.Count,
+	})
+	s.router.Register(Command{
+		Name:        TopCommand,
+		Usage:       "[n]",
+		Description: "Show most popular pictures",
+		Handler:     s.handlers.Image.TopImages,
+	})
+	s.router.Register(Command{
+		Name:        ResetHistoryCommand,
+		Description: "Allow recently sent pictures to be repeated",
+		Handler:     s.handlers.Image.ResetHistory,
+	})
+	s.router.Register(Command{
+		Name:        WhoAmICommand,
+		Description: "Show your user ID, chat ID and admin status",
+		Handler:     s.handlers.General.WhoAmI,
+	})
+	s.router.Register(Command{
+		Name:        FeedbackCommand,
+		Usage:       "<text>",
+		Description: "Send feedback to bot admins",
+		Cooldown:    s.cfg.FeedbackCooldown,
+		Handler:     s.handlers.General.Feedback,
+	})
+	s.router.Register(Command{
+		Name:        StatsCommand,
+		Description: "Get your usage stats",
+		Handler:     s.handlers.General.StatsResponse,
+	})
+	s.router.Register(Command{
+		Name:        BroadcastCommand,
+		Usage:       "<text>",
+		Description: "Send message to all known chats",
+		AdminOnly:   true,
+		LongRunning: true,
+		Handler:     s.handlers.Admin.Broadcast,
+	})
+	s.router.Register(Command{
+		Name:        AddImageCommand,
+		Usage:       "[tags]",
+		Description: "Add photo to library with optional tags",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.AddImage,
+	})
+	s.router.Register(Command{
+		Name:        ImportURLsCommand,
+		Usage:       "[tags]",
+		Description: "Add pictures from document with URLs, one per line",
+		AdminOnly:   true,
+		LongRunning: true,
+		Handler:     s.handlers.Admin.ImportURLs,
+	})
+	s.router.Register(Command{
+		Name:        DeleteImageCommand,
+		Usage:       "<id>",
+		Description: "Delete image from library by ID",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.DeleteImage,
+	})
+	s.router.Register(Command{
+		Name:        RestoreImageCommand,
+		Usage:       "<id>",
+		Description: "Restore recently deleted image by ID",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.RestoreImage,
+	})
+	s.router.Register(Command{
+		Name:        RateImageCommand,
+		Usage:       "<id> <sfw|nsfw>",
+		Description: "Set image rating",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.RateImage,
+	})
+	s.router.Register(Command{
+		Name:        TagsCommand,
+		Usage:       "<id>",
+		Description: "Show image tags",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.Tags,
+	})
+	s.router.Register(Command{
+		Name:        TagAddCommand,
+		Usage:       "<id> <tags>",
+		Description: "Add tags to image",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.TagAdd,
+	})
+	s.router.Register(Command{
+		Name:        TagRemoveCommand,
+		Usage:       "<id> <tags>",
+		Description: "Remove tags from image",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.TagRemove,
+	})
+	s.router.Register(Command{
+		Name:        TagWeightCommand,
+		Usage:       "<tag> <weight>",
+		Description: "Set how often tag is picked",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.TagWeight,
+	})
+	s.router.Register(Command{
+		Name:        FeedbackListCommand,
+		Description: "List recent feedback",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.FeedbackList,
+	})
+	s.router.Register(Command{
+		Name:        SubsCountCommand,
+		Description: "Count active subscriptions by interval",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.SubsCount,
+	})
+	s.router.Register(Command{
+		Name:        SuggestCommand,
+		Usage:       "<tags>",
+		Description: "Suggest replied picture for the library",
+		Handler:     s.handlers.Admin.Suggest,
+	})
+	s.router.Register(Command{
+		Name:        ReviewCommand,
+		Description: "Review suggested pictures",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.Review,
+	})
+	s.router.Register(Command{
+		Name:        ByUploaderCommand,
+		Usage:       "<userID>",
+		Description: "List images added by user",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.ByUploader,
+	})
+	s.router.Register(Command{
+		Name:        MaintenanceCommand,
+		Usage:       "<on|off>",
+		Description: "Toggle maintenance mode",
+		AdminOnly:   true,
+		Handler:     s.handlers.Admin.Maintenance,
+	})
+}
+
+func (s *Server) registerCallbacks() {
+	s.callbacks.Register(Callback{
+		Prefix:   image.RefreshImageCallbackPrefix,
+		Cooldown: s.cfg.NextButtonCooldown,
+		Handler:  s.handlers.Image.RefreshImage,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:  admin.DeleteImageCallbackPrefix,
+		Handler: s.handlers.Admin.DeleteImageCallback,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:  admin.ReviewCallbackPrefix,
+		Handler: s.handlers.Admin.ReviewCallback,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:  image.FavoritesCallbackPrefix,
+		Handler: s.handlers.Image.FavoritesPage,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:   image.HistoryCallbackPrefix,
+		Cooldown: s.cfg.NextButtonCooldown,
+		Handler:  s.handlers.Image.HistoryImage,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:  image.TopCallbackPrefix,
+		Handler: s.handlers.Image.TopPage,
+	})
+	s.callbacks.Register(Callback{
+		Prefix:  admin.FeedbackCallbackPrefix,
+		Handler: s.handlers.Admin.FeedbackPage,
+	})
 }
 
 func (s *Server) Start() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+	s.lastUpdateID, s.lastUpdateAt = s.services.State.UpdateOffset(ctx)
+	s.savedUpdateID = s.lastUpdateID
+	cancel()
+
+	updatesChan, err := s.listenUpdates()
+	if err != nil {
+		s.log.Error("Error starting updates listener", "err", err)
+		os.Exit(1)
+	}
 
-	updatesChan := s.bot.GetUpdatesChan(u)
+	s.running.Store(true)
+	defer s.running.Store(false)
+
+	// offset is saved periodically instead of on every update, so slow db does not hold update intake
+	offsetTicker := time.NewTicker(offsetSaveInterval)
+	defer offsetTicker.Stop()
+	defer s.saveUpdateOffset()
 
 	for {
+		// shutdown signal takes priority over pending updates
 		select {
-		case update := <-updatesChan:
-			go s.handleUpdate(&update)
 		case <-c:
-			log.Println("Stopping bot...")
+			s.shutdown()
 
-			s.bot.StopReceivingUpdates()
+			return
+		default:
+		}
 
-			log.Println("Bot gracefully stopped!")
+		select {
+		case update, ok := <-updatesChan:
+			if !ok {
+				// poller retries failed requests by itself, so channel is closed only if listener stopped
+				s.log.Error("Updates channel closed")
+				s.shutdown()
+
+				return
+			}
+
+			if s.isDuplicate(update) {
+				s.log.Debug("Skipping already processed update", "update_id", update.UpdateID)
+
+				continue
+			}
+
+			s.lastUpdateID = update.UpdateID
+			s.lastUpdateAt = time.Now()
+
+			ok = s.submit(func() {
+				defer s.recoverUpdate(&update)
+
+				s.handleUpdate(&update)
+			})
+			if !ok {
+				s.rejectBusy(&update)
+			}
+		case <-offsetTicker.C:
+			s.saveUpdateOffset()
+		case <-c:
+			s.shutdown()
 
 			return
 		}
 	}
 }
 
+// saveUpdateOffset saves ID of last received update if it changed since last save
+func (s *Server) saveUpdateOffset() {
+	if s.lastUpdateID == s.savedUpdateID {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+	defer cancel()
+
+	s.services.State.SaveUpdateOffset(ctx, s.lastUpdateID)
+	s.savedUpdateID = s.lastUpdateID
+}
+
+// IsRunning reports whether update loop is running
+func (s *Server) IsRunning() bool {
+	return s.running.Load()
+}
+
+// Drained reports whether nothing was left running after Start returned, so db can be closed
+func (s *Server) Drained() bool {
+	return s.drained.Load()
+}
+
+// submit runs task on worker pool tracking it for shutdown, returns false if pool is saturated
+func (s *Server) submit(task func()) bool {
+	s.wg.Add(1)
+	s.inFlight.Add(1)
+
+	ok := s.pool.Submit(func() {
+		defer s.wg.Done()
+		defer s.inFlight.Add(-1)
+
+		task()
+	})
+	if !ok {
+		s.wg.Done()
+		s.inFlight.Add(-1)
+	}
+
+	return ok
+}
+
+// rejectBusy tells user to retry later when all workers are busy
+func (s *Server) rejectBusy(update *tgbotapi.Update) {
+	s.log.Warn("Worker pool is saturated, update dropped", "update_id", update.UpdateID)
+
+	if update.Message == nil || !update.Message.IsCommand() {
+		return
+	}
+
+	_, err := s.bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "I'm busy right now, please try again later!"))
+	if err != nil {
+		s.log.Error("Error sending message", "chat_id", update.Message.Chat.ID, "err", err)
+	}
+}
+
+func (s *Server) shutdown() {
+	s.log.Info("Stopping bot...")
+
+	s.stopUpdates()
+	defer s.pool.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	subsErr := s.services.Subscription.Stop(ctx)
+	if subsErr != nil {
+		s.log.Warn("Error stopping subscriptions", "err", subsErr)
+	}
+
+	if !s.waitInFlight(s.cfg.ShutdownTimeout) {
+		s.log.Warn("Shutdown timeout reached, cancelling handlers", "running_handlers", s.inFlight.Load())
+
+		// handlers waiting for db or Telegram return once their context is cancelled
+		s.cancelHandlers()
+
+		if !s.waitInFlight(cancelGracePeriod) {
+			s.log.Warn("Handlers did not stop after cancellation", "running_handlers", s.inFlight.Load())
+
+			return
+		}
+	}
+
+	if subsErr != nil {
+		return
+	}
+
+	s.drained.Store(true)
+	s.log.Info("Bot gracefully stopped!")
+}
+
+// recoverUpdate keeps bot running if handling of a single update panics
+func (s *Server) recoverUpdate(update *tgbotapi.Update) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	var chatID int64
+	var source string
+
+	switch {
+	case update.Message != nil:
+		chatID = update.Message.Chat.ID
+		source = "message"
+		if update.Message.IsCommand() {
+			source = "/" + update.Message.Command()
+		}
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+		source = "callback " + update.CallbackQuery.Data
+	case update.InlineQuery != nil:
+		source = "inline query"
+	case update.MyChatMember != nil:
+		chatID = update.MyChatMember.Chat.ID
+		source = "membership update"
+	case update.ChannelPost != nil:
+		chatID = update.ChannelPost.Chat.ID
+		source = "channel post"
+	}
+
+	s.log.Error(
+		"Panic while handling update",
+		"update_id", update.UpdateID, "chat_id", chatID, "source", source, "panic", r, "stack", string(debug.Stack()),
+	)
+
+	if !s.cfg.NotifyAdminsOnPanic {
+		return
+	}
+
+	msgText := fmt.Sprintf("Panic while handling %s in chat %d: %v", source, chatID, r)
+	for _, adminID := range s.cfg.Admins() {
+		s.handlers.General.MessageResponse(adminID, msgText)
+	}
+}
+
+// waitInFlight waits for running handlers to finish, returns false if timeout elapsed
+func (s *Server) waitInFlight(timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// isDuplicate reports whether update was already processed, e.g. redelivered by Telegram after timeout
+func (s *Server) isDuplicate(update tgbotapi.Update) bool {
+	return update.UpdateID <= s.lastUpdateID && time.Since(s.lastUpdateAt) < updateIDResetPeriod
+}
+
 func (s *Server) handleUpdate(update *tgbotapi.Update) {
+	ctx, cancel := context.WithTimeout(s.handlersCtx, s.cfg.RequestTimeout)
+	defer cancel()
+
+	if s.dbUnavailable() {
+		s.replyUnavailable(update)
+
+		return
+	}
+
+	if update.CallbackQuery != nil {
+		if s.inMaintenance(update.CallbackQuery.From) {
+			lang := i18n.DefaultLang
+			if update.CallbackQuery.Message != nil {
+				lang = s.language(ctx, update.CallbackQuery.Message.Chat.ID)
+			}
+
+			msgText := i18n.T(lang, i18n.KeyMaintenance)
+			if _, err := s.bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, msgText)); err != nil {
+				s.log.Error("Error answering callback", "err", err)
+			}
+
+			return
+		}
+
+		s.handleCallback(ctx, update.CallbackQuery)
+
+		return
+	}
+
+	if update.InlineQuery != nil {
+		if !s.inMaintenance(update.InlineQuery.From) {
+			s.handlers.Image.InlineQuery(ctx, update.InlineQuery)
+		}
+
+		return
+	}
+
+	if update.MyChatMember != nil {
+		s.handleMyChatMember(ctx, update.MyChatMember)
+
+		return
+	}
+
+	if update.ChannelPost != nil {
+		if s.cfg.SourceChannelID != 0 && update.ChannelPost.Chat.ID == s.cfg.SourceChannelID {
+			s.handlers.Admin.SourcePost(ctx, update.ChannelPost)
+		}
+
+		return
+	}
+
 	if update.Message == nil {
 		return
 	}
 
+	s.registerChat(ctx, update.Message.Chat)
+
+	// commands sent as media caption are handled as regular ones
+	if update.Message.Text == "" && update.Message.Caption != "" {
+		update.Message.Text = update.Message.Caption
+		update.Message.Entities = update.Message.CaptionEntities
+	}
+
+	if update.Message.IsCommand() && !addressedTo(update.Message, s.bot.Self.UserName, s.cfg.RequireMentionInGroups) {
+		s.log.Debug("Ignoring command meant for another bot", "chat_id", update.Message.Chat.ID, "command", update.Message.CommandWithAt())
+
+		return
+	}
+
+	if s.inMaintenance(update.Message.From) {
+		// groups are not spammed with replies to regular messages
+		if update.Message.IsCommand() || update.Message.Chat.IsPrivate() {
+			msgText := i18n.T(s.language(ctx, update.Message.Chat.ID), i18n.KeyMaintenance)
+			s.handlers.General.MessageResponse(update.Message.Chat.ID, msgText)
+		}
+
+		return
+	}
+
 	if !update.Message.IsCommand() {
-		s.handleMessage(update.Message)
+		s.handleMessage(ctx, update.Message)
+
+		return
+	}
+
+	s.handleCommand(ctx, update.Message)
+}
+
+// handleMyChatMember tracks bot being added to chats and removed from them, private chats report blocking this way
+func (s *Server) handleMyChatMember(ctx context.Context, update *tgbotapi.ChatMemberUpdated) {
+	wasMember, isMember := isPresent(update.OldChatMember), isPresent(update.NewChatMember)
+
+	switch {
+	case isMember && !wasMember:
+		s.log.Info("Bot added to chat", "chat_id", update.Chat.ID, "chat_type", update.Chat.Type)
+		s.registerChat(ctx, &update.Chat)
+	case wasMember && !isMember:
+		s.log.Info("Bot removed from chat", "chat_id", update.Chat.ID, "chat_type", update.Chat.Type)
+
+		err := s.services.Subscription.Deactivate(ctx, update.Chat.ID)
+		if err != nil {
+			s.log.Error("Can not deactivate subscriptions", "chat_id", update.Chat.ID, "err", err)
+		}
+	}
+}
+
+// registerChat saves chat and greets groups seen for the first time if enabled,
+// private chats are greeted by /start anyway
+func (s *Server) registerChat(ctx context.Context, chat *tgbotapi.Chat) {
+	if !s.services.Chat.Register(ctx, chat.ID) || !s.cfg.GreetNewChats || chat.IsPrivate() {
+		return
+	}
+
+	s.log.Info("Greeting new chat", "chat_id", chat.ID)
+	s.handlers.General.StartResponse(ctx, chat.ID)
+}
+
+// isPresent reports whether chat member can see and send messages in chat
+func isPresent(member tgbotapi.ChatMember) bool {
+	if member.Status == "restricted" {
+		return member.IsMember
+	}
+
+	return !member.HasLeft() && !member.WasKicked()
+}
+
+// addressedTo reports whether command is meant for bot with username, commands with mention of another bot are not.
+// Commands without mention are meant for every bot in chat, in groups they can be ignored with requireMention.
+func addressedTo(message *tgbotapi.Message, username string, requireMention bool) bool {
+	_, target, mentioned := strings.Cut(message.CommandWithAt(), "@")
+	if mentioned {
+		return strings.EqualFold(target, username)
+	}
+
+	return !requireMention || message.Chat.IsPrivate()
+}
+
+// inMaintenance reports whether update from user must be rejected, admins can use bot during maintenance
+func (s *Server) inMaintenance(user *tgbotapi.User) bool {
+	return s.services.State.Maintenance() && (user == nil || !s.cfg.IsAdmin(user.ID))
+}
+
+// replyUnavailable tells user to retry later instead of waiting for db queries to time out
+func (s *Server) replyUnavailable(update *tgbotapi.Update) {
+	// chat language is stored in db, so default one is used
+	msgText := errmsg.Text(s.cfg, i18n.DefaultLang, database.ErrUnavailable)
+
+	switch {
+	case update.CallbackQuery != nil:
+		if _, err := s.bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, msgText)); err != nil {
+			s.log.Error("Error answering callback", "err", err)
+		}
+	case update.Message != nil && (update.Message.IsCommand() || update.Message.Chat.IsPrivate()):
+		s.handlers.General.MessageResponse(update.Message.Chat.ID, msgText)
+	}
+}
+
+// replyOnTimeout asks user to retry if handling did not fit into request timeout
+func (s *Server) replyOnTimeout(ctx context.Context, chatID int64) {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+
+	s.log.Warn("Request timeout exceeded", "chat_id", chatID, "timeout", s.cfg.RequestTimeout)
+
+	msgText := errmsg.Text(s.cfg, s.language(context.Background(), chatID), ctx.Err())
+	s.handlers.General.MessageResponse(chatID, msgText)
+}
+
+func (s *Server) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	cb, ok := s.callbacks.Match(query.Data)
+	if !ok {
+		s.log.Warn("Unknown callback", "data", query.Data)
 
 		return
 	}
 
-	s.handleCommand(update.Message)
+	if cb.Cooldown > 0 && query.Message != nil && !s.cooldownExempt(query.From) {
+		// buttons have own cooldown, so paging through pictures does not block commands and vice versa
+		cooldownKey := s.cooldownKeyFor(query.Message.Chat.ID, query.From) + ":" + cb.Prefix
+
+		waitTime := s.services.Cooldown.Remaining(cooldownKey, cb.Cooldown)
+		if waitTime > 0 {
+			metrics.CooldownRejections.Inc()
+
+			msgText := i18n.T(s.language(ctx, query.Message.Chat.ID), i18n.KeyCooldown, waitTime.Seconds())
+			if _, err := s.bot.Request(tgbotapi.NewCallback(query.ID, msgText)); err != nil {
+				s.log.Error("Error answering callback", "err", err)
+			}
+
+			return
+		}
+
+		s.services.Cooldown.Touch(ctx, cooldownKey, cb.Cooldown)
+	}
+
+	cb.Handler(ctx, query)
 }
 
-func (s *Server) handleMessage(message *tgbotapi.Message) {
+func (s *Server) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	var err error
 
 	lastUsedCmd, _ := s.lastCmd.Get(fmt.Sprint(message.Chat.ID))
 
 	switch lastUsedCmd {
 	case SubscribeCommand:
-		ctx := context.Background()
 		err = s.handlers.Image.CreateSubscription(ctx, message)
 	default:
-		msgText := "I can only handle listed commands in this chat!"
-		s.handlers.General.MessageResponse(message.Chat.ID, msgText)
+		s.fallbackResponse(ctx, message)
 	}
 
+	s.replyOnTimeout(ctx, message.Chat.ID)
+
 	if err != nil {
 		return
 	}
@@ -107,38 +975,200 @@ func (s *Server) handleMessage(message *tgbotapi.Message) {
 	s.lastCmd.Delete(fmt.Sprint(message.Chat.ID))
 }
 
-func (s *Server) handleCommand(message *tgbotapi.Message) {
-	if lastTime, ok := s.lastUsage.Get(fmt.Sprint(message.Chat.ID)); ok {
-		waitTime := s.cfg.CommandCooldown - time.Since(lastTime.(time.Time))
-		if waitTime > 0 {
-			msgText := fmt.Sprintf("Command on cooldown for %.1f sec", waitTime.Seconds())
-			s.handlers.General.MessageResponse(message.Chat.ID, msgText)
+// fallbackResponse answers non-command messages, private chats get help by default
+func (s *Server) fallbackResponse(ctx context.Context, message *tgbotapi.Message) {
+	if !message.Chat.IsPrivate() {
+		s.handlers.General.MessageResponse(message.Chat.ID, s.cfg.GroupFallbackMessage)
 
-			return
+		return
+	}
+
+	if s.cfg.PrivateFallbackMessage == "" {
+		s.handlers.General.HelpResponse(ctx, message.Chat.ID, s.helpCommands(message))
+
+		return
+	}
+
+	s.handlers.General.MessageResponse(message.Chat.ID, s.cfg.PrivateFallbackMessage)
+}
+
+func (s *Server) handleCommand(ctx context.Context, message *tgbotapi.Message) {
+	cmd, ok := s.router.Get(message.Command())
+	if ok && cmd.AdminOnly && !s.isAdmin(message) {
+		ok = false // pretend admin commands do not exist for regular users
+	}
+
+	cooldownKey := s.cooldownKey(message)
+	cooldown := s.chatCooldown(ctx, message.Chat.ID)
+
+	if ok {
+		if cd, own := s.commandCooldown(cmd); own {
+			// commands with own cooldown do not block other commands
+			cooldownKey += ":" + cmd.Name
+			cooldown = cd
 		}
 	}
 
-	switch message.Command() {
-	case StartCommand:
-		s.handlers.General.StartResponse(message.Chat.ID)
-	case PeepoCommand:
-		ctx := context.Background()
-		s.handlers.Image.GetImage(ctx, message)
-	case SubscribeCommand:
-		ctx := context.Background()
-		_ = s.handlers.Image.CreateSubscription(ctx, message)
-	case UnsubscribeCommand:
-		ctx := context.Background()
-		s.handlers.Image.DeleteSubscription(ctx, message)
-	case SubscriptionInfoCommand:
-		ctx := context.Background()
-		s.handlers.Image.GetSubscription(ctx, message)
-	case HelpCommand:
-		s.handlers.General.HelpResponse(message.Chat.ID)
-	default:
-		s.handlers.General.MessageResponse(message.Chat.ID, "Unknown command")
+	// commands reading cooldown must not change it
+	exempt := s.cooldownExempt(message.From) || (ok && cmd.NoCooldown)
+
+	waitTime := s.services.Cooldown.Remaining(cooldownKey, cooldown)
+	if waitTime > 0 && !exempt {
+		metrics.CooldownRejections.Inc()
+
+		msgText := i18n.T(s.language(ctx, message.Chat.ID), i18n.KeyCooldown, waitTime.Seconds())
+		s.handlers.General.MessageResponse(message.Chat.ID, msgText)
+
+		return
+	}
+
+	if message.From != nil {
+		s.services.Stats.RegisterUser(ctx, message.From.ID)
+	}
+
+	// cooldown is started before handling so long running handler can not be triggered again meanwhile,
+	// exempt users do not start it, so with chat scope they do not block others either
+	if !exempt {
+		s.services.Cooldown.Touch(ctx, cooldownKey, cooldown)
+	}
+
+	s.log.Debug("Handling command", "chat_id", message.Chat.ID, "command", message.Command())
+
+	if ok {
+		metrics.CommandsReceived.WithLabelValues(cmd.Name).Inc()
+
+		if cmd.LongRunning {
+			// not limited by request timeout, but still stopped if handlers are cancelled on shutdown
+			longCtx, cancelLong := context.WithCancel(s.handlersCtx)
+			defer cancelLong()
+
+			ctx = longCtx
+		}
+
+		cmd.Handler(ctx, message)
+	} else {
+		s.handlers.General.MessageResponse(message.Chat.ID, i18n.T(s.language(ctx, message.Chat.ID), i18n.KeyUnknownCommand))
+	}
+
+	s.replyOnTimeout(ctx, message.Chat.ID)
+
+	s.lastCmd.Set(fmt.Sprint(message.Chat.ID), s.router.Resolve(message.Command()), cache.DefaultExpiration)
+}
+
+// chatCooldown returns shared command cooldown, chat admins may override global one
+func (s *Server) chatCooldown(ctx context.Context, chatID int64) time.Duration {
+	// read errors are logged by chat service, global cooldown is used then
+	settings, _ := s.services.Chat.GetSettings(ctx, chatID)
+	if cd := settings.CooldownAsDuration(); cd > 0 {
+		return cd
+	}
+
+	return s.cfg.Cooldown()
+}
+
+// commandCooldown returns cooldown configured for command or set on registration, false if command uses shared one
+func (s *Server) commandCooldown(cmd Command) (time.Duration, bool) {
+	if cd, ok := s.cfg.CooldownFor(cmd.Name); ok {
+		return cd, true
+	}
+
+	if cmd.Cooldown > 0 {
+		return cmd.Cooldown, true
+	}
+
+	if cmd.CooldownScale > 0 {
+		return s.cfg.Cooldown() * time.Duration(cmd.CooldownScale), true
+	}
+
+	return 0, false
+}
+
+// cooldownStatus tells user remaining shared cooldown and cooldowns of commands with own ones, they are not touched
+func (s *Server) cooldownStatus(ctx context.Context, message *tgbotapi.Message) {
+	lang := s.language(ctx, message.Chat.ID)
+
+	if s.cooldownExempt(message.From) {
+		s.handlers.General.MessageResponse(message.Chat.ID, i18n.T(lang, i18n.KeyCooldownExempt))
+
+		return
 	}
 
-	s.lastUsage.Set(fmt.Sprint(message.Chat.ID), time.Now(), cache.DefaultExpiration)
-	s.lastCmd.Set(fmt.Sprint(message.Chat.ID), message.Command(), cache.DefaultExpiration)
+	key := s.cooldownKey(message)
+
+	var lines []string
+	if left := s.services.Cooldown.Remaining(key, s.chatCooldown(ctx, message.Chat.ID)); left > 0 {
+		lines = append(lines, i18n.T(lang, i18n.KeyCooldownLeft, left.Seconds()))
+	}
+
+	for _, cmd := range s.router.List() {
+		cd, own := s.commandCooldown(cmd)
+		if !own {
+			continue
+		}
+
+		if left := s.services.Cooldown.Remaining(key+":"+cmd.Name, cd); left > 0 {
+			lines = append(lines, i18n.T(lang, i18n.KeyCooldownOwn, cmd.Name, left.Seconds()))
+		}
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, i18n.T(lang, i18n.KeyCooldownNone))
+	}
+
+	s.handlers.General.MessageResponse(message.Chat.ID, strings.Join(lines, "\n"))
+}
+
+// cooldownExempt reports whether user skips cooldowns
+func (s *Server) cooldownExempt(user *tgbotapi.User) bool {
+	if user == nil || !s.cfg.IsCooldownExempt(user.ID) {
+		return false
+	}
+
+	s.log.Debug("Cooldown exemption applied", "user_id", user.ID)
+
+	return true
+}
+
+// cooldownKey returns cooldown key according to configured cooldown scope
+func (s *Server) cooldownKey(message *tgbotapi.Message) string {
+	return s.cooldownKeyFor(message.Chat.ID, message.From)
+}
+
+func (s *Server) cooldownKeyFor(chatID int64, from *tgbotapi.User) string {
+	if s.cfg.CooldownScope == config.CooldownScopeChat || from == nil {
+		return fmt.Sprint(chatID)
+	}
+
+	return fmt.Sprintf("%d:%d", chatID, from.ID)
+}
+
+// helpCommands lists commands visible to message sender
+func (s *Server) helpCommands(message *tgbotapi.Message) []general.CommandInfo {
+	isAdmin := s.isAdmin(message)
+
+	var commands []general.CommandInfo
+	for _, cmd := range s.router.List() {
+		if cmd.Hidden || (cmd.AdminOnly && !isAdmin) {
+			continue
+		}
+
+		commands = append(commands, general.CommandInfo{
+			Name:        cmd.Name,
+			Usage:       cmd.Usage,
+			Description: cmd.Description,
+			Aliases:     s.router.AliasesOf(cmd.Name),
+		})
+	}
+
+	return commands
+}
+
+func (s *Server) language(ctx context.Context, chatID int64) string {
+	settings, _ := s.services.Chat.GetSettings(ctx, chatID)
+
+	return settings.Language
+}
+
+func (s *Server) isAdmin(message *tgbotapi.Message) bool {
+	return message.From != nil && s.cfg.IsAdmin(message.From.ID)
 }
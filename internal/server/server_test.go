@@ -0,0 +1,1116 @@
+package server
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/handler"
+	"apubot/internal/handler/image"
+	"apubot/internal/i18n"
+	"apubot/internal/infrastructure/database"
+	"apubot/internal/infrastructure/repository"
+	"apubot/internal/infrastructure/telegram"
+	"apubot/internal/service"
+	"apubot/internal/testutil"
+	"apubot/pkg/utils/workerpool"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testBotUsername = "peepo_bot"
+	testAdminID     = 100
+)
+
+// telegramRequest is Bot API call made by bot
+type telegramRequest struct {
+	method string
+	params url.Values
+}
+
+// fakeTelegram is stub Bot API server remembering requests sent by bot
+type fakeTelegram struct {
+	mu       sync.Mutex
+	requests []telegramRequest
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	_ = r.ParseMultipartForm(1 << 20)
+	params := r.Form
+	if r.MultipartForm != nil {
+		params = r.MultipartForm.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if method == "getMe" {
+		fmt.Fprintf(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":%q}}`, testBotUsername)
+
+		return
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, telegramRequest{method: method, params: params})
+	f.mu.Unlock()
+
+	// album is answered with message per picture
+	if method == "sendMediaGroup" {
+		var media []json.RawMessage
+		_ = json.Unmarshal([]byte(params.Get("media")), &media)
+
+		messages := make([]string, len(media))
+		for i := range messages {
+			messages[i] = fmt.Sprintf(`{"message_id":%d,"date":0,"chat":{"id":%s},"photo":[{"file_id":"tg-sent-%d"}]}`,
+				i+1, cmp.Or(params.Get("chat_id"), "1"), i)
+		}
+
+		fmt.Fprintf(w, `{"ok":true,"result":[%s]}`, strings.Join(messages, ","))
+
+		return
+	}
+
+	fmt.Fprintf(
+		w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":%s},"photo":[{"file_id":"tg-sent"}]}}`,
+		cmp.Or(params.Get("chat_id"), "1"),
+	)
+}
+
+// calls returns requests with given method
+func (f *fakeTelegram) calls(method string) []telegramRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []telegramRequest
+	for _, req := range f.requests {
+		if req.method == method {
+			calls = append(calls, req)
+		}
+	}
+
+	return calls
+}
+
+// messages returns texts sent to chat
+func (f *fakeTelegram) messages(chatID int64) []string {
+	var texts []string
+	for _, req := range f.calls("sendMessage") {
+		if req.params.Get("chat_id") == fmt.Sprint(chatID) {
+			texts = append(texts, req.params.Get("text"))
+		}
+	}
+
+	return texts
+}
+
+// answers returns texts of callback query answers
+func (f *fakeTelegram) answers() []string {
+	var texts []string
+	for _, req := range f.calls("answerCallbackQuery") {
+		texts = append(texts, req.params.Get("text"))
+	}
+
+	return texts
+}
+
+func (f *fakeTelegram) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = nil
+}
+
+// newTestServer creates server with real services on temp db talking to stub Telegram
+func newTestServer(t *testing.T, modify func(cfg *config.Config)) (*Server, *fakeTelegram) {
+	t.Helper()
+
+	return newTestServerFrom(t, "../../config", modify)
+}
+
+// newTestServerFrom creates server like newTestServer with config read from folder
+func newTestServerFrom(t *testing.T, folder string, modify func(cfg *config.Config)) (*Server, *fakeTelegram) {
+	t.Helper()
+
+	t.Setenv("api_key", "test-key")
+	t.Setenv("db_path", filepath.Join(t.TempDir(), "test.db"))
+
+	cfg, err := config.NewConfig(folder)
+	if err != nil {
+		t.Fatalf("can not load config: %v", err)
+	}
+
+	cfg.IsDebug = false
+	cfg.ImagesDirPath = t.TempDir()
+	cfg.AdminIDs = []int64{testAdminID}
+	cfg.SendRateLimit, cfg.ChatSendRateLimit, cfg.ChatSendBurst = 1000, 1000, 1000
+	if modify != nil {
+		modify(cfg)
+	}
+
+	log := discardLogger()
+
+	db, err := database.New(cfg, log)
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+
+	fake := &fakeTelegram{}
+	srv := httptest.NewServer(fake)
+
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.ApiKey, srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatalf("can not create bot api: %v", err)
+	}
+
+	bot := telegram.New(cfg, api)
+	services := service.New(&service.InitParams{
+		Config:       cfg,
+		Logger:       log,
+		Repositories: repository.New(&repository.InitParams{Config: cfg, DB: db}),
+	})
+
+	s := New(&InitParams{
+		Config:        cfg,
+		Logger:        log,
+		Bot:           bot,
+		Handlers:      handler.New(&handler.InitParams{Config: cfg, Logger: log, Bot: bot, Services: services}),
+		Services:      services,
+		DBUnavailable: func() bool { return false },
+	})
+
+	t.Cleanup(func() {
+		_ = services.Subscription.Stop(context.Background())
+		s.pool.Stop()
+		srv.Close()
+		_ = db.Close()
+	})
+
+	return s, fake
+}
+
+// command returns update with command message from user, chats with negative IDs are groups
+func command(chatID int64, userID int64, text string) *tgbotapi.Update {
+	chatType := "private"
+	if chatID < 0 {
+		chatType = "group"
+	}
+
+	name, _, _ := strings.Cut(text, " ")
+
+	return &tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: chatID, Type: chatType},
+			From: &tgbotapi.User{ID: userID},
+			Text: text,
+			Date: int(time.Now().Unix()),
+			Entities: []tgbotapi.MessageEntity{
+				{Type: "bot_command", Offset: 0, Length: len(name)},
+			},
+		},
+	}
+}
+
+// callback returns update with button press under message in chat
+func callback(chatID int64, userID int64, data string) *tgbotapi.Update {
+	return &tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "query",
+			From:    &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: chatID, Type: "private"}},
+			Data:    data,
+		},
+	}
+}
+
+func TestCommandsAreRouted(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 || photos[0].params.Get("photo") != "tg-01.jpg" {
+		t.Fatalf("/peepo sent photos %v, want tg-01.jpg", photos)
+	}
+
+	s.handleUpdate(command(2, 1, "/no_such_command"))
+
+	unknown := i18n.T(i18n.DefaultLang, i18n.KeyUnknownCommand)
+	if got := tg.messages(2); len(got) != 1 || got[0] != unknown {
+		t.Errorf("unknown command got replies %q, want %q", got, unknown)
+	}
+}
+
+func TestAdminCommandsAreHiddenFromUsers(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	s.handleUpdate(command(1, 1, "/maintenance on"))
+
+	unknown := i18n.T(i18n.DefaultLang, i18n.KeyUnknownCommand)
+	if got := tg.messages(1); len(got) != 1 || got[0] != unknown {
+		t.Fatalf("admin command from user got replies %q, want %q", got, unknown)
+	}
+
+	if s.services.State.Maintenance() {
+		t.Fatal("user turned maintenance on")
+	}
+
+	s.handleUpdate(command(testAdminID, testAdminID, "/maintenance on"))
+
+	if !s.services.State.Maintenance() {
+		t.Error("admin could not turn maintenance on")
+	}
+}
+
+func TestMaintenanceBlocksOnlyUsers(t *testing.T) {
+	// admin sends commands in a row, so cooldown must not reject them
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.CooldownExemptIDs = []int64{testAdminID} })
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	maintenance := i18n.T(i18n.DefaultLang, i18n.KeyMaintenance)
+
+	s.handleUpdate(command(testAdminID, testAdminID, "/maintenance on"))
+	s.handleUpdate(command(1, 1, "/peepo"))
+	s.handleUpdate(callback(1, 1, image.RefreshImageCallbackPrefix))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 0 {
+		t.Fatalf("sent %d photos to user during maintenance", len(photos))
+	}
+
+	if got := tg.messages(1); len(got) != 1 || got[0] != maintenance {
+		t.Errorf("user got replies %q, want %q", got, maintenance)
+	}
+
+	if got := tg.answers(); len(got) != 1 || got[0] != maintenance {
+		t.Errorf("user button press got answers %q, want %q", got, maintenance)
+	}
+
+	// admins keep using both regular and admin commands
+	s.handleUpdate(command(testAdminID, testAdminID, "/peepo"))
+	s.handleUpdate(command(testAdminID, testAdminID, "/maintenance off"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Errorf("sent %d photos to admin during maintenance, want 1", len(photos))
+	}
+
+	if s.services.State.Maintenance() {
+		t.Fatal("admin could not turn maintenance off")
+	}
+
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 2 {
+		t.Errorf("user got no photo after maintenance")
+	}
+}
+
+func TestUsersCanNotAddImages(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	update := command(1, 1, "/add_image happy")
+	update.Message.Photo = []tgbotapi.PhotoSize{{FileID: "photo", FileUniqueID: "photo", Width: 100, Height: 100}}
+
+	s.handleUpdate(update)
+
+	unknown := i18n.T(i18n.DefaultLang, i18n.KeyUnknownCommand)
+	if got := tg.messages(1); len(got) != 1 || got[0] != unknown {
+		t.Fatalf("/add_image from user got replies %q, want %q", got, unknown)
+	}
+
+	if count, err := s.services.Image.CountImages(context.Background(), ""); err != nil || count != 0 {
+		t.Errorf("library has %d images, %v, want none added by user", count, err)
+	}
+}
+
+func TestAddImageRequiresPicture(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	s.handleUpdate(command(testAdminID, testAdminID, "/add_image happy"))
+
+	if got := tg.messages(testAdminID); len(got) != 1 || !strings.HasPrefix(got[0], "Please send a photo") {
+		t.Fatalf("/add_image without picture got replies %q, want request to send photo", got)
+	}
+
+	if count, err := s.services.Image.CountImages(context.Background(), ""); err != nil || count != 0 {
+		t.Errorf("library has %d images, %v, want none added", count, err)
+	}
+}
+
+func TestCallbacksAreRouted(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.NextButtonCooldown = time.Minute })
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	s.handleUpdate(callback(1, 1, image.RefreshImageCallbackPrefix))
+
+	if edits := tg.calls("editMessageMedia"); len(edits) != 1 {
+		t.Fatalf("Next button edited %d messages, want 1", len(edits))
+	}
+
+	if got := tg.answers(); len(got) != 1 || got[0] != "" {
+		t.Fatalf("Next button got answers %q, want one empty answer", got)
+	}
+
+	// button has own cooldown, so the second press is rejected without editing message
+	s.handleUpdate(callback(1, 1, image.RefreshImageCallbackPrefix))
+
+	if edits := tg.calls("editMessageMedia"); len(edits) != 1 {
+		t.Errorf("second press edited message during cooldown")
+	}
+
+	if got := tg.answers(); len(got) != 2 || !strings.Contains(got[1], "cooldown") {
+		t.Errorf("second press got answers %q, want cooldown answer", got)
+	}
+
+	// commands are not blocked by button cooldown
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Errorf("/peepo after button press sent %d photos, want 1", len(photos))
+	}
+}
+
+func TestUnknownCallbackIsIgnored(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	s.handleUpdate(callback(1, 1, "no_such_button:1"))
+
+	if len(tg.calls("answerCallbackQuery")) != 0 || len(tg.calls("sendMessage")) != 0 {
+		t.Error("bot replied to unknown button")
+	}
+}
+
+func TestUpdatesWithoutMessageAreIgnored(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	noFrom := command(1, 1, "/help")
+	noFrom.Message.From = nil
+
+	noMessage := callback(1, 1, image.RefreshImageCallbackPrefix)
+	noMessage.CallbackQuery.Message = nil
+
+	tests := []struct {
+		name   string
+		update *tgbotapi.Update
+		// wantReplies is number of messages sent to chat
+		wantReplies int
+	}{
+		{name: "empty update", update: &tgbotapi.Update{UpdateID: 1}},
+		{name: "edited message", update: &tgbotapi.Update{EditedMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "/peepo"}}},
+		{name: "callback without message", update: noMessage},
+		// anonymous group admins send commands without user
+		{name: "command without sender", update: noFrom, wantReplies: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tg.reset()
+
+			// must not panic
+			s.handleUpdate(tt.update)
+
+			if got := tg.messages(1); len(got) != tt.wantReplies {
+				t.Errorf("got replies %q, want %d", got, tt.wantReplies)
+			}
+		})
+	}
+}
+
+func TestCommandInCaptionIsHandled(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	update := command(1, 1, "/no_such_command")
+	update.Message.Caption, update.Message.CaptionEntities = update.Message.Text, update.Message.Entities
+	update.Message.Text, update.Message.Entities = "", nil
+	update.Message.Photo = []tgbotapi.PhotoSize{{FileID: "photo"}}
+
+	s.handleUpdate(update)
+
+	unknown := i18n.T(i18n.DefaultLang, i18n.KeyUnknownCommand)
+	if got := tg.messages(1); len(got) != 1 || got[0] != unknown {
+		t.Errorf("command in caption got replies %q, want %q", got, unknown)
+	}
+}
+
+func TestBusyPoolRejectsCommands(t *testing.T) {
+	s, tg := newTestServer(t, nil)
+
+	s.pool.Stop()
+	s.pool = workerpool.New(1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// one task occupies the worker and another one the queue
+	s.submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	s.submit(func() { <-release })
+
+	for _, update := range []*tgbotapi.Update{
+		command(1, 1, "/peepo"),
+		{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 2, Type: "private"}, Text: "hi"}},
+	} {
+		if s.submit(func() { s.handleUpdate(update) }) {
+			t.Fatal("update accepted by saturated pool")
+		}
+
+		s.rejectBusy(update)
+	}
+
+	close(release)
+
+	if got := tg.messages(1); len(got) != 1 || !strings.Contains(got[0], "busy") {
+		t.Errorf("rejected command got replies %q, want busy reply", got)
+	}
+
+	// users are not told about dropped regular messages
+	if got := tg.messages(2); len(got) != 0 {
+		t.Errorf("rejected message got replies %q", got)
+	}
+
+	if !s.waitInFlight(time.Second) {
+		t.Error("rejected updates are counted as running")
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		name     string
+		updateID int
+		savedAgo time.Duration
+		want     bool
+	}{
+		{"new update", 11, time.Minute, false},
+		{"redelivered update", 10, time.Minute, true},
+		{"older update", 5, time.Minute, true},
+		{"ids reset after long idle", 5, updateIDResetPeriod + time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{lastUpdateID: 10, lastUpdateAt: time.Now().Add(-tt.savedAgo)}
+
+			if got := s.isDuplicate(tgbotapi.Update{UpdateID: tt.updateID}); got != tt.want {
+				t.Errorf("isDuplicate(%d) = %t, want %t", tt.updateID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollingResumesFromSavedOffset(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	ctx := context.Background()
+
+	s.services.State.SaveUpdateOffset(ctx, 41)
+
+	id, savedAt := s.services.State.UpdateOffset(ctx)
+	if id != 41 || time.Since(savedAt) > time.Minute {
+		t.Fatalf("got saved offset %d at %s, want 41 saved now", id, savedAt)
+	}
+
+	s.lastUpdateID = id
+
+	_, err := s.listenUpdates()
+	if err != nil {
+		t.Fatalf("can not listen for updates: %v", err)
+	}
+	defer s.poller.Stop()
+
+	if got := s.poller.config.Offset; got != 42 {
+		t.Errorf("polling starts from offset %d, want 42", got)
+	}
+}
+
+func TestUpdateOffsetIsSavedOnlyWhenChanged(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	ctx := context.Background()
+
+	s.lastUpdateID = 7
+	s.saveUpdateOffset()
+
+	if id, _ := s.services.State.UpdateOffset(ctx); id != 7 {
+		t.Fatalf("saved offset %d, want 7", id)
+	}
+
+	// offset saved elsewhere is not overwritten while no new updates are received
+	s.services.State.SaveUpdateOffset(ctx, 3)
+	s.saveUpdateOffset()
+
+	if id, _ := s.services.State.UpdateOffset(ctx); id != 3 {
+		t.Errorf("unchanged offset was saved again, got %d", id)
+	}
+
+	s.lastUpdateID = 8
+	s.saveUpdateOffset()
+
+	if id, _ := s.services.State.UpdateOffset(ctx); id != 8 {
+		t.Errorf("saved offset %d, want 8", id)
+	}
+}
+
+func TestAliasSharesCommandCooldown(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) {
+		cfg.CommandCooldown = time.Minute
+		cfg.Aliases = map[string]string{"p": "peepo"}
+	})
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	s.handleUpdate(command(1, 1, "/p"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Fatalf("/p sent %d photos, want 1", len(photos))
+	}
+
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Errorf("/peepo sent photo right after /p, want it on cooldown")
+	}
+
+	if got := tg.messages(1); len(got) != 1 || !strings.Contains(got[0], "cooldown") {
+		t.Errorf("/peepo got replies %q, want cooldown reply", got)
+	}
+}
+
+func TestCheapCommandIsNotBlockedByExpensiveOne(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) {
+		cfg.CommandCooldown = time.Minute
+		cfg.CommandCooldowns = map[string]time.Duration{HelpCommand: time.Second}
+	})
+	for i := 0; i < 5; i++ {
+		testutil.AddImage(t, s.services.Image, fmt.Sprintf("%02d.jpg", i))
+	}
+
+	s.handleUpdate(command(1, 1, "/peepo_many 2"))
+	s.handleUpdate(command(1, 1, "/help"))
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if groups := tg.calls("sendMediaGroup"); len(groups) != 1 {
+		t.Fatalf("/peepo_many sent %d albums, want 1", len(groups))
+	}
+
+	got := tg.messages(1)
+	if len(got) != 1 || !strings.Contains(got[0], "/peepo") {
+		t.Errorf("/help after /peepo_many got replies %q, want help", got)
+	}
+
+	// shared cooldown is not started by command with own one
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Errorf("/peepo after /peepo_many sent %d photos, want 1", len(photos))
+	}
+
+	// expensive command is still limited by its own budget
+	s.handleUpdate(command(1, 1, "/peepo_many 2"))
+
+	if groups := tg.calls("sendMediaGroup"); len(groups) != 1 {
+		t.Errorf("second /peepo_many sent album, want it on cooldown")
+	}
+
+	if got = tg.messages(1); len(got) != 2 || !strings.Contains(got[1], "cooldown") {
+		t.Errorf("second /peepo_many got replies %q, want cooldown reply", got)
+	}
+}
+
+// writeCooldownConfig writes shipped config to folder with command_cooldown replaced
+func writeCooldownConfig(t *testing.T, folder string, cooldown string) {
+	t.Helper()
+
+	data, err := os.ReadFile("../../config/config.yaml")
+	if err != nil {
+		t.Fatalf("can not read shipped config: %v", err)
+	}
+
+	data = regexp.MustCompile(`(?m)^command_cooldown:.*$`).ReplaceAll(data, []byte("command_cooldown: "+cooldown))
+
+	if err = os.WriteFile(filepath.Join(folder, "config.yaml"), data, 0o644); err != nil {
+		t.Fatalf("can not write config: %v", err)
+	}
+}
+
+func TestReloadedCooldownTakesEffect(t *testing.T) {
+	folder := t.TempDir()
+	writeCooldownConfig(t, folder, "1h")
+
+	s, tg := newTestServerFrom(t, folder, nil)
+	for i := 0; i < 3; i++ {
+		testutil.AddImage(t, s.services.Image, fmt.Sprintf("%02d.jpg", i))
+	}
+
+	many, _ := s.router.Get(PeepoManyCommand)
+
+	s.handleUpdate(command(1, 1, "/peepo"))
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Fatalf("sent %d photos, want the second /peepo on cooldown", len(photos))
+	}
+
+	if cd, _ := s.commandCooldown(many); cd != time.Duration(s.cfg.MaxBatchSize)*time.Hour {
+		t.Errorf("/peepo_many cooldown = %s, want batch size times global one", cd)
+	}
+
+	writeCooldownConfig(t, folder, "1ms")
+
+	if _, err := s.cfg.Reload(); err != nil {
+		t.Fatalf("can not reload config: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 2 {
+		t.Errorf("sent %d photos, want /peepo allowed with reloaded cooldown", len(photos))
+	}
+
+	if cd, _ := s.commandCooldown(many); cd != time.Duration(s.cfg.MaxBatchSize)*time.Millisecond {
+		t.Errorf("/peepo_many cooldown after reload = %s, want it to follow global one", cd)
+	}
+}
+
+func TestHelpListsAliases(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) {
+		cfg.Aliases = map[string]string{"p": "peepo", "pp": "p"}
+	})
+
+	s.handleUpdate(command(1, 1, "/help"))
+
+	got := tg.messages(1)
+	if len(got) != 1 {
+		t.Fatalf("/help got %d replies, want 1", len(got))
+	}
+
+	if !strings.Contains(got[0], "(/p, /pp) - Get random picture") {
+		t.Errorf("help %q does not list aliases of /peepo", got[0])
+	}
+}
+
+func TestPanicInHandlerDoesNotStopBot(t *testing.T) {
+	for _, notify := range []bool{false, true} {
+		t.Run(fmt.Sprintf("notify admins %t", notify), func(t *testing.T) {
+			s, tg := newTestServer(t, func(cfg *config.Config) { cfg.NotifyAdminsOnPanic = notify })
+			testutil.AddImage(t, s.services.Image, "01.jpg")
+
+			s.router.Register(Command{
+				Name:       "boom",
+				NoCooldown: true,
+				Handler: func(context.Context, *tgbotapi.Message) {
+					panic("something broke")
+				},
+			})
+
+			// updates are submitted the same way as in Start
+			for _, update := range []*tgbotapi.Update{command(1, 1, "/boom"), command(1, 1, "/peepo")} {
+				s.submit(func() {
+					defer s.recoverUpdate(update)
+
+					s.handleUpdate(update)
+				})
+
+				if !s.waitInFlight(time.Second) {
+					t.Fatal("update is still being handled")
+				}
+			}
+
+			if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+				t.Errorf("update after panic sent %d photos, want 1", len(photos))
+			}
+
+			got := tg.messages(testAdminID)
+			if !notify {
+				if len(got) != 0 {
+					t.Errorf("admin got messages %q with notifications disabled", got)
+				}
+
+				return
+			}
+
+			if len(got) != 1 || !strings.Contains(got[0], "/boom") || !strings.Contains(got[0], "something broke") {
+				t.Errorf("admin got messages %q, want panic report for /boom", got)
+			}
+		})
+	}
+}
+
+func TestCooldownExemptUsersAreNotThrottled(t *testing.T) {
+	const exemptID, userID = 7, 8
+
+	s, tg := newTestServer(t, func(cfg *config.Config) {
+		cfg.CommandCooldown = time.Minute
+		cfg.CooldownExemptIDs = []int64{exemptID}
+	})
+	for i := 0; i < 5; i++ {
+		testutil.AddImage(t, s.services.Image, fmt.Sprintf("%02d.jpg", i))
+	}
+
+	for _, chatID := range []int64{exemptID, userID} {
+		s.handleUpdate(command(chatID, chatID, "/peepo"))
+		s.handleUpdate(command(chatID, chatID, "/peepo"))
+	}
+
+	photos := map[string]int{}
+	for _, call := range tg.calls("sendPhoto") {
+		photos[call.params.Get("chat_id")]++
+	}
+
+	if got := photos[fmt.Sprint(exemptID)]; got != 2 {
+		t.Errorf("exempt user got %d photos, want 2", got)
+	}
+
+	if got := tg.messages(exemptID); len(got) != 0 {
+		t.Errorf("exempt user got replies %q", got)
+	}
+
+	if left := s.services.Cooldown.Remaining(s.cooldownKeyFor(exemptID, &tgbotapi.User{ID: exemptID}), time.Minute); left > 0 {
+		t.Errorf("exempt user started cooldown of %s", left)
+	}
+
+	if got := photos[fmt.Sprint(userID)]; got != 1 {
+		t.Errorf("regular user got %d photos, want 1", got)
+	}
+
+	if got := tg.messages(userID); len(got) != 1 || !strings.Contains(got[0], "cooldown") {
+		t.Errorf("regular user got replies %q, want cooldown reply", got)
+	}
+}
+
+func TestAddressedTo(t *testing.T) {
+	tests := []struct {
+		name           string
+		chatID         int64
+		text           string
+		requireMention bool
+		want           bool
+	}{
+		{"private without mention", 1, "/peepo", false, true},
+		{"private without mention when mention required", 1, "/peepo", true, true},
+		{"group without mention", -1, "/peepo", false, true},
+		{"group without mention when mention required", -1, "/peepo", true, false},
+		{"mention of this bot", -1, "/peepo@" + testBotUsername, true, true},
+		{"mention of this bot in other case", -1, "/peepo@Peepo_Bot", true, true},
+		{"mention of another bot", -1, "/peepo@other_bot", false, false},
+		{"mention of another bot in private chat", 1, "/peepo@other_bot", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := command(tt.chatID, 1, tt.text).Message
+
+			if got := addressedTo(message, testBotUsername, tt.requireMention); got != tt.want {
+				t.Errorf("addressedTo(%q) = %t, want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsForOtherBotsAreIgnored(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.RequireMentionInGroups = true })
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	s.handleUpdate(command(-1, 1, "/peepo@other_bot"))
+	s.handleUpdate(command(-2, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 0 {
+		t.Fatalf("commands not meant for bot sent photos %v", photos)
+	}
+
+	if got := append(tg.messages(-1), tg.messages(-2)...); len(got) != 0 {
+		t.Fatalf("commands not meant for bot got replies %q", got)
+	}
+
+	s.handleUpdate(command(-3, 1, "/peepo@"+testBotUsername))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Errorf("command with mention of bot sent %d photos, want 1", len(photos))
+	}
+}
+
+// membership returns update about bot status in chat changed from old to new one
+func membership(chatID int64, oldStatus, newStatus string) *tgbotapi.Update {
+	return &tgbotapi.Update{
+		MyChatMember: &tgbotapi.ChatMemberUpdated{
+			Chat:          tgbotapi.Chat{ID: chatID, Type: "group"},
+			From:          tgbotapi.User{ID: 1},
+			OldChatMember: tgbotapi.ChatMember{Status: oldStatus},
+			NewChatMember: tgbotapi.ChatMember{Status: newStatus},
+		},
+	}
+}
+
+func TestNewChatsAreGreetedOnce(t *testing.T) {
+	welcome := i18n.T(i18n.DefaultLang, i18n.KeyWelcome)
+
+	greetings := func(tg *fakeTelegram, chatID int64) int {
+		n := 0
+		for _, text := range tg.messages(chatID) {
+			if text == welcome {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		greet   bool
+		chatID  int64
+		updates []*tgbotapi.Update
+		want    int
+	}{
+		{
+			name:   "bot added to group",
+			greet:  true,
+			chatID: -5,
+			updates: []*tgbotapi.Update{
+				membership(-5, "left", "member"),
+				command(-5, 1, "/peepo"),
+				command(-5, 2, "/peepo"),
+			},
+			want: 1,
+		},
+		{
+			name:   "bot removed and added again",
+			greet:  true,
+			chatID: -5,
+			updates: []*tgbotapi.Update{
+				membership(-5, "left", "member"),
+				membership(-5, "member", "kicked"),
+				membership(-5, "left", "administrator"),
+			},
+			want: 1,
+		},
+		{
+			// bot was added before greetings were enabled
+			name:   "group seen first by command",
+			greet:  true,
+			chatID: -6,
+			updates: []*tgbotapi.Update{
+				command(-6, 1, "/peepo"),
+				command(-6, 2, "/peepo"),
+			},
+			want: 1,
+		},
+		{
+			name:   "private chat",
+			greet:  true,
+			chatID: 1,
+			updates: []*tgbotapi.Update{
+				command(1, 1, "/peepo"),
+			},
+		},
+		{
+			name:   "greetings disabled",
+			chatID: -5,
+			updates: []*tgbotapi.Update{
+				membership(-5, "left", "member"),
+				command(-5, 1, "/peepo"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, tg := newTestServer(t, func(cfg *config.Config) { cfg.GreetNewChats = tt.greet })
+			testutil.AddImage(t, s.services.Image, "01.jpg")
+
+			for _, update := range tt.updates {
+				s.handleUpdate(update)
+			}
+
+			if got := greetings(tg, tt.chatID); got != tt.want {
+				t.Errorf("chat got %d greetings, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCooldownStatusReportsRemainingTime(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.CommandCooldown = time.Minute })
+	testutil.AddImage(t, s.services.Image, "01.jpg")
+
+	s.handleUpdate(command(1, 1, "/cooldown"))
+
+	none := i18n.T(i18n.DefaultLang, i18n.KeyCooldownNone)
+	if got := tg.messages(1); len(got) != 1 || got[0] != none {
+		t.Fatalf("/cooldown without cooldown got replies %q, want %q", got, none)
+	}
+
+	// status check does not start cooldown
+	s.handleUpdate(command(1, 1, "/peepo"))
+
+	if photos := tg.calls("sendPhoto"); len(photos) != 1 {
+		t.Fatalf("/peepo after /cooldown sent %d photos, want 1", len(photos))
+	}
+
+	tg.reset()
+	s.handleUpdate(command(1, 1, "/cooldown"))
+
+	left := s.services.Cooldown.Remaining(s.cooldownKeyFor(1, &tgbotapi.User{ID: 1}), time.Minute)
+
+	got := tg.messages(1)
+	if len(got) != 1 {
+		t.Fatalf("/cooldown got %d replies, want 1", len(got))
+	}
+
+	// reply ends with "<seconds> sec"
+	fields := strings.Fields(got[0])
+	if len(fields) < 2 {
+		t.Fatalf("/cooldown got reply %q, want remaining time", got[0])
+	}
+
+	seconds, err := strconv.ParseFloat(fields[len(fields)-2], 64)
+	if err != nil {
+		t.Fatalf("can not parse remaining time from %q: %v", got[0], err)
+	}
+
+	if diff := left.Seconds() - seconds; diff < -0.1 || diff > 0.1 {
+		t.Errorf("/cooldown reported %.1f sec, cooldown entry has %.1f sec left", seconds, left.Seconds())
+	}
+
+	// status check does not reset cooldown
+	if again := s.services.Cooldown.Remaining(s.cooldownKeyFor(1, &tgbotapi.User{ID: 1}), time.Minute); again > left {
+		t.Errorf("cooldown grew from %s to %s after /cooldown", left, again)
+	}
+}
+
+func TestCooldownScope(t *testing.T) {
+	const chatID = -1
+
+	tests := []struct {
+		scope string
+		// wantPhotos is number of pictures sent after two users asked twice each
+		wantPhotos int
+	}{
+		{scope: config.CooldownScopeUser, wantPhotos: 2},
+		{scope: config.CooldownScopeChat, wantPhotos: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			s, tg := newTestServer(t, func(cfg *config.Config) {
+				cfg.CommandCooldown = time.Minute
+				cfg.CooldownScope = tt.scope
+			})
+			for i := 0; i < 5; i++ {
+				testutil.AddImage(t, s.services.Image, fmt.Sprintf("%02d.jpg", i))
+			}
+
+			for _, userID := range []int64{1, 2, 1, 2} {
+				s.handleUpdate(command(chatID, userID, "/peepo"))
+			}
+
+			if photos := tg.calls("sendPhoto"); len(photos) != tt.wantPhotos {
+				t.Errorf("got %d photos, want %d", len(photos), tt.wantPhotos)
+			}
+
+			replies := tg.messages(chatID)
+			if len(replies) != 4-tt.wantPhotos {
+				t.Fatalf("got replies %q, want %d cooldown replies", replies, 4-tt.wantPhotos)
+			}
+
+			for _, reply := range replies {
+				// reply mentions remaining time, e.g. "Command on cooldown for 59.9 sec"
+				if !strings.Contains(reply, "cooldown for") || !strings.HasSuffix(reply, "sec") {
+					t.Errorf("got reply %q, want cooldown with remaining time", reply)
+				}
+			}
+		})
+	}
+}
+
+// slowRepository stands for db query stuck longer than request timeout, it returns early only if context is done
+type slowRepository struct {
+	delay time.Duration
+}
+
+func (r slowRepository) Query(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestSlowCommandRepliesOnTimeout(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.RequestTimeout = 50 * time.Millisecond })
+
+	repo := slowRepository{delay: 5 * time.Second}
+
+	var queryErr error
+	s.router.Register(Command{
+		Name:       "slow",
+		NoCooldown: true,
+		Handler: func(ctx context.Context, message *tgbotapi.Message) {
+			queryErr = repo.Query(ctx)
+		},
+	})
+
+	start := time.Now()
+	s.handleUpdate(command(1, 1, "/slow"))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handling took %s, want it to stop at request timeout", elapsed)
+	}
+
+	if !errors.Is(queryErr, context.DeadlineExceeded) {
+		t.Errorf("query returned %v, want deadline exceeded", queryErr)
+	}
+
+	want := i18n.T(i18n.DefaultLang, i18n.KeyTimeout)
+	if got := tg.messages(1); len(got) != 1 || got[0] != want {
+		t.Errorf("got replies %q, want %q", got, want)
+	}
+}
+
+func TestLongRunningCommandIsStoppedOnlyByShutdown(t *testing.T) {
+	s, tg := newTestServer(t, func(cfg *config.Config) { cfg.RequestTimeout = 20 * time.Millisecond })
+
+	repo := slowRepository{delay: 100 * time.Millisecond}
+
+	queryErrs := make(chan error, 2)
+	s.router.Register(Command{
+		Name:        "long",
+		NoCooldown:  true,
+		LongRunning: true,
+		Handler: func(ctx context.Context, message *tgbotapi.Message) {
+			queryErrs <- repo.Query(ctx)
+		},
+	})
+
+	// outlives request timeout
+	s.handleUpdate(command(1, 1, "/long"))
+
+	if err := <-queryErrs; err != nil {
+		t.Errorf("long running command got %v, want it to outlive request timeout", err)
+	}
+
+	if got := tg.messages(1); len(got) != 0 {
+		t.Errorf("got replies %q, want no timeout reply", got)
+	}
+
+	// stopped by handlers cancellation on shutdown
+	repo.delay = 5 * time.Second
+	time.AfterFunc(20*time.Millisecond, s.cancelHandlers)
+
+	s.handleUpdate(command(1, 1, "/long"))
+
+	if err := <-queryErrs; !errors.Is(err, context.Canceled) {
+		t.Errorf("long running command got %v after handlers were cancelled, want context canceled", err)
+	}
+}
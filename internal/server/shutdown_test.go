@@ -0,0 +1,110 @@
+package server
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/service"
+	"apubot/internal/service/subscription"
+	"apubot/pkg/utils/workerpool"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newShutdownServer creates server with only parts used by shutdown
+func newShutdownServer(timeout time.Duration) *Server {
+	cfg := &config.Config{ShutdownTimeout: timeout}
+	log := discardLogger()
+
+	handlersCtx, cancelHandlers := context.WithCancel(context.Background())
+
+	return &Server{
+		cfg:            cfg,
+		log:            log,
+		services:       &service.Services{Subscription: subscription.New(cfg, log, nil)},
+		pool:           workerpool.New(2, 2),
+		poller:         newPoller((&fakeUpdates{}).get, tgbotapi.NewUpdate(0), log),
+		handlersCtx:    handlersCtx,
+		cancelHandlers: cancelHandlers,
+	}
+}
+
+func TestShutdownWaitsForRunningHandlers(t *testing.T) {
+	s := newShutdownServer(time.Second)
+
+	var finished atomic.Bool
+	started := make(chan struct{})
+
+	s.submit(func() {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	})
+	<-started
+
+	s.shutdown()
+
+	if !finished.Load() {
+		t.Fatal("shutdown returned before handler finished")
+	}
+
+	if !s.Drained() {
+		t.Error("server is not drained after handlers finished")
+	}
+}
+
+func TestShutdownCancelsHandlersAfterTimeout(t *testing.T) {
+	s := newShutdownServer(20 * time.Millisecond)
+
+	var cancelled atomic.Bool
+	started := make(chan struct{})
+
+	s.submit(func() {
+		close(started)
+
+		select {
+		case <-s.handlersCtx.Done():
+			cancelled.Store(true)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	<-started
+
+	s.shutdown()
+
+	if !cancelled.Load() {
+		t.Fatal("handler context was not cancelled")
+	}
+
+	if !s.Drained() {
+		t.Error("server is not drained after cancelled handler returned")
+	}
+}
+
+func TestShutdownTimeoutLeavesHandlersRunning(t *testing.T) {
+	s := newShutdownServer(20 * time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+
+	// handler ignoring cancellation, e.g. stuck in a call without context
+	s.submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	start := time.Now()
+	s.shutdown()
+
+	if elapsed := time.Since(start); elapsed > s.cfg.ShutdownTimeout+cancelGracePeriod+time.Second {
+		t.Errorf("shutdown took %s, want it to give up after timeout", elapsed)
+	}
+
+	if s.Drained() {
+		t.Error("server reported drained while handler is still running")
+	}
+}
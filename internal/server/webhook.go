@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// listenUpdates returns updates channel fed either by webhook or by long polling
+func (s *Server) listenUpdates() (tgbotapi.UpdatesChannel, error) {
+	if s.cfg.WebhookURL == "" {
+		u := tgbotapi.NewUpdate(s.lastUpdateID + 1)
+		u.Timeout = int(s.cfg.PollTimeout.Seconds())
+		u.AllowedUpdates = s.cfg.AllowedUpdates
+
+		updatesChan := make(chan tgbotapi.Update, s.cfg.UpdateBufferSize)
+
+		s.poller = newPoller(s.bot.GetUpdates, u, s.log)
+		go s.poller.run(updatesChan)
+
+		return updatesChan, nil
+	}
+
+	wh, err := tgbotapi.NewWebhook(s.cfg.WebhookURL)
+	if err != nil {
+		return nil, err
+	}
+
+	wh.AllowedUpdates = s.cfg.AllowedUpdates
+
+	_, err = s.bot.Request(wh)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookURL, err := url.Parse(s.cfg.WebhookURL)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := webhookURL.Path
+	if pattern == "" {
+		pattern = "/"
+	}
+
+	updatesChan := s.bot.ListenForWebhook(pattern)
+
+	s.webhookServer = &http.Server{Addr: s.cfg.WebhookListenAddr}
+
+	go func() {
+		err := s.webhookServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("Error serving webhook", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	s.log.Info("Listening for webhook updates", "addr", s.cfg.WebhookListenAddr)
+
+	return updatesChan, nil
+}
+
+// stopUpdates stops long polling or removes webhook and stops its HTTP server
+func (s *Server) stopUpdates() {
+	if s.webhookServer == nil {
+		s.poller.Stop()
+
+		return
+	}
+
+	_, err := s.bot.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		s.log.Error("Error removing webhook", "err", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = s.webhookServer.Shutdown(ctx)
+	if err != nil {
+		s.log.Error("Error stopping webhook server", "err", err)
+	}
+}
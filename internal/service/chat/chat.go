@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/logger"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+	"time"
+)
+
+type Service struct {
+	cfg      *config.Config
+	log      logger.Logger
+	repo     ChatRepository
+	known    map[int64]struct{}
+	settings map[int64]domain.ChatSettings
+	mu       sync.RWMutex
+	// hotLog collapses settings read errors as settings are read for most updates
+	hotLog logger.Logger
+}
+
+func New(cfg *config.Config, log logger.Logger, repo ChatRepository) *Service {
+	service := &Service{
+		cfg:      cfg,
+		log:      log,
+		hotLog:   logger.Deduplicate(log, cfg.LogDedupWindow),
+		repo:     repo,
+		known:    make(map[int64]struct{}),
+		settings: make(map[int64]domain.ChatSettings),
+		mu:       sync.RWMutex{},
+	}
+
+	ids, err := repo.GetAllIDs(context.Background())
+	if err != nil {
+		log.Error("Can not initialize Chat service", "err", err)
+		os.Exit(1)
+	}
+
+	for _, id := range ids {
+		service.known[id] = struct{}{}
+	}
+
+	return service
+}
+
+// Register saves chat as known, db is touched only for chats seen for the first time.
+// True is returned once per chat, concurrent updates from new chat report it to one caller only.
+func (s *Service) Register(ctx context.Context, chatId int64) (isNew bool) {
+	s.mu.RLock()
+	_, ok := s.known[chatId]
+	s.mu.RUnlock()
+
+	if ok {
+		return false
+	}
+
+	s.mu.Lock()
+	if _, ok = s.known[chatId]; ok {
+		s.mu.Unlock()
+
+		return false
+	}
+	s.known[chatId] = struct{}{}
+	s.mu.Unlock()
+
+	err := s.repo.SaveChat(ctx, chatId, time.Now().Unix())
+	if err != nil {
+		s.log.Error("Can not save chat", "chat_id", chatId, "err", err)
+
+		// chat is registered again on next update
+		s.mu.Lock()
+		delete(s.known, chatId)
+		s.mu.Unlock()
+
+		return false
+	}
+
+	return true
+}
+
+func (s *Service) ListIDs(ctx context.Context) ([]int64, error) {
+	ids, err := s.repo.GetAllIDs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get chats")
+	}
+
+	return ids, nil
+}
+
+// GetSettings returns chat settings, defaults are used for chats without saved ones.
+// Defaults are returned with error too, so callers that must not guess settings (e.g. opt out) can tell them apart.
+func (s *Service) GetSettings(ctx context.Context, chatId int64) (domain.ChatSettings, error) {
+	s.mu.RLock()
+	settings, ok := s.settings[chatId]
+	s.mu.RUnlock()
+
+	if ok {
+		return settings, nil
+	}
+
+	settings, err := s.repo.GetSettings(ctx, chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		settings = domain.DefaultChatSettings(chatId)
+	} else if err != nil {
+		// do not cache so settings are read again next time
+		s.hotLog.Error("Can not get chat settings", "chat_id", chatId, "err", err)
+
+		return domain.DefaultChatSettings(chatId), errors.Wrap(err, "can not get chat settings")
+	}
+
+	s.mu.Lock()
+	s.settings[chatId] = settings
+	s.mu.Unlock()
+
+	return settings, nil
+}
+
+func (s *Service) SetRating(ctx context.Context, chatId int64, rating string) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.Rating = rating
+
+	return s.saveSettings(ctx, settings)
+}
+
+func (s *Service) SetLanguage(ctx context.Context, chatId int64, language string) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.Language = language
+
+	return s.saveSettings(ctx, settings)
+}
+
+// SetCooldown overrides command cooldown in chat, 0 restores global one
+func (s *Service) SetCooldown(ctx context.Context, chatId int64, cooldown time.Duration) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.Cooldown = int64(cooldown.Seconds())
+
+	return s.saveSettings(ctx, settings)
+}
+
+// SetQuietHours sets window in minutes since midnight when scheduled pictures are not delivered, equal values disable it
+func (s *Service) SetQuietHours(ctx context.Context, chatId int64, start int, end int) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.QuietStart = start
+	settings.QuietEnd = end
+
+	return s.saveSettings(ctx, settings)
+}
+
+func (s *Service) SetTimezone(ctx context.Context, chatId int64, timezone string) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.Timezone = timezone
+
+	return s.saveSettings(ctx, settings)
+}
+
+func (s *Service) SetHDMode(ctx context.Context, chatId int64, on bool) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.HDMode = on
+
+	return s.saveSettings(ctx, settings)
+}
+
+// SetStopped opts chat out of scheduled pictures and broadcasts or back in
+func (s *Service) SetStopped(ctx context.Context, chatId int64, stopped bool) error {
+	settings, err := s.GetSettings(ctx, chatId)
+	if err != nil {
+		return err
+	}
+
+	settings.Stopped = stopped
+
+	return s.saveSettings(ctx, settings)
+}
+
+// SaveSettings replaces all chat settings at once
+func (s *Service) SaveSettings(ctx context.Context, settings domain.ChatSettings) error {
+	return s.saveSettings(ctx, settings)
+}
+
+func (s *Service) saveSettings(ctx context.Context, settings domain.ChatSettings) error {
+	err := s.repo.SaveSettings(ctx, settings)
+	if err != nil {
+		return errors.Wrap(err, "can not save chat settings")
+	}
+
+	s.mu.Lock()
+	s.settings[settings.ChatID] = settings
+	s.mu.Unlock()
+
+	return nil
+}
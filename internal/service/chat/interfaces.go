@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"time"
+)
+
+type ChatService interface {
+	Register(ctx context.Context, chatId int64) (isNew bool)
+	ListIDs(ctx context.Context) ([]int64, error)
+	GetSettings(ctx context.Context, chatId int64) (domain.ChatSettings, error)
+	SetRating(ctx context.Context, chatId int64, rating string) error
+	SetLanguage(ctx context.Context, chatId int64, language string) error
+	SetCooldown(ctx context.Context, chatId int64, cooldown time.Duration) error
+	SetQuietHours(ctx context.Context, chatId int64, start int, end int) error
+	SetTimezone(ctx context.Context, chatId int64, timezone string) error
+	SetHDMode(ctx context.Context, chatId int64, on bool) error
+	SetStopped(ctx context.Context, chatId int64, stopped bool) error
+	SaveSettings(ctx context.Context, settings domain.ChatSettings) error
+}
+
+type ChatRepository interface {
+	SaveChat(ctx context.Context, chatId int64, seenAt int64) error
+	GetAllIDs(ctx context.Context) (ids []int64, err error)
+	GetSettings(ctx context.Context, chatId int64) (settings domain.ChatSettings, err error)
+	SaveSettings(ctx context.Context, settings domain.ChatSettings) error
+}
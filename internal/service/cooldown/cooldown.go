@@ -0,0 +1,77 @@
+package cooldown
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/logger"
+	"context"
+	"github.com/patrickmn/go-cache"
+	"time"
+)
+
+type Service struct {
+	cfg       *config.Config
+	log       logger.Logger
+	repo      CooldownRepository
+	lastUsage *cache.Cache
+}
+
+func New(cfg *config.Config, log logger.Logger, repo CooldownRepository) *Service {
+	service := &Service{
+		cfg:       cfg,
+		log:       log,
+		repo:      repo,
+		lastUsage: cache.New(cfg.CommandCooldown, 5*time.Minute),
+	}
+
+	err := service.restore(context.Background())
+	if err != nil {
+		log.Error("Can not restore cooldowns", "err", err)
+	}
+
+	return service
+}
+
+// restore loads not yet expired cooldowns saved before restart
+func (s *Service) restore(ctx context.Context) error {
+	cds, err := s.repo.LoadCooldowns(ctx, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	for _, cd := range cds {
+		s.lastUsage.Set(cd.Key, cd.UsedAtAsUnixTime(), time.Until(cd.ExpiresAtAsUnixTime()))
+	}
+
+	s.log.Info("Restored cooldowns", "count", len(cds))
+
+	return nil
+}
+
+// Remaining returns time left until cooldown for key expires
+func (s *Service) Remaining(key string, cooldown time.Duration) time.Duration {
+	lastTime, ok := s.lastUsage.Get(key)
+	if !ok {
+		return 0
+	}
+
+	return max(cooldown-time.Since(lastTime.(time.Time)), 0)
+}
+
+// Touch starts cooldown for key
+func (s *Service) Touch(ctx context.Context, key string, cooldown time.Duration) {
+	now := time.Now()
+
+	s.lastUsage.Set(key, now, cooldown)
+
+	cd := domain.Cooldown{
+		Key:       key,
+		UsedAt:    now.Unix(),
+		ExpiresAt: now.Add(cooldown).Unix(),
+	}
+
+	err := s.repo.SaveCooldown(ctx, cd)
+	if err != nil {
+		s.log.Error("Can not save cooldown", "key", key, "err", err)
+	}
+}
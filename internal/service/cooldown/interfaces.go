@@ -0,0 +1,17 @@
+package cooldown
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"time"
+)
+
+type CooldownService interface {
+	Remaining(key string, cooldown time.Duration) time.Duration
+	Touch(ctx context.Context, key string, cooldown time.Duration)
+}
+
+type CooldownRepository interface {
+	SaveCooldown(ctx context.Context, cd domain.Cooldown) error
+	LoadCooldowns(ctx context.Context, now int64) (cds []domain.Cooldown, err error)
+}
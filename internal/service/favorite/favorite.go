@@ -0,0 +1,93 @@
+package favorite
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+type Service struct {
+	cfg  *config.Config
+	log  logger.Logger
+	repo FavoriteRepository
+	// lastServed holds the last image sent on request of each user
+	lastServed map[int64]domain.File
+	mu         sync.RWMutex
+}
+
+func New(cfg *config.Config, log logger.Logger, repo FavoriteRepository) *Service {
+	return &Service{
+		cfg:        cfg,
+		log:        log,
+		repo:       repo,
+		lastServed: make(map[int64]domain.File),
+		mu:         sync.RWMutex{},
+	}
+}
+
+func (s *Service) SetLastServed(userId int64, file domain.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastServed[userId] = file
+}
+
+func (s *Service) LastServed(userId int64) (domain.File, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok := s.lastServed[userId]
+
+	return file, ok
+}
+
+func (s *Service) Add(ctx context.Context, userId int64, file domain.File) error {
+	err := s.repo.AddFavorite(ctx, userId, file.ID, time.Now().Unix())
+	if err != nil {
+		return errors.Wrap(err, "can not add favorite")
+	}
+
+	return nil
+}
+
+// AddMany saves several favorites at once, e.g. on import
+func (s *Service) AddMany(ctx context.Context, userId int64, imageIds []int64) error {
+	err := s.repo.AddFavorites(ctx, userId, imageIds, time.Now().Unix())
+	if err != nil {
+		return errors.Wrap(err, "can not add favorites")
+	}
+
+	return nil
+}
+
+func (s *Service) List(ctx context.Context, userId int64) ([]int64, error) {
+	ids, err := s.repo.ListFavorites(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not list favorites")
+	}
+
+	if len(ids) == 0 {
+		return nil, custom_errors.NewNotFound("no favorites found")
+	}
+
+	return ids, nil
+}
+
+func (s *Service) Get(ctx context.Context, userId int64, imageId int64) (int64, error) {
+	id, err := s.repo.GetFavorite(ctx, userId, imageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, custom_errors.NewNotFound("can not find favorite")
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "can not get favorite")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,22 @@
+package favorite
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type FavoriteService interface {
+	SetLastServed(userId int64, file domain.File)
+	LastServed(userId int64) (domain.File, bool)
+	Add(ctx context.Context, userId int64, file domain.File) error
+	AddMany(ctx context.Context, userId int64, imageIds []int64) error
+	List(ctx context.Context, userId int64) ([]int64, error)
+	Get(ctx context.Context, userId int64, imageId int64) (int64, error)
+}
+
+type FavoriteRepository interface {
+	AddFavorite(ctx context.Context, userId int64, imageId int64, createdAt int64) error
+	AddFavorites(ctx context.Context, userId int64, imageIds []int64, createdAt int64) error
+	ListFavorites(ctx context.Context, userId int64) ([]int64, error)
+	GetFavorite(ctx context.Context, userId int64, imageId int64) (id int64, err error)
+}
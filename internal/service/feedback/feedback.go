@@ -0,0 +1,51 @@
+package feedback
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type Service struct {
+	cfg  *config.Config
+	log  logger.Logger
+	repo FeedbackRepository
+}
+
+func New(cfg *config.Config, log logger.Logger, repo FeedbackRepository) *Service {
+	return &Service{
+		cfg:  cfg,
+		log:  log,
+		repo: repo,
+	}
+}
+
+func (s *Service) Submit(ctx context.Context, fb domain.Feedback) (domain.Feedback, error) {
+	fb.CreatedAt = time.Now().Unix()
+
+	id, err := s.repo.Create(ctx, fb)
+	if err != nil {
+		return fb, errors.Wrap(err, "can not save feedback")
+	}
+
+	fb.ID = id
+
+	return fb, nil
+}
+
+func (s *Service) ListRecent(ctx context.Context, limit int) ([]domain.Feedback, error) {
+	list, err := s.repo.ListRecent(ctx, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not list feedback")
+	}
+
+	if len(list) == 0 {
+		return nil, custom_errors.NewNotFound("no feedback found")
+	}
+
+	return list, nil
+}
@@ -0,0 +1,16 @@
+package feedback
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type FeedbackService interface {
+	Submit(ctx context.Context, fb domain.Feedback) (domain.Feedback, error)
+	ListRecent(ctx context.Context, limit int) ([]domain.Feedback, error)
+}
+
+type FeedbackRepository interface {
+	Create(ctx context.Context, fb domain.Feedback) (id int64, err error)
+	ListRecent(ctx context.Context, limit int) ([]domain.Feedback, error)
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Service keeps last history_size images served to each chat
+type Service struct {
+	cfg  *config.Config
+	log  logger.Logger
+	repo HistoryRepository
+}
+
+func New(cfg *config.Config, log logger.Logger, repo HistoryRepository) *Service {
+	return &Service{
+		cfg:  cfg,
+		log:  log,
+		repo: repo,
+	}
+}
+
+// Add records image sent to chat, nothing is saved if history is disabled
+func (s *Service) Add(ctx context.Context, chatId int64, imageId int64) error {
+	if s.cfg.HistorySize == 0 {
+		return nil
+	}
+
+	err := s.repo.Add(ctx, domain.ServedImage{
+		ChatID:   chatId,
+		ImageID:  imageId,
+		ServedAt: time.Now().Unix(),
+	}, s.cfg.HistorySize)
+	if err != nil {
+		return errors.Wrap(err, "can not save served image")
+	}
+
+	return nil
+}
+
+// Recent returns images last served to chat, newest first
+func (s *Service) Recent(ctx context.Context, chatId int64) ([]domain.ServedImage, error) {
+	served, err := s.repo.RecentlyServed(ctx, chatId, s.cfg.HistorySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get served images")
+	}
+
+	if len(served) == 0 {
+		return nil, custom_errors.NewNotFound("no images served to chat")
+	}
+
+	return served, nil
+}
@@ -0,0 +1,16 @@
+package history
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type HistoryService interface {
+	Add(ctx context.Context, chatId int64, imageId int64) error
+	Recent(ctx context.Context, chatId int64) ([]domain.ServedImage, error)
+}
+
+type HistoryRepository interface {
+	Add(ctx context.Context, served domain.ServedImage, keep int) error
+	RecentlyServed(ctx context.Context, chatId int64, n int) ([]domain.ServedImage, error)
+}
@@ -0,0 +1,43 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"context"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// GetDailyFile returns picture of the day, the same for all chats with same rating during calendar day of t.
+// Each file is scored by hash of day and its ID, so adding or removing other files rarely changes the pick.
+func (s *Service) GetDailyFile(ctx context.Context, rating string, t time.Time) (domain.File, error) {
+	available, err := s.listAvailable(rating)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	if len(available) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no images allowed in chat")
+	}
+
+	day := t.Format(time.DateOnly)
+
+	var (
+		best      domain.File
+		bestScore uint64
+	)
+
+	for _, file := range available {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(day + ":" + strconv.FormatInt(file.ID, 10)))
+
+		// ties are broken by ID as files come from map in random order
+		score := h.Sum64()
+		if score > bestScore || (score == bestScore && file.ID < best.ID) {
+			best, bestScore = file, score
+		}
+	}
+
+	return best, nil
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDailyFileIsStableWithinDay(t *testing.T) {
+	images := uploadedImages(20)
+	s := newTestService(t, newTestConfig(t), images)
+	ctx := context.Background()
+
+	morning := time.Date(2024, 5, 1, 0, 1, 0, 0, time.UTC)
+	want, err := s.GetDailyFile(ctx, domain.ChatRatingAll, morning)
+	if err != nil {
+		t.Fatalf("can not get daily file: %v", err)
+	}
+
+	// regular requests in between do not change picture of the day
+	picks(t, s, 1, 5)
+
+	for _, at := range []time.Time{morning.Add(12 * time.Hour), morning.Add(23*time.Hour + 58*time.Minute)} {
+		got, err := s.GetDailyFile(ctx, domain.ChatRatingAll, at)
+		if err != nil || got.ID != want.ID {
+			t.Errorf("daily file at %s = %s, %v, want %s", at.Format(time.TimeOnly), got.Name, err, want.Name)
+		}
+	}
+
+	// another service instance, e.g. after restart, picks the same file
+	other := newTestService(t, newTestConfig(t), images)
+	if got, err := other.GetDailyFile(ctx, domain.ChatRatingAll, morning); err != nil || got.Name != want.Name {
+		t.Errorf("daily file after restart = %s, %v, want %s", got.Name, err, want.Name)
+	}
+}
+
+func TestDailyFileChangesWithDate(t *testing.T) {
+	s := newTestService(t, newTestConfig(t), uploadedImages(20))
+	ctx := context.Background()
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := s.GetDailyFile(ctx, domain.ChatRatingAll, day)
+	if err != nil {
+		t.Fatalf("can not get daily file: %v", err)
+	}
+
+	next, err := s.GetDailyFile(ctx, domain.ChatRatingAll, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("can not get daily file: %v", err)
+	}
+
+	if next.ID == first.ID {
+		t.Errorf("daily file of the next day is %s again", next.Name)
+	}
+}
+
+func TestDailyFileRespectsRating(t *testing.T) {
+	images := uploadedImages(10)
+	for i := range images {
+		images[i].file.Rating = domain.RatingNSFW
+		if i == 3 {
+			images[i].file.Rating = domain.RatingSFW
+		}
+	}
+
+	s := newTestService(t, newTestConfig(t), images)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 30; i++ {
+		file, err := s.GetDailyFile(context.Background(), domain.ChatRatingSFW, day.AddDate(0, 0, i))
+		if err != nil {
+			t.Fatalf("can not get daily file: %v", err)
+		}
+
+		if file.Name != "04.jpg" {
+			t.Fatalf("daily file for sfw chat is %s with rating %q, want the only sfw one", file.Name, file.Rating)
+		}
+	}
+}
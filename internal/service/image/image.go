@@ -3,44 +3,191 @@ package image
 import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
+	"apubot/internal/metrics"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"apubot/pkg/utils/lru"
+	"apubot/pkg/utils/queue"
+	"cmp"
 	"context"
+	"fmt"
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
-	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
+const (
+	// countCacheTTL is how long image counts are reused before querying db again
+	countCacheTTL = 30 * time.Second
+	// purgeInterval is how often images deleted longer than restore window ago are removed for good
+	purgeInterval = time.Hour
+)
+
+// ErrNoImages is returned when image pool is empty, e.g. on fresh install before images are added
+var ErrNoImages = custom_errors.NewNotFound("no images available yet")
+
+// DuplicateError is returned by AddImage when image with the same content is already in library
+type DuplicateError struct {
+	ExistingID int64
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("image with the same content already exists with ID %d", e.ExistingID)
+}
+
 type Service struct {
 	cfg            *config.Config
+	log            logger.Logger
 	repo           ImageRepository
-	availableFiles map[string]string
+	availableFiles map[string]domain.File
 	mu             sync.RWMutex
+	// writeMu serializes changes of available files with rescan, which replaces them, so they are not lost
+	writeMu sync.Mutex
+	// recentlyServed holds names of files last sent to each chat
+	recentlyServed map[int64]*queue.Queue
+	historyMu      sync.Mutex
+	// tagsCache holds tags of recently served files, nil if disabled
+	tagsCache *lru.Cache[string, []string]
+	// counts holds image counts by tag, empty tag is total
+	counts *cache.Cache
+	// tagIndex holds tags and weights used by weighted tag selection
+	tagIndex *cache.Cache
+	// rnd is source of all random picks, seeded one makes selection reproducible
+	rnd   *rand.Rand
+	rndMu sync.Mutex
+}
+
+func New(cfg *config.Config, log logger.Logger, repo ImageRepository) *Service {
+	return NewWithRand(cfg, log, repo, rand.New(rand.NewSource(time.Now().UnixNano())))
 }
 
-func New(cfg *config.Config, repo ImageRepository) *Service {
+// NewWithRand creates service picking images with given random source
+func NewWithRand(cfg *config.Config, log logger.Logger, repo ImageRepository, rnd *rand.Rand) *Service {
 	service := &Service{
 		cfg:            cfg,
+		log:            log,
 		repo:           repo,
-		availableFiles: make(map[string]string),
+		availableFiles: make(map[string]domain.File),
 		mu:             sync.RWMutex{},
+		recentlyServed: make(map[int64]*queue.Queue),
+		historyMu:      sync.Mutex{},
+		counts:         cache.New(countCacheTTL, 5*time.Minute),
+		tagIndex:       cache.New(countCacheTTL, 5*time.Minute),
+		rnd:            rnd,
 	}
 
 	err := service.updateAvailableFiles()
 	if err != nil {
-		log.Fatalf("can not initialize Image service: %v", err)
+		log.Error("Can not initialize Image service", "err", err)
+		os.Exit(1)
+	}
+
+	if len(service.availableFiles) == 0 {
+		log.Warn("No available images in selected directory or db, add some with /add_image")
 	}
 
+	if cfg.ImageCacheSize > 0 {
+		service.tagsCache = lru.New[string, []string](cfg.ImageCacheSize)
+	}
+
+	if cfg.ImageRescanInterval > 0 {
+		go service.watchAvailableFiles(cfg.ImageRescanInterval)
+	}
+
+	go service.watchDeletedFiles()
+
 	return service
 }
 
+// watchAvailableFiles periodically picks up files added to images dir without restart
+func (s *Service) watchAvailableFiles(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := s.updateAvailableFiles()
+		if err != nil {
+			s.log.Error("Can not rescan images", "err", err)
+		}
+	}
+}
+
+// watchDeletedFiles periodically removes images which can not be restored anymore
+func (s *Service) watchDeletedFiles() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+		err := s.purgeDeletedFiles(ctx)
+		cancel()
+
+		if err != nil {
+			s.log.Error("Can not purge deleted images", "err", err)
+		}
+	}
+}
+
+func (s *Service) purgeDeletedFiles(ctx context.Context) error {
+	files, err := s.repo.GetDeleted(ctx, time.Now().Add(-s.cfg.ImageRestoreWindow).Unix())
+	if err != nil {
+		return errors.Wrap(err, "can not get deleted images")
+	}
+
+	for _, file := range files {
+		path := filepath.Join(s.cfg.ImagesDirPath, file.Name)
+
+		if s.cfg.PurgeDeletedFiles {
+			err = os.Remove(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				s.log.Warn("Can not remove image file", "file", file.Name, "err", err)
+			}
+		}
+
+		// row is kept while file stays in images dir, otherwise next scan registers it again under new ID
+		if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			err = s.repo.DeleteImage(ctx, file)
+		} else {
+			err = s.repo.PurgeImage(ctx, file)
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "can not delete image")
+		}
+
+		s.log.Info("Deleted image purged", "image_id", file.ID, "file", file.Name)
+	}
+
+	return nil
+}
+
+func (s *Service) imageLimits() domain.ImageLimits {
+	return domain.ImageLimits{
+		PhotoBytes:      s.cfg.MaxPhotoBytes,
+		AnimationBytes:  s.cfg.MaxAnimationBytes,
+		PhotoDimensions: s.cfg.MaxPhotoDimensions,
+	}
+}
+
+// dbContext bounds single db call of background job with request timeout
+func (s *Service) dbContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+}
+
 func (s *Service) updateAvailableFiles() error {
-	var imageFiles map[string]string
-	supportedExtensions := []string{".jpg", ".jpeg", ".png", ".gif"}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	ctx, cancel := s.dbContext()
+	imageFiles, err := s.repo.GetAll(ctx)
+	cancel()
 
-	imageFiles, err := s.repo.GetAll(context.Background())
 	if err != nil {
 		return errors.Wrap(err, "can not read data from db")
 	}
@@ -55,54 +202,663 @@ func (s *Service) updateAvailableFiles() error {
 			continue
 		}
 
-		ext := filepath.Ext(fileFs.Name())
-		if !slices.Contains(supportedExtensions, ext) {
+		fileType := domain.TypeByName(fileFs.Name())
+		if fileType == "" {
 			continue
 		}
 
-		_, ok := imageFiles[fileFs.Name()]
-		if !ok {
-			imageFiles[fileFs.Name()] = ""
+		file, ok := imageFiles[fileFs.Name()]
+		if ok && file.Hash == "" && !file.IsDeleted() {
+			// images added before hashes were stored are not detected as duplicates otherwise
+			file.Hash = s.backfillHash(file)
+			imageFiles[file.Name] = file
+		}
+
+		if ok && file.TgID != "" {
+			// already accepted by Telegram
+			continue
+		}
+
+		// files Telegram would reject are left out until replaced, so they are checked again on next scan
+		err = s.imageLimits().CheckFile(filepath.Join(s.cfg.ImagesDirPath, fileFs.Name()))
+		if err != nil {
+			s.log.Warn("Skipping image which can not be sent", "file", fileFs.Name(), "err", err)
+			delete(imageFiles, fileFs.Name())
+
+			continue
+		}
+
+		if ok {
+			continue
+		}
+
+		// register new file in db so it gets an ID
+		file = domain.File{Name: fileFs.Name(), Type: fileType}
+
+		file.Hash, err = s.hashFile(file.Name)
+		if err != nil {
+			s.log.Warn("Can not hash image", "file", file.Name, "err", err)
+		}
+
+		ctx, cancel = s.dbContext()
+		file.ID, err = s.repo.AddImage(ctx, file, nil)
+		cancel()
+
+		if err != nil {
+			return errors.Wrap(err, "can not register image")
+		}
+
+		imageFiles[file.Name] = file
+	}
+
+	// soft deleted files are kept in db until purged so they are not registered again
+	for name, file := range imageFiles {
+		if file.IsDeleted() {
+			delete(imageFiles, name)
 		}
 	}
 
-	if len(imageFiles) == 0 {
-		return errors.New("no available images in selected directory or db")
+	s.mu.Lock()
+	for name, file := range imageFiles {
+		// files can be served during rescan, as MarkServed does not wait for it
+		if current, ok := s.availableFiles[name]; ok && current.LastServedAt > file.LastServedAt {
+			file.LastServedAt, file.ServeCount = current.LastServedAt, current.ServeCount
+			imageFiles[name] = file
+		}
 	}
 
 	s.availableFiles = imageFiles
+	s.mu.Unlock()
 
 	return nil
 }
 
+// backfillHash saves hash of image file which has none yet, empty hash is returned on failure
+func (s *Service) backfillHash(file domain.File) string {
+	hash, err := s.hashFile(file.Name)
+	if err != nil {
+		s.log.Warn("Can not hash image", "file", file.Name, "err", err)
+
+		return ""
+	}
+
+	ctx, cancel := s.dbContext()
+	defer cancel()
+
+	err = s.repo.SetHash(ctx, file.ID, hash)
+	if err != nil {
+		s.log.Warn("Can not save image hash", "file", file.Name, "err", err)
+
+		return ""
+	}
+
+	return hash
+}
+
+func (s *Service) hashFile(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.cfg.ImagesDirPath, name))
+	if err != nil {
+		return "", err
+	}
+
+	return domain.ContentHash(data), nil
+}
+
 func (s *Service) GetRandomFile(ctx context.Context) (domain.File, error) {
+	files, err := s.listAvailable(domain.ChatRatingAll)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	return files[s.intn(len(files))], nil
+}
+
+// GetRandomFileForChat returns random file allowed by chat rating skipping files recently sent to chat
+func (s *Service) GetRandomFileForChat(ctx context.Context, chatId int64, rating string) (domain.File, error) {
+	available, err := s.listAvailable(rating)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	if len(available) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no images allowed in chat")
+	}
+
+	return s.pickForChat(ctx, chatId, available, 1)[0], nil
+}
+
+// GetRandomPhotosForChat returns up to count distinct random photos for album
+func (s *Service) GetRandomPhotosForChat(ctx context.Context, chatId int64, rating string, count int) ([]domain.File, error) {
+	available, err := s.listAvailable(rating)
+	if err != nil {
+		return nil, err
+	}
+
+	photos := make([]domain.File, 0, len(available))
+	for _, f := range available {
+		if !f.IsAnimation() {
+			photos = append(photos, f)
+		}
+	}
+
+	if len(photos) == 0 {
+		return nil, custom_errors.NewNotFound("no photos available")
+	}
+
+	return s.pickForChat(ctx, chatId, photos, count), nil
+}
+
+// GetRandomAnimationForChat returns random animation skipping ones recently sent to chat
+func (s *Service) GetRandomAnimationForChat(ctx context.Context, chatId int64, rating string) (domain.File, error) {
+	available, err := s.listAvailable(rating)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	animations := make([]domain.File, 0, len(available))
+	for _, f := range available {
+		if f.IsAnimation() {
+			animations = append(animations, f)
+		}
+	}
+
+	if len(animations) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no animations available")
+	}
+
+	return s.pickForChat(ctx, chatId, animations, 1)[0], nil
+}
+
+// GetRandomCachedPhotos returns up to count random photos already uploaded to Telegram matching tag filter,
+// chat history is not used as results are not sent to particular chat
+func (s *Service) GetRandomCachedPhotos(
+	ctx context.Context,
+	rating string,
+	filter domain.TagFilter,
+	count int,
+) ([]domain.File, error) {
+	if s.isEmpty() {
+		return nil, ErrNoImages
+	}
+
+	var names []string
+	if !filter.IsEmpty() {
+		var err error
+
+		names, err = s.repo.GetNamesByTags(ctx, filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "can not get images by tags")
+		}
+	}
+
+	s.mu.RLock()
+	var files []domain.File
+	if filter.IsEmpty() {
+		files = make([]domain.File, 0, len(s.availableFiles))
+		for _, file := range s.availableFiles {
+			files = append(files, file)
+		}
+	} else {
+		files = make([]domain.File, 0, len(names))
+		for _, name := range names {
+			if file, ok := s.availableFiles[name]; ok {
+				files = append(files, file)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	photos := slices.DeleteFunc(files, func(f domain.File) bool {
+		return f.TgID == "" || f.IsAnimation() || !f.AllowedFor(rating)
+	})
+
+	if len(photos) == 0 {
+		return nil, custom_errors.NewNotFound("no uploaded photos available")
+	}
+
+	s.shuffle(photos)
+
+	return photos[:min(count, len(photos))], nil
+}
+
+// listAvailable returns files allowed by chat rating, ErrNoImages is returned if there are no files at all
+func (s *Service) listAvailable(rating string) ([]domain.File, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	n := rand.Intn(len(s.availableFiles))
+	if len(s.availableFiles) == 0 {
+		return nil, ErrNoImages
+	}
 
-	for k, v := range s.availableFiles {
-		if n == 0 {
-			return domain.File{Name: k, TgID: v}, nil
+	files := make([]domain.File, 0, len(s.availableFiles))
+	for _, file := range s.availableFiles {
+		if file.AllowedFor(rating) {
+			files = append(files, file)
 		}
+	}
+
+	return files, nil
+}
+
+func (s *Service) intn(n int) int {
+	s.rndMu.Lock()
+	defer s.rndMu.Unlock()
+
+	return s.rnd.Intn(n)
+}
+
+// shuffle randomly reorders files, they are sorted by ID first as files usually come from map in random order
+func (s *Service) shuffle(files []domain.File) {
+	slices.SortFunc(files, func(a, b domain.File) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	s.rndMu.Lock()
+	defer s.rndMu.Unlock()
 
-		n--
+	s.rnd.Shuffle(len(files), func(i, j int) {
+		files[i], files[j] = files[j], files[i]
+	})
+}
+
+func (s *Service) isEmpty() bool {
+	return s.availableCount() == 0
+}
+
+func (s *Service) availableCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.availableFiles)
+}
+
+// GetRandomFileByTags returns random file matching tag filter
+func (s *Service) GetRandomFileByTags(
+	ctx context.Context,
+	chatId int64,
+	rating string,
+	filter domain.TagFilter,
+) (domain.File, error) {
+	if s.isEmpty() {
+		return domain.File{}, ErrNoImages
+	}
+
+	names, err := s.repo.GetNamesByTags(ctx, filter)
+	if err != nil {
+		return domain.File{}, errors.Wrap(err, "can not get images by tag")
+	}
+
+	s.mu.RLock()
+	// skip tagged images which are no longer available
+	files := make([]domain.File, 0, len(names))
+	for _, name := range names {
+		if file, ok := s.availableFiles[name]; ok && file.AllowedFor(rating) {
+			files = append(files, file)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(files) == 0 {
+		return domain.File{}, custom_errors.NewNotFound("no images matching tags")
 	}
 
-	// this should never happen
-	return domain.File{}, errors.New("GetRandomFile: no file selected")
+	return s.pickForChat(ctx, chatId, files, 1)[0], nil
 }
 
-func (s *Service) UpdateFile(ctx context.Context, file domain.File) error {
+// pickForChat selects up to count distinct random files not recently sent to chat and remembers them.
+// If pool is not larger than no-repeat window plain random is used.
+func (s *Service) pickForChat(ctx context.Context, chatId int64, files []domain.File, count int) []domain.File {
+	count = min(count, len(files))
+
+	s.shuffle(files)
+
+	switch s.cfg.SelectionStrategy {
+	case config.SelectionLeastRecent:
+		// stable sort keeps files served at the same time shuffled
+		slices.SortStableFunc(files, func(a, b domain.File) int {
+			return cmp.Compare(a.LastServedAt, b.LastServedAt)
+		})
+	case config.SelectionWeightedTag:
+		s.orderByTagWeight(ctx, files)
+	}
+
+	if s.cfg.NoRepeatWindow == 0 {
+		return files[:count]
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	history, ok := s.recentlyServed[chatId]
+	if !ok {
+		history = queue.NewQueue(s.cfg.NoRepeatWindow)
+		s.recentlyServed[chatId] = history
+	}
+
+	if len(files) > s.cfg.NoRepeatWindow {
+		// move recently served files to the end so they are picked last
+		fresh := make([]domain.File, 0, len(files))
+		var stale []domain.File
+		for _, f := range files {
+			if history.Contains(f.Name) {
+				stale = append(stale, f)
+			} else {
+				fresh = append(fresh, f)
+			}
+		}
+
+		files = append(fresh, stale...)
+	}
+
+	picked := files[:count]
+	for _, f := range picked {
+		history.Add(f.Name)
+	}
+
+	return picked
+}
+
+// ResetHistory forgets files recently sent to chat so they can be picked again right away
+func (s *Service) ResetHistory(chatId int64) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	delete(s.recentlyServed, chatId)
+}
+
+// MarkServed remembers when file was sent for least recent selection and counts serves
+func (s *Service) MarkServed(ctx context.Context, file domain.File) error {
+	now := time.Now().Unix()
+
+	err := s.repo.MarkServed(ctx, file.ID, now)
+	if err != nil {
+		return errors.Wrap(err, "can not mark file served")
+	}
+
+	// lock is not held during db calls, so selection does not wait for them
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if f, ok := s.availableFiles[file.Name]; ok {
+		f.LastServedAt = now
+		f.ServeCount++
+		s.availableFiles[file.Name] = f
+	}
+
+	return nil
+}
+
+// TopImages returns up to n most served available images
+func (s *Service) TopImages(ctx context.Context, n int) ([]domain.File, error) {
+	files, err := s.repo.TopImages(ctx, n)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get top images")
+	}
+
+	if len(files) == 0 {
+		return nil, custom_errors.NewNotFound("no images served yet")
+	}
+
+	return files, nil
+}
+
+// GetByUploader returns images added by user
+func (s *Service) GetByUploader(ctx context.Context, uploaderID int64) ([]domain.File, error) {
+	files, err := s.repo.GetByUploader(ctx, uploaderID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get images by uploader")
+	}
+
+	if len(files) == 0 {
+		return nil, custom_errors.NewNotFound("no images uploaded by user")
+	}
+
+	return files, nil
+}
+
+func (s *Service) GetAllTags(ctx context.Context) ([]string, error) {
+	tags, err := s.repo.GetAllTags(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get tags")
+	}
+
+	return tags, nil
+}
+
+// CountImages returns number of images, only ones with tag if it is not empty
+func (s *Service) CountImages(ctx context.Context, tag string) (int, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	if count, ok := s.counts.Get(tag); ok {
+		return count.(int), nil
+	}
+
+	count, err := s.repo.CountImages(ctx, tag)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not count images")
+	}
+
+	s.counts.SetDefault(tag, count)
+
+	return count, nil
+}
+
+func (s *Service) GetTags(ctx context.Context, file domain.File) ([]string, error) {
+	if s.tagsCache != nil {
+		if tags, ok := s.tagsCache.Get(file.Name); ok {
+			metrics.ImageCacheHits.Inc()
+
+			return tags, nil
+		}
+
+		metrics.ImageCacheMisses.Inc()
+	}
+
+	tags, err := s.repo.GetTags(ctx, file.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get image tags")
+	}
+
+	if s.tagsCache != nil {
+		s.tagsCache.Add(file.Name, tags)
+	}
+
+	return tags, nil
+}
+
+// forgetTags drops cached tags of file after they changed
+func (s *Service) forgetTags(file domain.File) {
+	if s.tagsCache != nil {
+		s.tagsCache.Remove(file.Name)
+	}
+
+	s.tagIndex.Flush()
+}
+
+// UpdateFile saves TG ID of uploaded file, other fields of caller copy may be stale and are not stored
+func (s *Service) UpdateFile(ctx context.Context, file domain.File) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	err := s.repo.SaveImage(ctx, file)
 	if err != nil {
 		return errors.Wrap(err, "can not update image")
 	}
 
-	s.availableFiles[file.Name] = file.TgID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// image could be deleted while it was uploaded
+	if f, ok := s.availableFiles[file.Name]; ok {
+		f.TgID = file.TgID
+		s.availableFiles[file.Name] = f
+	}
+
+	return nil
+}
+
+func (s *Service) AddImage(ctx context.Context, file domain.File, tags []string) (domain.File, error) {
+	if file.UploadedAt == 0 {
+		file.UploadedAt = time.Now().Unix()
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if file.Hash != "" {
+		existing, err := s.repo.GetByHash(ctx, file.Hash)
+		if err == nil {
+			return file, &DuplicateError{ExistingID: existing.ID}
+		}
+
+		var notFoundErr *custom_errors.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			return file, errors.Wrap(err, "can not check duplicates")
+		}
+	}
+
+	id, err := s.repo.AddImage(ctx, file, tags)
+	if err != nil {
+		return file, errors.Wrap(err, "can not add image")
+	}
+
+	file.ID = id
+
+	s.mu.Lock()
+	s.availableFiles[file.Name] = file
+	s.mu.Unlock()
+
+	s.forgetTags(file)
+
+	return file, nil
+}
+
+// List returns available images sorted by ID
+func (s *Service) List(ctx context.Context) []domain.File {
+	s.mu.RLock()
+	files := make([]domain.File, 0, len(s.availableFiles))
+	for _, file := range s.availableFiles {
+		files = append(files, file)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(files, func(a, b domain.File) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return files
+}
+
+func (s *Service) AddTags(ctx context.Context, file domain.File, tags []string) error {
+	err := s.repo.AddTags(ctx, file.Name, tags)
+	if err != nil {
+		return errors.Wrap(err, "can not add tags")
+	}
+
+	s.forgetTags(file)
+
+	return nil
+}
+
+func (s *Service) RemoveTag(ctx context.Context, file domain.File, tag string) error {
+	err := s.repo.RemoveTag(ctx, file.Name, tag)
+	if err != nil {
+		return errors.Wrap(err, "can not remove tag")
+	}
+
+	s.forgetTags(file)
+
+	return nil
+}
+
+func (s *Service) GetByID(ctx context.Context, id int64) (domain.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, file := range s.availableFiles {
+		if file.ID == id {
+			return file, nil
+		}
+	}
+
+	return domain.File{}, custom_errors.NewNotFound(fmt.Sprintf("image #%d not found", id))
+}
+
+// DeleteImage stops serving image, it can be restored within restore window and is purged afterwards
+func (s *Service) DeleteImage(ctx context.Context, file domain.File) error {
+	// write lock is held during db call, so concurrent deletions can not remove the last images at once
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.availableCount() == 1 {
+		return errors.New("can not delete last available image")
+	}
+
+	err := s.repo.SoftDeleteImage(ctx, file, time.Now().Unix())
+	if err != nil {
+		return errors.Wrap(err, "can not delete image")
+	}
+
+	s.mu.Lock()
+	delete(s.availableFiles, file.Name)
+	s.mu.Unlock()
+
+	s.forgetTags(file)
 
 	return nil
 }
+
+// RestoreImage makes image deleted within restore window available again
+func (s *Service) RestoreImage(ctx context.Context, id int64) (domain.File, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	file, err := s.repo.RestoreImage(ctx, id, time.Now().Add(-s.cfg.ImageRestoreWindow).Unix())
+	if err != nil {
+		return file, errors.Wrap(err, "can not restore image")
+	}
+
+	s.mu.Lock()
+	s.availableFiles[file.Name] = file
+	s.mu.Unlock()
+
+	s.forgetTags(file)
+
+	return file, nil
+}
+
+func (s *Service) SetRating(ctx context.Context, file domain.File, rating string) (domain.File, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.repo.SetRating(ctx, file.ID, rating)
+	if err != nil {
+		return file, errors.Wrap(err, "can not set rating")
+	}
+
+	file.Rating = rating
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// image could be deleted meanwhile, caller copy is not added back
+	if f, ok := s.availableFiles[file.Name]; ok {
+		f.Rating = rating
+		s.availableFiles[file.Name] = f
+	}
+
+	return file, nil
+}
+
+func (s *Service) GetByTgID(ctx context.Context, tgId string) (domain.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, file := range s.availableFiles {
+		if tgId != "" && file.TgID == tgId {
+			return file, nil
+		}
+	}
+
+	return domain.File{}, custom_errors.NewNotFound("image not found")
+}
@@ -0,0 +1,744 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/internal/infrastructure/database"
+	imageRepo "apubot/internal/infrastructure/repository/image"
+	"apubot/internal/metrics"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testSeed = 42
+
+// testImage is image saved to library before service starts
+type testImage struct {
+	file domain.File
+	tags []string
+}
+
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	return &config.Config{
+		DBPath:             filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConns:     1,
+		RequestTimeout:     time.Second,
+		ImagesDirPath:      t.TempDir(),
+		ImageRestoreWindow: time.Hour,
+		SelectionStrategy:  config.SelectionRandom,
+	}
+}
+
+func newTestRepository(t *testing.T, cfg *config.Config, images []testImage) *imageRepo.Repository {
+	t.Helper()
+
+	db, err := database.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("can not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := imageRepo.New(db)
+
+	for _, img := range images {
+		id, err := repo.AddImage(context.Background(), img.file, img.tags)
+		if err != nil {
+			t.Fatalf("can not add image %s: %v", img.file.Name, err)
+		}
+
+		if img.file.LastServedAt != 0 {
+			if err = repo.MarkServed(context.Background(), id, img.file.LastServedAt); err != nil {
+				t.Fatalf("can not mark image %s served: %v", img.file.Name, err)
+			}
+		}
+	}
+
+	return repo
+}
+
+// uploadedImages returns n photos already uploaded to Telegram, so they are served without files in images dir
+func uploadedImages(n int) []testImage {
+	images := make([]testImage, n)
+	for i := range images {
+		images[i] = testImage{file: domain.File{Name: fmt.Sprintf("%02d.jpg", i+1), TgID: fmt.Sprintf("tg-%d", i+1)}}
+	}
+
+	return images
+}
+
+func newTestService(t *testing.T, cfg *config.Config, images []testImage) *Service {
+	t.Helper()
+
+	repo := newTestRepository(t, cfg, images)
+
+	return NewWithRand(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), repo, rand.New(rand.NewSource(testSeed)))
+}
+
+// picks returns names of n files picked in a row for chat
+func picks(t *testing.T, s *Service, chatId int64, n int) []string {
+	t.Helper()
+
+	names := make([]string, n)
+	for i := range names {
+		file, err := s.GetRandomFileForChat(context.Background(), chatId, domain.ChatRatingAll)
+		if err != nil {
+			t.Fatalf("can not pick file: %v", err)
+		}
+
+		names[i] = file.Name
+	}
+
+	return names
+}
+
+func TestSelectionStrategies(t *testing.T) {
+	taggedImages := uploadedImages(6)
+	for i := range taggedImages {
+		taggedImages[i].tags = []string{"dog"}
+		if i < 3 {
+			taggedImages[i].tags = []string{"cat"}
+		}
+	}
+
+	servedImages := uploadedImages(4)
+	for i := range servedImages {
+		// 04.jpg was served longest ago, 01.jpg most recently
+		servedImages[i].file.LastServedAt = int64(1000 - i)
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		images   []testImage
+		weights  map[string]int
+		// check validates picks made in a row without no-repeat window
+		check func(t *testing.T, s *Service, names []string)
+	}{
+		{
+			name:     "random picks from whole pool",
+			strategy: config.SelectionRandom,
+			images:   uploadedImages(5),
+			check: func(t *testing.T, s *Service, names []string) {
+				seen := make(map[string]bool)
+				for _, name := range names {
+					seen[name] = true
+				}
+
+				if len(seen) < 4 {
+					t.Errorf("random selection picked only %v out of 5 files", seen)
+				}
+			},
+		},
+		{
+			name:     "least recent picks file not served for longest time",
+			strategy: config.SelectionLeastRecent,
+			images:   servedImages,
+			check: func(t *testing.T, s *Service, names []string) {
+				for _, name := range names {
+					if name != "04.jpg" {
+						t.Fatalf("least recent selection picked %s, want 04.jpg", name)
+					}
+				}
+			},
+		},
+		{
+			name:     "weighted tag prefers heavier tag",
+			strategy: config.SelectionWeightedTag,
+			images:   taggedImages,
+			weights:  map[string]int{"cat": 9},
+			check: func(t *testing.T, s *Service, names []string) {
+				cats := 0
+				for _, name := range names {
+					if name <= "03.jpg" {
+						cats++
+					}
+				}
+
+				// cat images are expected in 90% of picks
+				if cats < len(names)*8/10 {
+					t.Errorf("got %d cat images out of %d picks, want about 90%%", cats, len(names))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func() (*Service, []string) {
+				cfg := newTestConfig(t)
+				cfg.SelectionStrategy = tt.strategy
+
+				s := newTestService(t, cfg, tt.images)
+				for tag, weight := range tt.weights {
+					if err := s.SetTagWeight(context.Background(), tag, weight); err != nil {
+						t.Fatalf("can not set tag weight: %v", err)
+					}
+				}
+
+				return s, picks(t, s, 1, 200)
+			}
+
+			s, names := run()
+			tt.check(t, s, names)
+
+			// the same seed gives the same picks
+			_, again := run()
+			for i := range names {
+				if names[i] != again[i] {
+					t.Fatalf("pick %d differs between runs with the same seed: %s and %s", i, names[i], again[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLeastRecentOrderFollowsServes(t *testing.T) {
+	images := uploadedImages(4)
+	for i := range images {
+		// 04.jpg was served longest ago, 01.jpg most recently
+		images[i].file.LastServedAt = int64(1000 - i)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.SelectionStrategy = config.SelectionLeastRecent
+	s := newTestService(t, cfg, images)
+
+	var got []string
+	for i := 0; i < 8; i++ {
+		file, err := s.GetRandomFileForChat(context.Background(), 1, domain.ChatRatingAll)
+		if err != nil {
+			t.Fatalf("can not pick file: %v", err)
+		}
+
+		if err = s.MarkServed(context.Background(), file); err != nil {
+			t.Fatalf("can not mark file served: %v", err)
+		}
+
+		got = append(got, file.Name)
+		// serve times are in seconds, so picks made in the same second are ordered by old serve time
+		s.mu.Lock()
+		served := s.availableFiles[file.Name]
+		served.LastServedAt = int64(2000 + i)
+		s.availableFiles[file.Name] = served
+		s.mu.Unlock()
+	}
+
+	want := []string{"04.jpg", "03.jpg", "02.jpg", "01.jpg", "04.jpg", "03.jpg", "02.jpg", "01.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("picked %q, want files in order they were served least recently %q", got, want)
+	}
+}
+
+func TestUpdateFileSavesOnlyTgID(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newTestService(t, cfg, uploadedImages(3))
+
+	stale, _ := s.GetByTgID(context.Background(), "tg-1")
+
+	if err := s.MarkServed(context.Background(), stale); err != nil {
+		t.Fatalf("can not mark file served: %v", err)
+	}
+
+	stale.TgID = "tg-reuploaded"
+	if err := s.UpdateFile(context.Background(), stale); err != nil {
+		t.Fatalf("can not update file: %v", err)
+	}
+
+	file, err := s.GetByID(context.Background(), stale.ID)
+	if err != nil || file.TgID != "tg-reuploaded" || file.ServeCount != 1 {
+		t.Errorf("updated file is %+v, %v, want new TG ID and serve count kept", file, err)
+	}
+
+	// upload finished after image was deleted
+	deleted, _ := s.GetByTgID(context.Background(), "tg-2")
+	if err = s.DeleteImage(context.Background(), deleted); err != nil {
+		t.Fatalf("can not delete image: %v", err)
+	}
+
+	deleted.TgID = "tg-late"
+	if err = s.UpdateFile(context.Background(), deleted); err != nil {
+		t.Fatalf("can not update file: %v", err)
+	}
+
+	if _, err = s.GetByID(context.Background(), deleted.ID); err == nil {
+		t.Error("deleted image is available again after its TG ID was saved")
+	}
+}
+
+func TestSetRatingOfDeletedImage(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newTestService(t, cfg, uploadedImages(2))
+
+	file, _ := s.GetByTgID(context.Background(), "tg-1")
+	if err := s.DeleteImage(context.Background(), file); err != nil {
+		t.Fatalf("can not delete image: %v", err)
+	}
+
+	if _, err := s.SetRating(context.Background(), file, domain.RatingNSFW); err != nil {
+		t.Fatalf("can not set rating: %v", err)
+	}
+
+	if _, err := s.GetByID(context.Background(), file.ID); err == nil {
+		t.Error("deleted image is available again after rating")
+	}
+
+	other, _ := s.GetByTgID(context.Background(), "tg-2")
+	if _, err := s.SetRating(context.Background(), other, domain.RatingNSFW); err != nil {
+		t.Fatalf("can not set rating: %v", err)
+	}
+
+	if got, _ := s.GetByID(context.Background(), other.ID); got.Rating != domain.RatingNSFW {
+		t.Errorf("rating of available image is %q, want nsfw", got.Rating)
+	}
+}
+
+func TestNoRepeatWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		pool   int
+		window int
+	}{
+		{name: "pool larger than window", pool: 6, window: 3},
+		{name: "window one less than pool", pool: 5, window: 4},
+		{name: "pool not larger than window", pool: 3, window: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.NoRepeatWindow = tt.window
+
+			s := newTestService(t, cfg, uploadedImages(tt.pool))
+			names := picks(t, s, 1, 50)
+
+			if tt.pool <= tt.window {
+				// plain random is used, picks must still succeed
+				return
+			}
+
+			for i := range names {
+				for j := max(0, i-tt.window); j < i; j++ {
+					if names[i] == names[j] {
+						t.Fatalf("%s repeated after %d picks, window is %d", names[i], i-j, tt.window)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryIsKeptPerChat(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.NoRepeatWindow = 3
+
+	s := newTestService(t, cfg, uploadedImages(4))
+
+	first := picks(t, s, 1, 3)
+
+	// other chat is not limited by pictures sent to the first one
+	seen := make(map[string]bool)
+	for _, name := range picks(t, s, 2, 40) {
+		seen[name] = true
+	}
+
+	if len(seen) != 4 {
+		t.Errorf("second chat got %d distinct files in 40 picks, want all 4", len(seen))
+	}
+
+	// the only file not sent to first chat recently
+	next := picks(t, s, 1, 1)[0]
+	for _, name := range first {
+		if name == next {
+			t.Fatalf("%s repeated in first chat within window", next)
+		}
+	}
+
+	s.ResetHistory(1)
+
+	s.historyMu.Lock()
+	_, ok := s.recentlyServed[1]
+	s.historyMu.Unlock()
+
+	if ok {
+		t.Error("history of chat was not reset")
+	}
+}
+
+func TestResetHistoryAllowsRepeats(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.NoRepeatWindow = 3
+
+	s := newTestService(t, cfg, uploadedImages(4))
+
+	repeats := 0
+	for range 20 {
+		recent := picks(t, s, 1, 3)
+
+		s.ResetHistory(1)
+
+		// without reset only the fourth file could be picked
+		if slices.Contains(recent, picks(t, s, 1, 1)[0]) {
+			repeats++
+		}
+
+		s.ResetHistory(1)
+	}
+
+	if repeats == 0 {
+		t.Error("recently served files were never picked after history reset")
+	}
+
+	// reset of one chat keeps history of others
+	recent := picks(t, s, 2, 3)
+	s.ResetHistory(1)
+
+	if next := picks(t, s, 2, 1)[0]; slices.Contains(recent, next) {
+		t.Errorf("%s repeated in other chat after reset of first one", next)
+	}
+}
+
+func TestAddImageRejectsDuplicates(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newTestService(t, cfg, uploadedImages(2))
+
+	hash := domain.ContentHash([]byte("peepo"))
+
+	added, err := s.AddImage(context.Background(), domain.File{Name: "new.jpg", TgID: "tg-new", Hash: hash}, nil)
+	if err != nil {
+		t.Fatalf("can not add image: %v", err)
+	}
+
+	_, err = s.AddImage(context.Background(), domain.File{Name: "copy.jpg", TgID: "tg-copy", Hash: hash}, nil)
+
+	var duplicateErr *DuplicateError
+	if !errors.As(err, &duplicateErr) || duplicateErr.ExistingID != added.ID {
+		t.Fatalf("got %v adding the same content, want duplicate of image %d", err, added.ID)
+	}
+
+	// deleted image does not block adding its content again
+	if err = s.DeleteImage(context.Background(), added); err != nil {
+		t.Fatalf("can not delete image: %v", err)
+	}
+
+	if _, err = s.AddImage(context.Background(), domain.File{Name: "copy.jpg", TgID: "tg-copy", Hash: hash}, nil); err != nil {
+		t.Errorf("can not add content of deleted image: %v", err)
+	}
+}
+
+func TestScanBackfillsMissingHashes(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	data := []byte("old peepo")
+	if err := os.WriteFile(filepath.Join(cfg.ImagesDirPath, "01.jpg"), data, 0o644); err != nil {
+		t.Fatalf("can not write image: %v", err)
+	}
+
+	// image registered before hashes were stored
+	repo := newTestRepository(t, cfg, uploadedImages(1))
+	s := NewWithRand(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), repo, rand.New(rand.NewSource(testSeed)))
+
+	existing, err := repo.GetByHash(context.Background(), domain.ContentHash(data))
+	if err != nil {
+		t.Fatalf("hash of scanned image was not saved: %v", err)
+	}
+
+	if existing.Name != "01.jpg" {
+		t.Fatalf("hash saved for %s, want 01.jpg", existing.Name)
+	}
+
+	_, err = s.AddImage(context.Background(), domain.File{Name: "tg_upload.jpg", Hash: domain.ContentHash(data)}, nil)
+
+	var duplicateErr *DuplicateError
+	if !errors.As(err, &duplicateErr) || duplicateErr.ExistingID != existing.ID {
+		t.Errorf("got %v adding content of scanned image, want duplicate of image %d", err, existing.ID)
+	}
+}
+
+func TestScanSkipsOversizedFiles(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.MaxAnimationBytes = 1024
+
+	write := func(name string, size int) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(cfg.ImagesDirPath, name), make([]byte, size), 0o644); err != nil {
+			t.Fatalf("can not write image: %v", err)
+		}
+	}
+
+	available := func(s *Service) []string {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		var names []string
+		for name := range s.availableFiles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		return names
+	}
+
+	write("01.gif", 512)
+	write("02.gif", 2048)
+
+	s := newTestService(t, cfg, nil)
+
+	if got := available(s); !slices.Equal(got, []string{"01.gif"}) {
+		t.Errorf("available files %q, want oversized one skipped", got)
+	}
+
+	// replaced file is checked again on next scan
+	write("02.gif", 1024)
+
+	if err := s.updateAvailableFiles(); err != nil {
+		t.Fatalf("can not rescan images: %v", err)
+	}
+
+	if got := available(s); !slices.Equal(got, []string{"01.gif", "02.gif"}) {
+		t.Errorf("available files %q after replacing oversized one, want both", got)
+	}
+}
+
+func TestDeleteAndRestoreImage(t *testing.T) {
+	cfg := newTestConfig(t)
+	s := newTestService(t, cfg, uploadedImages(2))
+
+	file, err := s.GetByTgID(context.Background(), "tg-1")
+	if err != nil {
+		t.Fatalf("can not get image: %v", err)
+	}
+
+	if err = s.DeleteImage(context.Background(), file); err != nil {
+		t.Fatalf("can not delete image: %v", err)
+	}
+
+	if _, err = s.GetByID(context.Background(), file.ID); err == nil {
+		t.Fatal("deleted image is still available")
+	}
+
+	// the other image is the last one and is kept
+	last, _ := s.GetByTgID(context.Background(), "tg-2")
+	if err = s.DeleteImage(context.Background(), last); err == nil {
+		t.Error("last available image was deleted")
+	}
+
+	restored, err := s.RestoreImage(context.Background(), file.ID)
+	if err != nil {
+		t.Fatalf("can not restore image: %v", err)
+	}
+
+	if _, err = s.GetByID(context.Background(), restored.ID); err != nil {
+		t.Errorf("restored image is not available: %v", err)
+	}
+}
+
+func TestPurgeDeletedFiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		purgeFiles   bool
+		wantFileKept bool
+		deletedAgo   time.Duration
+		// wantRow is false if image row is removed, row of kept file stays as purged
+		wantRow    bool
+		wantPurged bool
+	}{
+		{name: "recently deleted image is kept", deletedAgo: time.Minute, wantFileKept: true, wantRow: true},
+		{name: "file is kept by default", deletedAgo: 2 * time.Hour, wantFileKept: true, wantRow: true, wantPurged: true},
+		{name: "file is removed when enabled", purgeFiles: true, deletedAgo: 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.PurgeDeletedFiles = tt.purgeFiles
+
+			path := filepath.Join(cfg.ImagesDirPath, "01.jpg")
+			if err := os.WriteFile(path, []byte("peepo"), 0o644); err != nil {
+				t.Fatalf("can not write image: %v", err)
+			}
+
+			repo := newTestRepository(t, cfg, uploadedImages(2))
+			s := NewWithRand(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), repo, rand.New(rand.NewSource(testSeed)))
+
+			file, err := s.GetByTgID(context.Background(), "tg-1")
+			if err != nil {
+				t.Fatalf("can not get image: %v", err)
+			}
+
+			err = repo.SoftDeleteImage(context.Background(), file, time.Now().Add(-tt.deletedAgo).Unix())
+			if err != nil {
+				t.Fatalf("can not delete image: %v", err)
+			}
+
+			if err = s.purgeDeletedFiles(context.Background()); err != nil {
+				t.Fatalf("can not purge images: %v", err)
+			}
+
+			all, err := repo.GetAll(context.Background())
+			if err != nil {
+				t.Fatalf("can not get images: %v", err)
+			}
+
+			row, ok := all["01.jpg"]
+			if ok != tt.wantRow || row.Purged != tt.wantPurged {
+				t.Errorf("image in db after purge: %v, purged: %v, want %v, %v", ok, row.Purged, tt.wantRow, tt.wantPurged)
+			}
+
+			if _, err = os.Stat(path); (err == nil) != tt.wantFileKept {
+				t.Errorf("file kept after purge: %v, want %v", err == nil, tt.wantFileKept)
+			}
+
+			// deleted image does not come back with kept file
+			if err = s.updateAvailableFiles(); err != nil {
+				t.Fatalf("can not rescan images: %v", err)
+			}
+
+			for _, f := range s.List(context.Background()) {
+				if f.Name == "01.jpg" {
+					t.Errorf("deleted image is available again after rescan with ID %d", f.ID)
+				}
+			}
+
+			all, err = repo.GetAll(context.Background())
+			if err != nil {
+				t.Fatalf("can not get images: %v", err)
+			}
+
+			if row, ok = all["01.jpg"]; ok && row.ID != file.ID {
+				t.Errorf("rescan registered deleted image again with ID %d", row.ID)
+			}
+
+			_, err = s.RestoreImage(context.Background(), file.ID)
+			if (err == nil) != (tt.wantRow && !tt.wantPurged) {
+				t.Errorf("restore after purge returned %v, want it to work only within restore window", err)
+			}
+		})
+	}
+}
+
+// slowScanRepository makes GetAll wait for release once scanned is set, so changes can be made during rescan
+type slowScanRepository struct {
+	*imageRepo.Repository
+	scanned chan struct{}
+	release chan struct{}
+}
+
+func (r *slowScanRepository) GetAll(ctx context.Context) (map[string]domain.File, error) {
+	files, err := r.Repository.GetAll(ctx)
+
+	if r.scanned != nil {
+		close(r.scanned)
+		<-r.release
+	}
+
+	return files, err
+}
+
+func TestChangesDuringRescanAreKept(t *testing.T) {
+	cfg := newTestConfig(t)
+	repo := &slowScanRepository{Repository: newTestRepository(t, cfg, uploadedImages(3))}
+	s := NewWithRand(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), repo, rand.New(rand.NewSource(testSeed)))
+
+	deleted, _ := s.GetByTgID(context.Background(), "tg-1")
+	rated, _ := s.GetByTgID(context.Background(), "tg-2")
+
+	repo.scanned, repo.release = make(chan struct{}), make(chan struct{})
+
+	scanDone := make(chan error)
+	go func() { scanDone <- s.updateAvailableFiles() }()
+	<-repo.scanned
+
+	// db is already read by rescan, changes below must not be overwritten by its stale copy
+	changesDone := make(chan struct{})
+	go func() {
+		defer close(changesDone)
+
+		if err := s.DeleteImage(context.Background(), deleted); err != nil {
+			t.Errorf("can not delete image: %v", err)
+		}
+
+		if _, err := s.SetRating(context.Background(), rated, domain.RatingNSFW); err != nil {
+			t.Errorf("can not rate image: %v", err)
+		}
+
+		if _, err := s.AddImage(context.Background(), domain.File{Name: "new.jpg", TgID: "tg-new"}, nil); err != nil {
+			t.Errorf("can not add image: %v", err)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+
+	if err := <-scanDone; err != nil {
+		t.Fatalf("can not rescan images: %v", err)
+	}
+	<-changesDone
+
+	if _, err := s.GetByID(context.Background(), deleted.ID); err == nil {
+		t.Error("image deleted during rescan is available again")
+	}
+
+	if file, err := s.GetByID(context.Background(), rated.ID); err != nil || file.Rating != domain.RatingNSFW {
+		t.Errorf("image rated during rescan is %+v, %v, want nsfw", file, err)
+	}
+
+	if _, err := s.GetByTgID(context.Background(), "tg-new"); err != nil {
+		t.Errorf("image added during rescan is not available: %v", err)
+	}
+}
+
+// counterValue returns current value of counter
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("can not read counter: %v", err)
+	}
+
+	return m.GetCounter().GetValue()
+}
+
+func TestTagsCacheHitsAndMisses(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.ImageCacheSize = 1
+
+	images := uploadedImages(2)
+	images[0].tags, images[1].tags = []string{"cat"}, []string{"dog"}
+
+	s := newTestService(t, cfg, images)
+	ctx := context.Background()
+
+	cat, dog := domain.File{Name: images[0].file.Name}, domain.File{Name: images[1].file.Name}
+	hits, misses := counterValue(t, metrics.ImageCacheHits), counterValue(t, metrics.ImageCacheMisses)
+
+	// the only slot is taken by dog, so cat is read from db again
+	for _, file := range []domain.File{cat, cat, dog, cat} {
+		tags, err := s.GetTags(ctx, file)
+		if err != nil || len(tags) != 1 {
+			t.Fatalf("GetTags(%s) = %q, %v", file.Name, tags, err)
+		}
+	}
+
+	if got := counterValue(t, metrics.ImageCacheHits) - hits; got != 1 {
+		t.Errorf("counted %v cache hits, want 1", got)
+	}
+
+	if got := counterValue(t, metrics.ImageCacheMisses) - misses; got != 3 {
+		t.Errorf("counted %v cache misses, want 3", got)
+	}
+}
@@ -3,14 +3,60 @@ package image
 import (
 	"apubot/internal/domain"
 	"context"
+	"time"
 )
 
 type ImageService interface {
 	GetRandomFile(ctx context.Context) (domain.File, error)
+	GetRandomFileForChat(ctx context.Context, chatId int64, rating string) (domain.File, error)
+	GetDailyFile(ctx context.Context, rating string, t time.Time) (domain.File, error)
+	GetRandomPhotosForChat(ctx context.Context, chatId int64, rating string, count int) ([]domain.File, error)
+	GetRandomAnimationForChat(ctx context.Context, chatId int64, rating string) (domain.File, error)
+	GetRandomCachedPhotos(ctx context.Context, rating string, filter domain.TagFilter, count int) ([]domain.File, error)
+	GetRandomFileByTags(ctx context.Context, chatId int64, rating string, filter domain.TagFilter) (domain.File, error)
+	GetAllTags(ctx context.Context) ([]string, error)
+	GetTags(ctx context.Context, file domain.File) ([]string, error)
 	UpdateFile(ctx context.Context, file domain.File) error
+	AddImage(ctx context.Context, file domain.File, tags []string) (domain.File, error)
+	GetByID(ctx context.Context, id int64) (domain.File, error)
+	GetByTgID(ctx context.Context, tgId string) (domain.File, error)
+	DeleteImage(ctx context.Context, file domain.File) error
+	RestoreImage(ctx context.Context, id int64) (domain.File, error)
+	SetRating(ctx context.Context, file domain.File, rating string) (domain.File, error)
+	CountImages(ctx context.Context, tag string) (int, error)
+	MarkServed(ctx context.Context, file domain.File) error
+	ResetHistory(chatId int64)
+	TopImages(ctx context.Context, n int) ([]domain.File, error)
+	GetByUploader(ctx context.Context, uploaderID int64) ([]domain.File, error)
+	List(ctx context.Context) []domain.File
+	AddTags(ctx context.Context, file domain.File, tags []string) error
+	RemoveTag(ctx context.Context, file domain.File, tag string) error
+	GetTagWeights(ctx context.Context) (map[string]int, error)
+	SetTagWeight(ctx context.Context, tag string, weight int) error
 }
 
 type ImageRepository interface {
-	GetAll(ctx context.Context) (map[string]string, error)
+	GetAll(ctx context.Context) (map[string]domain.File, error)
 	SaveImage(ctx context.Context, file domain.File) error
+	AddImage(ctx context.Context, file domain.File, tags []string) (id int64, err error)
+	GetNamesByTags(ctx context.Context, filter domain.TagFilter) ([]string, error)
+	GetAllTags(ctx context.Context) ([]string, error)
+	GetTags(ctx context.Context, name string) ([]string, error)
+	AddTags(ctx context.Context, name string, tags []string) error
+	RemoveTag(ctx context.Context, name string, tag string) error
+	DeleteImage(ctx context.Context, file domain.File) error
+	PurgeImage(ctx context.Context, file domain.File) error
+	SoftDeleteImage(ctx context.Context, file domain.File, deletedAt int64) error
+	RestoreImage(ctx context.Context, id int64, deletedSince int64) (domain.File, error)
+	GetDeleted(ctx context.Context, deletedBefore int64) ([]domain.File, error)
+	GetByHash(ctx context.Context, hash string) (domain.File, error)
+	SetHash(ctx context.Context, id int64, hash string) error
+	SetRating(ctx context.Context, id int64, rating string) error
+	MarkServed(ctx context.Context, id int64, servedAt int64) error
+	TopImages(ctx context.Context, n int) ([]domain.File, error)
+	GetByUploader(ctx context.Context, uploaderID int64) ([]domain.File, error)
+	CountImages(ctx context.Context, tag string) (int, error)
+	GetImageTags(ctx context.Context) (map[string][]string, error)
+	GetTagWeights(ctx context.Context) (map[string]int, error)
+	SetTagWeight(ctx context.Context, tag string, weight int) error
 }
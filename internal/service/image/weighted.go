@@ -0,0 +1,151 @@
+package image
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"github.com/pkg/errors"
+	"slices"
+)
+
+// tagIndexKey is the only key of tagIndex cache
+const tagIndexKey = "index"
+
+// tagIndex is what weighted tag selection knows about tags
+type tagIndex struct {
+	// imageTags holds tags by image name, untagged images are missing
+	imageTags map[string][]string
+	weights   map[string]int
+}
+
+func (i tagIndex) weight(tag string) int {
+	if weight, ok := i.weights[tag]; ok {
+		return weight
+	}
+
+	return domain.DefaultTagWeight
+}
+
+// GetTagWeights returns weights set by admins, other tags have domain.DefaultTagWeight
+func (s *Service) GetTagWeights(ctx context.Context) (map[string]int, error) {
+	weights, err := s.repo.GetTagWeights(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get tag weights")
+	}
+
+	return weights, nil
+}
+
+// SetTagWeight changes how often tag is picked by weighted tag selection, 0 makes its images picked last
+func (s *Service) SetTagWeight(ctx context.Context, tag string, weight int) error {
+	err := s.repo.SetTagWeight(ctx, tag, weight)
+	if err != nil {
+		return errors.Wrap(err, "can not set tag weight")
+	}
+
+	s.tagIndex.Flush()
+
+	return nil
+}
+
+func (s *Service) getTagIndex(ctx context.Context) (tagIndex, error) {
+	if index, ok := s.tagIndex.Get(tagIndexKey); ok {
+		return index.(tagIndex), nil
+	}
+
+	imageTags, err := s.repo.GetImageTags(ctx)
+	if err != nil {
+		return tagIndex{}, errors.Wrap(err, "can not get image tags")
+	}
+
+	weights, err := s.repo.GetTagWeights(ctx)
+	if err != nil {
+		return tagIndex{}, errors.Wrap(err, "can not get tag weights")
+	}
+
+	index := tagIndex{imageTags: imageTags, weights: weights}
+	s.tagIndex.SetDefault(tagIndexKey, index)
+
+	return index, nil
+}
+
+// orderByTagWeight reorders shuffled files so each next one is taken from tag picked by weight
+// among tags having files left. Untagged files form own group with default weight.
+// Files are left as they are if tags can not be loaded.
+func (s *Service) orderByTagWeight(ctx context.Context, files []domain.File) {
+	index, err := s.getTagIndex(ctx)
+	if err != nil {
+		s.log.Warn("Can not load tags for weighted selection, using random", "err", err)
+
+		return
+	}
+
+	// groups hold positions of files in shuffled order, so first file left in group is random one
+	groups := make(map[string][]int)
+	// next is position in group of its first file not taken yet
+	next := make(map[string]int)
+	for i, file := range files {
+		tags := index.imageTags[file.Name]
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+
+		for _, tag := range tags {
+			groups[tag] = append(groups[tag], i)
+		}
+	}
+
+	// tags are sorted so seeded random source gives the same order
+	tags := make([]string, 0, len(groups))
+	for tag := range groups {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+
+	taken := make([]bool, len(files))
+	left := func(tag string) bool {
+		for next[tag] < len(groups[tag]) && taken[groups[tag][next[tag]]] {
+			next[tag]++
+		}
+
+		return next[tag] < len(groups[tag])
+	}
+
+	ordered := make([]domain.File, 0, len(files))
+	for len(ordered) < len(files) {
+		total := 0
+		for _, tag := range tags {
+			if left(tag) {
+				total += index.weight(tag)
+			}
+		}
+
+		if total == 0 {
+			// only files of zero weight tags are left
+			for i, file := range files {
+				if !taken[i] {
+					ordered = append(ordered, file)
+				}
+			}
+
+			break
+		}
+
+		n := s.intn(total)
+		for _, tag := range tags {
+			if next[tag] == len(groups[tag]) {
+				continue
+			}
+
+			n -= index.weight(tag)
+			if n < 0 {
+				i := groups[tag][next[tag]]
+				taken[i] = true
+				ordered = append(ordered, files[i])
+
+				break
+			}
+		}
+	}
+
+	copy(files, ordered)
+}
@@ -0,0 +1,121 @@
+package image
+
+import (
+	"apubot/internal/config"
+	"context"
+	"math"
+	"testing"
+)
+
+func TestOrderByTagWeight(t *testing.T) {
+	images := uploadedImages(6)
+	images[0].tags = []string{"muted"}
+	images[1].tags = []string{"muted"}
+	images[2].tags = []string{"cat"}
+	images[3].tags = []string{"cat", "muted"}
+	// 05.jpg and 06.jpg are untagged
+
+	cfg := newTestConfig(t)
+	cfg.SelectionStrategy = config.SelectionWeightedTag
+
+	s := newTestService(t, cfg, images)
+
+	if err := s.SetTagWeight(context.Background(), "muted", 0); err != nil {
+		t.Fatalf("can not set tag weight: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		files := s.List(context.Background())
+		s.shuffle(files)
+		s.orderByTagWeight(context.Background(), files)
+
+		// images only having zero weight tag come after all others
+		for j, file := range files[:4] {
+			if file.Name == "01.jpg" || file.Name == "02.jpg" {
+				t.Fatalf("zero weight image %s is at position %d", file.Name, j)
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, file := range files {
+			seen[file.Name] = true
+		}
+
+		if len(seen) != len(images) {
+			t.Fatalf("ordering lost or duplicated files: %v", files)
+		}
+	}
+}
+
+func TestOrderByTagWeightFollowsWeights(t *testing.T) {
+	images := uploadedImages(2)
+	images[0].tags = []string{"cat"}
+	images[1].tags = []string{"dog"}
+
+	cfg := newTestConfig(t)
+	cfg.SelectionStrategy = config.SelectionWeightedTag
+
+	s := newTestService(t, cfg, images)
+
+	for tag, weight := range map[string]int{"cat": 1, "dog": 3} {
+		if err := s.SetTagWeight(context.Background(), tag, weight); err != nil {
+			t.Fatalf("can not set tag weight: %v", err)
+		}
+	}
+
+	const draws = 4000
+
+	first := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		files := s.List(context.Background())
+		s.shuffle(files)
+		s.orderByTagWeight(context.Background(), files)
+
+		first[files[0].Name]++
+	}
+
+	// random source is seeded, tolerance only keeps test independent of the seed chosen
+	for name, want := range map[string]float64{"01.jpg": 0.25, "02.jpg": 0.75} {
+		if got := float64(first[name]) / draws; math.Abs(got-want) > 0.03 {
+			t.Errorf("%s picked first in %.3f of draws, want %.2f", name, got, want)
+		}
+	}
+}
+
+func TestSetTagWeightAppliesAtOnce(t *testing.T) {
+	images := uploadedImages(2)
+	images[0].tags = []string{"cat"}
+	images[1].tags = []string{"dog"}
+
+	cfg := newTestConfig(t)
+	cfg.SelectionStrategy = config.SelectionWeightedTag
+
+	s := newTestService(t, cfg, images)
+
+	// index of tags is cached by first pick
+	picks(t, s, 1, 1)
+
+	if err := s.SetTagWeight(context.Background(), "cat", 0); err != nil {
+		t.Fatalf("can not set tag weight: %v", err)
+	}
+
+	for _, name := range picks(t, s, 1, 20) {
+		if name != "02.jpg" {
+			t.Fatalf("picked %s of zero weight tag while other one is available", name)
+		}
+	}
+
+	weights, err := s.GetTagWeights(context.Background())
+	if err != nil {
+		t.Fatalf("can not get tag weights: %v", err)
+	}
+
+	if weight, ok := weights["cat"]; !ok || weight != 0 {
+		t.Errorf("weights = %v, want cat set to 0", weights)
+	}
+
+	if _, ok := weights["dog"]; ok {
+		t.Errorf("weights = %v, dog has default weight and must not be listed", weights)
+	}
+
+}
@@ -3,25 +3,59 @@ package service
 import (
 	"apubot/internal/config"
 	"apubot/internal/infrastructure/repository"
+	"apubot/internal/service/chat"
+	"apubot/internal/service/cooldown"
+	"apubot/internal/service/favorite"
+	"apubot/internal/service/feedback"
+	"apubot/internal/service/history"
 	"apubot/internal/service/image"
+	"apubot/internal/service/source"
+	"apubot/internal/service/state"
+	"apubot/internal/service/stats"
 	"apubot/internal/service/subscription"
+	"apubot/internal/service/suggestion"
+	"apubot/pkg/logger"
 )
 
 type (
 	InitParams struct {
 		Config       *config.Config
+		Logger       logger.Logger
 		Repositories *repository.Repositories
 	}
 
 	Services struct {
 		Image        *image.Service
 		Subscription *subscription.Service
+		Cooldown     *cooldown.Service
+		Chat         *chat.Service
+		Stats        *stats.Service
+		Favorite     *favorite.Service
+		Feedback     *feedback.Service
+		State        *state.Service
+		Suggestion   *suggestion.Service
+		Source       *source.Service
+		History      *history.Service
 	}
 )
 
 func New(p *InitParams) *Services {
+	var imageRepo image.ImageRepository = p.Repositories.Image
+	if p.Config.ImageSource == config.ImageSourceDir {
+		imageRepo = p.Repositories.ImageDir
+	}
+
 	return &Services{
-		Image:        image.New(p.Config, p.Repositories.Image),
-		Subscription: subscription.New(p.Config, p.Repositories.Subscription),
+		Image:        image.New(p.Config, p.Logger, imageRepo),
+		Subscription: subscription.New(p.Config, p.Logger, p.Repositories.Subscription),
+		Cooldown:     cooldown.New(p.Config, p.Logger, p.Repositories.Cooldown),
+		Chat:         chat.New(p.Config, p.Logger, p.Repositories.Chat),
+		Stats:        stats.New(p.Config, p.Logger, p.Repositories.Stats),
+		Favorite:     favorite.New(p.Config, p.Logger, p.Repositories.Favorite),
+		Feedback:     feedback.New(p.Config, p.Logger, p.Repositories.Feedback),
+		State:        state.New(p.Config, p.Logger, p.Repositories.State),
+		Suggestion:   suggestion.New(p.Config, p.Logger, p.Repositories.Suggestion),
+		Source:       source.New(p.Config, p.Logger, p.Repositories.Source),
+		History:      history.New(p.Config, p.Logger, p.Repositories.History),
 	}
 }
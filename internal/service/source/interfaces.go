@@ -0,0 +1,18 @@
+package source
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type SourceService interface {
+	MessageID(imageId int64) (int, bool)
+	Save(ctx context.Context, msg domain.SourceMessage) error
+	Delete(ctx context.Context, imageId int64) error
+}
+
+type SourceRepository interface {
+	GetAll(ctx context.Context) ([]domain.SourceMessage, error)
+	Save(ctx context.Context, msg domain.SourceMessage) error
+	Delete(ctx context.Context, imageId int64) error
+}
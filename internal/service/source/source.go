@@ -0,0 +1,86 @@
+package source
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/logger"
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+)
+
+// Service keeps posts of source channel images are forwarded from, they are cached as each send looks them up
+type Service struct {
+	cfg      *config.Config
+	log      logger.Logger
+	repo     SourceRepository
+	messages map[int64]domain.SourceMessage
+	mu       sync.RWMutex
+}
+
+func New(cfg *config.Config, log logger.Logger, repo SourceRepository) *Service {
+	service := &Service{
+		cfg:      cfg,
+		log:      log,
+		repo:     repo,
+		messages: make(map[int64]domain.SourceMessage),
+		mu:       sync.RWMutex{},
+	}
+
+	messages, err := repo.GetAll(context.Background())
+	if err != nil {
+		log.Error("Can not initialize Source service", "err", err)
+		os.Exit(1)
+	}
+
+	for _, msg := range messages {
+		service.messages[msg.ImageID] = msg
+	}
+
+	return service
+}
+
+// MessageID returns post image can be forwarded from, posts of previously configured channels are ignored
+func (s *Service) MessageID(imageId int64) (int, bool) {
+	if s.cfg.SourceChannelID == 0 {
+		return 0, false
+	}
+
+	s.mu.RLock()
+	msg, ok := s.messages[imageId]
+	s.mu.RUnlock()
+
+	if !ok || msg.ChannelID != s.cfg.SourceChannelID {
+		return 0, false
+	}
+
+	return msg.MessageID, true
+}
+
+func (s *Service) Save(ctx context.Context, msg domain.SourceMessage) error {
+	err := s.repo.Save(ctx, msg)
+	if err != nil {
+		return errors.Wrap(err, "can not save source message")
+	}
+
+	s.mu.Lock()
+	s.messages[msg.ImageID] = msg
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Delete forgets source message of image, e.g. after the post was deleted from channel
+func (s *Service) Delete(ctx context.Context, imageId int64) error {
+	err := s.repo.Delete(ctx, imageId)
+	if err != nil {
+		return errors.Wrap(err, "can not delete source message")
+	}
+
+	s.mu.Lock()
+	delete(s.messages, imageId)
+	s.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package state
+
+import (
+	"apubot/internal/domain"
+	"context"
+	"time"
+)
+
+type StateService interface {
+	UpdateOffset(ctx context.Context) (id int, savedAt time.Time)
+	SaveUpdateOffset(ctx context.Context, id int)
+	Maintenance() bool
+	SetMaintenance(ctx context.Context, on bool) error
+}
+
+type StateRepository interface {
+	Get(ctx context.Context, key string) (v domain.StateValue, err error)
+	Set(ctx context.Context, v domain.StateValue) error
+}
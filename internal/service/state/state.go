@@ -0,0 +1,95 @@
+package state
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/logger"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	updateOffsetKey = "update_offset"
+	maintenanceKey  = "maintenance"
+)
+
+type Service struct {
+	cfg  *config.Config
+	log  logger.Logger
+	repo StateRepository
+	// maintenance is read on every update so it is kept in memory
+	maintenance atomic.Bool
+}
+
+func New(cfg *config.Config, log logger.Logger, repo StateRepository) *Service {
+	service := &Service{
+		cfg:  cfg,
+		log:  log,
+		repo: repo,
+	}
+
+	v, err := repo.Get(context.Background(), maintenanceKey)
+	if err == nil {
+		service.maintenance.Store(v.Value == strconv.FormatBool(true))
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Error("Can not get maintenance mode", "err", err)
+	}
+
+	return service
+}
+
+func (s *Service) Maintenance() bool {
+	return s.maintenance.Load()
+}
+
+// SetMaintenance toggles maintenance mode, it is saved so it survives restart
+func (s *Service) SetMaintenance(ctx context.Context, on bool) error {
+	err := s.repo.Set(ctx, domain.StateValue{
+		Key:       maintenanceKey,
+		Value:     strconv.FormatBool(on),
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "can not save maintenance mode")
+	}
+
+	s.maintenance.Store(on)
+
+	return nil
+}
+
+// UpdateOffset returns ID of last processed update and when it was saved, zero values if nothing was saved
+func (s *Service) UpdateOffset(ctx context.Context) (id int, savedAt time.Time) {
+	v, err := s.repo.Get(ctx, updateOffsetKey)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.log.Error("Can not get update offset", "err", err)
+		}
+
+		return 0, time.Time{}
+	}
+
+	id, err = strconv.Atoi(v.Value)
+	if err != nil {
+		s.log.Error("Invalid update offset saved", "value", v.Value, "err", err)
+
+		return 0, time.Time{}
+	}
+
+	return id, v.UpdatedAtAsUnixTime()
+}
+
+func (s *Service) SaveUpdateOffset(ctx context.Context, id int) {
+	err := s.repo.Set(ctx, domain.StateValue{
+		Key:       updateOffsetKey,
+		Value:     strconv.Itoa(id),
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		s.log.Error("Can not save update offset", "update_id", id, "err", err)
+	}
+}
@@ -0,0 +1,18 @@
+package stats
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type StatsService interface {
+	RegisterUser(ctx context.Context, userId int64)
+	IncrementImages(ctx context.Context, userId int64)
+	Get(ctx context.Context, userId int64) (domain.UsageStats, error)
+}
+
+type StatsRepository interface {
+	CreateUser(ctx context.Context, userId int64, firstUsedAt int64) error
+	IncrementImages(ctx context.Context, userId int64, now int64) error
+	Get(ctx context.Context, userId int64) (stats domain.UsageStats, err error)
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+type Service struct {
+	cfg   *config.Config
+	log   logger.Logger
+	repo  StatsRepository
+	known map[int64]struct{}
+	mu    sync.RWMutex
+}
+
+func New(cfg *config.Config, log logger.Logger, repo StatsRepository) *Service {
+	return &Service{
+		cfg:   cfg,
+		log:   log,
+		repo:  repo,
+		known: make(map[int64]struct{}),
+		mu:    sync.RWMutex{},
+	}
+}
+
+// RegisterUser remembers first usage time, db is touched once per user per run
+func (s *Service) RegisterUser(ctx context.Context, userId int64) {
+	s.mu.RLock()
+	_, ok := s.known[userId]
+	s.mu.RUnlock()
+
+	if ok {
+		return
+	}
+
+	err := s.repo.CreateUser(ctx, userId, time.Now().Unix())
+	if err != nil {
+		s.log.Error("Can not save user stats", "user_id", userId, "err", err)
+
+		return
+	}
+
+	s.mu.Lock()
+	s.known[userId] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Service) IncrementImages(ctx context.Context, userId int64) {
+	err := s.repo.IncrementImages(ctx, userId, time.Now().Unix())
+	if err != nil {
+		s.log.Error("Can not update user stats", "user_id", userId, "err", err)
+	}
+}
+
+func (s *Service) Get(ctx context.Context, userId int64) (domain.UsageStats, error) {
+	stats, err := s.repo.Get(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats, custom_errors.NewNotFound("can not find stats")
+	}
+
+	if err != nil {
+		return stats, errors.Wrap(err, "can not get stats")
+	}
+
+	return stats, nil
+}
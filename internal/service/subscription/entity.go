@@ -3,8 +3,11 @@ package subscription
 import "time"
 
 type StartWorkerInput struct {
-	ChatID   int64
-	ExitChan chan struct{}
-	Delay    time.Duration
-	Period   time.Duration
+	SubscriptionID int64
+	ChatID         int64
+	ExitChan       chan struct{}
+	Delay          time.Duration
+	Period         time.Duration
+	// ExactFirstRun disables jitter of first delivery, e.g. for just created subscription
+	ExactFirstRun bool
 }
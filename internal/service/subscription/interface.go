@@ -2,20 +2,34 @@ package subscription
 
 import (
 	"apubot/internal/domain"
-	"apubot/pkg/utils/queue"
 	"context"
+	"time"
 )
 
 type SubscriptionService interface {
-	Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error)
-	Create(ctx context.Context, sub domain.Subscription, sendFunc func(chatId int64, q *queue.Queue) error) error
-	Delete(ctx context.Context, chatId int64) error
-	RescheduleExisting(ctx context.Context, sendFunc func(chatId int64, q *queue.Queue) error) error
+	List(ctx context.Context, chatId int64) (subs []domain.Subscription, err error)
+	Create(ctx context.Context, sub domain.Subscription, sendFunc func(chatId int64) error) (time.Time, error)
+	Delete(ctx context.Context, id int64) error
+	Pause(ctx context.Context, chatId int64) error
+	Resume(ctx context.Context, chatId int64, sendFunc func(chatId int64) error) error
+	DeleteAll(ctx context.Context, chatId int64) error
+	Deactivate(ctx context.Context, chatId int64) error
+	RescheduleExisting(ctx context.Context, sendFunc func(chatId int64) error) error
+	CountByPeriod(ctx context.Context) ([]domain.SubscriptionCount, error)
+	Schedule(ctx context.Context, send domain.ScheduledSend, sendFunc func(chatId int64) error) error
 }
 
 type SubscriptionRepository interface {
-	Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error)
+	GetByChat(ctx context.Context, chatId int64) (subs []domain.Subscription, err error)
 	GetAll(ctx context.Context) (subs []domain.Subscription, err error)
-	Create(ctx context.Context, sub domain.Subscription) error
-	Delete(ctx context.Context, chatId int64) error
+	CountByPeriod(ctx context.Context) (counts []domain.SubscriptionCount, err error)
+	CountActiveByChat(ctx context.Context, chatId int64) (count int, err error)
+	Create(ctx context.Context, sub domain.Subscription) (id int64, err error)
+	Update(ctx context.Context, sub domain.Subscription) error
+	Delete(ctx context.Context, id int64) error
+	Deactivate(ctx context.Context, chatId int64) error
+	GetAllScheduled(ctx context.Context) (sends []domain.ScheduledSend, err error)
+	CountScheduledByChat(ctx context.Context, chatId int64) (count int, err error)
+	CreateScheduled(ctx context.Context, send domain.ScheduledSend) (id int64, err error)
+	DeleteScheduled(ctx context.Context, id int64) error
 }
@@ -0,0 +1,121 @@
+package subscription
+
+import (
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Schedule saves one-off delivery and starts waiting for it, delivery is dropped once it fires.
+// Saved deliveries are restored by RescheduleExisting, so they survive restarts.
+func (s *Service) Schedule(
+	ctx context.Context,
+	send domain.ScheduledSend,
+	sendFunc func(chatId int64) error,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count, err := s.repo.CountScheduledByChat(ctx, send.ChatID)
+	if err != nil {
+		return errors.Wrap(err, "can not count scheduled sends")
+	}
+
+	if count >= MaxScheduledPerChat {
+		return ErrTooManyScheduled
+	}
+
+	send.ID, err = s.repo.CreateScheduled(ctx, send)
+	if err != nil {
+		return errors.Wrap(err, "can not create scheduled send")
+	}
+
+	s.startScheduled(send, sendFunc)
+
+	return nil
+}
+
+// startScheduled starts goroutine waiting for delivery, overdue ones are sent at once, caller must hold the lock.
+// Nothing is started after Stop, the delivery is saved and restored after restart.
+func (s *Service) startScheduled(send domain.ScheduledSend, sendFunc func(chatId int64) error) {
+	if s.stopped {
+		s.log.Debug("Service is stopped, scheduled send is not started", "scheduled_send_id", send.ID)
+
+		return
+	}
+
+	exitChan := make(chan struct{}, 1)
+	s.runningSends[send.ID] = exitChan
+
+	s.workers.Add(1)
+	go s.runScheduled(send, exitChan, sendFunc)
+}
+
+func (s *Service) runScheduled(
+	send domain.ScheduledSend,
+	exitChan chan struct{},
+	sendFunc func(chatId int64) error,
+) {
+	defer s.workers.Done()
+
+	select {
+	case <-time.After(time.Until(send.SendAtAsUnixTime())):
+	case <-exitChan:
+		return
+	}
+
+	if !s.claimScheduled(send.ID, exitChan) {
+		return
+	}
+
+	err := s.safeSend(send.ChatID, sendFunc, "scheduled_send_id", send.ID)
+
+	var unavailableErr *custom_errors.ChatUnavailableError
+	switch {
+	case errors.As(err, &unavailableErr):
+		s.log.Warn("Chat is unavailable, dropping scheduled picture", "chat_id", send.ChatID, "err", err)
+	case err != nil:
+		s.hotLog.Error("Can not send scheduled picture", "chat_id", send.ChatID, "scheduled_send_id", send.ID, "err", err)
+	}
+}
+
+// claimScheduled drops fired delivery before it is sent, so RescheduleExisting can not start it once more.
+// False is returned if goroutine was stopped or replaced meanwhile, the delivery is not its own then.
+// False is returned as well if delivery can not be dropped, it stays saved and is sent after restart instead.
+func (s *Service) claimScheduled(id int64, exitChan chan struct{}) bool {
+	s.mu.Lock()
+	// timer and exit can be ready at once, select does not prefer any of them
+	if s.runningSends[id] != exitChan {
+		s.mu.Unlock()
+
+		return false
+	}
+
+	delete(s.runningSends, id)
+	s.mu.Unlock()
+
+	// send is dropped even if it fails, retrying it later would surprise chat more than a missed picture
+	err := s.repo.DeleteScheduled(context.Background(), id)
+	if err != nil {
+		s.hotLog.Error("Can not delete scheduled send, skipping it", "scheduled_send_id", id, "err", err)
+
+		return false
+	}
+
+	return true
+}
+
+// stopScheduled stops goroutine waiting for delivery if any, caller must hold the lock
+func (s *Service) stopScheduled(id int64) {
+	exitChan, ok := s.runningSends[id]
+	if !ok {
+		return
+	}
+
+	exitChan <- struct{}{}
+	close(exitChan)
+
+	delete(s.runningSends, id)
+}
@@ -0,0 +1,163 @@
+package subscription
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"context"
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingDeleteRepository can not drop scheduled sends while fail is set, like broken db
+type failingDeleteRepository struct {
+	*fakeRepository
+	fail atomic.Bool
+}
+
+func (r *failingDeleteRepository) DeleteScheduled(ctx context.Context, id int64) error {
+	if r.fail.Load() {
+		return errors.New("database is locked")
+	}
+
+	return r.fakeRepository.DeleteScheduled(ctx, id)
+}
+
+func TestScheduledSendIsDeliveredOnce(t *testing.T) {
+	s, repo := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	d := &deliveries{}
+
+	err := s.Schedule(context.Background(), domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Unix() + 1}, d.send)
+	if err != nil {
+		t.Fatalf("can not schedule send: %v", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Fatalf("got %d deliveries, want 1", n)
+	}
+
+	repo.mu.Lock()
+	left := len(repo.sends)
+	repo.mu.Unlock()
+
+	if left != 0 {
+		t.Fatalf("fired send was not deleted")
+	}
+
+	// restart does not deliver it again
+	if err = s.RescheduleExisting(context.Background(), d.send); err != nil {
+		t.Fatalf("can not reschedule: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Errorf("got %d deliveries after restart, want 1", n)
+	}
+}
+
+func TestRescheduledSendIsDeliveredOnce(t *testing.T) {
+	s, _ := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	d := &deliveries{}
+
+	err := s.Schedule(context.Background(), domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Unix() + 1}, d.send)
+	if err != nil {
+		t.Fatalf("can not schedule send: %v", err)
+	}
+
+	// replaced goroutine must not deliver alongside the new one
+	for i := 0; i < 3; i++ {
+		if err = s.RescheduleExisting(context.Background(), d.send); err != nil {
+			t.Fatalf("can not reschedule: %v", err)
+		}
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Errorf("got %d deliveries, want 1", n)
+	}
+}
+
+func TestScheduledSendIsSkippedIfItCanNotBeDropped(t *testing.T) {
+	s, fake := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	repo := &failingDeleteRepository{fakeRepository: fake}
+	repo.fail.Store(true)
+	s.repo = repo
+
+	d := &deliveries{}
+
+	err := s.Schedule(context.Background(), domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Add(-time.Hour).Unix()}, d.send)
+	if err != nil {
+		t.Fatalf("can not schedule send: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// sending it would repeat the picture after restart
+	if n := d.count(); n != 0 {
+		t.Fatalf("got %d deliveries of send left in db, want none", n)
+	}
+
+	// saved send is delivered once db works again
+	repo.fail.Store(false)
+	if err = s.RescheduleExisting(context.Background(), d.send); err != nil {
+		t.Fatalf("can not reschedule: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Errorf("got %d deliveries after restart, want 1", n)
+	}
+}
+
+func TestOverdueScheduledSendIsDeliveredAtOnce(t *testing.T) {
+	s, repo := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	// send saved before restart whose time passed meanwhile
+	_, _ = repo.CreateScheduled(context.Background(), domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Add(-time.Hour).Unix()})
+
+	d := &deliveries{}
+	if err := s.RescheduleExisting(context.Background(), d.send); err != nil {
+		t.Fatalf("can not reschedule: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Errorf("got %d deliveries, want 1", n)
+	}
+}
+
+func TestScheduleLimitPerChat(t *testing.T) {
+	s, _ := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	send := domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Add(time.Hour).Unix()}
+
+	for i := 0; i < MaxScheduledPerChat; i++ {
+		if err := s.Schedule(context.Background(), send, (&deliveries{}).send); err != nil {
+			t.Fatalf("can not schedule send %d: %v", i, err)
+		}
+	}
+
+	if err := s.Schedule(context.Background(), send, (&deliveries{}).send); !errors.Is(err, ErrTooManyScheduled) {
+		t.Errorf("got %v scheduling over limit, want ErrTooManyScheduled", err)
+	}
+
+	send.ChatID = 2
+	if err := s.Schedule(context.Background(), send, (&deliveries{}).send); err != nil {
+		t.Errorf("limit of one chat applies to other: %v", err)
+	}
+}
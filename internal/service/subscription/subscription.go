@@ -4,34 +4,102 @@ import (
 	"apubot/internal/config"
 	"apubot/internal/domain"
 	"apubot/pkg/custom_errors"
-	"apubot/pkg/utils/queue"
+	"apubot/pkg/logger"
 	"context"
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
-	"log"
+	"math/rand"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
+const (
+	// firstRunDelay is delay before first delivery of new subscription
+	firstRunDelay = time.Second
+	// countCacheTTL is how long subscription counts are reused before querying db again
+	countCacheTTL = 30 * time.Second
+	countCacheKey = "by_period"
+)
+
+// MaxScheduledPerChat limits pending one-off deliveries of single chat
+const MaxScheduledPerChat = 10
+
+var (
+	// ErrLimitReached is returned by Create when chat already has max_subs_per_chat active subscriptions
+	ErrLimitReached = errors.New("subscription limit reached")
+	// ErrTooManyScheduled is returned by Schedule when chat already has MaxScheduledPerChat pending deliveries
+	ErrTooManyScheduled = errors.New("too many scheduled sends")
+)
+
 type (
 	Service struct {
 		cfg                  *config.Config
+		log                  logger.Logger
 		repo                 SubscriptionRepository
 		runningSubscriptions map[int64]chan struct{}
-		mu                   sync.RWMutex
+		// runningSends holds exit channels of goroutines waiting for one-off deliveries
+		runningSends map[int64]chan struct{}
+		mu           sync.RWMutex
+		// workers tracks running delivery goroutines so shutdown can wait for them
+		workers sync.WaitGroup
+		// stopped is set by Stop, no goroutines are started afterwards so workers can be waited for
+		stopped bool
+		counts  *cache.Cache
+		// hotLog collapses errors repeated by delivery loops of many subscriptions while db or Telegram fails
+		hotLog logger.Logger
 	}
 )
 
-func New(cfg *config.Config, repo SubscriptionRepository) *Service {
+func New(cfg *config.Config, log logger.Logger, repo SubscriptionRepository) *Service {
 	service := &Service{
 		cfg:                  cfg,
+		log:                  log,
+		hotLog:               logger.Deduplicate(log, cfg.LogDedupWindow),
 		repo:                 repo,
 		runningSubscriptions: make(map[int64]chan struct{}),
+		runningSends:         make(map[int64]chan struct{}),
 		mu:                   sync.RWMutex{},
+		counts:               cache.New(countCacheTTL, 5*time.Minute),
 	}
 
 	return service
 }
 
+// CountByPeriod returns number of active subscriptions grouped by period, result is cached briefly
+func (s *Service) CountByPeriod(ctx context.Context) ([]domain.SubscriptionCount, error) {
+	if counts, ok := s.counts.Get(countCacheKey); ok {
+		return counts.([]domain.SubscriptionCount), nil
+	}
+
+	counts, err := s.repo.CountByPeriod(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not count subscriptions")
+	}
+
+	s.counts.SetDefault(countCacheKey, counts)
+
+	return counts, nil
+}
+
+// safeSend runs delivery, panic is returned as error so it counts as failed attempt instead of crashing bot
+func (s *Service) safeSend(
+	chatId int64,
+	sendFunc func(chatId int64) error,
+	logArgs ...any,
+) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			args := append([]any{"chat_id", chatId}, logArgs...)
+			s.log.Error("Panic while sending scheduled picture", append(args, "panic", r, "stack", string(debug.Stack()))...)
+
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+
+	return sendFunc(chatId)
+}
+
 func (s *Service) getAllFromDB(ctx context.Context) (subs []domain.Subscription, err error) {
 	subs, err = s.repo.GetAll(ctx)
 	if err != nil {
@@ -41,31 +109,44 @@ func (s *Service) getAllFromDB(ctx context.Context) (subs []domain.Subscription,
 	return subs, nil
 }
 
-func (s *Service) startWorker(
-	sub domain.Subscription,
-	exitChan chan struct{},
-	sendFunc func(chatId int64, q *queue.Queue) error,
-) {
-	passedIntervals := time.Since(sub.SubscribedAtAsUnixTime()) / sub.PeriodAsDurationInSeconds()
-	nextRun := sub.SubscribedAtAsUnixTime().Add((passedIntervals + 1) * sub.PeriodAsDurationInSeconds())
+func (s *Service) startWorker(sub domain.Subscription, sendFunc func(chatId int64) error) {
+	s.runWorker(&StartWorkerInput{
+		SubscriptionID: sub.ID,
+		ChatID:         sub.ChatId,
+		ExitChan:       make(chan struct{}, 1),
+		Delay:          time.Until(sub.NextRun()),
+		Period:         sub.PeriodAsDurationInSeconds(),
+	}, sendFunc)
+}
 
-	workerInput := &StartWorkerInput{
-		ChatID:   sub.ChatId,
-		ExitChan: exitChan,
-		Delay:    time.Until(nextRun),
-		Period:   sub.PeriodAsDurationInSeconds(),
+// runWorker starts subscription goroutine, caller must hold the lock. Nothing is started after Stop,
+// subscriptions saved meanwhile are started by RescheduleExisting after restart.
+func (s *Service) runWorker(inp *StartWorkerInput, sendFunc func(chatId int64) error) {
+	if s.stopped {
+		s.log.Debug("Service is stopped, subscription is not started", "subscription_id", inp.SubscriptionID)
+
+		return
 	}
 
-	go s.startSubscription(workerInput, sendFunc)
+	s.runningSubscriptions[inp.SubscriptionID] = inp.ExitChan
+
+	s.workers.Add(1)
+	go s.startSubscription(inp, sendFunc)
 }
 
 func (s *Service) startSubscription(
 	inp *StartWorkerInput,
-	sendFunc func(chatId int64, q *queue.Queue) error,
+	sendFunc func(chatId int64) error,
 ) {
+	defer s.workers.Done()
+
 	failCount := 0
-	timeout := inp.Delay // initial delay before next scheduled event
-	q := queue.NewQueue(s.cfg.LastSentQueueSize)
+	// jitter is added to each scheduled time separately, so it does not accumulate
+	next := time.Now().Add(inp.Delay)
+	timeout := inp.Delay
+	if !inp.ExactFirstRun {
+		timeout += s.jitter()
+	}
 
 	for {
 		select {
@@ -74,25 +155,48 @@ func (s *Service) startSubscription(
 			return
 		}
 
-		start := time.Now()
-
 		if failCount >= s.cfg.MaxRetries {
-			log.Printf("Max retries reached for chat %d, auto-deleting subscription!", inp.ChatID)
-			err := s.Delete(context.Background(), inp.ChatID)
+			s.log.Warn(
+				"Max retries reached, auto-deleting subscription",
+				"chat_id", inp.ChatID, "subscription_id", inp.SubscriptionID,
+			)
+			err := s.Delete(context.Background(), inp.SubscriptionID)
 			if err != nil {
-				log.Printf("Can not auto-delete subscription %d: %v", inp.ChatID, err)
+				s.hotLog.Error("Can not auto-delete subscription", "subscription_id", inp.SubscriptionID, "err", err)
+			}
+
+			return
+		}
+
+		err := s.safeSend(inp.ChatID, sendFunc, "subscription_id", inp.SubscriptionID)
+
+		// schedule next event, ones missed while sending took longer than period are skipped
+		next = next.Add(inp.Period)
+		for !next.After(time.Now()) {
+			next = next.Add(inp.Period)
+		}
+		timeout = time.Until(next) + s.jitter()
+
+		var unavailableErr *custom_errors.ChatUnavailableError
+		if errors.As(err, &unavailableErr) {
+			s.log.Warn(
+				"Chat is unavailable, deactivating subscriptions",
+				"chat_id", inp.ChatID, "subscription_id", inp.SubscriptionID, "err", err,
+			)
+
+			err = s.deactivate(context.Background(), inp.ChatID)
+			if err != nil {
+				s.hotLog.Error("Can not deactivate subscriptions", "chat_id", inp.ChatID, "err", err)
 			}
 
 			return
 		}
 
-		err := sendFunc(inp.ChatID, q)
-		timeout = inp.Period - time.Since(start) // schedule next event
 		if err != nil {
 			failCount++
-			log.Printf(
-				"Can not send scheduled message to chat %d (%d/%d): %v",
-				inp.ChatID, failCount, s.cfg.MaxRetries, err,
+			s.hotLog.Error(
+				"Can not send scheduled message",
+				"chat_id", inp.ChatID, "fail_count", failCount, "max_retries", s.cfg.MaxRetries, "err", err,
 			)
 
 			continue
@@ -102,9 +206,18 @@ func (s *Service) startSubscription(
 	}
 }
 
+// jitter returns random delay up to configured one, it spreads deliveries of subscriptions with same period
+func (s *Service) jitter() time.Duration {
+	if s.cfg.SubJitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(s.cfg.SubJitter)))
+}
+
 func (s *Service) RescheduleExisting(
 	ctx context.Context,
-	sendFunc func(chatId int64, q *queue.Queue) error,
+	sendFunc func(chatId int64) error,
 ) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -123,89 +236,280 @@ func (s *Service) RescheduleExisting(
 	s.runningSubscriptions = make(map[int64]chan struct{}, len(existingSubs))
 
 	for i := range existingSubs {
-		exitChan := make(chan struct{}, 1)
+		if existingSubs[i].Paused {
+			continue
+		}
+
+		s.startWorker(existingSubs[i], sendFunc)
+	}
 
-		go s.startWorker(existingSubs[i], exitChan, sendFunc)
+	sends, err := s.repo.GetAllScheduled(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can not reschedule existing scheduled sends")
+	}
 
-		s.runningSubscriptions[existingSubs[i].ChatId] = exitChan
+	for _, ch := range s.runningSends {
+		ch <- struct{}{}
+		close(ch)
 	}
 
-	log.Printf("Rescheduled %d existing subscription(s)!", len(s.runningSubscriptions))
+	s.runningSends = make(map[int64]chan struct{}, len(sends))
+
+	for _, send := range sends {
+		s.startScheduled(send, sendFunc)
+	}
+
+	s.log.Info(
+		"Rescheduled existing subscriptions",
+		"count", len(s.runningSubscriptions), "scheduled_sends", len(s.runningSends),
+	)
 
 	return nil
 }
 
-func (s *Service) Get(ctx context.Context, chatId int64) (sub domain.Subscription, err error) {
+func (s *Service) List(ctx context.Context, chatId int64) (subs []domain.Subscription, err error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.runningSubscriptions[chatId]
-	if !ok {
-		return sub, custom_errors.NewNotFound("can not find subscription")
+	subs, err = s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get subscriptions")
 	}
 
-	sub, err = s.repo.Get(ctx, chatId)
-	if err != nil {
-		return sub, errors.Wrap(err, "can not get subscription")
+	if len(subs) == 0 {
+		return nil, custom_errors.NewNotFound("can not find subscriptions")
 	}
 
-	return sub, nil
+	return subs, nil
 }
 
+// Create saves subscription and starts its delivery, time of first delivery is returned
 func (s *Service) Create(
 	ctx context.Context,
 	sub domain.Subscription,
-	sendFunc func(chatId int64, q *queue.Queue) error,
-) error {
+	sendFunc func(chatId int64) error,
+) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub.Period <= 0 {
+		return time.Time{}, errors.New("subscription period must be positive")
+	}
+
+	existing, err := s.repo.GetByChat(ctx, sub.ChatId)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "can not get subscriptions")
+	}
+
+	for _, e := range existing {
+		if e.Period == sub.Period {
+			return time.Time{}, custom_errors.NewAlreadyExists("subscription with same period already exists")
+		}
+	}
+
+	if s.cfg.MaxSubsPerChat > 0 {
+		active, err := s.repo.CountActiveByChat(ctx, sub.ChatId)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "can not count subscriptions")
+		}
+
+		if active >= s.cfg.MaxSubsPerChat {
+			return time.Time{}, ErrLimitReached
+		}
+	}
+
+	id, err := s.repo.Create(ctx, sub)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "can not create subscription")
+	}
+
+	s.runWorker(&StartWorkerInput{
+		SubscriptionID: id,
+		ChatID:         sub.ChatId,
+		ExitChan:       make(chan struct{}, 1),
+		Delay:          firstRunDelay,
+		Period:         sub.PeriodAsDurationInSeconds(),
+		ExactFirstRun:  true,
+	}, sendFunc)
+
+	return time.Now().Add(firstRunDelay), nil
+}
+
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(ctx, id)
+}
+
+// Pause stops delivery for all chat subscriptions keeping their settings
+func (s *Service) Pause(ctx context.Context, chatId int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// kill running subscription goroutine if exists
-	exitChanOld, ok := s.runningSubscriptions[sub.ChatId]
-	if ok {
-		exitChanOld <- struct{}{}
-		close(exitChanOld)
+	subs, err := s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
+	}
+
+	if len(subs) == 0 {
+		return custom_errors.NewNotFound("can not find subscriptions")
+	}
+
+	for _, sub := range subs {
+		if sub.Paused {
+			continue
+		}
+
+		sub.Paused = true
+
+		err = s.repo.Update(ctx, sub)
+		if err != nil {
+			return errors.Wrap(err, "can not pause subscription")
+		}
+
+		s.stopWorker(sub.ID)
 	}
 
-	err := s.repo.Create(ctx, sub)
+	return nil
+}
+
+// Resume restarts delivery for paused chat subscriptions, next event is scheduled one period from now
+func (s *Service) Resume(
+	ctx context.Context,
+	chatId int64,
+	sendFunc func(chatId int64) error,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs, err := s.repo.GetByChat(ctx, chatId)
 	if err != nil {
-		return errors.Wrap(err, "can not create subscription")
+		return errors.Wrap(err, "can not get subscriptions")
 	}
 
-	exitChan := make(chan struct{}, 1)
+	if len(subs) == 0 {
+		return custom_errors.NewNotFound("can not find subscriptions")
+	}
 
-	workerInput := &StartWorkerInput{
-		ChatID:   sub.ChatId,
-		ExitChan: exitChan,
-		Delay:    time.Duration(1) * time.Second,
-		Period:   sub.PeriodAsDurationInSeconds(),
+	for _, sub := range subs {
+		if !sub.Paused {
+			continue
+		}
+
+		sub.Paused = false
+		sub.CreatedAt = time.Now().Unix()
+
+		err = s.repo.Update(ctx, sub)
+		if err != nil {
+			return errors.Wrap(err, "can not resume subscription")
+		}
+
+		s.startWorker(sub, sendFunc)
 	}
 
-	go s.startSubscription(workerInput, sendFunc)
+	return nil
+}
 
-	s.runningSubscriptions[sub.ChatId] = exitChan
+// Deactivate stops subscriptions of chat bot can not deliver to anymore, e.g. after it was removed from group
+func (s *Service) Deactivate(ctx context.Context, chatId int64) error {
+	return s.deactivate(ctx, chatId)
+}
+
+func (s *Service) DeleteAll(ctx context.Context, chatId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs, err := s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
+	}
+
+	if len(subs) == 0 {
+		return custom_errors.NewNotFound("can not find subscriptions")
+	}
+
+	for _, sub := range subs {
+		err = s.delete(ctx, sub.ID)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s *Service) Delete(ctx context.Context, chatId int64) error {
+// deactivate pauses all chat subscriptions and stops their workers,
+// they can be restarted with Resume once chat is reachable again
+func (s *Service) deactivate(ctx context.Context, chatId int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	exitChan, ok := s.runningSubscriptions[chatId]
-	if !ok {
-		return custom_errors.NewNotFound("can not find subscription")
+	subs, err := s.repo.GetByChat(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not get subscriptions")
+	}
+
+	err = s.repo.Deactivate(ctx, chatId)
+	if err != nil {
+		return errors.Wrap(err, "can not deactivate subscriptions")
+	}
+
+	for _, sub := range subs {
+		s.stopWorker(sub.ID)
 	}
 
-	err := s.repo.Delete(ctx, chatId)
+	return nil
+}
+
+// delete drops subscription and stops its worker, caller must hold the lock
+func (s *Service) delete(ctx context.Context, id int64) error {
+	err := s.repo.Delete(ctx, id)
 	if err != nil {
 		return errors.Wrap(err, "can not delete subscription")
 	}
 
-	exitChan <- struct{}{} // stop running subscription goroutine
+	s.stopWorker(id)
+
+	return nil
+}
+
+// stopWorker stops running subscription goroutine if any, caller must hold the lock
+func (s *Service) stopWorker(id int64) {
+	exitChan, ok := s.runningSubscriptions[id]
+	if !ok {
+		return
+	}
+
+	exitChan <- struct{}{}
 	close(exitChan)
 
-	delete(s.runningSubscriptions, chatId)
+	delete(s.runningSubscriptions, id)
+}
 
-	return nil
+// Stop stops all delivery workers and waits until running deliveries finish or ctx is done
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	for id := range s.runningSubscriptions {
+		s.stopWorker(id)
+	}
+	for id := range s.runningSends {
+		s.stopScheduled(id)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "subscription workers did not stop in time")
+	}
 }
@@ -0,0 +1,440 @@
+package subscription
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps subscriptions and scheduled sends in memory
+type fakeRepository struct {
+	mu          sync.Mutex
+	nextID      int64
+	subs        map[int64]domain.Subscription
+	sends       map[int64]domain.ScheduledSend
+	deactivated []int64
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		subs:  make(map[int64]domain.Subscription),
+		sends: make(map[int64]domain.ScheduledSend),
+	}
+}
+
+func (r *fakeRepository) GetByChat(_ context.Context, chatId int64) (subs []domain.Subscription, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range r.subs {
+		if sub.ChatId == chatId {
+			subs = append(subs, sub)
+		}
+	}
+
+	return subs, nil
+}
+
+func (r *fakeRepository) GetAll(_ context.Context) (subs []domain.Subscription, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range r.subs {
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+func (r *fakeRepository) CountByPeriod(_ context.Context) (counts []domain.SubscriptionCount, err error) {
+	return nil, nil
+}
+
+func (r *fakeRepository) CountActiveByChat(_ context.Context, chatId int64) (count int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range r.subs {
+		if sub.ChatId == chatId && !sub.Paused {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *fakeRepository) Create(_ context.Context, sub domain.Subscription) (id int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	sub.ID = r.nextID
+	r.subs[sub.ID] = sub
+
+	return sub.ID, nil
+}
+
+func (r *fakeRepository) Update(_ context.Context, sub domain.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subs[sub.ID] = sub
+
+	return nil
+}
+
+func (r *fakeRepository) Delete(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subs, id)
+
+	return nil
+}
+
+func (r *fakeRepository) Deactivate(_ context.Context, chatId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, sub := range r.subs {
+		if sub.ChatId == chatId {
+			sub.Paused = true
+			r.subs[id] = sub
+		}
+	}
+
+	r.deactivated = append(r.deactivated, chatId)
+
+	return nil
+}
+
+func (r *fakeRepository) GetAllScheduled(_ context.Context) (sends []domain.ScheduledSend, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, send := range r.sends {
+		sends = append(sends, send)
+	}
+
+	return sends, nil
+}
+
+func (r *fakeRepository) CountScheduledByChat(_ context.Context, chatId int64) (count int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, send := range r.sends {
+		if send.ChatID == chatId {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *fakeRepository) CreateScheduled(_ context.Context, send domain.ScheduledSend) (id int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	send.ID = r.nextID
+	r.sends[send.ID] = send
+
+	return send.ID, nil
+}
+
+func (r *fakeRepository) DeleteScheduled(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sends, id)
+
+	return nil
+}
+
+// deliveries records chats pictures were sent to
+type deliveries struct {
+	mu    sync.Mutex
+	chats []int64
+	err   error
+}
+
+func (d *deliveries) send(chatId int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.chats = append(d.chats, chatId)
+
+	return d.err
+}
+
+func (d *deliveries) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.chats)
+}
+
+func newTestService(cfg *config.Config) (*Service, *fakeRepository) {
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+
+	repo := newFakeRepository()
+
+	return New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), repo), repo
+}
+
+func TestStoppedServiceStartsNoDeliveries(t *testing.T) {
+	s, repo := newTestService(&config.Config{})
+	d := &deliveries{}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("can not stop service: %v", err)
+	}
+
+	// subscription is saved and started after restart, but not by stopped service
+	_, err := s.Create(context.Background(), domain.Subscription{ChatId: 1, Period: 1}, d.send)
+	if err != nil {
+		t.Fatalf("can not create subscription: %v", err)
+	}
+
+	err = s.Schedule(context.Background(), domain.ScheduledSend{ChatID: 1, SendAt: time.Now().Unix()}, d.send)
+	if err != nil {
+		t.Fatalf("can not schedule send: %v", err)
+	}
+
+	if len(s.runningSubscriptions) != 0 || len(s.runningSends) != 0 {
+		t.Errorf("stopped service started %d subscriptions and %d sends", len(s.runningSubscriptions), len(s.runningSends))
+	}
+
+	if len(repo.subs) != 1 || len(repo.sends) != 1 {
+		t.Errorf("got %d subscriptions and %d sends saved, want both saved", len(repo.subs), len(repo.sends))
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+
+	if n := d.count(); n != 0 {
+		t.Errorf("stopped service delivered %d pictures", n)
+	}
+}
+
+func TestDuplicateSubscriptionIsRejected(t *testing.T) {
+	s, repo := newTestService(&config.Config{})
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+
+	d := &deliveries{}
+	hour := int(time.Hour.Seconds())
+
+	for _, sub := range []domain.Subscription{
+		{ChatId: 1, Period: hour},
+		{ChatId: 1, Period: 2 * hour},
+		{ChatId: 2, Period: hour},
+	} {
+		if _, err := s.Create(context.Background(), sub, d.send); err != nil {
+			t.Fatalf("can not create subscription %+v: %v", sub, err)
+		}
+	}
+
+	_, err := s.Create(context.Background(), domain.Subscription{ChatId: 1, Period: hour}, d.send)
+
+	var existsErr *custom_errors.AlreadyExistsError
+	if !errors.As(err, &existsErr) {
+		t.Errorf("duplicate subscription error = %v, want already exists", err)
+	}
+
+	if len(repo.subs) != 3 || len(s.runningSubscriptions) != 3 {
+		t.Errorf("got %d subscriptions saved and %d running, want 3", len(repo.subs), len(s.runningSubscriptions))
+	}
+}
+
+func TestStopWaitsForWorkers(t *testing.T) {
+	s, _ := newTestService(&config.Config{})
+
+	err := s.RescheduleExisting(context.Background(), (&deliveries{}).send)
+	if err != nil {
+		t.Fatalf("can not reschedule: %v", err)
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		if _, err = s.Create(context.Background(), domain.Subscription{ChatId: i, Period: 3600}, (&deliveries{}).send); err != nil {
+			t.Fatalf("can not create subscription: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatalf("workers did not stop: %v", err)
+	}
+}
+
+func TestUnavailableChatIsDeactivated(t *testing.T) {
+	s, repo := newTestService(&config.Config{})
+	defer s.Stop(context.Background())
+
+	d := &deliveries{err: custom_errors.NewChatUnavailable("bot was kicked from the group chat")}
+
+	for _, period := range []int{1, 3600} {
+		if _, err := s.Create(context.Background(), domain.Subscription{ChatId: 7, Period: period}, d.send); err != nil {
+			t.Fatalf("can not create subscription: %v", err)
+		}
+	}
+
+	// both subscriptions fire after first run delay, the first failed delivery pauses them all
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s.mu.RLock()
+		running := len(s.runningSubscriptions)
+		s.mu.RUnlock()
+
+		if running == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions are still running", running)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if len(repo.deactivated) == 0 || repo.deactivated[0] != 7 {
+		t.Errorf("deactivated chats = %v, want chat 7", repo.deactivated)
+	}
+
+	for _, sub := range repo.subs {
+		if !sub.Paused {
+			t.Errorf("subscription %d is not paused", sub.ID)
+		}
+	}
+
+	// subscriptions are kept so /sub_resume can restart them
+	if len(repo.subs) != 2 {
+		t.Errorf("got %d subscriptions, want both kept", len(repo.subs))
+	}
+}
+
+func TestFailingDeliveryDeletesSubscriptionAfterRetries(t *testing.T) {
+	s, repo := newTestService(&config.Config{MaxRetries: 1})
+	defer s.Stop(context.Background())
+
+	d := &deliveries{err: context.DeadlineExceeded}
+
+	if _, err := s.Create(context.Background(), domain.Subscription{ChatId: 7, Period: 1}, d.send); err != nil {
+		t.Fatalf("can not create subscription: %v", err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if len(repo.subs) != 0 {
+		t.Errorf("subscription failing with other errors was not deleted after retries")
+	}
+
+	if len(repo.deactivated) != 0 {
+		t.Errorf("chat was deactivated after transient errors")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	s, _ := newTestService(&config.Config{SubJitter: 30 * time.Second})
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		j := s.jitter()
+		if j < 0 || j >= 30*time.Second {
+			t.Fatalf("jitter %s out of [0, 30s)", j)
+		}
+
+		seen[j] = true
+	}
+
+	if len(seen) < 2 {
+		t.Error("jitter does not spread deliveries")
+	}
+
+	s, _ = newTestService(&config.Config{})
+	if j := s.jitter(); j != 0 {
+		t.Errorf("disabled jitter = %s, want 0", j)
+	}
+}
+
+func TestFirstDeliveryOfNewSubscriptionIsNotJittered(t *testing.T) {
+	s, _ := newTestService(&config.Config{SubJitter: time.Hour})
+	defer s.Stop(context.Background())
+
+	d := &deliveries{}
+
+	if _, err := s.Create(context.Background(), domain.Subscription{ChatId: 1, Period: 7200}, d.send); err != nil {
+		t.Fatalf("can not create subscription: %v", err)
+	}
+
+	time.Sleep(firstRunDelay + 500*time.Millisecond)
+
+	if n := d.count(); n != 1 {
+		t.Errorf("got %d deliveries after first run delay, want 1", n)
+	}
+}
+
+func TestJitterSpreadsSubscriptionsWithSamePeriod(t *testing.T) {
+	const jitter = 500 * time.Millisecond
+
+	s, _ := newTestService(&config.Config{SubJitter: jitter})
+	defer s.Stop(context.Background())
+
+	var mu sync.Mutex
+	sent := make(map[int64][]time.Time)
+	send := func(chatId int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sent[chatId] = append(sent[chatId], time.Now())
+
+		return nil
+	}
+
+	for chatId := int64(1); chatId <= 5; chatId++ {
+		if _, err := s.Create(context.Background(), domain.Subscription{ChatId: chatId, Period: 1}, send); err != nil {
+			t.Fatalf("can not create subscription: %v", err)
+		}
+	}
+
+	// first delivery is not jittered, so the second one shows jitter of each subscription
+	time.Sleep(firstRunDelay + time.Second + jitter + 300*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	gaps := make(map[time.Duration]bool)
+	for chatId := int64(1); chatId <= 5; chatId++ {
+		times := sent[chatId]
+		if len(times) < 2 {
+			t.Fatalf("chat %d got %d deliveries, want at least 2", chatId, len(times))
+		}
+
+		gap := times[1].Sub(times[0])
+		if gap < time.Second-50*time.Millisecond || gap > time.Second+jitter+100*time.Millisecond {
+			t.Errorf("chat %d got second delivery %s after first one, want within period plus jitter", chatId, gap)
+		}
+
+		gaps[gap.Round(time.Millisecond)] = true
+	}
+
+	if len(gaps) < 2 {
+		t.Error("subscriptions with same period are delivered at the same time")
+	}
+}
@@ -0,0 +1,22 @@
+package suggestion
+
+import (
+	"apubot/internal/domain"
+	"context"
+)
+
+type SuggestionService interface {
+	Submit(ctx context.Context, s domain.Suggestion) (domain.Suggestion, error)
+	Next(ctx context.Context) (domain.Suggestion, error)
+	Take(ctx context.Context, id int64) (domain.Suggestion, error)
+	Requeue(ctx context.Context, s domain.Suggestion) error
+	Count(ctx context.Context) (int, error)
+}
+
+type SuggestionRepository interface {
+	Create(ctx context.Context, s domain.Suggestion) (id int64, err error)
+	Next(ctx context.Context) (domain.Suggestion, error)
+	Take(ctx context.Context, id int64) (domain.Suggestion, error)
+	Count(ctx context.Context) (int, error)
+	CountByUser(ctx context.Context, userID int64) (int, error)
+}
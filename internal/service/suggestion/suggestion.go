@@ -0,0 +1,105 @@
+package suggestion
+
+import (
+	"apubot/internal/config"
+	"apubot/internal/domain"
+	"apubot/pkg/custom_errors"
+	"apubot/pkg/logger"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// MaxPendingPerUser limits suggestions waiting for review from single user
+const MaxPendingPerUser = 10
+
+// ErrTooManyPending is returned by Submit when user reached MaxPendingPerUser
+var ErrTooManyPending = errors.New("too many pending suggestions")
+
+type Service struct {
+	cfg  *config.Config
+	log  logger.Logger
+	repo SuggestionRepository
+}
+
+func New(cfg *config.Config, log logger.Logger, repo SuggestionRepository) *Service {
+	return &Service{
+		cfg:  cfg,
+		log:  log,
+		repo: repo,
+	}
+}
+
+func (s *Service) Submit(ctx context.Context, sug domain.Suggestion) (domain.Suggestion, error) {
+	pending, err := s.repo.CountByUser(ctx, sug.UserID)
+	if err != nil {
+		return sug, errors.Wrap(err, "can not count pending suggestions")
+	}
+
+	if pending >= MaxPendingPerUser {
+		return sug, ErrTooManyPending
+	}
+
+	sug.CreatedAt = time.Now().Unix()
+
+	id, err := s.repo.Create(ctx, sug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sug, custom_errors.NewAlreadyExists("image is already suggested")
+	}
+
+	if err != nil {
+		return sug, errors.Wrap(err, "can not save suggestion")
+	}
+
+	sug.ID = id
+
+	return sug, nil
+}
+
+// Next returns the oldest suggestion waiting for review
+func (s *Service) Next(ctx context.Context) (domain.Suggestion, error) {
+	sug, err := s.repo.Next(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sug, custom_errors.NewNotFound("no pending suggestions")
+	}
+
+	if err != nil {
+		return sug, errors.Wrap(err, "can not get pending suggestion")
+	}
+
+	return sug, nil
+}
+
+// Take removes suggestion from review queue, so it is approved or rejected only once
+func (s *Service) Take(ctx context.Context, id int64) (domain.Suggestion, error) {
+	sug, err := s.repo.Take(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sug, custom_errors.NewNotFound("suggestion not found")
+	}
+
+	if err != nil {
+		return sug, errors.Wrap(err, "can not take suggestion")
+	}
+
+	return sug, nil
+}
+
+// Requeue puts taken suggestion back, e.g. if approved image could not be added
+func (s *Service) Requeue(ctx context.Context, sug domain.Suggestion) error {
+	_, err := s.repo.Create(ctx, sug)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(err, "can not requeue suggestion")
+	}
+
+	return nil
+}
+
+func (s *Service) Count(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not count suggestions")
+	}
+
+	return count, nil
+}
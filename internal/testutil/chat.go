@@ -0,0 +1,63 @@
+package testutil
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/service/chat"
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"slices"
+	"sync"
+)
+
+// ChatRepository keeps chat settings in memory, every chat with settings is known
+type ChatRepository struct {
+	mu       sync.Mutex
+	Settings map[int64]domain.ChatSettings
+	// Unreadable chats fail settings reads as if db was unavailable
+	Unreadable map[int64]bool
+}
+
+var _ chat.ChatRepository = (*ChatRepository)(nil)
+
+func (r *ChatRepository) SaveChat(context.Context, int64, int64) error {
+	return nil
+}
+
+func (r *ChatRepository) GetAllIDs(context.Context) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.Settings))
+	for id := range r.Settings {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (r *ChatRepository) GetSettings(_ context.Context, chatId int64) (domain.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Unreadable[chatId] {
+		return domain.ChatSettings{}, errors.New("db is unavailable")
+	}
+
+	settings, ok := r.Settings[chatId]
+	if !ok {
+		return domain.ChatSettings{}, errors.Wrap(sql.ErrNoRows, "can not get chat settings")
+	}
+
+	return settings, nil
+}
+
+func (r *ChatRepository) SaveSettings(_ context.Context, settings domain.ChatSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Settings[settings.ChatID] = settings
+
+	return nil
+}
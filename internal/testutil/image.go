@@ -0,0 +1,22 @@
+package testutil
+
+import (
+	"apubot/internal/domain"
+	"apubot/internal/service/image"
+	"context"
+	"testing"
+)
+
+// AddImage saves picture already uploaded to Telegram, its TG ID is name with tg- prefix
+func AddImage(t *testing.T, images image.ImageService, name string, tags ...string) domain.File {
+	t.Helper()
+
+	file, err := images.AddImage(
+		context.Background(), domain.File{Name: name, TgID: "tg-" + name, Type: domain.TypePhoto}, tags,
+	)
+	if err != nil {
+		t.Fatalf("can not add image: %v", err)
+	}
+
+	return file
+}
@@ -0,0 +1,162 @@
+// Package testutil holds fakes and fixtures shared by tests of handlers and servers
+package testutil
+
+import (
+	"apubot/internal/infrastructure/telegram"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Sender records sent requests instead of calling Telegram
+type Sender struct {
+	mu   sync.Mutex
+	sent []tgbotapi.Chattable
+	// Errs are returned by next Send calls in order, nil means success
+	Errs []error
+	// Err is returned by Send calls after Errs are used up
+	Err error
+	// MemberStatus is status of every chat member, member is used if it is empty
+	MemberStatus string
+	// Files maps file ID to its content served by FileServer, missing files are not found
+	Files map[string][]byte
+	// FileServer serves Files, GetFileDirectURL fails while it is not started
+	FileServer *httptest.Server
+	// OnSend is called with every request passed to Send, e.g. to cancel handler midway, it must not use Sender
+	OnSend func(c tgbotapi.Chattable)
+}
+
+var _ telegram.Sender = (*Sender)(nil)
+
+// Send records request, uploaded files get new TG IDs like in real responses
+func (s *Sender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, c)
+
+	if s.OnSend != nil {
+		s.OnSend(c)
+	}
+
+	err := s.Err
+	if len(s.Errs) > 0 {
+		err = s.Errs[0]
+		s.Errs = s.Errs[1:]
+	}
+
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	fileID := fmt.Sprintf("uploaded-%d", len(s.sent))
+
+	return tgbotapi.Message{
+		MessageID: len(s.sent),
+		Photo:     []tgbotapi.PhotoSize{{FileID: fileID}},
+		Animation: &tgbotapi.Animation{FileID: fileID},
+	}, nil
+}
+
+func (s *Sender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, c)
+
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (s *Sender) SendMediaGroup(c tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, c)
+
+	res := make([]tgbotapi.Message, len(c.Media))
+	for i := range res {
+		res[i].Photo = []tgbotapi.PhotoSize{{FileID: fmt.Sprintf("uploaded-%d-%d", len(s.sent), i)}}
+	}
+
+	return res, nil
+}
+
+func (s *Sender) GetChatMember(tgbotapi.GetChatMemberConfig) (tgbotapi.ChatMember, error) {
+	status := s.MemberStatus
+	if status == "" {
+		status = "member"
+	}
+
+	return tgbotapi.ChatMember{Status: status}, nil
+}
+
+func (s *Sender) GetFileDirectURL(fileID string) (string, error) {
+	if s.FileServer == nil {
+		return "", errors.New("Bad Request: file is too big")
+	}
+
+	return s.FileServer.URL + "/" + fileID, nil
+}
+
+// ServeFiles starts FileServer with uploaded files
+func (s *Sender) ServeFiles(t *testing.T, files map[string][]byte) {
+	t.Helper()
+
+	s.Files = files
+	s.FileServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.Files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(s.FileServer.Close)
+}
+
+// Sent returns all recorded requests, failed ones included
+func (s *Sender) Sent() []tgbotapi.Chattable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]tgbotapi.Chattable(nil), s.sent...)
+}
+
+// Texts returns texts of messages sent to chat
+func (s *Sender) Texts(chatID int64) []string {
+	var texts []string
+	for _, c := range s.Sent() {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok && msg.ChatID == chatID {
+			texts = append(texts, msg.Text)
+		}
+	}
+
+	return texts
+}
+
+// Photos returns sent photos
+func (s *Sender) Photos() []tgbotapi.PhotoConfig {
+	var photos []tgbotapi.PhotoConfig
+	for _, c := range s.Sent() {
+		if photo, ok := c.(tgbotapi.PhotoConfig); ok {
+			photos = append(photos, photo)
+		}
+	}
+
+	return photos
+}
+
+// Reset forgets recorded requests
+func (s *Sender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = nil
+}
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS image_tags
+(
+    image_name TEXT NOT NULL,
+    tag        TEXT NOT NULL,
+    PRIMARY KEY (image_name, tag)
+);
+
+CREATE INDEX IF NOT EXISTS image_tags_tag_idx ON image_tags (tag);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS subscription_old
+(
+    chat_id    INT PRIMARY KEY NOT NULL,
+    created_at BIGINT          NOT NULL,
+    period     INT             NOT NULL
+);
+
+INSERT OR REPLACE INTO subscription_old (chat_id, created_at, period)
+SELECT chat_id, created_at, period
+FROM subscription
+ORDER BY id;
+
+DROP TABLE subscription;
+
+ALTER TABLE subscription_old RENAME TO subscription;
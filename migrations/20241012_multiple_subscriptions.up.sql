@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS subscription_new
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INT    NOT NULL,
+    created_at BIGINT NOT NULL,
+    period     INT    NOT NULL,
+    UNIQUE (chat_id, period)
+);
+
+INSERT INTO subscription_new (chat_id, created_at, period)
+SELECT chat_id, created_at, period
+FROM subscription;
+
+DROP TABLE subscription;
+
+ALTER TABLE subscription_new RENAME TO subscription;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS cooldowns
+(
+    key        TEXT PRIMARY KEY NOT NULL,
+    used_at    BIGINT           NOT NULL,
+    expires_at BIGINT           NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS chats
+(
+    chat_id       INT PRIMARY KEY NOT NULL,
+    first_seen_at BIGINT          NOT NULL
+);
+
+INSERT OR IGNORE INTO chats (chat_id, first_seen_at)
+SELECT chat_id, MIN(created_at)
+FROM subscription
+GROUP BY chat_id;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS usage_stats
+(
+    user_id          INT PRIMARY KEY NOT NULL,
+    images_requested INT             NOT NULL DEFAULT 0,
+    first_used_at    BIGINT          NOT NULL
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS images_old
+(
+    name  TEXT PRIMARY KEY NOT NULL,
+    tg_id TEXT             NOT NULL DEFAULT ''
+);
+
+INSERT INTO images_old (name, tg_id)
+SELECT name, tg_id
+FROM images;
+
+DROP TABLE images;
+
+ALTER TABLE images_old RENAME TO images;
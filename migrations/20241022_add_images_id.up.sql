@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS images_new
+(
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name  TEXT UNIQUE NOT NULL,
+    tg_id TEXT        NOT NULL DEFAULT ''
+);
+
+INSERT INTO images_new (name, tg_id)
+SELECT name, tg_id
+FROM images;
+
+DROP TABLE images;
+
+ALTER TABLE images_new RENAME TO images;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS favorites
+(
+    user_id    INT    NOT NULL,
+    image_id   INT    NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, image_id)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS file_id_cache;
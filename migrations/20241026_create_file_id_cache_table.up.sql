@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS file_id_cache
+(
+    hash  TEXT PRIMARY KEY NOT NULL,
+    tg_id TEXT             NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS chat_settings;
+
+ALTER TABLE images DROP COLUMN rating;
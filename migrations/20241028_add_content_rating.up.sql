@@ -0,0 +1,7 @@
+ALTER TABLE images ADD COLUMN rating TEXT NOT NULL DEFAULT 'sfw';
+
+CREATE TABLE IF NOT EXISTS chat_settings
+(
+    chat_id INT PRIMARY KEY NOT NULL,
+    rating  TEXT            NOT NULL DEFAULT 'sfw'
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS feedback
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id    INT    NOT NULL,
+    user_id    INT    NOT NULL,
+    username   TEXT   NOT NULL DEFAULT '',
+    text       TEXT   NOT NULL,
+    created_at BIGINT NOT NULL
+);
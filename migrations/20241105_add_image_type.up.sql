@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN type TEXT NOT NULL DEFAULT 'photo';
+
+UPDATE images SET type = 'animation' WHERE name LIKE '%.gif' OR name LIKE '%.mp4';
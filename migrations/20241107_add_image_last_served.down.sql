@@ -0,0 +1 @@
+ALTER TABLE images DROP COLUMN last_served_at;
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN last_served_at INT NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS bot_state
+(
+    key        TEXT PRIMARY KEY NOT NULL,
+    value      TEXT             NOT NULL,
+    updated_at BIGINT           NOT NULL
+);
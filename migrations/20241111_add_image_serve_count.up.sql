@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN serve_count INT NOT NULL DEFAULT 0;
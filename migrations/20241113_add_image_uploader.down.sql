@@ -0,0 +1,3 @@
+DROP INDEX images_uploader_id_idx;
+ALTER TABLE images DROP COLUMN uploaded_at;
+ALTER TABLE images DROP COLUMN uploader_id;
@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN uploader_id INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN uploaded_at INT NOT NULL DEFAULT 0;
+CREATE INDEX images_uploader_id_idx ON images (uploader_id);
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN deleted_at INT NOT NULL DEFAULT 0;
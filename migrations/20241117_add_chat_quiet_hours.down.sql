@@ -0,0 +1,3 @@
+ALTER TABLE chat_settings DROP COLUMN timezone;
+ALTER TABLE chat_settings DROP COLUMN quiet_end;
+ALTER TABLE chat_settings DROP COLUMN quiet_start;
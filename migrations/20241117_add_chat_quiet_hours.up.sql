@@ -0,0 +1,3 @@
+ALTER TABLE chat_settings ADD COLUMN quiet_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_settings ADD COLUMN quiet_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_settings ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS pending_images
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT   NOT NULL UNIQUE,
+    tg_id      TEXT   NOT NULL,
+    type       TEXT   NOT NULL,
+    tags       TEXT   NOT NULL,
+    user_id    INT    NOT NULL,
+    chat_id    INT    NOT NULL,
+    created_at BIGINT NOT NULL
+);
+CREATE INDEX pending_images_user_id_idx ON pending_images (user_id);
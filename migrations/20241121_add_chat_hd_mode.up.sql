@@ -0,0 +1 @@
+ALTER TABLE chat_settings ADD COLUMN hd_mode INTEGER NOT NULL DEFAULT 0;
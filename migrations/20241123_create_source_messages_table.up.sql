@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS source_messages
+(
+    image_id   INTEGER PRIMARY KEY,
+    channel_id INT NOT NULL,
+    message_id INT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS tags
+(
+    name   TEXT PRIMARY KEY,
+    weight INT NOT NULL DEFAULT 1
+);
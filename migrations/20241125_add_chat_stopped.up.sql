@@ -0,0 +1 @@
+ALTER TABLE chat_settings ADD COLUMN stopped INTEGER NOT NULL DEFAULT 0;
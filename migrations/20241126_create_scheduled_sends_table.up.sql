@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS scheduled_sends
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INT    NOT NULL,
+    send_at BIGINT NOT NULL
+);
+CREATE INDEX scheduled_sends_chat_id_idx ON scheduled_sends (chat_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS images_hash_idx;
+ALTER TABLE images DROP COLUMN hash;
@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+CREATE INDEX images_hash_idx ON images (hash);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS served_images
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id   INT    NOT NULL,
+    image_id  INT    NOT NULL,
+    served_at BIGINT NOT NULL
+);
+CREATE INDEX served_images_chat_id_idx ON served_images (chat_id, served_at);
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN purged INT NOT NULL DEFAULT 0;
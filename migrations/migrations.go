@@ -0,0 +1,7 @@
+// Package migrations embeds SQL migrations so the binary does not depend on working directory
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -11,3 +11,42 @@ func (e *NotFoundError) Error() string {
 func NewNotFound(message string) *NotFoundError {
 	return &NotFoundError{Message: message}
 }
+
+type AlreadyExistsError struct {
+	Message string
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return e.Message
+}
+
+func NewAlreadyExists(message string) *AlreadyExistsError {
+	return &AlreadyExistsError{Message: message}
+}
+
+// ChatUnavailableError means messages can not be delivered to chat anymore,
+// e.g. bot was blocked by user or removed from group
+type ChatUnavailableError struct {
+	Message string
+}
+
+func (e *ChatUnavailableError) Error() string {
+	return e.Message
+}
+
+func NewChatUnavailable(message string) *ChatUnavailableError {
+	return &ChatUnavailableError{Message: message}
+}
+
+// UnavailableError means dependency is temporarily not available and request should be retried later
+type UnavailableError struct {
+	Message string
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Message
+}
+
+func NewUnavailable(message string) *UnavailableError {
+	return &UnavailableError{Message: message}
+}
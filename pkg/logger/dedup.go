@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// occurrence is message seen during current window
+type occurrence struct {
+	level slog.Level
+	msg   string
+	// args are ones of the latest suppressed call
+	args       []any
+	suppressed int
+}
+
+// deduplicated logs first warning or error with given message at once and collapses identical ones
+// logged after it into summary written once per window, debug and info messages are passed as they are
+type deduplicated struct {
+	Logger
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]*occurrence
+}
+
+// Deduplicate wraps log for hot paths which may log the same error thousands of times during incident,
+// log is returned as it is if window is not positive
+func Deduplicate(log Logger, window time.Duration) Logger {
+	if window <= 0 {
+		return log
+	}
+
+	d := &deduplicated{
+		Logger: log,
+		window: window,
+		seen:   make(map[string]*occurrence),
+	}
+
+	go d.flushEvery(window)
+
+	return d
+}
+
+func (d *deduplicated) Warn(msg string, args ...any) {
+	d.log(slog.LevelWarn, msg, args)
+}
+
+func (d *deduplicated) Error(msg string, args ...any) {
+	d.log(slog.LevelError, msg, args)
+}
+
+func (d *deduplicated) log(lvl slog.Level, msg string, args []any) {
+	key := fmt.Sprint(lvl, msg)
+
+	d.mu.Lock()
+	o, ok := d.seen[key]
+	if ok {
+		o.suppressed++
+		o.args = args
+		d.mu.Unlock()
+
+		return
+	}
+
+	d.seen[key] = &occurrence{level: lvl, msg: msg}
+	d.mu.Unlock()
+
+	d.write(lvl, msg, args)
+}
+
+func (d *deduplicated) write(lvl slog.Level, msg string, args []any) {
+	if lvl == slog.LevelError {
+		d.Logger.Error(msg, args...)
+	} else {
+		d.Logger.Warn(msg, args...)
+	}
+}
+
+func (d *deduplicated) flushEvery(window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.flush()
+	}
+}
+
+// flush writes summaries of suppressed messages, ones not repeated during window are forgotten
+// so they are written at once next time
+func (d *deduplicated) flush() {
+	d.mu.Lock()
+	var summaries []occurrence
+	for key, o := range d.seen {
+		if o.suppressed == 0 {
+			delete(d.seen, key)
+
+			continue
+		}
+
+		summaries = append(summaries, *o)
+		o.suppressed = 0
+		o.args = nil
+	}
+	d.mu.Unlock()
+
+	for _, o := range summaries {
+		msg := fmt.Sprintf("%s (occurred %d more times in %s)", o.msg, o.suppressed, d.window)
+		d.write(o.level, msg, o.args)
+	}
+}
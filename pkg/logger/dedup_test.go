@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingLogger remembers written messages with their level
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (r *recordingLogger) record(lvl string, msg string, args []any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, fmt.Sprint(lvl, " ", msg, " ", args))
+}
+
+func (r *recordingLogger) Debug(msg string, args ...any) { r.record("DEBUG", msg, args) }
+func (r *recordingLogger) Info(msg string, args ...any)  { r.record("INFO", msg, args) }
+func (r *recordingLogger) Warn(msg string, args ...any)  { r.record("WARN", msg, args) }
+func (r *recordingLogger) Error(msg string, args ...any) { r.record("ERROR", msg, args) }
+
+func (r *recordingLogger) written() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.entries)
+}
+
+func TestDeduplicateCollapsesRepeatedErrors(t *testing.T) {
+	rec := &recordingLogger{}
+	// window is long so only explicit flushes write summaries
+	d := Deduplicate(rec, time.Hour).(*deduplicated)
+
+	for i := 1; i <= 3; i++ {
+		d.Error("Can not send picture", "chat_id", i)
+	}
+	d.Warn("Can not send picture", "chat_id", 4)
+	d.Info("Started", "n", 1)
+	d.Info("Started", "n", 2)
+
+	want := []string{
+		"ERROR Can not send picture [chat_id 1]",
+		"WARN Can not send picture [chat_id 4]",
+		"INFO Started [n 1]",
+		"INFO Started [n 2]",
+	}
+	if got := rec.written(); !slices.Equal(got, want) {
+		t.Fatalf("written before flush:\n%q\nwant:\n%q", got, want)
+	}
+
+	d.flush()
+
+	want = append(want, "ERROR Can not send picture (occurred 2 more times in 1h0m0s) [chat_id 3]")
+	if got := rec.written(); !slices.Equal(got, want) {
+		t.Fatalf("written after flush:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestDeduplicateForgetsQuietMessages(t *testing.T) {
+	rec := &recordingLogger{}
+	d := Deduplicate(rec, time.Hour).(*deduplicated)
+
+	d.Error("Db is down")
+	d.Error("Db is down")
+
+	// first flush summarizes repeats, second one forgets message not repeated since
+	d.flush()
+	d.flush()
+
+	d.Error("Db is down")
+
+	want := []string{
+		"ERROR Db is down []",
+		"ERROR Db is down (occurred 1 more times in 1h0m0s) []",
+		"ERROR Db is down []",
+	}
+	if got := rec.written(); !slices.Equal(got, want) {
+		t.Fatalf("written:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestDeduplicateDisabled(t *testing.T) {
+	rec := &recordingLogger{}
+
+	if log := Deduplicate(rec, 0); log != Logger(rec) {
+		t.Error("zero window must return log as it is")
+	}
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+)
+
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// level is shared by created loggers so it can be changed at runtime
+var level slog.LevelVar
+
+// New creates text logger writing to stdout, level is one of debug, info, warn, error
+func New(lvl string) (*slog.Logger, error) {
+	err := SetLevel(lvl)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &level})
+
+	return slog.New(handler), nil
+}
+
+// SetLevel changes level of created loggers
+func SetLevel(lvl string) error {
+	var l slog.Level
+
+	err := l.UnmarshalText([]byte(lvl))
+	if err != nil {
+		return err
+	}
+
+	level.Set(l)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	// Closed lets all calls through
+	Closed State = iota
+	// Open rejects calls until cooldown passes
+	Open
+	// HalfOpen lets a single trial call through, its result closes or reopens breaker
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker opens after threshold consecutive failures and rejects calls for cooldown,
+// zero threshold disables it
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	// trial is set while half-open breaker waits for result of trial call
+	trial bool
+	mu    sync.Mutex
+}
+
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether call may be made, every allowed call must be followed by Done
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case Open:
+		return false
+	case HalfOpen:
+		if b.trial {
+			return false
+		}
+
+		b.trial = true
+	}
+
+	return true
+}
+
+// Done records result of call allowed by Allow, returns states before and after it
+func (b *Breaker) Done(failed bool) (from State, to State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.currentState()
+	if from == HalfOpen {
+		b.trial = false
+	}
+
+	if !failed {
+		b.state = Closed
+		b.failures = 0
+
+		return from, b.state
+	}
+
+	b.failures++
+	if from == HalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+
+	return from, b.state
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState()
+}
+
+// currentState moves open breaker to half-open once cooldown passed, must be called under lock
+func (b *Breaker) currentState() State {
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		b.state = HalfOpen
+	}
+
+	return b.state
+}
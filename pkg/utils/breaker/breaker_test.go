@@ -0,0 +1,100 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	b := New(2, 20*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("call %d rejected by closed breaker", i)
+		}
+
+		b.Done(true)
+	}
+
+	if got := b.State(); got != Open {
+		t.Fatalf("state after failures = %s, want open", got)
+	}
+
+	if b.Allow() {
+		t.Fatal("open breaker allowed call")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("state after cooldown = %s, want half-open", got)
+	}
+
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected trial call")
+	}
+
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed second call during trial")
+	}
+
+	from, to := b.Done(false)
+	if from != HalfOpen || to != Closed {
+		t.Fatalf("trial success moved breaker %s -> %s, want half-open -> closed", from, to)
+	}
+
+	if !b.Allow() {
+		t.Fatal("closed breaker rejected call")
+	}
+
+	b.Done(false)
+}
+
+func TestBreakerFailedTrialReopens(t *testing.T) {
+	b := New(1, 10*time.Millisecond)
+
+	b.Allow()
+	b.Done(true)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected trial call")
+	}
+
+	from, to := b.Done(true)
+	if from != HalfOpen || to != Open {
+		t.Fatalf("trial failure moved breaker %s -> %s, want half-open -> open", from, to)
+	}
+
+	if b.Allow() {
+		t.Fatal("reopened breaker allowed call")
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b := New(2, time.Minute)
+
+	b.Allow()
+	b.Done(true)
+	b.Allow()
+	b.Done(false)
+	b.Allow()
+	b.Done(true)
+
+	if got := b.State(); got != Closed {
+		t.Errorf("state = %s, want closed as failures were not consecutive", got)
+	}
+}
+
+func TestBreakerZeroThresholdNeverOpens(t *testing.T) {
+	b := New(0, time.Minute)
+
+	for i := 0; i < 100; i++ {
+		if !b.Allow() {
+			t.Fatalf("call %d rejected by disabled breaker", i)
+		}
+
+		b.Done(true)
+	}
+}
@@ -0,0 +1,60 @@
+package lru
+
+import "testing"
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// reading a makes b the least recently used one
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %t, want 1", v, ok)
+	}
+
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is kept, want it evicted as least recently used")
+	}
+
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %t, want %d", key, v, ok, want)
+		}
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestCacheAddUpdatesExistingKey(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("a", 10)
+	c.Add("c", 3)
+
+	if v, ok := c.Get("a"); !ok || v != 10 {
+		t.Errorf("Get(a) = %d, %t, want updated value kept as recently used", v, ok)
+	}
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is kept, want it evicted")
+	}
+}
+
+func TestCacheRemove(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Add("a", 1)
+	c.Remove("a")
+	c.Remove("missing")
+
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Errorf("removed value is kept, Len() = %d", c.Len())
+	}
+}
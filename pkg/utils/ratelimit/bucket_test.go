@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketAllowsBurstThenSpreadsCalls(t *testing.T) {
+	b := NewBucket(10, 3)
+
+	for i := 0; i < 3; i++ {
+		if wait := b.Reserve(); wait != 0 {
+			t.Fatalf("call %d of burst waits %s", i, wait)
+		}
+	}
+
+	// tokens are taken in advance, so each next caller waits one more refill period
+	first, second := b.Reserve(), b.Reserve()
+
+	if first <= 50*time.Millisecond || first > 100*time.Millisecond {
+		t.Errorf("first call over burst waits %s, want about 100ms", first)
+	}
+
+	if second <= first || second > 200*time.Millisecond {
+		t.Errorf("second call over burst waits %s, want about 200ms", second)
+	}
+}
+
+func TestBucketRefills(t *testing.T) {
+	b := NewBucket(100, 1)
+
+	b.Reserve()
+	time.Sleep(20 * time.Millisecond)
+
+	if wait := b.Reserve(); wait != 0 {
+		t.Errorf("call after refill waits %s", wait)
+	}
+}
+
+func TestBucketPause(t *testing.T) {
+	b := NewBucket(100, 10)
+
+	b.Pause(time.Second)
+	// shorter pause does not cut the longer one
+	b.Pause(time.Millisecond)
+
+	if wait := b.Reserve(); wait < 900*time.Millisecond {
+		t.Errorf("call during pause waits %s, want about 1s", wait)
+	}
+}
@@ -0,0 +1,48 @@
+package text_split
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Split breaks text into chunks of at most limit runes, on line boundaries where possible
+func Split(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	var chunk strings.Builder
+	chunkLen := 0
+
+	flush := func() {
+		if chunkLen > 0 {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			chunkLen = 0
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		lineLen := utf8.RuneCountInString(line)
+
+		if chunkLen+lineLen > limit {
+			flush()
+		}
+
+		// line itself is too long, cut it by runes
+		for lineLen > limit {
+			runes := []rune(line)
+			chunks = append(chunks, string(runes[:limit]))
+			line = string(runes[limit:])
+			lineLen -= limit
+		}
+
+		chunk.WriteString(line)
+		chunkLen += lineLen
+	}
+
+	flush()
+
+	return chunks
+}
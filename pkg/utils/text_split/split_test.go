@@ -0,0 +1,50 @@
+package text_split
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short text", "hello", 10, []string{"hello"}},
+		{"exactly limit", "hello", 5, []string{"hello"}},
+		{"on line boundaries", "aaa\nbbb\nccc", 8, []string{"aaa\nbbb\n", "ccc"}},
+		{"long line is cut", "aaaaaaa\nbb", 3, []string{"aaa", "aaa", "a\n", "bb"}},
+		{"runes are not broken", "привет мир", 4, []string{"прив", "ет м", "ир"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.text, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitKeepsWholeText(t *testing.T) {
+	text := strings.Repeat("line of help text\n", 300) + strings.Repeat("x", 5000)
+
+	chunks := Split(text, 4096)
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want at least 3", len(chunks))
+	}
+
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 4096 {
+			t.Errorf("chunk %d has %d runes, want at most 4096", i, n)
+		}
+	}
+
+	if joined := strings.Join(chunks, ""); joined != text {
+		t.Error("joined chunks differ from text")
+	}
+}
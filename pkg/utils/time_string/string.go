@@ -1,8 +1,11 @@
 package time_string
 
 import (
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const DefaultEmptyDurationString = "0s"
@@ -27,3 +30,39 @@ func ShortDur(d time.Duration) string {
 
 	return s
 }
+
+// ParseDur parses user entered duration like 90s, 30m, 1h 30m or 1d, case and spaces are ignored.
+// Days are accepted only before other units.
+func ParseDur(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	var days time.Duration
+
+	if rawDays, rest, ok := strings.Cut(s, "d"); ok {
+		n, err := strconv.Atoi(rawDays)
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid number of days %q", rawDays)
+		}
+
+		days = time.Duration(n) * 24 * time.Hour
+		if rest == "" {
+			return days, nil
+		}
+
+		s = rest
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid duration")
+	}
+
+	if d < 0 {
+		return 0, errors.New("duration must not be negative")
+	}
+
+	return days + d, nil
+}
@@ -0,0 +1,56 @@
+package time_string
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDur(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "90s", want: 90 * time.Second},
+		{in: "30m", want: 30 * time.Minute},
+		{in: "1h", want: time.Hour},
+		{in: "1h 30m", want: 90 * time.Minute},
+		{in: "1H30M", want: 90 * time.Minute},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "1d12h", want: 36 * time.Hour},
+		{in: "", wantErr: true},
+		{in: "soon", wantErr: true},
+		{in: "30", wantErr: true},
+		{in: "-5m", wantErr: true},
+		{in: "xd", wantErr: true},
+		{in: "1h1d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDur(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseDur(%q) = %s, %v, want %s, error %t", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShortDur(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, DefaultEmptyDurationString},
+		{90 * time.Second, "1m30s"},
+		{10 * time.Minute, "10m"},
+		{2 * time.Hour, "2h"},
+		{24 * time.Hour, "24h"},
+	}
+
+	for _, tt := range tests {
+		if got := ShortDur(tt.in); got != tt.want {
+			t.Errorf("ShortDur(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package workerpool
+
+import "sync"
+
+// Pool runs submitted tasks on fixed number of goroutines
+type Pool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// New starts size workers, up to queueSize tasks wait for a free worker
+func New(size int, queueSize int) *Pool {
+	p := &Pool{
+		tasks: make(chan func(), queueSize),
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// Submit queues task without blocking, returns false if pool is saturated
+func (p *Pool) Submit(task func()) bool {
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop lets workers finish queued tasks and exit, Submit must not be called after Stop
+func (p *Pool) Stop() {
+	p.once.Do(func() {
+		close(p.tasks)
+	})
+}
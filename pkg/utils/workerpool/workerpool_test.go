@@ -0,0 +1,89 @@
+package workerpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	p := New(2, 10)
+
+	var running, peak atomic.Int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		ok := p.Submit(func() {
+			defer wg.Done()
+
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		})
+		if !ok {
+			t.Fatalf("task %d rejected while queue has room", i)
+		}
+	}
+
+	wg.Wait()
+	p.Stop()
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("%d tasks ran at once, want 2", got)
+	}
+}
+
+func TestPoolRejectsTasksWhenSaturated(t *testing.T) {
+	p := New(1, 1)
+	defer p.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	p.Submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	if !p.Submit(func() {}) {
+		t.Fatal("task rejected while queue has room")
+	}
+
+	if p.Submit(func() {}) {
+		t.Error("task accepted while worker is busy and queue is full")
+	}
+
+	close(release)
+}
+
+func TestStopRunsQueuedTasks(t *testing.T) {
+	p := New(1, 5)
+
+	var done atomic.Int64
+	for i := 0; i < 5; i++ {
+		p.Submit(func() {
+			time.Sleep(time.Millisecond)
+			done.Add(1)
+		})
+	}
+
+	p.Stop()
+	// stopping twice must not panic
+	p.Stop()
+	p.wg.Wait()
+
+	if got := done.Load(); got != 5 {
+		t.Errorf("%d of 5 queued tasks ran after stop", got)
+	}
+}